@@ -1,66 +1,129 @@
 package main
 
 import (
-	"compress/zlib"
+	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
 	"os"
 	"path"
 	"path/filepath"
-	"sort"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/git"
 )
 
-// ./your_git.sh init
-func initCmd(repoPath string) *Status {
-	for _, dir := range []string{".git", ".git/objects", ".git/refs"} {
-		dirPath := path.Join(repoPath, dir)
-		if err := os.Mkdir(dirPath, 0755); err != nil {
+// ./your_git.sh init [-q] [--bare] [--template=<dir>] [--object-format=<format>] [-b <branch>] [<directory>]
+func initCmd(args []string) *Status {
+	usage := "usage: init [-q | --quiet] [--bare] [--template=<template-directory>] [--object-format=<format>] [-b <branch-name> | --initial-branch=<branch-name>] [<directory>]"
+	quiet := false
+	opts := git.InitOptions{}
+	template, hasTemplate := "", false
+	directory := ""
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "-q" || arg == "--quiet":
+			quiet = true
+		case arg == "--bare":
+			opts.Bare = true
+		case (arg == "-b" || arg == "--initial-branch") && i+1 < len(args):
+			i++
+			opts.InitialBranch = args[i]
+		case strings.HasPrefix(arg, "--initial-branch="):
+			opts.InitialBranch = strings.TrimPrefix(arg, "--initial-branch=")
+		case arg == "--template" && i+1 < len(args):
+			i++
+			template, hasTemplate = args[i], true
+		case strings.HasPrefix(arg, "--template="):
+			template, hasTemplate = strings.TrimPrefix(arg, "--template="), true
+		case arg == "--object-format" && i+1 < len(args):
+			i++
+			opts.ObjectFormat = args[i]
+		case strings.HasPrefix(arg, "--object-format="):
+			opts.ObjectFormat = strings.TrimPrefix(arg, "--object-format=")
+		case strings.HasPrefix(arg, "-"):
 			return &Status{
-				exitCode: ExitCodeError,
-				err:      fmt.Errorf("Error creating directory: %s\n", err.Error()),
+				exitCode: 129,
+				err:      fmt.Errorf("error: unknown option `%s'\n%s", arg, usage),
+			}
+		case directory == "":
+			directory = arg
+		default:
+			return &Status{
+				exitCode: 129,
+				err:      fmt.Errorf("%s", usage),
 			}
 		}
 	}
 
-	headFileContents := []byte("ref: refs/heads/master\n")
-	headPath := path.Join(repoPath, ".git/HEAD")
-	if err := ioutil.WriteFile(headPath, headFileContents, 0644); err != nil {
+	// Outside a repository, only the system and global config apply.
+	config, err := git.ReadConfigFiles(nil, true)
+	if err != nil {
 		return &Status{
-			exitCode: ExitCodeError,
-			err:      fmt.Errorf("Error writing file: %s\n", err.Error()),
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
 		}
 	}
-
-	fmt.Println("Initialized git directory")
-	return &Status{
-		exitCode: ExitCodeOK,
-		err:      nil,
+	if !hasTemplate {
+		template = defaultTemplateDir(config)
+	}
+	opts.TemplateDir = template
+	branchGiven := opts.InitialBranch != ""
+	if !branchGiven {
+		opts.InitialBranch, _ = config.Get("init.defaultbranch")
 	}
-}
 
-// ./your_git.sh cat-file -p <blob_sha>
-func catFileCmd() *Status {
-	if len(os.Args) < 3 {
+	if directory == "" {
+		directory = "."
+	}
+	if err := os.MkdirAll(directory, 0755); err != nil {
 		return &Status{
-			exitCode: ExitCodeError,
-			err:      fmt.Errorf("specify the sha of blob object: cat-file -p <blob_sha>\n"),
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: cannot mkdir %s: %s", directory, err),
 		}
 	}
-
-	fullSha := os.Args[3]
-	objectContent, err := catObject(fullSha)
+	workTree, err := filepath.Abs(directory)
 	if err != nil {
 		return &Status{
-			exitCode: ExitCodeError,
-			err:      fmt.Errorf("Error reading blob object (binary data): %s\n", err),
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
 		}
 	}
+	gitDir := filepath.Join(workTree, ".git")
+	if env := os.Getenv("GIT_DIR"); env != "" {
+		if gitDir, err = filepath.Abs(env); err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", err),
+			}
+		}
+	} else if opts.Bare {
+		gitDir = workTree
+	}
+	if opts.Bare {
+		workTree = ""
+	}
 
-	// blob(object type) 4(size)\000test(content)
-	fmt.Print(strings.Split(objectContent.String(), "\x00")[1])
+	repo, reinit, err := git.InitRepository(gitDir, workTree, opts)
+	if err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
+		}
+	}
+	if reinit && branchGiven {
+		fmt.Fprintf(os.Stderr, "warning: re-init: ignored --initial-branch=%s\n", opts.InitialBranch)
+	}
+	if !quiet {
+		if reinit {
+			fmt.Printf("Reinitialized existing Git repository in %s/\n", repo.GitDir)
+		} else {
+			fmt.Printf("Initialized empty Git repository in %s/\n", repo.GitDir)
+		}
+	}
 
 	return &Status{
 		exitCode: ExitCodeOK,
@@ -68,72 +131,321 @@ func catFileCmd() *Status {
 	}
 }
 
-// ./your_git.sh hash-object -w <file>
-func hashObjectCmd() *Status {
-	if len(os.Args) < 3 {
+// Return the template directory from GIT_TEMPLATE_DIR, init.templateDir or
+// the default location of git's templates.
+func defaultTemplateDir(config *git.Config) string {
+	if env := os.Getenv("GIT_TEMPLATE_DIR"); env != "" {
+		return env
+	}
+	if dir, ok := config.Get("init.templatedir"); ok {
+		if strings.HasPrefix(dir, "~/") {
+			if home, err := os.UserHomeDir(); err == nil {
+				dir = filepath.Join(home, dir[2:])
+			}
+		}
+		return dir
+	}
+	return "/usr/share/git-core/templates"
+}
+
+// ./your_git.sh cat-file (-t | -s | -e | -p | <type>) <object>
+// ./your_git.sh cat-file (--batch | --batch-check)[=<format>]
+func catFileCmd(repo *git.Repository, args []string) *Status {
+	usage := "usage: cat-file (-t | -s | -e | -p | <type>) <object>\n   or: cat-file (--batch | --batch-check)[=<format>]\n"
+	if len(args) == 1 && (strings.HasPrefix(args[0], "--batch")) {
+		return catFileBatch(repo, args[0])
+	}
+	if len(args) != 2 {
 		return &Status{
 			exitCode: ExitCodeError,
-			err:      fmt.Errorf("pass the content of file: hash-object -w <file>\n"),
+			err:      fmt.Errorf("%s", usage),
 		}
 	}
 
-	// read data from file
-	filePath := os.Args[3]
-	content, err := ioutil.ReadFile(filePath)
+	option, name := args[0], args[1]
+	sha, err := git.ResolveRevision(repo, name)
 	if err != nil {
+		if option == "-e" {
+			return &Status{exitCode: ExitCodeError, err: nil}
+		}
 		return &Status{
 			exitCode: ExitCodeError,
-			err:      fmt.Errorf("error reading file content"),
+			err:      fmt.Errorf("fatal: Not a valid object name %s\n", name),
+		}
+	}
+	if !strings.HasPrefix(option, "-") {
+		// cat-file <type> <object> prints the raw content, peeling tags and commits.
+		if sha, err = git.PeelObject(repo, sha, option); err != nil {
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      fmt.Errorf("fatal: git cat-file %s: bad file\n", name),
+			}
 		}
 	}
 
-	// create hash from tempBuffer
-	hash, err := createHash(content)
+	objReader, err := repo.Objects.Get(sha)
 	if err != nil {
+		if option == "-e" {
+			return &Status{exitCode: ExitCodeError, err: nil}
+		}
 		return &Status{
 			exitCode: ExitCodeError,
-			err:      fmt.Errorf("error creating hash"),
+			err:      fmt.Errorf("fatal: Not a valid object name %s\n", name),
 		}
 	}
-	fmt.Println(hash)
+	defer objReader.Close()
 
-	// create dir if dir doesn't exist
-	objectDir := fmt.Sprintf(".git/objects/%s", hash[:2])
-	if _, err := os.Stat(objectDir); errors.Is(err, os.ErrNotExist) {
-		err := os.MkdirAll(objectDir, 0755)
+	switch option {
+	case "-e":
+		// exit with zero status if the object exists
+	case "-t":
+		fmt.Println(objReader.Type)
+	case "-s":
+		fmt.Println(objReader.ContentSize)
+	case "-p":
+		content, err := objReader.ReadContents()
 		if err != nil {
 			return &Status{
 				exitCode: ExitCodeError,
-				err:      fmt.Errorf("Error creating directory: %s\n", err),
+				err:      fmt.Errorf("Error reading object: %s\n", err),
+			}
+		}
+		if objReader.Type == "tree" {
+			tree, err := git.ParseTree(content)
+			if err != nil {
+				return &Status{
+					exitCode: ExitCodeError,
+					err:      fmt.Errorf("Error reading tree object: %s\n", err),
+				}
+			}
+			for _, child := range tree.Children {
+				fmt.Printf("%s %s %s\t%s\n", child.PaddedMode(), child.ObjectType(), child.Sha, child.Name)
+			}
+			break
+		}
+		// blobs may contain NUL bytes, so write them as they are.
+		os.Stdout.Write(content)
+	default:
+		if strings.HasPrefix(option, "-") {
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      fmt.Errorf("error: unknown switch `%s'\n%s", option, usage),
+			}
+		}
+		if _, err := io.Copy(os.Stdout, objReader); err != nil {
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      fmt.Errorf("Error reading object: %s\n", err),
 			}
 		}
 	}
 
-	// write data to file under .git/objects
-	object, err := os.OpenFile(objectPath(hash), os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// Read object names from stdin and print "<sha> <type> <size>" (and the
+// content for --batch) for each of them.
+func catFileBatch(repo *git.Repository, option string) *Status {
+	withContent := strings.HasPrefix(option, "--batch=") || option == "--batch"
+	format := "%(objectname) %(objecttype) %(objectsize)"
+	if eq := strings.Index(option, "="); eq >= 0 {
+		format = option[eq+1:]
+	} else if option != "--batch" && option != "--batch-check" {
 		return &Status{
 			exitCode: ExitCodeError,
-			err:      fmt.Errorf("error opening file"),
+			err:      fmt.Errorf("error: unknown option `%s'\n", strings.TrimPrefix(option, "--")),
 		}
 	}
 
-	writer := zlib.NewWriter(object)
-	header := []byte(fmt.Sprintf("blob %d\x00", len(content)))
-	if _, err := writer.Write(header); err != nil {
+	writer := bufio.NewWriter(os.Stdout)
+	defer writer.Flush()
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// The text after the first whitespace is %(rest).
+		name, rest := line, ""
+		if i := strings.IndexAny(line, " \t"); i >= 0 && strings.Contains(format, "%(rest)") {
+			name, rest = line[:i], line[i+1:]
+		}
+
+		sha, err := git.ResolveRevision(repo, name)
+		var objReader *git.GitObjectReader
+		if err == nil {
+			objReader, err = repo.Objects.Get(sha)
+		}
+		if err != nil {
+			fmt.Fprintf(writer, "%s missing\n", name)
+			writer.Flush()
+			continue
+		}
+
+		header := strings.NewReplacer(
+			"%(objectname)", sha,
+			"%(objecttype)", objReader.Type,
+			"%(objectsize)", strconv.FormatInt(objReader.ContentSize, 10),
+			"%(rest)", rest,
+		).Replace(format)
+		fmt.Fprintln(writer, header)
+		if withContent {
+			content, err := objReader.ReadContents()
+			if err != nil {
+				return &Status{
+					exitCode: ExitCodeError,
+					err:      fmt.Errorf("Error reading object %s: %s\n", sha, err),
+				}
+			}
+			writer.Write(content)
+			writer.WriteString("\n")
+		}
+		objReader.Close()
+		// Flush per object so that the output can be read interactively.
+		if err := writer.Flush(); err != nil {
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      fmt.Errorf("error writing output: %s\n", err),
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
 		return &Status{
 			exitCode: ExitCodeError,
-			err:      fmt.Errorf("error writing header to create compressed data"),
+			err:      fmt.Errorf("error reading stdin: %s\n", err),
+		}
+	}
+
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// ./your_git.sh hash-object [-w] [-t <type>] [--stdin] [--stdin-paths] [--literally] <file>...
+func hashObjectCmd(repo *git.Repository, args []string) *Status {
+	usage := "usage: hash-object [-w] [-t <type>] [--stdin] [--stdin-paths] [--literally] <file>..."
+	objType := "blob"
+	write, fromStdin, stdinPaths, literally := false, false, false, false
+	files := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-w":
+			write = true
+		case arg == "-t" && i+1 < len(args):
+			i++
+			objType = args[i]
+		case strings.HasPrefix(arg, "-t") && len(arg) > 2:
+			objType = arg[2:]
+		case arg == "--stdin":
+			fromStdin = true
+		case arg == "--stdin-paths":
+			stdinPaths = true
+		case arg == "--literally":
+			literally = true
+		case arg == "--":
+			files = append(files, args[i+1:]...)
+			i = len(args)
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			return &Status{
+				exitCode: 129,
+				err:      fmt.Errorf("error: unknown option `%s'\n%s", arg, usage),
+			}
+		default:
+			files = append(files, arg)
 		}
 	}
-	if _, err := writer.Write(content); err != nil {
+	if stdinPaths && fromStdin {
 		return &Status{
-			exitCode: ExitCodeError,
-			err:      fmt.Errorf("error writing content to create compressed data"),
+			exitCode: 129,
+			err:      fmt.Errorf("error: Can't use --stdin-paths with --stdin\n%s", usage),
+		}
+	}
+	if stdinPaths && len(files) > 0 {
+		return &Status{
+			exitCode: 129,
+			err:      fmt.Errorf("error: Can't specify files with --stdin-paths\n%s", usage),
+		}
+	}
+	if !fromStdin && !stdinPaths && len(files) == 0 {
+		return &Status{
+			exitCode: 129,
+			err:      fmt.Errorf("%s", usage),
+		}
+	}
+	switch objType {
+	case "blob", "tree", "commit", "tag":
+	default:
+		if !literally {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: invalid object type \"%s\"", objType),
+			}
+		}
+	}
+
+	writer := bufio.NewWriter(os.Stdout)
+	defer writer.Flush()
+	hashContent := func(content []byte) *Status {
+		if !literally {
+			if err := git.ValidateObject(objType, content); err != nil {
+				return &Status{
+					exitCode: 128,
+					err:      fmt.Errorf("fatal: %s", err),
+				}
+			}
+		}
+		var sha string
+		var err error
+		if write {
+			if repo == nil {
+				return &Status{
+					exitCode: 128,
+					err:      fmt.Errorf("fatal: %s", git.ErrNotRepository),
+				}
+			}
+			sha, err = repo.Objects.Put(objType, content)
+		} else {
+			sha, err = git.CreateHash(objType, content)
+		}
+		if err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: unable to write object: %s", err),
+			}
+		}
+		fmt.Fprintln(writer, sha)
+		return nil
+	}
+
+	if fromStdin {
+		content, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: could not read from stdin: %s", err),
+			}
+		}
+		if status := hashContent(content); status != nil {
+			return status
 		}
 	}
-	writer.Close()
-	object.Close()
+	if stdinPaths {
+		// Process the paths as they arrive so that scripts can read each
+		// object name before sending the next path.
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			files = append(files[:0], scanner.Text())
+			if status := hashFiles(files, hashContent); status != nil {
+				return status
+			}
+			writer.Flush()
+		}
+	} else if status := hashFiles(files, hashContent); status != nil {
+		return status
+	}
 
 	return &Status{
 		exitCode: ExitCodeOK,
@@ -141,71 +453,326 @@ func hashObjectCmd() *Status {
 	}
 }
 
-// ./your_git.sh ls-tree --name-only <tree_sha>
-func lsTreeCmd() *Status {
-	if len(os.Args) < 3 {
+func hashFiles(files []string, hashContent func([]byte) *Status) *Status {
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: could not open '%s' for reading: %s", file, errors.Unwrap(err)),
+			}
+		}
+		if status := hashContent(content); status != nil {
+			return status
+		}
+	}
+	return nil
+}
+
+// ./your_git.sh ls-tree [-r] [-t] [-d] [-l] [-z] [--name-only] [--full-name] <tree-ish> [<path>...]
+func lsTreeCmd(repo *git.Repository, args []string) *Status {
+	usage := "usage: ls-tree [-r] [-t] [-d] [-l] [-z] [--name-only] [--full-name] <tree-ish> [<path>...]\n"
+	opts := lsTreeOptions{}
+	positional := []string{}
+	for _, arg := range args {
+		switch arg {
+		case "-r":
+			opts.recursive = true
+		case "-t":
+			opts.showTrees = true
+		case "-d":
+			opts.onlyTrees = true
+		case "-l", "--long":
+			opts.long = true
+		case "-z":
+			opts.nulTerminated = true
+		case "--name-only", "--name-status":
+			opts.nameOnly = true
+		case "--full-name":
+			opts.fullName = true
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return &Status{
+					exitCode: ExitCodeError,
+					err:      fmt.Errorf("error: unknown option `%s'\n%s", arg, usage),
+				}
+			}
+			positional = append(positional, arg)
+		}
+	}
+	if len(positional) < 1 {
 		return &Status{
 			exitCode: ExitCodeError,
-			err:      fmt.Errorf("pass the tree object hash: ls-tree --name-only <tree_sha>\n"),
+			err:      fmt.Errorf("pass the tree object hash: %s", usage),
 		}
 	}
 
-	fullSha := os.Args[3]
-	objectContent, err := catObject(fullSha)
+	treeSha, err := git.ResolveRevision(repo, positional[0])
+	if err == nil {
+		treeSha, err = git.PeelObject(repo, treeSha, "tree")
+	}
 	if err != nil {
 		return &Status{
 			exitCode: ExitCodeError,
-			err:      fmt.Errorf("Error reading tree object: %s\n", err),
+			err:      fmt.Errorf("fatal: not a tree object: %s\n", positional[0]),
 		}
 	}
-
-	var result []string
-
-	fileContentlist := strings.Split(objectContent.String(), "\x00")[1:]
-	for i := 0; i < len(fileContentlist)-1; i++ {
-		temp := strings.Split(fileContentlist[i], " ")
-		result = append(result, temp[len(temp)-1])
+	for _, p := range positional[1:] {
+		name, err := git.NormalizePath(repo, p)
+		if err != nil {
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      fmt.Errorf("fatal: %s\n", err),
+			}
+		}
+		// A trailing slash (or "." and "..") means the contents of the
+		// directory.
+		if base := path.Base(p); (strings.HasSuffix(p, "/") || base == "." || base == "..") && name != "." {
+			name += "/"
+		}
+		opts.paths = append(opts.paths, name)
+	}
+	// Like git, only the entries under the current directory are listed, and
+	// the names are relative to it.
+	opts.prefix, _ = workTreePrefix(repo)
+	if len(opts.paths) == 0 && opts.prefix != "" {
+		opts.paths = []string{opts.prefix}
 	}
 
-	sort.Strings(result)
-	for _, item := range result {
-		fmt.Println(item)
+	writer := bufio.NewWriter(os.Stdout)
+	defer writer.Flush()
+	if err := listTree(repo, treeSha, "", &opts, writer); err != nil {
+		return &Status{
+			exitCode: ExitCodeError,
+			err:      fmt.Errorf("Error reading tree object: %s\n", err),
+		}
 	}
 
-	// to use ToLower pattern
-	// sort.Slice(result, func(i, j int) bool {
-	// 	return strings.ToLower(result[i]) < strings.ToLower(result[j])
-	// })
-	// for _, item := range result {
-	// 	fmt.Println(item)
-	// }
 	return &Status{
 		exitCode: ExitCodeOK,
 		err:      nil,
 	}
 }
 
-// ./your_git.sh commit-tree <tree_sha> -p <commit_sha> -m <message>
-func createCommitCmd() *Status {
-	if len(os.Args) < 3 {
+type lsTreeOptions struct {
+	recursive     bool // -r
+	showTrees     bool // -t
+	onlyTrees     bool // -d
+	long          bool // -l
+	nulTerminated bool // -z
+	nameOnly      bool // --name-only
+	fullName      bool // --full-name: names relative to the top, not to prefix
+	paths         []string
+	prefix        string // the current directory, e.g. "dir/"
+}
+
+// Print the entries of the tree under prefix as ls-tree does.
+func listTree(repo *git.Repository, treeSha, prefix string, opts *lsTreeOptions, w io.Writer) error {
+	treeBuf, err := git.ReadObjectContent(repo, treeSha)
+	if err != nil {
+		return err
+	}
+	tree, err := git.ParseTree(treeBuf)
+	if err != nil {
+		return err
+	}
+	for _, child := range tree.Children {
+		name := prefix + child.Name
+		isTree := child.Mode == "40000"
+
+		show, recurse := true, isTree && opts.recursive
+		if len(opts.paths) > 0 {
+			show, recurse = false, false
+			for _, p := range opts.paths {
+				trimmed := strings.TrimSuffix(p, "/")
+				switch {
+				case p == "." || strings.HasPrefix(name, trimmed+"/"):
+					// inside the path
+					show = true
+					recurse = recurse || (isTree && opts.recursive)
+				case name == trimmed && p == trimmed:
+					// the path itself
+					show = true
+					recurse = recurse || (isTree && opts.recursive)
+				case name == trimmed || strings.HasPrefix(trimmed, name+"/"):
+					// a parent directory of the path
+					recurse = recurse || isTree
+					show = show || (isTree && (opts.showTrees || (opts.onlyTrees && opts.recursive)))
+				}
+			}
+		}
+		if recurse && opts.recursive && !opts.showTrees && !opts.onlyTrees {
+			// Trees are replaced by their contents with -r.
+			show = false
+		}
+		if opts.onlyTrees && !isTree {
+			show = false
+		}
+
+		if show {
+			if err := printTreeEntry(repo, child, name, opts, w); err != nil {
+				return err
+			}
+		}
+		if recurse {
+			if err := listTree(repo, child.Sha, name+"/", opts, w); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func printTreeEntry(repo *git.Repository, child git.TreeChild, name string, opts *lsTreeOptions, w io.Writer) error {
+	if opts.prefix != "" && !opts.fullName {
+		if rel, err := filepath.Rel(filepath.FromSlash(opts.prefix), filepath.FromSlash(name)); err == nil {
+			name = filepath.ToSlash(rel)
+		}
+		if name == "." {
+			// the current directory itself
+			name = "./"
+		}
+	}
+	terminator := "\n"
+	if opts.nulTerminated {
+		terminator = "\x00"
+	} else {
+		name = quotePath(name, false)
+	}
+	if opts.nameOnly {
+		_, err := fmt.Fprintf(w, "%s%s", name, terminator)
+		return err
+	}
+	if opts.long {
+		size := "-"
+		if child.ObjectType() == "blob" {
+			objReader, err := repo.Objects.Get(child.Sha)
+			if err != nil {
+				return err
+			}
+			size = strconv.FormatInt(objReader.ContentSize, 10)
+			objReader.Close()
+		}
+		_, err := fmt.Fprintf(w, "%s %s %s %7s\t%s%s", child.PaddedMode(), child.ObjectType(), child.Sha, size, name, terminator)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s %s %s\t%s%s", child.PaddedMode(), child.ObjectType(), child.Sha, name, terminator)
+	return err
+}
+
+// ./your_git.sh commit-tree <tree_sha> [-p <parent_sha>]... [-m <message>]... [-F <file>]...
+func createCommitCmd(repo *git.Repository, args []string) *Status {
+	usage := "usage: commit-tree <tree_sha> [-p <parent_sha>]... [-m <message>]... [-F <file>]...\n"
+
+	treeSha := ""
+	parents := []string{}
+	messages := []string{}
+	messageGiven := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch arg {
+		case "-p", "-m", "-F":
+			if i+1 >= len(args) {
+				return &Status{
+					exitCode: ExitCodeError,
+					err:      fmt.Errorf("error: switch `%s' requires a value\n%s", arg[1:], usage),
+				}
+			}
+			value := args[i+1]
+			i++
+			switch arg {
+			case "-p":
+				sha, err := git.ResolveRevision(repo, value)
+				if err == nil {
+					sha, err = git.PeelObject(repo, sha, "commit")
+				}
+				if err != nil {
+					return &Status{
+						exitCode: ExitCodeError,
+						err:      fmt.Errorf("fatal: not a valid object name %s\n", value),
+					}
+				}
+				value = sha
+				duplicated := false
+				for _, parent := range parents {
+					duplicated = duplicated || parent == value
+				}
+				if duplicated {
+					fmt.Fprintf(os.Stderr, "error: duplicate parent %s ignored\n", value)
+					continue
+				}
+				parents = append(parents, value)
+			case "-m":
+				messages = append(messages, value+"\n")
+				messageGiven = true
+			case "-F":
+				var content []byte
+				var err error
+				if value == "-" {
+					content, err = ioutil.ReadAll(os.Stdin)
+				} else {
+					content, err = ioutil.ReadFile(value)
+				}
+				if err != nil {
+					return &Status{
+						exitCode: ExitCodeError,
+						err:      fmt.Errorf("fatal: could not read log file '%s': %s\n", value, err),
+					}
+				}
+				messages = append(messages, string(content))
+				messageGiven = true
+			}
+		default:
+			if treeSha != "" || strings.HasPrefix(arg, "-") {
+				return &Status{
+					exitCode: ExitCodeError,
+					err:      fmt.Errorf("%s", usage),
+				}
+			}
+			treeSha = arg
+		}
+	}
+	if treeSha == "" {
 		return &Status{
 			exitCode: ExitCodeError,
 			err:      fmt.Errorf("pass the tree object hash: <tree_sha>\n"),
 		}
 	}
 
-	tree_sha := os.Args[2]
-	commit_sha := os.Args[4]
-	message := os.Args[6]
+	sha, err := git.ResolveRevision(repo, treeSha)
+	if err == nil {
+		sha, err = git.PeelObject(repo, sha, "tree")
+	}
+	if err != nil {
+		return &Status{
+			exitCode: ExitCodeError,
+			err:      fmt.Errorf("fatal: not a valid object name %s\n", treeSha),
+		}
+	}
+	treeSha = sha
+
+	// Read the message from stdin when neither -m nor -F is given.
+	if !messageGiven {
+		content, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      fmt.Errorf("error reading message from stdin: %s\n", err),
+			}
+		}
+		messages = append(messages, string(content))
+	}
+	// Each -m and -F becomes a separate paragraph.
+	message := strings.Join(messages, "\n")
 
-	sha, err := WriteCommitObject(tree_sha, commit_sha, message)
+	commitSha, err := git.WriteCommitObject(repo, treeSha, parents, message)
 	if err != nil {
 		return &Status{
 			exitCode: ExitCodeError,
 			err:      fmt.Errorf("error writing to commit object: %s\n", err),
 		}
 	}
-	fmt.Printf("%x\n", sha)
+	fmt.Printf("%x\n", commitSha)
 
 	return &Status{
 		exitCode: ExitCodeOK,
@@ -214,24 +781,30 @@ func createCommitCmd() *Status {
 }
 
 // ./your_git.sh write-tree
-func writeTreeCmd() *Status {
-	workDir, err := filepath.Abs(".")
+func writeTreeCmd(repo *git.Repository, args []string) *Status {
+	if len(args) > 0 {
+		return &Status{
+			exitCode: 129,
+			err:      fmt.Errorf("usage: write-tree\n"),
+		}
+	}
+
+	idx, err := git.ReadIndex(repo)
 	if err != nil {
 		return &Status{
 			exitCode: ExitCodeError,
-			err:      fmt.Errorf("error reading directory: %s\n", err),
+			err:      fmt.Errorf("error reading index: %s\n", err),
 		}
 	}
 
-	sha, err := WriteTreeObject(workDir)
-	fmt.Printf("%x\n", sha)
-
+	sha, err := git.WriteTreeFromIndex(repo, idx)
 	if err != nil {
 		return &Status{
 			exitCode: ExitCodeError,
 			err:      fmt.Errorf("error writing tree object: %s\n", err),
 		}
 	}
+	fmt.Printf("%x\n", sha)
 
 	return &Status{
 		exitCode: ExitCodeOK,
@@ -239,66 +812,3489 @@ func writeTreeCmd() *Status {
 	}
 }
 
-// ./your_git.sh clone https://github.com/blah/blah <some_dir>
-func cloneCmd() *Status {
-	gitRepositoryURL := os.Args[2]
-	directory := os.Args[3]
-
-	repoPath := path.Join(".", directory)
-	if err := os.MkdirAll(repoPath, 0750); err != nil {
-		return &Status{
-			exitCode: ExitCodeError,
-			err:      fmt.Errorf("error creating directory: %s\n", err),
+// ./your_git.sh add [-f] <path>...
+func addCmd(repo *git.Repository, args []string) *Status {
+	force := false
+	paths := []string{}
+	for i, arg := range args {
+		if arg == "--" {
+			paths = append(paths, args[i+1:]...)
+			break
+		}
+		switch arg {
+		case "-f", "--force":
+			force = true
+		default:
+			paths = append(paths, arg)
 		}
 	}
-	log.Printf("[Debug] git url: %s, dir: %s\n", gitRepositoryURL, directory)
-
-	status := initCmd(repoPath)
-	if status.err != nil {
+	if len(paths) < 1 {
 		return &Status{
 			exitCode: ExitCodeError,
-			err:      fmt.Errorf("error initializing git repository: %s\n", status.err),
+			err:      fmt.Errorf("Nothing specified, nothing added.\n"),
 		}
 	}
 
-	// latest commit: 7b8eb72b9dfa14a28ed22d7618b3cdecaa5d5be0
-	commitSha, err := fetchLatestCommitHash(gitRepositoryURL)
+	idx, err := git.ReadIndex(repo)
 	if err != nil {
 		return &Status{
 			exitCode: ExitCodeError,
-			err:      fmt.Errorf("error fetching latest commit hash: %s\n", err),
+			err:      fmt.Errorf("error reading index: %s\n", err),
 		}
 	}
-
-	if err := writeBranchRefFile(repoPath, "master", commitSha); err != nil {
-		return &Status{
-			exitCode: ExitCodeError,
-			err:      fmt.Errorf("error writing branch ref file: %s\n", err),
+	var ignore *git.IgnoreMatcher
+	if !force {
+		if ignore, err = git.NewIgnoreMatcher(repo); err != nil {
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      fmt.Errorf("error reading ignore files: %s\n", err),
+			}
 		}
 	}
 
-	// Fetch objects.
-	if err := fetchObjects(gitRepositoryURL, commitSha); err != nil {
-		return &Status{
-			exitCode: ExitCodeError,
-			err:      fmt.Errorf("error fetching objects: %s\n", err),
+	ignoredPaths := []string{}
+	for _, arg := range paths {
+		name, err := git.NormalizePath(repo, arg)
+		if err != nil {
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      fmt.Errorf("fatal: %s\n", err),
+			}
+		}
+
+		// Tracked files are updated even if they are ignored, untracked
+		// ones are added unless they are ignored.
+		files := []string{}
+		existing := map[string]bool{}
+		tracked := idx.Match(name)
+		for _, entry := range tracked {
+			if _, err := os.Lstat(filepath.Join(repo.WorkTree, filepath.FromSlash(entry.Name))); err == nil {
+				existing[entry.Name] = true
+				files = append(files, entry.Name)
+			}
+		}
+		untracked, err := git.ListUntrackedFiles(repo, idx, name, ignore)
+		if err != nil {
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      fmt.Errorf("error reading %s: %s\n", arg, err),
+			}
+		}
+		for _, file := range untracked {
+			if !file.Ignored && !strings.HasSuffix(file.Name, "/") {
+				files = append(files, file.Name)
+			}
+		}
+		if len(tracked) == 0 && len(files) == 0 && ignore != nil {
+			// Ignored files are only added when they are forced.
+			if info, err := os.Lstat(filepath.Join(repo.WorkTree, filepath.FromSlash(name))); err == nil {
+				if ignored, _ := ignore.IsIgnored(name, info.IsDir()); ignored {
+					ignoredPaths = append(ignoredPaths, arg)
+					continue
+				}
+			}
+		}
+		if len(files) == 0 && len(tracked) == 0 && len(untracked) == 0 {
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      fmt.Errorf("fatal: pathspec '%s' did not match any files\n", arg),
+			}
+		}
+
+		// Stage the removal of tracked files which no longer exist.
+		for _, entry := range tracked {
+			if !existing[entry.Name] {
+				idx.Remove(entry.Name)
+			}
+		}
+
+		for _, file := range files {
+			if entry, ok := idx.Find(file); ok {
+				info, err := os.Lstat(filepath.Join(repo.WorkTree, filepath.FromSlash(file)))
+				if err == nil && entry.Stage() == 0 && entry.StatMatches(info) {
+					continue
+				}
+			}
+			entry, err := git.HashWorktreeFile(repo, file)
+			if err != nil {
+				return &Status{
+					exitCode: ExitCodeError,
+					err:      fmt.Errorf("error adding %s: %s\n", file, err),
+				}
+			}
+			idx.Add(entry)
 		}
 	}
 
-	if err := writeFetchedObjects(repoPath); err != nil {
+	if err := idx.Write(repo); err != nil {
 		return &Status{
 			exitCode: ExitCodeError,
-			err:      fmt.Errorf("error writing fetched objects: %s\n", err),
+			err:      fmt.Errorf("error writing index: %s\n", err),
 		}
 	}
-	// Restore files committed at the commit sha.
-	if err := restoreRepository(repoPath, commitSha); err != nil {
+
+	if len(ignoredPaths) > 0 {
+		message := "The following paths are ignored by one of your .gitignore files:\n" + strings.Join(ignoredPaths, "\n")
+		if advice, _ := git.GetConfigValue(repo, "advice.addIgnoredFile"); advice != "false" {
+			message += "\nhint: Use -f if you really want to add them.\nhint: Turn this message off by running\nhint: \"git config advice.addIgnoredFile false\""
+		}
 		return &Status{
 			exitCode: ExitCodeError,
-			err:      fmt.Errorf("error restoring repository: %s\n", err),
+			err:      fmt.Errorf("%s", message),
 		}
 	}
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
 
+// ./your_git.sh rm [--cached] [-r] [-f] [-q] <path>...
+func rmCmd(repo *git.Repository, args []string) *Status {
+	cached, recursive, force, quiet := false, false, false, false
+	paths := []string{}
+	for i, arg := range args {
+		if arg == "--" {
+			paths = append(paths, args[i+1:]...)
+			break
+		}
+		switch arg {
+		case "--cached":
+			cached = true
+		case "-r":
+			recursive = true
+		case "-f", "--force":
+			force = true
+		case "-q", "--quiet":
+			quiet = true
+		default:
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) < 1 {
+		return &Status{
+			exitCode: ExitCodeError,
+			err:      fmt.Errorf("usage: rm [--cached] [-r] [-f] [-q] <path>...\n"),
+		}
+	}
+
+	idx, err := git.ReadIndex(repo)
+	if err != nil {
+		return &Status{
+			exitCode: ExitCodeError,
+			err:      fmt.Errorf("error reading index: %s\n", err),
+		}
+	}
+
+	// Check all paths before removing anything.
+	removed := []git.IndexEntry{}
+	for _, arg := range paths {
+		name, err := git.NormalizePath(repo, arg)
+		if err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", err),
+			}
+		}
+		matched := idx.Match(name)
+		if len(matched) == 0 {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: pathspec '%s' did not match any files", arg),
+			}
+		}
+		if !recursive && (len(matched) > 1 || matched[0].Name != name) {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: not removing '%s' recursively without -r", arg),
+			}
+		}
+		removed = append(removed, matched...)
+	}
+
+	// Like git, refuse to lose content which is only in the index or only in
+	// the working tree. A file which is gone from the working tree is fine.
+	if !force {
+		status, err := git.GetStatus(repo)
+		if err != nil {
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      fmt.Errorf("error: %s", err),
+			}
+		}
+		changes := map[string]git.FileStatus{}
+		for _, c := range status.Changes {
+			changes[c.Name] = c
+		}
+		var stagedAndLocal, staged, local []string
+		for _, entry := range removed {
+			c, ok := changes[entry.Name]
+			if !ok || c.Unstaged == 'D' {
+				continue
+			}
+			hasStaged, hasLocal := c.Staged != ' ', c.Unstaged != ' '
+			switch {
+			case hasStaged && hasLocal:
+				stagedAndLocal = append(stagedAndLocal, entry.Name)
+			case cached:
+			case hasStaged:
+				staged = append(staged, entry.Name)
+			case hasLocal:
+				local = append(local, entry.Name)
+			}
+		}
+		message := ""
+		report := func(files []string, what, hint string) {
+			if len(files) == 0 {
+				return
+			}
+			subject := "the following file has"
+			if len(files) > 1 {
+				subject = "the following files have"
+			}
+			message += fmt.Sprintf("error: %s %s:\n", subject, what)
+			for _, name := range files {
+				message += fmt.Sprintf("    %s\n", name)
+			}
+			message += hint + "\n"
+		}
+		report(stagedAndLocal, "staged content different from both the\nfile and the HEAD", "(use -f to force removal)")
+		report(staged, "changes staged in the index", "(use --cached to keep the file, or -f to force removal)")
+		report(local, "local modifications", "(use --cached to keep the file, or -f to force removal)")
+		if message != "" {
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      errors.New(strings.TrimSuffix(message, "\n")),
+			}
+		}
+	}
+
+	for _, entry := range removed {
+		idx.Remove(entry.Name)
+		if !quiet {
+			fmt.Printf("rm '%s'\n", entry.Name)
+		}
+		if cached {
+			continue
+		}
+		if err := git.RemoveWorktreeFile(repo, entry.Name); err != nil {
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      fmt.Errorf("error removing %s: %s\n", entry.Name, err),
+			}
+		}
+	}
+
+	if err := idx.Write(repo); err != nil {
+		return &Status{
+			exitCode: ExitCodeError,
+			err:      fmt.Errorf("error writing index: %s\n", err),
+		}
+	}
+
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// ./your_git.sh ls-files [-s] [-z]
+func lsFilesCmd(repo *git.Repository, args []string) *Status {
+	stage, nulTerminated := false, false
+	for _, arg := range args {
+		switch arg {
+		case "-s", "--stage":
+			stage = true
+		case "-z":
+			nulTerminated = true
+		default:
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      fmt.Errorf("unknown option %q: ls-files [-s] [-z]\n", arg),
+			}
+		}
+	}
+
+	idx, err := git.ReadIndex(repo)
+	if err != nil {
+		return &Status{
+			exitCode: ExitCodeError,
+			err:      fmt.Errorf("error reading index: %s\n", err),
+		}
+	}
+
+	// Like git, only the files under the current directory are listed.
+	prefix, _ := workTreePrefix(repo)
+	for _, entry := range idx.Entries {
+		if !strings.HasPrefix(entry.Name, prefix) {
+			continue
+		}
+		name, terminator := strings.TrimPrefix(entry.Name, prefix), "\n"
+		if nulTerminated {
+			terminator = "\x00"
+		} else {
+			name = quotePath(name, false)
+		}
+		if stage {
+			fmt.Printf("%06o %x %d\t%s%s", entry.Mode, entry.Sha, entry.Stage(), name, terminator)
+		} else {
+			fmt.Printf("%s%s", name, terminator)
+		}
+	}
+
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// ./your_git.sh status [--short|--porcelain[=v1]] [-b]
+func statusCmd(repo *git.Repository, args []string) *Status {
+	short, porcelain, showBranch := false, false, false
+	for _, arg := range args {
+		switch arg {
+		case "-s", "--short":
+			short = true
+		case "--porcelain", "--porcelain=v1":
+			short, porcelain = true, true
+		case "-b", "--branch":
+			showBranch = true
+		default:
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      fmt.Errorf("unknown option %q: status [--short|--porcelain[=v1]] [-b]\n", arg),
+			}
+		}
+	}
+
+	status, err := git.GetStatus(repo)
+	if err != nil {
+		return &Status{
+			exitCode: ExitCodeError,
+			err:      fmt.Errorf("error getting status: %s\n", err),
+		}
+	}
+
+	if short {
+		printShortStatus(repo, status, showBranch, porcelain)
+	} else {
+		printLongStatus(repo, status)
+	}
+
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// ./your_git.sh commit -m <message>
+func commitCmd(repo *git.Repository, args []string) *Status {
+	messages := []string{}
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "-m" || args[i] == "--message":
+			if i+1 >= len(args) {
+				return &Status{
+					exitCode: ExitCodeError,
+					err:      fmt.Errorf("switch `m' requires a value\n"),
+				}
+			}
+			messages = append(messages, args[i+1])
+			i++
+		case strings.HasPrefix(args[i], "--message="):
+			messages = append(messages, strings.TrimPrefix(args[i], "--message="))
+		case strings.HasPrefix(args[i], "-m"):
+			messages = append(messages, strings.TrimPrefix(args[i], "-m"))
+		default:
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      fmt.Errorf("unknown option %q: commit -m <message>\n", args[i]),
+			}
+		}
+	}
+	// Each -m becomes a separate paragraph.
+	message := strings.TrimSpace(strings.Join(messages, "\n\n"))
+	if message == "" {
+		return &Status{
+			exitCode: ExitCodeError,
+			err:      fmt.Errorf("Aborting commit due to empty commit message.\n"),
+		}
+	}
+
+	ref, parentSha, err := git.ReadHead(repo)
+	if err != nil {
+		return &Status{
+			exitCode: ExitCodeError,
+			err:      fmt.Errorf("error reading HEAD: %s\n", err),
+		}
+	}
+
+	idx, err := git.ReadIndex(repo)
+	if err != nil {
+		return &Status{
+			exitCode: ExitCodeError,
+			err:      fmt.Errorf("error reading index: %s\n", err),
+		}
+	}
+	treeSha, err := git.WriteTreeFromIndex(repo, idx)
+	if err != nil {
+		return &Status{
+			exitCode: ExitCodeError,
+			err:      fmt.Errorf("error writing tree object: %s\n", err),
+		}
+	}
+
+	// Refuse to create a commit which doesn't change anything.
+	if parentSha != "" {
+		parentTreeSha, err := git.ReadCommitTree(repo, parentSha)
+		if err != nil {
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      fmt.Errorf("error reading HEAD commit: %s\n", err),
+			}
+		}
+		if parentTreeSha == fmt.Sprintf("%x", treeSha) {
+			status, err := git.GetStatus(repo)
+			if err == nil {
+				printLongStatus(repo, status)
+			}
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      nil,
+			}
+		}
+	}
+
+	parents := []string{}
+	if parentSha != "" {
+		parents = append(parents, parentSha)
+	}
+	sha, err := git.WriteCommitObject(repo, fmt.Sprintf("%x", treeSha), parents, message)
+	if err != nil {
+		return &Status{
+			exitCode: ExitCodeError,
+			err:      fmt.Errorf("error writing to commit object: %s\n", err),
+		}
+	}
+	commitSha := fmt.Sprintf("%x", sha)
+
+	// Advance the branch only if nobody else moved it in the meantime.
+	subject := strings.SplitN(message, "\n", 2)[0]
+	reflogMessage, oldSha := "commit: "+subject, parentSha
+	if parentSha == "" {
+		// The branch must still not exist.
+		reflogMessage, oldSha = "commit (initial): "+subject, strings.Repeat("0", 40)
+	}
+	if err := git.UpdateRef(repo, "HEAD", commitSha, oldSha, reflogMessage); err != nil {
+		return &Status{
+			exitCode: ExitCodeError,
+			err:      fmt.Errorf("error updating HEAD: %s\n", err),
+		}
+	}
+
+	branch := "detached HEAD"
+	if ref != "" {
+		branch = strings.TrimPrefix(ref, "refs/heads/")
+	}
+	if parentSha == "" {
+		branch += " (root-commit)"
+	}
+	fmt.Printf("[%s %s] %s\n", branch, commitSha[:7], subject)
+
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// ./your_git.sh config [<file-option>] [--type=<type>] [--get|--get-all|--add|--unset|--unset-all|--replace-all|--list] <name> [<value>]
+func configCmd(repo *git.Repository, args []string) *Status {
+	const (
+		exitCodeConfigMissing = 1
+		exitCodeConfigInvalid = 5
+	)
+	usage := "usage: config [--global|--system|--local|--file <file>] [--type=<type>] [--get|--get-all|--add|--unset|--unset-all|--replace-all|--list] <name> [<value>]\n"
+
+	action, file, valueType := "", "", ""
+	includes := ""
+	params := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--get" || arg == "--get-all" || arg == "--add" || arg == "--unset" ||
+			arg == "--unset-all" || arg == "--replace-all" || arg == "--list" || arg == "-l":
+			if action != "" {
+				return &Status{
+					exitCode: ExitCodeError,
+					err:      fmt.Errorf("error: only one action at a time\n%s", usage),
+				}
+			}
+			action = strings.TrimLeft(arg, "-")
+			if action == "l" {
+				action = "list"
+			}
+		case arg == "--global" || arg == "--system" || arg == "--local":
+			system, global, local := git.ConfigFiles(repo)
+			switch arg {
+			case "--global":
+				// Write to ~/.gitconfig unless only the XDG file exists, like git.
+				file = global[len(global)-1]
+				if _, err := os.Stat(file); os.IsNotExist(err) && len(global) > 1 {
+					if _, err := os.Stat(global[0]); err == nil {
+						file = global[0]
+					}
+				}
+			case "--system":
+				file = system
+			case "--local":
+				if repo == nil {
+					return &Status{
+						exitCode: 128,
+						err:      fmt.Errorf("fatal: --local can only be used inside a git repository\n"),
+					}
+				}
+				file = local
+			}
+		case arg == "--file" || arg == "-f":
+			if i+1 >= len(args) {
+				return &Status{
+					exitCode: ExitCodeError,
+					err:      fmt.Errorf("error: option `file' requires a value\n"),
+				}
+			}
+			file = args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--file="):
+			file = strings.TrimPrefix(arg, "--file=")
+		case strings.HasPrefix(arg, "--type="):
+			valueType = strings.TrimPrefix(arg, "--type=")
+		case arg == "--bool" || arg == "--int" || arg == "--path":
+			valueType = strings.TrimPrefix(arg, "--")
+		case arg == "--includes" || arg == "--no-includes":
+			includes = arg
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      fmt.Errorf("error: unknown option `%s'\n%s", arg, usage),
+			}
+		default:
+			params = append(params, arg)
+		}
+	}
+	if action == "" {
+		switch len(params) {
+		case 1:
+			action = "get"
+		case 2:
+			action = "set"
+		default:
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      fmt.Errorf("%s", usage),
+			}
+		}
+	}
+
+	expectedParams := map[string]int{
+		"get": 1, "get-all": 1, "unset": 1, "unset-all": 1,
+		"set": 2, "add": 2, "replace-all": 2, "list": 0,
+	}
+	if len(params) != expectedParams[action] {
+		return &Status{
+			exitCode: ExitCodeError,
+			err:      fmt.Errorf("error: wrong number of arguments\n%s", usage),
+		}
+	}
+
+	// Outside a repository, there is no local config file.
+	var fsys git.FS = git.OSFS{}
+	gitDir := ""
+	if repo != nil {
+		fsys = repo.FS
+		gitDir, _ = filepath.Abs(repo.GitDir)
+	}
+
+	switch action {
+	case "get", "get-all", "list":
+		var config *git.Config
+		var err error
+		if file != "" {
+			// Includes are not followed for a specific file unless requested.
+			entries, readErr := git.ReadConfigFile(fsys, file, gitDir, includes == "--includes", 0)
+			if readErr != nil && !os.IsNotExist(readErr) {
+				err = readErr
+			}
+			config = &git.Config{Entries: entries}
+		} else {
+			config, err = git.ReadConfigFiles(repo, includes != "--no-includes")
+		}
+		if err != nil {
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      fmt.Errorf("fatal: %s\n", err),
+			}
+		}
+
+		if action == "list" {
+			for _, entry := range config.Entries {
+				if entry.NoValue {
+					fmt.Println(entry.Name())
+				} else {
+					fmt.Printf("%s=%s\n", entry.Name(), entry.Value)
+				}
+			}
+			break
+		}
+
+		if _, _, _, err := git.SplitConfigKey(params[0]); err != nil {
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      fmt.Errorf("error: %s\n", err),
+			}
+		}
+		entries := config.Lookup(params[0])
+		if len(entries) == 0 {
+			return &Status{
+				exitCode: exitCodeConfigMissing,
+				err:      nil,
+			}
+		}
+		if action == "get" {
+			entries = entries[len(entries)-1:]
+		}
+		for _, entry := range entries {
+			formatted, err := git.FormatConfigValue(entry, valueType)
+			if err != nil {
+				return &Status{
+					exitCode: ExitCodeError,
+					err:      fmt.Errorf("fatal: %s\n", err),
+				}
+			}
+			fmt.Println(formatted)
+		}
+
+	default:
+		if file == "" {
+			if repo == nil {
+				return &Status{
+					exitCode: 128,
+					err:      fmt.Errorf("fatal: not in a git directory\n"),
+				}
+			}
+			_, _, file = git.ConfigFiles(repo)
+		}
+		cf, err := git.OpenConfigFile(fsys, file)
+		if err != nil {
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      fmt.Errorf("fatal: %s\n", err),
+			}
+		}
+		switch action {
+		case "set", "replace-all":
+			if valueType != "" {
+				if params[1], err = git.FormatConfigValue(git.ConfigEntry{Value: params[1]}, valueType); err != nil {
+					break
+				}
+			}
+			err = cf.Set(params[0], params[1], action == "replace-all")
+		case "add":
+			err = cf.Add(params[0], params[1])
+		case "unset", "unset-all":
+			var found bool
+			found, err = cf.Unset(params[0], action == "unset-all")
+			if err == nil && !found {
+				return &Status{
+					exitCode: exitCodeConfigInvalid,
+					err:      nil,
+				}
+			}
+		}
+		if err != nil {
+			return &Status{
+				exitCode: exitCodeConfigInvalid,
+				err:      fmt.Errorf("%s\n", err),
+			}
+		}
+		if err := cf.Save(); err != nil {
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      fmt.Errorf("error: %s\n", err),
+			}
+		}
+	}
+
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// ./your_git.sh log [--oneline] [-n <number>] [--format=<format>] [--reverse] [<rev>...] [-- <path>...]
+func logCmd(repo *git.Repository, args []string) *Status {
+	revs, paths := []string{}, []string{}
+	maxCount := -1
+	pretty, format, separator := "medium", "", "\n"
+	reverse := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			for _, p := range args[i+1:] {
+				name, err := git.NormalizePath(repo, p)
+				if err != nil {
+					return &Status{
+						exitCode: ExitCodeError,
+						err:      fmt.Errorf("fatal: %s\n", err),
+					}
+				}
+				paths = append(paths, name)
+			}
+			i = len(args)
+		case arg == "--oneline":
+			pretty, format = "", "%h %s"
+		case arg == "--reverse":
+			reverse = true
+		case arg == "-n" || arg == "--max-count":
+			if i+1 >= len(args) {
+				return &Status{
+					exitCode: ExitCodeError,
+					err:      fmt.Errorf("fatal: switch `n' requires a value\n"),
+				}
+			}
+			i++
+			arg = "-n" + args[i]
+			fallthrough
+		case strings.HasPrefix(arg, "-n") || strings.HasPrefix(arg, "--max-count=") ||
+			(len(arg) > 1 && arg[0] == '-' && arg[1] >= '0' && arg[1] <= '9'):
+			value := strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(arg, "--max-count="), "-n"), "-")
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return &Status{
+					exitCode: ExitCodeError,
+					err:      fmt.Errorf("fatal: '%s': not an integer\n", value),
+				}
+			}
+			maxCount = n
+		case strings.HasPrefix(arg, "--format=") || strings.HasPrefix(arg, "--pretty="):
+			value := strings.TrimPrefix(strings.TrimPrefix(arg, "--format="), "--pretty=")
+			switch {
+			case value == "oneline" || value == "short" || value == "medium" || value == "full" || value == "fuller":
+				pretty, format = value, ""
+			case strings.HasPrefix(value, "format:"):
+				// "format:" separates commits while "tformat:" terminates them.
+				pretty, format, separator = "", strings.TrimPrefix(value, "format:"), ""
+			default:
+				pretty, format = "", strings.TrimPrefix(value, "tformat:")
+			}
+		case arg == "--pretty":
+			pretty, format = "medium", ""
+		case strings.HasPrefix(arg, "-"):
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      fmt.Errorf("fatal: unrecognized argument: %s\n", arg),
+			}
+		default:
+			revs = append(revs, arg)
+		}
+	}
+	if len(revs) == 0 {
+		revs = append(revs, "HEAD")
+	}
+
+	starts := []string{}
+	for _, rev := range revs {
+		if rev == "HEAD" {
+			if ref, sha, err := git.ReadHead(repo); err == nil && sha == "" {
+				return &Status{
+					exitCode: ExitCodeError,
+					err:      fmt.Errorf("fatal: your current branch '%s' does not have any commits yet\n", strings.TrimPrefix(ref, "refs/heads/")),
+				}
+			}
+		}
+		sha, err := git.ResolveRevision(repo, rev)
+		if err == nil {
+			sha, err = git.PeelObject(repo, sha, "commit")
+		}
+		if err != nil {
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      fmt.Errorf("fatal: ambiguous argument '%s': %s\n", rev, err),
+			}
+		}
+		starts = append(starts, sha)
+	}
+
+	walker, err := git.NewCommitWalker(repo, starts, paths)
+	if err != nil {
+		return &Status{
+			exitCode: ExitCodeError,
+			err:      fmt.Errorf("error reading commit: %s\n", err),
+		}
+	}
+	commits := []*git.Commit{}
+	for maxCount < 0 || len(commits) < maxCount {
+		commit, err := walker.Next()
+		if err != nil {
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      fmt.Errorf("error reading commit: %s\n", err),
+			}
+		}
+		if commit == nil {
+			break
+		}
+		commits = append(commits, commit)
+	}
+	if reverse {
+		for i, j := 0, len(commits)-1; i < j; i, j = i+1, j-1 {
+			commits[i], commits[j] = commits[j], commits[i]
+		}
+	}
+
+	for i, commit := range commits {
+		if pretty != "" {
+			// Multi-line formats are separated by a blank line.
+			if i > 0 && pretty != "oneline" {
+				fmt.Println()
+			}
+			fmt.Print(formatCommitPretty(commit, pretty))
+			continue
+		}
+		if separator == "" && i > 0 {
+			fmt.Println()
+		}
+		fmt.Print(formatCommit(commit, format) + separator)
+	}
+
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// ./your_git.sh rev-parse [--verify] [-q] [--short[=<length>]] [--abbrev-ref] [--symbolic-full-name] <rev>...
+func revParseCmd(repo *git.Repository, args []string) *Status {
+	verify, quiet, abbrevRef, fullName := false, false, false, false
+	shortLen := 0
+	revs := []string{}
+	for i, arg := range args {
+		switch {
+		case arg == "--":
+			// paths are printed as is
+			revs = append(revs, args[i:]...)
+		case arg == "--verify":
+			verify = true
+		case arg == "-q" || arg == "--quiet":
+			quiet = true
+		case arg == "--short" || strings.HasPrefix(arg, "--short="):
+			shortLen = 7
+			if value, ok := git.GetConfigValue(repo, "core.abbrev"); ok {
+				if n, err := strconv.Atoi(value); err == nil {
+					shortLen = n
+				}
+			}
+			if strings.HasPrefix(arg, "--short=") {
+				n, err := strconv.Atoi(strings.TrimPrefix(arg, "--short="))
+				if err != nil {
+					return &Status{
+						exitCode: ExitCodeError,
+						err:      fmt.Errorf("fatal: invalid --short value: %s\n", arg),
+					}
+				}
+				shortLen = n
+			}
+			if shortLen < 4 {
+				shortLen = 4
+			}
+		case arg == "--abbrev-ref":
+			abbrevRef = true
+		case arg == "--symbolic-full-name":
+			fullName = true
+		case arg == "--git-dir":
+			fmt.Println(displayGitDir(repo))
+		case arg == "--absolute-git-dir":
+			gitDir, err := filepath.Abs(repo.GitDir)
+			if err != nil {
+				return &Status{
+					exitCode: ExitCodeError,
+					err:      fmt.Errorf("fatal: %s\n", err),
+				}
+			}
+			fmt.Println(gitDir)
+		case arg == "--show-toplevel" || arg == "--show-prefix" || arg == "--show-cdup":
+			if repo.WorkTree == "" {
+				return &Status{
+					exitCode: 128,
+					err:      fmt.Errorf("fatal: this operation must be run in a work tree\n"),
+				}
+			}
+			prefix, _ := workTreePrefix(repo)
+			switch arg {
+			case "--show-toplevel":
+				top, err := filepath.Abs(repo.WorkTree)
+				if err != nil {
+					return &Status{
+						exitCode: ExitCodeError,
+						err:      fmt.Errorf("fatal: %s\n", err),
+					}
+				}
+				fmt.Println(top)
+			case "--show-prefix":
+				fmt.Println(prefix)
+			case "--show-cdup":
+				fmt.Println(strings.Repeat("../", strings.Count(prefix, "/")))
+			}
+		case arg == "--is-inside-work-tree":
+			_, inside := workTreePrefix(repo)
+			fmt.Println(inside)
+		case arg == "--is-inside-git-dir":
+			fmt.Println(isInsideDir(repo.GitDir))
+		case arg == "--is-bare-repository":
+			fmt.Println(repo.WorkTree == "")
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      fmt.Errorf("fatal: unknown option %s\n", arg),
+			}
+		default:
+			revs = append(revs, arg)
+		}
+		if arg == "--" {
+			break
+		}
+	}
+
+	if verify && len(revs) != 1 {
+		return &Status{
+			exitCode: ExitCodeError,
+			err:      fmt.Errorf("fatal: Needed a single revision\n"),
+		}
+	}
+
+	failed := func(rev string, err error) *Status {
+		if quiet {
+			return &Status{exitCode: ExitCodeError, err: nil}
+		}
+		if verify {
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      fmt.Errorf("fatal: Needed a single revision\n"),
+			}
+		}
+		if !errors.Is(err, git.ErrUnknownRevision) {
+			// e.g. an ambiguous short sha or a path missing in the tree
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      fmt.Errorf("fatal: %s\n", err),
+			}
+		}
+		return &Status{
+			exitCode: ExitCodeError,
+			err:      fmt.Errorf("fatal: ambiguous argument '%s': unknown revision or path not in the working tree.\nUse '--' to separate paths from revisions, like this:\n'git <command> [<revision>...] -- [<file>...]'\n", rev),
+		}
+	}
+	output := func(prefix, sha string) {
+		if shortLen > 0 {
+			sha = git.ShortenSha(repo, sha, shortLen)
+		}
+		fmt.Println(prefix + sha)
+	}
+
+	for i, rev := range revs {
+		if rev == "--" {
+			for _, p := range revs[i:] {
+				fmt.Println(p)
+			}
+			break
+		}
+
+		// <from>..<to> means "<to> ^<from>"
+		if dots := strings.Index(rev, ".."); dots >= 0 && !strings.Contains(rev, "...") && !verify {
+			from, to := rev[:dots], rev[dots+2:]
+			if from == "" {
+				from = "HEAD"
+			}
+			if to == "" {
+				to = "HEAD"
+			}
+			toSha, toErr := git.ResolveRevision(repo, to)
+			fromSha, fromErr := git.ResolveRevision(repo, from)
+			if toErr == nil && fromErr == nil {
+				output("", toSha)
+				output("^", fromSha)
+				continue
+			}
+			// Not a range after all, e.g. HEAD:../file.
+		}
+
+		prefix := ""
+		if strings.HasPrefix(rev, "^") && !verify {
+			prefix, rev = "^", rev[1:]
+		}
+
+		if abbrevRef || fullName {
+			ref, _, err := git.DwimRef(repo, rev)
+			if err != nil {
+				return failed(rev, err)
+			}
+			if ref == "HEAD" {
+				if headRef, _, err := git.ReadHead(repo); err == nil && headRef != "" {
+					ref = headRef
+				}
+			}
+			if ref != "" {
+				if abbrevRef {
+					ref = git.ShortenRefName(ref)
+				}
+				fmt.Println(prefix + ref)
+				continue
+			}
+		}
+
+		sha, err := git.ResolveRevision(repo, rev)
+		if err != nil {
+			// Not a revision. Without --verify, an existing path is printed as is.
+			if _, statErr := os.Lstat(rev); statErr == nil && !verify {
+				fmt.Println(rev)
+				continue
+			}
+			return failed(rev, err)
+		}
+		if abbrevRef || fullName {
+			// a sha has no symbolic name
+			if !fullName || abbrevRef {
+				output(prefix, sha)
+			}
+			continue
+		}
+		output(prefix, sha)
+	}
+
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// ./your_git.sh clone https://github.com/blah/blah <some_dir>
+func cloneCmd(args []string) *Status {
+	if len(args) != 2 {
+		return &Status{
+			exitCode: 129,
+			err:      fmt.Errorf("usage: clone <repo> <dir>\n"),
+		}
+	}
+	gitRepositoryURL := args[0]
+	directory := args[1]
+
+	repoPath := path.Join(".", directory)
+	if err := os.MkdirAll(repoPath, 0750); err != nil {
+		return &Status{
+			exitCode: ExitCodeError,
+			err:      fmt.Errorf("error creating directory: %s\n", err),
+		}
+	}
+
+	absPath, err := filepath.Abs(repoPath)
+	if err != nil {
+		return &Status{
+			exitCode: ExitCodeError,
+			err:      fmt.Errorf("error initializing git repository: %s\n", err),
+		}
+	}
+	templateDir := ""
+	if config, err := git.ReadConfigFiles(nil, true); err == nil {
+		templateDir = defaultTemplateDir(config)
+	}
+	repo, _, err := git.InitRepository(filepath.Join(absPath, ".git"), absPath, git.InitOptions{TemplateDir: templateDir})
+	if err != nil {
+		return &Status{
+			exitCode: ExitCodeError,
+			err:      fmt.Errorf("error initializing git repository: %s\n", err),
+		}
+	}
+
+	// latest commit: 7b8eb72b9dfa14a28ed22d7618b3cdecaa5d5be0
+	commitSha, err := git.FetchLatestCommitHash(gitRepositoryURL)
+	if err != nil {
+		return &Status{
+			exitCode: ExitCodeError,
+			err:      fmt.Errorf("error fetching latest commit hash: %s\n", err),
+		}
+	}
+
+	// Fetch objects.
+	if err := git.FetchObjects(repo, gitRepositoryURL, commitSha); err != nil {
+		return &Status{
+			exitCode: ExitCodeError,
+			err:      fmt.Errorf("error fetching objects: %s\n", err),
+		}
+	}
+
+	// The branch can only point to the commit once its objects are there.
+	if err := git.WriteBranchRefFile(repo, "master", commitSha, "clone: from "+gitRepositoryURL); err != nil {
+		return &Status{
+			exitCode: ExitCodeError,
+			err:      fmt.Errorf("error writing branch ref file: %s\n", err),
+		}
+	}
+
+	// Restore files committed at the commit sha.
+	if err := git.RestoreRepository(repo, commitSha); err != nil {
+		return &Status{
+			exitCode: ExitCodeError,
+			err:      fmt.Errorf("error restoring repository: %s\n", err),
+		}
+	}
+
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// ./your_git.sh index-pack [-o <index-file>] <pack-file>
+// ./your_git.sh index-pack --stdin
+func indexPackCmd(repo *git.Repository, args []string) *Status {
+	usage := "usage: index-pack [-o <index-file>] <pack-file>\n   or: index-pack --stdin"
+	fromStdin := false
+	idxPath := ""
+	packPath := ""
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--stdin":
+			fromStdin = true
+		case arg == "-o" && i+1 < len(args):
+			i++
+			idxPath = args[i]
+		case strings.HasPrefix(arg, "-"):
+			return &Status{
+				exitCode: 129,
+				err:      fmt.Errorf("error: unknown option `%s'\n%s", arg, usage),
+			}
+		default:
+			packPath = arg
+		}
+	}
+	if fromStdin == (packPath != "") {
+		return &Status{
+			exitCode: 129,
+			err:      fmt.Errorf("%s", usage),
+		}
+	}
+
+	var name string
+	var err error
+	if fromStdin {
+		name, err = git.IndexPackStream(repo, os.Stdin)
+	} else {
+		if !strings.HasSuffix(packPath, ".pack") {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: packfile name '%s' does not end with '.pack'", packPath),
+			}
+		}
+		if idxPath == "" {
+			idxPath = strings.TrimSuffix(packPath, ".pack") + ".idx"
+		}
+		name, err = git.IndexPackFile(repo, packPath, idxPath)
+	}
+	if err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
+		}
+	}
+	fmt.Println(name)
+
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// Return the delta window and depth from pack.window and pack.depth.
+func packWindowAndDepth(repo *git.Repository) (int, int) {
+	window, depth := int64(git.DefaultPackWindow), int64(git.DefaultPackDepth)
+	if config, err := git.LoadConfig(repo); err == nil {
+		if n, err := config.GetInt("pack.window", window); err == nil {
+			window = n
+		}
+		if n, err := config.GetInt("pack.depth", depth); err == nil {
+			depth = n
+		}
+	}
+	return int(window), int(depth)
+}
+
+// Parse --window=<n> and --depth=<n>. ok is false if arg is neither.
+func parseWindowOption(arg string, window, depth *int) (ok bool, _ error) {
+	var target *int
+	switch {
+	case strings.HasPrefix(arg, "--window="):
+		target = window
+	case strings.HasPrefix(arg, "--depth="):
+		target = depth
+	default:
+		return false, nil
+	}
+	value := arg[strings.Index(arg, "=")+1:]
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return true, fmt.Errorf("fatal: invalid value for %s", arg)
+	}
+	*target = n
+	return true, nil
+}
+
+// ./your_git.sh pack-objects [--stdout] [--revs] [--all] [--window=<n>] [--depth=<n>] [-q] [<base-name>] < <object-list>
+func packObjectsCmd(repo *git.Repository, args []string) *Status {
+	usage := "usage: pack-objects [--stdout] [--revs] [--all] [--window=<n>] [--depth=<n>] [-q] [<base-name>] < <object-list>"
+	window, depth := packWindowAndDepth(repo)
+	toStdout, revs, all := false, false, false
+	baseName := ""
+	for _, arg := range args {
+		if ok, err := parseWindowOption(arg, &window, &depth); ok {
+			if err != nil {
+				return &Status{
+					exitCode: 128,
+					err:      err,
+				}
+			}
+			continue
+		}
+		switch {
+		case arg == "--stdout":
+			toStdout = true
+		case arg == "--revs":
+			revs = true
+		case arg == "--all":
+			all = true
+		case arg == "-q" || arg == "--quiet":
+		case strings.HasPrefix(arg, "-"):
+			return &Status{
+				exitCode: 129,
+				err:      fmt.Errorf("error: unknown option `%s'\n%s", arg, usage),
+			}
+		default:
+			baseName = arg
+		}
+	}
+	if toStdout == (baseName != "") {
+		return &Status{
+			exitCode: 129,
+			err:      fmt.Errorf("%s", usage),
+		}
+	}
+	if all && !revs {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: --all requires --revs"),
+		}
+	}
+
+	var objects []git.PackObject
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	if revs {
+		// Revisions to include, and ^<rev> to exclude.
+		tips, excluded := []string{}, []string{}
+		if all {
+			refs, err := git.ListRefs(repo)
+			if err != nil {
+				return &Status{
+					exitCode: 128,
+					err:      fmt.Errorf("fatal: %s", err),
+				}
+			}
+			for _, ref := range refs {
+				tips = append(tips, ref.Sha)
+			}
+			if _, headSha, err := git.ReadHead(repo); err == nil && headSha != "" {
+				tips = append(tips, headSha)
+			}
+		}
+		for scanner.Scan() {
+			rev := strings.TrimSpace(scanner.Text())
+			if rev == "" {
+				continue
+			}
+			exclude := strings.HasPrefix(rev, "^")
+			sha, err := git.ResolveRevision(repo, strings.TrimPrefix(rev, "^"))
+			if err != nil {
+				return &Status{
+					exitCode: 128,
+					err:      fmt.Errorf("fatal: bad revision '%s'", rev),
+				}
+			}
+			if exclude {
+				excluded = append(excluded, sha)
+			} else {
+				tips = append(tips, sha)
+			}
+		}
+		var err error
+		objects, err = git.ListObjects(repo, tips, excluded, nil)
+		if err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", err),
+			}
+		}
+	} else {
+		// "<sha> [<name>]" per line, as printed by rev-list --objects.
+		seen := map[string]bool{}
+		for scanner.Scan() {
+			line := scanner.Text()
+			sha, name := line, ""
+			if i := strings.IndexByte(line, ' '); i >= 0 {
+				sha, name = line[:i], line[i+1:]
+			}
+			if sha == "" || seen[sha] {
+				continue
+			}
+			seen[sha] = true
+			objReader, err := repo.Objects.Get(sha)
+			if err != nil {
+				return &Status{
+					exitCode: 128,
+					err:      fmt.Errorf("fatal: unable to read %s", sha),
+				}
+			}
+			objReader.Close()
+			objType, err := git.ParseObjectType(objReader.Type)
+			if err != nil {
+				return &Status{
+					exitCode: 128,
+					err:      fmt.Errorf("fatal: %s", err),
+				}
+			}
+			objects = append(objects, git.PackObject{
+				Sha:      sha,
+				ObjType:  objType,
+				Size:     objReader.ContentSize,
+				NameHash: git.PackNameHash(name),
+			})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: error reading stdin: %s", err),
+		}
+	}
+
+	if toStdout {
+		if _, _, err := git.WritePack(repo, os.Stdout, objects, window, depth); err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", err),
+			}
+		}
+	} else {
+		name, err := git.WritePackFiles(repo, baseName, objects, window, depth)
+		if err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", err),
+			}
+		}
+		fmt.Println(name)
+	}
+
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// ./your_git.sh repack [-a] [-A] [-d] [-q] [--window=<n>] [--depth=<n>]
+func repackCmd(repo *git.Repository, args []string) *Status {
+	usage := "usage: repack [-a] [-A] [-d] [-q] [--window=<n>] [--depth=<n>]"
+	window, depth := packWindowAndDepth(repo)
+	all, loosen, deleteOld, quiet := false, false, false, false
+	for _, arg := range args {
+		if ok, err := parseWindowOption(arg, &window, &depth); ok {
+			if err != nil {
+				return &Status{
+					exitCode: 128,
+					err:      err,
+				}
+			}
+			continue
+		}
+		switch arg {
+		case "-a":
+			all = true
+		case "-A":
+			// Like -a but unreachable objects are loosened instead of dropped.
+			all, loosen = true, true
+		case "-d":
+			deleteOld = true
+		case "-ad":
+			all, deleteOld = true, true
+		case "-Ad":
+			all, loosen, deleteOld = true, true, true
+		case "-q", "--quiet":
+			quiet = true
+		case "-f", "-F":
+			// deltas are always computed from scratch
+		default:
+			return &Status{
+				exitCode: 129,
+				err:      fmt.Errorf("error: unknown option `%s'\n%s", arg, usage),
+			}
+		}
+	}
+
+	name, err := git.Repack(repo, all, loosen, deleteOld, window, depth)
+	if err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
+		}
+	}
+	if name == "" && !quiet {
+		fmt.Println("Nothing new to pack.")
+	}
+
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// ./your_git.sh pack-refs [--all] [--no-prune]
+func packRefsCmd(repo *git.Repository, args []string) *Status {
+	all, prune := false, true
+	for _, arg := range args {
+		switch arg {
+		case "--all":
+			all = true
+		case "--prune":
+			prune = true
+		case "--no-prune":
+			prune = false
+		default:
+			return &Status{
+				exitCode: 129,
+				err:      fmt.Errorf("error: unknown option `%s'\nusage: pack-refs [--all] [--no-prune]", arg),
+			}
+		}
+	}
+	if err := git.PackRefs(repo, all, prune); err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
+		}
+	}
+
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// ./your_git.sh prune [-n] [-v] [--expire <time>]
+func pruneCmd(repo *git.Repository, args []string) *Status {
+	usage := "usage: prune [-n] [-v] [--expire <time>]"
+	dryRun, verbose := false, false
+	// Unreachable objects are pruned regardless of their age by default.
+	expire := time.Now().Add(time.Hour)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		var expireValue string
+		switch {
+		case arg == "-n" || arg == "--dry-run":
+			dryRun = true
+			continue
+		case arg == "-v" || arg == "--verbose":
+			verbose = true
+			continue
+		case arg == "--expire" && i+1 < len(args):
+			i++
+			expireValue = args[i]
+		case strings.HasPrefix(arg, "--expire="):
+			expireValue = strings.TrimPrefix(arg, "--expire=")
+		default:
+			return &Status{
+				exitCode: 129,
+				err:      fmt.Errorf("error: unknown option `%s'\n%s", arg, usage),
+			}
+		}
+		var err error
+		if expire, err = git.ParseExpiryDate(expireValue, time.Now()); err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", err),
+			}
+		}
+	}
+
+	pruned, err := git.PruneLooseObjects(repo, expire, dryRun)
+	if err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
+		}
+	}
+	if dryRun || verbose {
+		for _, sha := range pruned {
+			fmt.Println(sha)
+		}
+	}
+
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// ./your_git.sh gc [--aggressive] [--prune=<date>] [--no-prune] [-q]
+func gcCmd(repo *git.Repository, args []string) *Status {
+	usage := "usage: gc [--aggressive] [--prune=<date>] [--no-prune] [-q]"
+	window, depth := packWindowAndDepth(repo)
+	pruneExpire := git.DefaultPruneExpire
+	if value, ok := git.GetConfigValue(repo, "gc.pruneExpire"); ok {
+		pruneExpire = value
+	}
+	for _, arg := range args {
+		switch {
+		case arg == "--aggressive":
+			window, depth = 250, 50
+		case arg == "--prune":
+			pruneExpire = git.DefaultPruneExpire
+		case strings.HasPrefix(arg, "--prune="):
+			pruneExpire = strings.TrimPrefix(arg, "--prune=")
+		case arg == "--no-prune":
+			pruneExpire = "never"
+		case arg == "-q" || arg == "--quiet":
+		default:
+			return &Status{
+				exitCode: 129,
+				err:      fmt.Errorf("error: unknown option `%s'\n%s", arg, usage),
+			}
+		}
+	}
+	expire, err := git.ParseExpiryDate(pruneExpire, time.Now())
+	if err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
+		}
+	}
+
+	if err := git.PackRefs(repo, true, true); err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: failed to pack refs: %s", err),
+		}
+	}
+	reflogExpire, reflogExpireUnreachable, err := reflogExpiryDates(repo, time.Now())
+	if err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
+		}
+	}
+	reflogs, err := git.ListReflogs(repo)
+	if err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
+		}
+	}
+	for _, ref := range reflogs {
+		if _, err := git.ExpireReflog(repo, ref, reflogExpire, reflogExpireUnreachable, false); err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: failed to expire reflogs: %s", err),
+			}
+		}
+	}
+	// Unreachable packed objects are loosened so that prune expires them
+	// like other loose objects.
+	if _, err := git.Repack(repo, true, true, true, window, depth); err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: failed to repack: %s", err),
+		}
+	}
+	if !expire.IsZero() {
+		if _, err := git.PruneLooseObjects(repo, expire, false); err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: failed to prune: %s", err),
+			}
+		}
+	}
+
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// ./your_git.sh update-ref [-m <reason>] [--no-deref] <ref> <new-value> [<old-value>]
+// ./your_git.sh update-ref [-m <reason>] [--no-deref] -d <ref> [<old-value>]
+// ./your_git.sh update-ref [-m <reason>] [--no-deref] --stdin [-z]
+func updateRefCmd(repo *git.Repository, args []string) *Status {
+	usage := "usage: update-ref [<options>] -d <refname> [<old-val>]\n   or: update-ref [<options>] <refname> <new-val> [<old-val>]\n   or: update-ref [<options>] --stdin [-z]"
+	deref, del, fromStdin, nulTerminated := true, false, false, false
+	message, hasMessage := "", false
+	params := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-m" && i+1 < len(args):
+			message, hasMessage = args[i+1], true
+			i++
+		case strings.HasPrefix(arg, "-m") && len(arg) > 2:
+			message, hasMessage = arg[2:], true
+		case arg == "--no-deref":
+			deref = false
+		case arg == "-d":
+			del = true
+		case arg == "--stdin":
+			fromStdin = true
+		case arg == "-z":
+			nulTerminated = true
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			return &Status{
+				exitCode: 129,
+				err:      fmt.Errorf("error: unknown option `%s'\n%s", arg, usage),
+			}
+		default:
+			params = append(params, arg)
+		}
+	}
+
+	if hasMessage && message == "" {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: Refusing to perform update with empty message."),
+		}
+	}
+
+	if fromStdin {
+		if del || len(params) > 0 {
+			return &Status{
+				exitCode: 129,
+				err:      fmt.Errorf("%s", usage),
+			}
+		}
+		input, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", err),
+			}
+		}
+		if err := git.RunRefUpdates(repo, string(input), nulTerminated, deref, message, os.Stdout); err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", err),
+			}
+		}
+		return &Status{
+			exitCode: ExitCodeOK,
+			err:      nil,
+		}
+	}
+	if nulTerminated || del && (len(params) < 1 || len(params) > 2) || !del && (len(params) < 2 || len(params) > 3) {
+		return &Status{
+			exitCode: 129,
+			err:      fmt.Errorf("%s", usage),
+		}
+	}
+
+	ref, oldSha := params[0], ""
+	oldIndex := 2
+	if del {
+		oldIndex = 1
+	}
+	if len(params) > oldIndex {
+		sha, err := git.ResolveRefValue(repo, params[oldIndex])
+		if err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s: not a valid old SHA1", params[oldIndex]),
+			}
+		}
+		oldSha = sha
+	}
+
+	t := git.NewRefTransaction(repo)
+	t.Message = message
+	if del {
+		t.Delete(ref, oldSha, deref)
+	} else {
+		newSha, err := git.ResolveRefValue(repo, params[1])
+		if err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s: not a valid SHA1", params[1]),
+			}
+		}
+		t.Update(ref, newSha, oldSha, deref)
+	}
+	if err := t.Commit(); err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
+		}
+	}
+
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// ./your_git.sh symbolic-ref [-q] [--short] <name>
+// ./your_git.sh symbolic-ref [-m <reason>] <name> <ref>
+// ./your_git.sh symbolic-ref (-d | --delete) [-q] <name>
+func symbolicRefCmd(repo *git.Repository, args []string) *Status {
+	usage := "usage: symbolic-ref [-q] [--short] <name>\n   or: symbolic-ref [-m <reason>] <name> <ref>\n   or: symbolic-ref (-d | --delete) [-q] <name>"
+	quiet, short, del := false, false, false
+	message := ""
+	params := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-m" && i+1 < len(args):
+			message = args[i+1]
+			i++
+		case arg == "-q" || arg == "--quiet":
+			quiet = true
+		case arg == "--short":
+			short = true
+		case arg == "-d" || arg == "--delete":
+			del = true
+		case strings.HasPrefix(arg, "-"):
+			return &Status{
+				exitCode: 129,
+				err:      fmt.Errorf("error: unknown option `%s'\n%s", arg, usage),
+			}
+		default:
+			params = append(params, arg)
+		}
+	}
+	if len(params) < 1 || len(params) > 2 || del && len(params) != 1 {
+		return &Status{
+			exitCode: 129,
+			err:      fmt.Errorf("%s", usage),
+		}
+	}
+
+	name := params[0]
+	if len(params) == 2 {
+		if name == "HEAD" && !strings.HasPrefix(params[1], "refs/") {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: Refusing to point HEAD outside of refs/"),
+			}
+		}
+		if err := git.WriteSymbolicRef(repo, name, params[1], message); err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", err),
+			}
+		}
+		return &Status{
+			exitCode: ExitCodeOK,
+			err:      nil,
+		}
+	}
+
+	target, err := git.ReadSymbolicRef(repo, name)
+	if err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
+		}
+	}
+	if target == "" {
+		if quiet {
+			return &Status{exitCode: ExitCodeError, err: nil}
+		}
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: ref %s is not a symbolic ref", name),
+		}
+	}
+	if del {
+		if name == "HEAD" {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: deleting '%s' is not allowed", name),
+			}
+		}
+		if err := git.DeleteSymbolicRef(repo, name); err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", err),
+			}
+		}
+	} else if short {
+		fmt.Println(git.ShortenRefName(target))
+	} else {
+		fmt.Println(target)
+	}
+
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// ./your_git.sh show-ref [--head] [-d] [-s] [--abbrev[=<n>]] [--heads] [--tags] [-q] [<pattern>...]
+// ./your_git.sh show-ref --verify [-d] [-s] [--abbrev[=<n>]] [-q] <ref>...
+func showRefCmd(repo *git.Repository, args []string) *Status {
+	usage := "usage: show-ref [--head] [-d | --dereference] [-s | --hash[=<n>]] [--abbrev[=<n>]] [--heads] [--tags] [-q | --quiet] [<pattern>...]\n   or: show-ref --verify [-d] [-s] [--abbrev[=<n>]] [-q] <ref>..."
+	head, dereference, hashOnly, verify, quiet := false, false, false, false, false
+	heads, tags := false, false
+	abbrev := 0
+	patterns := []string{}
+	for _, arg := range args {
+		switch {
+		case arg == "--head":
+			head = true
+		case arg == "-d" || arg == "--dereference":
+			dereference = true
+		case arg == "-s" || arg == "--hash" || strings.HasPrefix(arg, "--hash="):
+			hashOnly = true
+			if strings.HasPrefix(arg, "--hash=") {
+				arg = "--abbrev=" + strings.TrimPrefix(arg, "--hash=")
+			}
+			fallthrough
+		case arg == "--abbrev" || strings.HasPrefix(arg, "--abbrev="):
+			if arg == "--abbrev" {
+				abbrev = 7
+			} else if strings.HasPrefix(arg, "--abbrev=") {
+				n, err := strconv.Atoi(strings.TrimPrefix(arg, "--abbrev="))
+				if err != nil {
+					return &Status{
+						exitCode: 129,
+						err:      fmt.Errorf("error: option `abbrev' expects a numerical value\n%s", usage),
+					}
+				}
+				abbrev = n
+			}
+		case arg == "--heads" || arg == "--branches":
+			heads = true
+		case arg == "--tags":
+			tags = true
+		case arg == "--verify":
+			verify = true
+		case arg == "-q" || arg == "--quiet":
+			quiet = true
+		case strings.HasPrefix(arg, "-"):
+			return &Status{
+				exitCode: 129,
+				err:      fmt.Errorf("error: unknown option `%s'\n%s", arg, usage),
+			}
+		default:
+			patterns = append(patterns, arg)
+		}
+	}
+
+	show := func(name, sha string) error {
+		if quiet {
+			return nil
+		}
+		shown := sha
+		if abbrev > 0 {
+			shown = git.ShortenSha(repo, sha, abbrev)
+		}
+		if hashOnly {
+			fmt.Println(shown)
+		} else {
+			fmt.Printf("%s %s\n", shown, name)
+		}
+		if !dereference {
+			return nil
+		}
+		peeled, err := git.PeelObject(repo, sha, "")
+		if err != nil || peeled == sha {
+			return err
+		}
+		if abbrev > 0 {
+			peeled = git.ShortenSha(repo, peeled, abbrev)
+		}
+		if hashOnly {
+			fmt.Println(peeled)
+		} else {
+			fmt.Printf("%s %s^{}\n", peeled, name)
+		}
+		return nil
+	}
+
+	refs, err := git.ListRefs(repo)
+	if err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
+		}
+	}
+
+	if verify {
+		if len(patterns) == 0 {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: --verify requires a reference"),
+			}
+		}
+		byName := map[string]string{}
+		for _, ref := range refs {
+			byName[ref.Name] = ref.Sha
+		}
+		if _, headSha, err := git.ReadHead(repo); err == nil && headSha != "" {
+			byName["HEAD"] = headSha
+		}
+		for _, name := range patterns {
+			sha, ok := byName[name]
+			if !ok || !(name == "HEAD" || strings.HasPrefix(name, "refs/")) {
+				if quiet {
+					return &Status{exitCode: ExitCodeError, err: nil}
+				}
+				return &Status{
+					exitCode: 128,
+					err:      fmt.Errorf("fatal: '%s' - not a valid ref", name),
+				}
+			}
+			if err := show(name, sha); err != nil {
+				return &Status{
+					exitCode: 128,
+					err:      fmt.Errorf("fatal: %s", err),
+				}
+			}
+		}
+		return &Status{
+			exitCode: ExitCodeOK,
+			err:      nil,
+		}
+	}
+
+	// A pattern matches whole trailing components, e.g. master matches
+	// refs/heads/master and refs/remotes/origin/master.
+	matches := func(name string) bool {
+		if heads || tags {
+			if !(heads && strings.HasPrefix(name, "refs/heads/") || tags && strings.HasPrefix(name, "refs/tags/")) {
+				return false
+			}
+		}
+		if len(patterns) == 0 {
+			return true
+		}
+		for _, pattern := range patterns {
+			if name == pattern || strings.HasSuffix(name, "/"+pattern) {
+				return true
+			}
+		}
+		return false
+	}
+
+	found := false
+	if head && !heads && !tags {
+		if _, headSha, err := git.ReadHead(repo); err == nil && headSha != "" {
+			found = true
+			if err := show("HEAD", headSha); err != nil {
+				return &Status{
+					exitCode: 128,
+					err:      fmt.Errorf("fatal: %s", err),
+				}
+			}
+		}
+	}
+	for _, ref := range refs {
+		if !matches(ref.Name) {
+			continue
+		}
+		found = true
+		if err := show(ref.Name, ref.Sha); err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", err),
+			}
+		}
+	}
+	if !found {
+		return &Status{exitCode: ExitCodeError, err: nil}
+	}
+
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// ./your_git.sh for-each-ref [--count=<n>] [--sort=<key>]... [--format=<format>] [--points-at=<object>] [<pattern>...]
+func forEachRefCmd(repo *git.Repository, args []string) *Status {
+	usage := "usage: for-each-ref [--count=<n>] [--sort=<key>]... [--format=<format>] [--points-at=<object>] [<pattern>...]"
+	format := git.DefaultRefFormat
+	count := -1
+	sortKeys := []string{}
+	pointsAt := ""
+	patterns := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		// --option <value> is the same as --option=<value>
+		for _, option := range []string{"--count", "--sort", "--format", "--points-at"} {
+			if arg == option && i+1 < len(args) {
+				i++
+				arg = option + "=" + args[i]
+			}
+		}
+		switch {
+		case strings.HasPrefix(arg, "--count="):
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "--count="))
+			if err != nil || n < 0 {
+				return &Status{
+					exitCode: 129,
+					err:      fmt.Errorf("error: invalid --count argument: `%s'", strings.TrimPrefix(arg, "--count=")),
+				}
+			}
+			count = n
+		case strings.HasPrefix(arg, "--sort="):
+			sortKeys = append(sortKeys, strings.TrimPrefix(arg, "--sort="))
+		case strings.HasPrefix(arg, "--format="):
+			format = strings.TrimPrefix(arg, "--format=")
+		case strings.HasPrefix(arg, "--points-at="):
+			sha, err := git.ResolveRevision(repo, strings.TrimPrefix(arg, "--points-at="))
+			if err != nil {
+				return &Status{
+					exitCode: 129,
+					err:      fmt.Errorf("error: malformed object name %s", strings.TrimPrefix(arg, "--points-at=")),
+				}
+			}
+			pointsAt = sha
+		case strings.HasPrefix(arg, "-"):
+			return &Status{
+				exitCode: 129,
+				err:      fmt.Errorf("error: unknown option `%s'\n%s", arg, usage),
+			}
+		default:
+			patterns = append(patterns, arg)
+		}
+	}
+
+	allRefs, err := git.ListRefs(repo)
+	if err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
+		}
+	}
+	refs := []git.Ref{}
+	for _, ref := range allRefs {
+		matched := len(patterns) == 0
+		for _, pattern := range patterns {
+			matched = matched || git.MatchRefPattern(pattern, ref.Name)
+		}
+		if !matched {
+			continue
+		}
+		if pointsAt != "" && ref.Sha != pointsAt {
+			// An annotated tag also points at the object it tags.
+			if peeled, err := git.PeelObject(repo, ref.Sha, ""); err != nil || peeled != pointsAt {
+				continue
+			}
+		}
+		refs = append(refs, ref)
+	}
+
+	formatter := git.NewRefFormatter(repo)
+	if err := formatter.Sort(refs, sortKeys); err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
+		}
+	}
+	if count >= 0 && count < len(refs) {
+		refs = refs[:count]
+	}
+	writer := bufio.NewWriter(os.Stdout)
+	defer writer.Flush()
+	for _, ref := range refs {
+		line, err := formatter.Format(ref, format)
+		if err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", err),
+			}
+		}
+		fmt.Fprintln(writer, line)
+	}
+
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// ./your_git.sh reflog [show] [<ref>]
+// ./your_git.sh reflog expire [--expire=<time>] [--expire-unreachable=<time>] [-n] [--verbose] [--all | <ref>...]
+// ./your_git.sh reflog delete [--rewrite] [--updateref] [-n] [--verbose] <ref>@{<n>}...
+// ./your_git.sh reflog exists <ref>
+func reflogCmd(repo *git.Repository, args []string) *Status {
+	if len(args) > 0 {
+		switch args[0] {
+		case "show":
+			return reflogShowCmd(repo, args[1:])
+		case "expire":
+			return reflogExpireCmd(repo, args[1:])
+		case "delete":
+			return reflogDeleteCmd(repo, args[1:])
+		case "exists":
+			if len(args) != 2 {
+				return &Status{
+					exitCode: 129,
+					err:      fmt.Errorf("usage: reflog exists <ref>"),
+				}
+			}
+			if !git.HasReflog(repo, args[1]) {
+				return &Status{exitCode: ExitCodeError, err: nil}
+			}
+			return &Status{exitCode: ExitCodeOK, err: nil}
+		}
+	}
+	return reflogShowCmd(repo, args)
+}
+
+// Print the reflog of the ref (HEAD by default), newest first.
+func reflogShowCmd(repo *git.Repository, args []string) *Status {
+	if len(args) > 1 {
+		return &Status{
+			exitCode: 129,
+			err:      fmt.Errorf("usage: reflog [show] [<ref>]"),
+		}
+	}
+	name := "HEAD"
+	if len(args) == 1 {
+		name = args[0]
+	}
+	ref, err := git.ReflogRef(repo, name)
+	if err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
+		}
+	}
+	entries, err := git.ReadReflog(repo, ref)
+	if err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
+		}
+	}
+	for n, entry := range entries {
+		fmt.Printf("%s %s@{%d}: %s\n", git.ShortenSha(repo, entry.NewSha, 7), name, n, entry.Message)
+	}
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// Return the default dates of reflog expire from gc.reflogExpire and
+// gc.reflogExpireUnreachable.
+func reflogExpiryDates(repo *git.Repository, now time.Time) (expire, expireUnreachable time.Time, _ error) {
+	expireValue, unreachableValue := git.DefaultReflogExpire, git.DefaultReflogExpireUnreachable
+	if value, ok := git.GetConfigValue(repo, "gc.reflogExpire"); ok {
+		expireValue = value
+	}
+	if value, ok := git.GetConfigValue(repo, "gc.reflogExpireUnreachable"); ok {
+		unreachableValue = value
+	}
+	expire, err := git.ParseExpiryDate(expireValue, now)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	expireUnreachable, err = git.ParseExpiryDate(unreachableValue, now)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return expire, expireUnreachable, nil
+}
+
+// Remove the old entries from the reflogs.
+func reflogExpireCmd(repo *git.Repository, args []string) *Status {
+	usage := "usage: reflog expire [--expire=<time>] [--expire-unreachable=<time>] [-n | --dry-run] [--verbose] [--all] <refs>..."
+	now := time.Now()
+	expire, expireUnreachable, err := reflogExpiryDates(repo, now)
+	if err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
+		}
+	}
+	all, dryRun, verbose := false, false, false
+	names := []string{}
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "--expire="):
+			if expire, err = git.ParseExpiryDate(strings.TrimPrefix(arg, "--expire="), now); err != nil {
+				return &Status{
+					exitCode: 129,
+					err:      fmt.Errorf("error: %s", err),
+				}
+			}
+		case strings.HasPrefix(arg, "--expire-unreachable="):
+			if expireUnreachable, err = git.ParseExpiryDate(strings.TrimPrefix(arg, "--expire-unreachable="), now); err != nil {
+				return &Status{
+					exitCode: 129,
+					err:      fmt.Errorf("error: %s", err),
+				}
+			}
+		case arg == "--all":
+			all = true
+		case arg == "-n" || arg == "--dry-run":
+			dryRun = true
+		case arg == "--verbose":
+			verbose = true
+		case strings.HasPrefix(arg, "-"):
+			return &Status{
+				exitCode: 129,
+				err:      fmt.Errorf("error: unknown option `%s'\n%s", arg, usage),
+			}
+		default:
+			names = append(names, arg)
+		}
+	}
+
+	refs := []string{}
+	if all {
+		if refs, err = git.ListReflogs(repo); err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", err),
+			}
+		}
+	}
+	for _, name := range names {
+		ref, err := git.ReflogRef(repo, name)
+		if err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", err),
+			}
+		}
+		refs = append(refs, ref)
+	}
+
+	for _, ref := range refs {
+		expired, err := git.ExpireReflog(repo, ref, expire, expireUnreachable, dryRun)
+		if err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", err),
+			}
+		}
+		if verbose {
+			printPrunedReflogEntries(expired, dryRun)
+		}
+	}
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// Delete single entries from the reflogs.
+func reflogDeleteCmd(repo *git.Repository, args []string) *Status {
+	usage := "usage: reflog delete [--rewrite] [--updateref] [-n | --dry-run] [--verbose] <ref>@{<specifier>}..."
+	rewrite, updateRef, dryRun, verbose := false, false, false, false
+	selectors := []string{}
+	for _, arg := range args {
+		switch {
+		case arg == "--rewrite":
+			rewrite = true
+		case arg == "--updateref":
+			updateRef = true
+		case arg == "-n" || arg == "--dry-run":
+			dryRun = true
+		case arg == "--verbose":
+			verbose = true
+		case strings.HasPrefix(arg, "-"):
+			return &Status{
+				exitCode: 129,
+				err:      fmt.Errorf("error: unknown option `%s'\n%s", arg, usage),
+			}
+		default:
+			selectors = append(selectors, arg)
+		}
+	}
+	if len(selectors) == 0 {
+		return &Status{
+			exitCode: 129,
+			err:      fmt.Errorf("fatal: no reflog specified to delete"),
+		}
+	}
+
+	// The entries of each ref are deleted at once, so that the indexes
+	// refer to the reflog before any deletion.
+	refs := []string{}
+	indexes := map[string][]int{}
+	for _, selector := range selectors {
+		ref, n, err := git.ParseReflogSelector(repo, selector)
+		if err != nil {
+			return &Status{
+				exitCode: ExitCodeError,
+				err:      fmt.Errorf("error: %s", err),
+			}
+		}
+		if _, ok := indexes[ref]; !ok {
+			refs = append(refs, ref)
+		}
+		indexes[ref] = append(indexes[ref], n)
+	}
+
+	for _, ref := range refs {
+		deleted, err := git.DeleteReflogEntries(repo, ref, indexes[ref], rewrite, updateRef, dryRun)
+		if err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", err),
+			}
+		}
+		if verbose {
+			printPrunedReflogEntries(deleted, dryRun)
+		}
+	}
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+func printPrunedReflogEntries(entries []git.ReflogEntry, dryRun bool) {
+	for _, entry := range entries {
+		if dryRun {
+			fmt.Printf("would prune %s\n", entry.Message)
+		} else {
+			fmt.Printf("prune %s\n", entry.Message)
+		}
+	}
+}
+
+// ./your_git.sh branch [-l] [-v] [-a | -r] [--contains <commit>] [<pattern>...]
+// ./your_git.sh branch [-f] <name> [<start-point>]
+// ./your_git.sh branch (-m | -M) [<old>] <new>
+// ./your_git.sh branch (-d | -D) [-r] <name>...
+// ./your_git.sh branch (--set-upstream-to=<upstream> | -u <upstream>) [<name>]
+// ./your_git.sh branch --unset-upstream [<name>]
+func branchCmd(repo *git.Repository, args []string) *Status {
+	usage := "usage: branch [<options>] [-r | -a] [--contains <commit>] [<pattern>...]\n   or: branch [<options>] <branch-name> [<start-point>]\n   or: branch [<options>] (-m | -M) [<old-branch>] <new-branch>\n   or: branch [<options>] (-d | -D) [-r] <branch-name>..."
+	list, all, remotes, force := false, false, false, false
+	del, move, showCurrent, unsetUpstream := false, false, false, false
+	verbose := 0
+	upstream, hasUpstream := "", false
+	contains := ""
+	params := []string{}
+	args = splitShortOptions(args, "adDflmMrv")
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-l" || arg == "--list":
+			list = true
+		case arg == "-a" || arg == "--all":
+			all = true
+		case arg == "-r" || arg == "--remotes":
+			remotes = true
+		case arg == "-v" || arg == "--verbose":
+			verbose++
+		case arg == "-f" || arg == "--force":
+			force = true
+		case arg == "-d" || arg == "--delete":
+			del = true
+		case arg == "-D":
+			del, force = true, true
+		case arg == "-m" || arg == "--move":
+			move = true
+		case arg == "-M":
+			move, force = true, true
+		case arg == "--show-current":
+			showCurrent = true
+		case arg == "--unset-upstream":
+			unsetUpstream = true
+		case arg == "-u" && i+1 < len(args):
+			upstream, hasUpstream = args[i+1], true
+			i++
+		case strings.HasPrefix(arg, "--set-upstream-to="):
+			upstream, hasUpstream = strings.TrimPrefix(arg, "--set-upstream-to="), true
+		case arg == "--contains" && i+1 < len(args):
+			contains = args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--contains="):
+			contains = strings.TrimPrefix(arg, "--contains=")
+		case arg == "--":
+			params = append(params, args[i+1:]...)
+			i = len(args)
+		case strings.HasPrefix(arg, "-"):
+			return &Status{
+				exitCode: 129,
+				err:      fmt.Errorf("error: unknown option `%s'\n%s", arg, usage),
+			}
+		default:
+			params = append(params, arg)
+		}
+	}
+
+	switch {
+	case showCurrent:
+		current, err := git.CurrentBranch(repo)
+		if err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", err),
+			}
+		}
+		if current != "" {
+			fmt.Println(current)
+		}
+		return &Status{exitCode: ExitCodeOK, err: nil}
+	case del:
+		return deleteBranches(repo, params, remotes, force)
+	case move:
+		return renameBranch(repo, params, force)
+	case hasUpstream || unsetUpstream:
+		return setBranchUpstream(repo, params, upstream, unsetUpstream)
+	case list || len(params) == 0 || all || remotes || verbose > 0 || contains != "":
+		return listBranches(repo, params, all, remotes, verbose, contains)
+	}
+
+	if len(params) > 2 {
+		return &Status{
+			exitCode: 129,
+			err:      fmt.Errorf("%s", usage),
+		}
+	}
+	name, start := params[0], "HEAD"
+	if len(params) == 2 {
+		start = params[1]
+	}
+	startSha, err := git.ResolveRevision(repo, start)
+	if err == nil {
+		startSha, err = git.PeelObject(repo, startSha, "commit")
+	}
+	if err != nil {
+		if start == "HEAD" {
+			// The start point of an unborn branch is reported by its name.
+			if current, _ := git.CurrentBranch(repo); current != "" {
+				start = current
+			}
+		}
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: not a valid object name: '%s'", start),
+		}
+	}
+	// Branching off a remote-tracking branch tracks it (branch.autoSetupMerge).
+	// This is decided first so that a failure doesn't leave a new branch behind.
+	tracked, err := git.AutoUpstream(repo, start)
+	if err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
+		}
+	}
+	if err := git.CreateBranch(repo, name, startSha, start, force); err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
+		}
+	}
+	if tracked != "" {
+		if err := git.SetUpstream(repo, name, tracked); err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", err),
+			}
+		}
+		fmt.Printf("branch '%s' set up to track '%s'.\n", name, git.ShortenRefName(tracked))
+	}
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// Delete the branches (or remote-tracking branches with remotes). Without
+// force, a branch must be merged into HEAD.
+func deleteBranches(repo *git.Repository, names []string, remotes, force bool) *Status {
+	if len(names) == 0 {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: branch name required"),
+		}
+	}
+	results, err := git.DeleteBranches(repo, names, remotes, force)
+	if err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
+		}
+	}
+
+	errs := []string{}
+	for _, result := range results {
+		switch {
+		case result.Err != nil:
+			errs = append(errs, fmt.Sprintf("error: %s", result.Err))
+		case remotes:
+			fmt.Printf("Deleted remote-tracking branch %s (was %s).\n", result.Name, git.ShortenSha(repo, result.Sha, 7))
+		default:
+			fmt.Printf("Deleted branch %s (was %s).\n", result.Name, git.ShortenSha(repo, result.Sha, 7))
+		}
+	}
+	if len(errs) > 0 {
+		return &Status{
+			exitCode: ExitCodeError,
+			err:      fmt.Errorf("%s", strings.Join(errs, "\n")),
+		}
+	}
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// Rename the branch old (the current branch by default) to new.
+func renameBranch(repo *git.Repository, params []string, force bool) *Status {
+	if len(params) == 0 || len(params) > 2 {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: branch name required"),
+		}
+	}
+	oldName, newName := "", params[len(params)-1]
+	if len(params) == 2 {
+		oldName = params[0]
+	} else {
+		current, err := git.CurrentBranch(repo)
+		if err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", err),
+			}
+		}
+		if current == "" {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: cannot rename the current branch while not on any."),
+			}
+		}
+		oldName = current
+	}
+	if err := git.RenameBranch(repo, oldName, newName, force); err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
+		}
+	}
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// Set or unset the upstream of the branch (the current branch by default).
+func setBranchUpstream(repo *git.Repository, params []string, upstream string, unset bool) *Status {
+	if len(params) > 1 {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: too many arguments to set new upstream"),
+		}
+	}
+	name := ""
+	if len(params) == 1 {
+		name = params[0]
+	} else {
+		current, err := git.CurrentBranch(repo)
+		if err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", err),
+			}
+		}
+		if current == "" {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: could not set upstream of HEAD when it does not point to any branch."),
+			}
+		}
+		name = current
+	}
+	if sha, _ := git.ResolveRevision(repo, "refs/heads/"+name); sha == "" {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: branch '%s' does not exist", name),
+		}
+	}
+
+	if unset {
+		found, err := git.UnsetUpstream(repo, name)
+		if err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", err),
+			}
+		}
+		if !found {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: Branch '%s' has no upstream information", name),
+			}
+		}
+		return &Status{exitCode: ExitCodeOK, err: nil}
+	}
+
+	ref, _, err := git.DwimRef(repo, upstream)
+	if err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
+		}
+	}
+	if !strings.HasPrefix(ref, "refs/heads/") && !strings.HasPrefix(ref, "refs/remotes/") {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: the requested upstream branch '%s' does not exist", upstream),
+		}
+	}
+	if err := git.SetUpstream(repo, name, ref); err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
+		}
+	}
+	fmt.Printf("branch '%s' set up to track '%s'.\n", name, git.ShortenRefName(ref))
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// List the local branches, the remote-tracking branches with remotes or both
+// with all. Patterns filter the names as shown.
+func listBranches(repo *git.Repository, patterns []string, all, remotes bool, verbose int, contains string) *Status {
+	containsSha := ""
+	if contains != "" {
+		sha, err := git.ResolveRevision(repo, contains)
+		if err == nil {
+			sha, err = git.PeelObject(repo, sha, "commit")
+		}
+		if err != nil {
+			return &Status{
+				exitCode: 129,
+				err:      fmt.Errorf("error: malformed object name %s", contains),
+			}
+		}
+		containsSha = sha
+	}
+	branches, err := git.ListBranches(repo, patterns, all, remotes, containsSha)
+	if err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
+		}
+	}
+
+	width := 0
+	for _, branch := range branches {
+		if len(branch.Name) > width {
+			width = len(branch.Name)
+		}
+	}
+	for _, branch := range branches {
+		prefix := "  "
+		if branch.Current {
+			prefix = "* "
+		}
+		if branch.Ref.Target != "" {
+			fmt.Printf("%s%s -> %s\n", prefix, branch.Name, git.ShortenRefName(branch.Ref.Target))
+			continue
+		}
+		if verbose == 0 {
+			fmt.Printf("%s%s\n", prefix, branch.Name)
+			continue
+		}
+		commit, err := git.ReadCommit(repo, branch.Ref.Sha)
+		if err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", err),
+			}
+		}
+		tracking, err := branchTracking(repo, branch.Ref.Name, verbose > 1)
+		if err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", err),
+			}
+		}
+		fmt.Printf("%s%-*s %s %s%s\n", prefix, width, branch.Name, git.ShortenSha(repo, branch.Ref.Sha, 7), tracking, commit.Subject())
+	}
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// Describe how the branch relates to its upstream for branch -v, e.g.
+// "[ahead 1, behind 2] ", or "[origin/main: ahead 1] " with showUpstream.
+// It is "" for a branch without upstream.
+func branchTracking(repo *git.Repository, ref string, showUpstream bool) (string, error) {
+	tracking, err := git.BranchTracking(repo, ref)
+	if tracking == nil {
+		return "", err
+	}
+	counts := []string{}
+	if tracking.Gone {
+		counts = append(counts, "gone")
+	}
+	if tracking.Ahead > 0 {
+		counts = append(counts, fmt.Sprintf("ahead %d", tracking.Ahead))
+	}
+	if tracking.Behind > 0 {
+		counts = append(counts, fmt.Sprintf("behind %d", tracking.Behind))
+	}
+	upstream := git.ShortenRefName(tracking.Upstream)
+	switch {
+	case showUpstream && len(counts) == 0:
+		return fmt.Sprintf("[%s] ", upstream), nil
+	case showUpstream:
+		return fmt.Sprintf("[%s: %s] ", upstream, strings.Join(counts, ", ")), nil
+	case len(counts) == 0:
+		return "", nil
+	}
+	return fmt.Sprintf("[%s] ", strings.Join(counts, ", ")), nil
+}
+
+// Split combined short options such as "-dr" into "-d" "-r" when all the
+// letters are flags without a value. Everything after "--" is kept as is.
+func splitShortOptions(args []string, flags string) []string {
+	split := []string{}
+	for i, arg := range args {
+		if arg == "--" {
+			return append(split, args[i:]...)
+		}
+		combined := len(arg) > 2 && arg[0] == '-' && arg[1] != '-'
+		for _, c := range arg[1:] {
+			combined = combined && strings.ContainsRune(flags, c)
+		}
+		if !combined {
+			split = append(split, arg)
+			continue
+		}
+		for _, c := range arg[1:] {
+			split = append(split, "-"+string(c))
+		}
+	}
+	return split
+}
+
+// Options of checkout and switch when moving HEAD.
+type switchOptions struct {
+	force        bool // discard local changes
+	quiet        bool
+	detachAdvice bool // explain the detached HEAD state
+}
+
+// ./your_git.sh checkout [-q] [-f] <branch>
+// ./your_git.sh checkout [-q] [-f] [--detach] <commit>
+// ./your_git.sh checkout [-q] [-f] (-b | -B) <new-branch> [<start-point>]
+// ./your_git.sh checkout [<tree-ish>] [--] <paths>...
+func checkoutCmd(repo *git.Repository, args []string) *Status {
+	usage := "usage: checkout [<options>] <branch>\n   or: checkout [<options>] [<branch>] -- <file>..."
+	opts := switchOptions{detachAdvice: true}
+	newBranch, forceCreate, detach := "", false, false
+	params, paths, hasPaths := []string{}, []string{}, false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-q" || arg == "--quiet":
+			opts.quiet = true
+		case arg == "-f" || arg == "--force":
+			opts.force = true
+		case arg == "--detach":
+			detach = true
+		case (arg == "-b" || arg == "-B") && i+1 < len(args):
+			newBranch, forceCreate = args[i+1], arg == "-B"
+			i++
+		case arg == "--":
+			paths, hasPaths = args[i+1:], true
+			i = len(args)
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			return &Status{
+				exitCode: 129,
+				err:      fmt.Errorf("error: unknown option `%s'\n%s", arg, usage),
+			}
+		default:
+			params = append(params, arg)
+		}
+	}
+
+	// checkout [<tree-ish>] -- <paths>, or checkout <paths> when the first
+	// argument is not a revision.
+	dashDash := hasPaths
+	if !hasPaths && newBranch == "" && !detach && len(params) > 0 {
+		if _, err := git.ResolveRevision(repo, params[0]); err != nil && params[0] != "-" && git.UniqueRemoteBranch(repo, params[0]) == "" {
+			paths, hasPaths, params = params, true, nil
+		} else if len(params) > 1 {
+			paths, hasPaths, params = params[1:], true, params[:1]
+		}
+	}
+	if hasPaths {
+		if newBranch != "" || detach || len(params) > 1 {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: '-b' and '--detach' cannot be used with updating paths"),
+			}
+		}
+		source := ""
+		if len(params) == 1 {
+			source = params[0]
+		}
+		return checkoutPaths(repo, source, paths, !opts.quiet && !dashDash)
+	}
+
+	if len(params) > 1 {
+		return &Status{
+			exitCode: 129,
+			err:      fmt.Errorf("%s", usage),
+		}
+	}
+	if newBranch != "" {
+		start := "HEAD"
+		if len(params) == 1 {
+			start = params[0]
+		}
+		target, err := git.NewBranchTarget(repo, newBranch, start, forceCreate)
+		if err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", err),
+			}
+		}
+		return switchTo(repo, target, opts)
+	}
+	if len(params) == 0 {
+		if !detach {
+			// Nothing to switch to.
+			return &Status{exitCode: ExitCodeOK, err: nil}
+		}
+		params = []string{"HEAD"}
+	}
+	if detach {
+		opts.detachAdvice = false
+	}
+
+	target, err := git.ResolveSwitchTarget(repo, params[0], detach)
+	if err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
+		}
+	}
+	return switchTo(repo, target, opts)
+}
+
+// ./your_git.sh switch [-q] [-f] <branch>
+// ./your_git.sh switch [-q] [-f] (-c | -C) <new-branch> [<start-point>]
+// ./your_git.sh switch [-q] [-f] --detach [<start-point>]
+func switchCmd(repo *git.Repository, args []string) *Status {
+	usage := "usage: switch [<options>] [<branch>]"
+	opts := switchOptions{}
+	newBranch, forceCreate, detach := "", false, false
+	params := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-q" || arg == "--quiet":
+			opts.quiet = true
+		case arg == "-f" || arg == "--force" || arg == "--discard-changes":
+			opts.force = true
+		case arg == "-d" || arg == "--detach":
+			detach = true
+		case (arg == "-c" || arg == "-C" || arg == "--create" || arg == "--force-create") && i+1 < len(args):
+			newBranch, forceCreate = args[i+1], arg == "-C" || arg == "--force-create"
+			i++
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			return &Status{
+				exitCode: 129,
+				err:      fmt.Errorf("error: unknown option `%s'\n%s", arg, usage),
+			}
+		default:
+			params = append(params, arg)
+		}
+	}
+	if len(params) > 1 || len(params) == 0 && newBranch == "" && !detach {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: missing branch or commit argument\n%s", usage),
+		}
+	}
+
+	if newBranch != "" {
+		start := "HEAD"
+		if len(params) == 1 {
+			start = params[0]
+		}
+		target, err := git.NewBranchTarget(repo, newBranch, start, forceCreate)
+		if err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", err),
+			}
+		}
+		return switchTo(repo, target, opts)
+	}
+	if len(params) == 0 {
+		params = []string{"HEAD"}
+	}
+	target, err := git.ResolveSwitchTarget(repo, params[0], detach)
+	if err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
+		}
+	}
+	if target.Branch == "" && !detach {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: a branch is expected, got commit '%s'\nhint: If you want to detach HEAD at the commit, try again with the --detach option.", params[0]),
+		}
+	}
+	return switchTo(repo, target, opts)
+}
+
+// Switch to the target like git.Switch, printing what happened like git.
+func switchTo(repo *git.Repository, target git.SwitchTarget, opts switchOptions) *Status {
+	result, err := git.Switch(repo, target, opts.force)
+	if _, ok := err.(*git.CheckoutConflictError); ok {
+		return &Status{
+			exitCode: ExitCodeError,
+			err:      fmt.Errorf("error: %s", err),
+		}
+	} else if err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
+		}
+	}
+
+	if !opts.quiet {
+		if result.Upstream != "" {
+			fmt.Printf("branch '%s' set up to track '%s'.\n", target.Branch, git.ShortenRefName(result.Upstream))
+		}
+		describe := func(sha string) string {
+			subject := ""
+			if commit, err := git.ReadCommit(repo, sha); err == nil {
+				subject = commit.Subject()
+			}
+			return git.ShortenSha(repo, sha, 7) + " " + subject
+		}
+		if result.OldRef == "" && result.OldSha != "" && result.OldSha != target.Sha {
+			fmt.Fprintf(os.Stderr, "Previous HEAD position was %s\n", describe(result.OldSha))
+		}
+		switch {
+		case target.Branch == "":
+			if result.OldRef != "" && opts.detachAdvice {
+				advice, _ := git.GetConfigValue(repo, "advice.detachedHead")
+				if advice != "false" {
+					fmt.Fprintf(os.Stderr, "Note: switching to '%s'.\n\n%s\n", target.Name, detachedHeadAdvice)
+				}
+			}
+			fmt.Fprintf(os.Stderr, "HEAD is now at %s\n", describe(target.Sha))
+		case "refs/heads/"+target.Branch == result.OldRef && !target.Create:
+			fmt.Fprintf(os.Stderr, "Already on '%s'\n", target.Branch)
+		case result.ResetCurrent:
+			fmt.Fprintf(os.Stderr, "Reset branch '%s'\n", target.Branch)
+		case result.Reset:
+			fmt.Fprintf(os.Stderr, "Switched to and reset branch '%s'\n", target.Branch)
+		case target.Create || target.Sha == "":
+			fmt.Fprintf(os.Stderr, "Switched to a new branch '%s'\n", target.Branch)
+		default:
+			fmt.Fprintf(os.Stderr, "Switched to branch '%s'\n", target.Branch)
+		}
+	}
+
+	// Show the local changes which were carried over.
+	if !opts.quiet && !opts.force {
+		status, err := git.GetStatus(repo)
+		if err == nil {
+			for _, c := range status.Changes {
+				letter := c.Unstaged
+				if letter == ' ' {
+					letter = c.Staged
+				}
+				fmt.Printf("%c\t%s\n", letter, relativePath(repo, c.Name))
+			}
+		}
+	}
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+const detachedHeadAdvice = `You are in 'detached HEAD' state. You can look around, make experimental
+changes and commit them, and you can discard any commits you make in this
+state without impacting any branches by switching back to a branch.
+
+If you want to create a new branch to retain commits you create, you may
+do so (now or later) by using -c with the switch command. Example:
+
+  git switch -c <new-branch-name>
+
+Or undo this operation with:
+
+  git switch -
+
+Turn off this advice by setting config variable advice.detachedHead to false
+`
+
+// Restore the paths from the index, or from the commit or tree source (which
+// also updates the index). With report the number of restored files is shown.
+func checkoutPaths(repo *git.Repository, source string, paths []string, report bool) *Status {
+	treeSha := ""
+	if source != "" {
+		sha, err := git.ResolveRevision(repo, source)
+		if err == nil {
+			sha, err = git.PeelObject(repo, sha, "tree")
+		}
+		if err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: invalid reference: %s", source),
+			}
+		}
+		treeSha = sha
+	}
+	names := []string{}
+	for _, p := range paths {
+		name, err := git.NormalizePath(repo, p)
+		if err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", err),
+			}
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: you must specify path(s) to restore"),
+		}
+	}
+	count, err := git.CheckoutPaths(repo, treeSha, names)
+	if err != nil {
+		return &Status{
+			exitCode: ExitCodeError,
+			err:      fmt.Errorf("error: %s", err),
+		}
+	}
+	if report {
+		from := "the index"
+		if treeSha != "" {
+			from = git.ShortenSha(repo, treeSha, 7)
+		}
+		noun := "paths"
+		if count == 1 {
+			noun = "path"
+		}
+		fmt.Fprintf(os.Stderr, "Updated %d %s from %s\n", count, noun, from)
+	}
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// ./your_git.sh reset [--soft | --mixed | --hard | --keep] [-q] [<commit>]
+// ./your_git.sh reset [-q] [<tree-ish>] [--] <paths>...
+func resetCmd(repo *git.Repository, args []string) *Status {
+	usage := "usage: reset [--mixed | --soft | --hard | --keep] [-q] [<commit>]\n   or: reset [-q] [<tree-ish>] [--] <pathspec>..."
+	mode, modeName, quiet := git.ResetMixed, "", false
+	params, paths, dashDash := []string{}, []string{}, false
+	for i, arg := range args {
+		if arg == "--" {
+			paths, dashDash = args[i+1:], true
+			break
+		}
+		switch arg {
+		case "--soft":
+			mode, modeName = git.ResetSoft, "soft"
+		case "--mixed":
+			mode, modeName = git.ResetMixed, "mixed"
+		case "--hard":
+			mode, modeName = git.ResetHard, "hard"
+		case "--keep":
+			mode, modeName = git.ResetKeep, "keep"
+		case "-q", "--quiet":
+			quiet = true
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return &Status{
+					exitCode: 129,
+					err:      fmt.Errorf("error: unknown option `%s'\n%s", strings.TrimLeft(arg, "-"), usage),
+				}
+			}
+			params = append(params, arg)
+		}
+	}
+
+	// The first argument is the commit unless it is a path, the others are
+	// paths.
+	rev := "HEAD"
+	if len(params) > 0 {
+		if _, err := git.ResolveRevision(repo, params[0]); err == nil || dashDash {
+			rev, params = params[0], params[1:]
+		} else if _, err := os.Lstat(params[0]); err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: ambiguous argument '%s': unknown revision or path not in the working tree.\nUse '--' to separate paths from revisions, like this:\n'git <command> [<revision>...] -- [<file>...]'", params[0]),
+			}
+		}
+		paths = append(params, paths...)
+	}
+	pathMode := len(paths) > 0 || dashDash
+	if pathMode && (mode == git.ResetSoft || mode == git.ResetHard || mode == git.ResetKeep) {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: Cannot do %s reset with paths.", modeName),
+		}
+	}
+	if pathMode && modeName == "mixed" {
+		fmt.Fprintln(os.Stderr, "warning: --mixed with paths is deprecated; use 'git reset -- <paths>' instead.")
+	}
+	// Only the branch can be moved without a working tree.
+	if repo.WorkTree == "" && mode != git.ResetSoft {
+		if modeName == "" {
+			modeName = "mixed"
+		}
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s reset is not allowed in a bare repository", modeName),
+		}
+	}
+
+	// HEAD may be unborn, then the index is reset to the empty tree.
+	sha, err := git.ResolveRevision(repo, rev)
+	if err == nil {
+		sha, err = git.PeelObject(repo, sha, "commit")
+	}
+	if err != nil {
+		if _, headSha, _ := git.ReadHead(repo); rev != "HEAD" || headSha != "" {
+			kind := "revision"
+			if pathMode {
+				kind = "tree"
+			}
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: Failed to resolve '%s' as a valid %s.", rev, kind),
+			}
+		}
+	}
+
+	switch {
+	case pathMode:
+		names := []string{}
+		for _, p := range paths {
+			name, err := git.NormalizePath(repo, p)
+			if err != nil {
+				return &Status{
+					exitCode: 128,
+					err:      fmt.Errorf("fatal: %s", err),
+				}
+			}
+			names = append(names, name)
+		}
+		treeSha := ""
+		if sha != "" {
+			if treeSha, err = git.ReadCommitTree(repo, sha); err != nil {
+				return &Status{
+					exitCode: 128,
+					err:      fmt.Errorf("fatal: %s", err),
+				}
+			}
+		}
+		err = git.ResetIndex(repo, treeSha, names)
+	case sha == "":
+		err = git.ResetIndex(repo, "", nil)
+	default:
+		err = git.Reset(repo, sha, mode, "reset: moving to "+rev)
+	}
+	if err != nil {
+		if _, ok := err.(*git.CheckoutConflictError); ok {
+			conflict := err.(*git.CheckoutConflictError)
+			file := append(conflict.Modified, conflict.Untracked...)[0]
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("error: Entry '%s' not uptodate. Cannot merge.\nfatal: Could not reset index file to revision '%s'.", file, rev),
+			}
+		}
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
+		}
+	}
+
+	if quiet || mode == git.ResetSoft || mode == git.ResetKeep {
+		return &Status{
+			exitCode: ExitCodeOK,
+			err:      nil,
+		}
+	}
+	if mode == git.ResetHard {
+		subject := ""
+		if commit, err := git.ReadCommit(repo, sha); err == nil {
+			subject = commit.Subject()
+		}
+		fmt.Printf("HEAD is now at %s %s\n", git.ShortenSha(repo, sha, 7), subject)
+		return &Status{
+			exitCode: ExitCodeOK,
+			err:      nil,
+		}
+	}
+	status, err := git.GetStatus(repo)
+	if err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
+		}
+	}
+	header := "Unstaged changes after reset:\n"
+	for _, c := range status.Changes {
+		if c.Unstaged == ' ' {
+			continue
+		}
+		fmt.Printf("%s%c\t%s\n", header, c.Unstaged, relativePath(repo, c.Name))
+		header = ""
+	}
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// ./your_git.sh check-ignore [-q] [-v [-n]] [--no-index] (--stdin | <path>...)
+func checkIgnoreCmd(repo *git.Repository, args []string) *Status {
+	quiet, verbose, nonMatching, noIndex, stdin := false, false, false, false, false
+	paths := []string{}
+	for i, arg := range args {
+		if arg == "--" {
+			paths = append(paths, args[i+1:]...)
+			break
+		}
+		switch arg {
+		case "-q", "--quiet":
+			quiet = true
+		case "-v", "--verbose":
+			verbose = true
+		case "-n", "--non-matching":
+			nonMatching = true
+		case "--no-index":
+			noIndex = true
+		case "--stdin":
+			stdin = true
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return &Status{
+					exitCode: 129,
+					err:      fmt.Errorf("error: unknown option `%s'\nusage: check-ignore [<options>] <pathname>...\n   or: check-ignore [<options>] --stdin", strings.TrimLeft(arg, "-")),
+				}
+			}
+			paths = append(paths, arg)
+		}
+	}
+	switch {
+	case stdin && len(paths) > 0:
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: cannot specify pathnames with --stdin"),
+		}
+	case quiet && verbose:
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: cannot have both --quiet and --verbose"),
+		}
+	case nonMatching && !verbose:
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: --non-matching is only valid with --verbose"),
+		}
+	}
+	if stdin {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			paths = append(paths, scanner.Text())
+		}
+	}
+	if len(paths) == 0 {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: no path specified"),
+		}
+	}
+
+	idx := &git.Index{}
+	if !noIndex {
+		var err error
+		if idx, err = git.ReadIndex(repo); err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", err),
+			}
+		}
+	}
+	ignore, err := git.NewIgnoreMatcher(repo)
+	if err != nil {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: %s", err),
+		}
+	}
+
+	ignored := false
+	for _, arg := range paths {
+		name, err := git.NormalizePath(repo, arg)
+		if err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", err),
+			}
+		}
+		// Tracked files are not subject to the ignore rules.
+		var pattern *git.IgnorePattern
+		if _, tracked := idx.Find(name); !tracked {
+			isDir := strings.HasSuffix(arg, "/")
+			if info, err := os.Lstat(arg); err == nil {
+				isDir = isDir || info.IsDir()
+			}
+			if pattern, err = ignore.Match(name, isDir); err != nil {
+				return &Status{
+					exitCode: 128,
+					err:      fmt.Errorf("fatal: %s", err),
+				}
+			}
+		}
+		if pattern != nil && !pattern.Negated {
+			ignored = true
+		}
+		switch {
+		case quiet:
+		case verbose && pattern != nil:
+			fmt.Printf("%s:%d:%s\t%s\n", pattern.Source, pattern.Line, pattern.Text, arg)
+		case verbose && nonMatching:
+			fmt.Printf("::\t%s\n", arg)
+		case pattern != nil && !pattern.Negated:
+			fmt.Println(arg)
+		}
+	}
+
+	if !ignored {
+		return &Status{
+			exitCode: ExitCodeError,
+			err:      nil,
+		}
+	}
+	return &Status{
+		exitCode: ExitCodeOK,
+		err:      nil,
+	}
+}
+
+// ./your_git.sh clean [-n] [-f] [-d] [-x | -X] [-q] [--] [<path>...]
+func cleanCmd(repo *git.Repository, args []string) *Status {
+	usage := "usage: clean [-d] [-f] [-n] [-q] [-x | -X] [--] <pathspec>..."
+	opts := git.CleanOptions{}
+	force, quiet := false, false
+	paths := []string{}
+	args = splitShortOptions(args, "dfnqxX")
+	for i, arg := range args {
+		if arg == "--" {
+			paths = append(paths, args[i+1:]...)
+			break
+		}
+		switch arg {
+		case "-n", "--dry-run":
+			opts.DryRun = true
+		case "-f", "--force":
+			force = true
+		case "-d":
+			opts.Directories = true
+		case "-x":
+			opts.Ignored = true
+		case "-X":
+			opts.OnlyIgnored = true
+		case "-q", "--quiet":
+			quiet = true
+		default:
+			if strings.HasPrefix(arg, "-") {
+				return &Status{
+					exitCode: 129,
+					err:      fmt.Errorf("error: unknown option `%s'\n%s", strings.TrimLeft(arg, "-"), usage),
+				}
+			}
+			paths = append(paths, arg)
+		}
+	}
+	if opts.Ignored && opts.OnlyIgnored {
+		return &Status{
+			exitCode: 128,
+			err:      fmt.Errorf("fatal: -x and -X cannot be used together"),
+		}
+	}
+	if !force && !opts.DryRun {
+		if requireForce, _ := git.GetConfigValue(repo, "clean.requireForce"); requireForce != "false" {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: clean.requireForce defaults to true and neither -i, -n, nor -f given; refusing to clean"),
+			}
+		}
+	}
+
+	// Without paths only the current directory is cleaned.
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	names := []string{}
+	for _, p := range paths {
+		name, err := git.NormalizePath(repo, p)
+		if err != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", err),
+			}
+		}
+		names = append(names, name)
+	}
+
+	removed, err := git.Clean(repo, names, opts)
+	if err != nil {
+		return &Status{
+			exitCode: ExitCodeError,
+			err:      fmt.Errorf("error: %s", err),
+		}
+	}
+	if !quiet {
+		verb := "Removing"
+		if opts.DryRun {
+			verb = "Would remove"
+		}
+		for _, name := range removed {
+			display := relativePath(repo, strings.TrimSuffix(name, "/"))
+			if strings.HasSuffix(name, "/") {
+				display += "/"
+			}
+			fmt.Printf("%s %s\n", verb, display)
+		}
+	}
 	return &Status{
 		exitCode: ExitCodeOK,
 		err:      nil,
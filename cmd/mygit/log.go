@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/git"
+)
+
+// Format the commit with the built-in pretty format (oneline, short, medium, full).
+func formatCommitPretty(c *git.Commit, pretty string) string {
+	var b strings.Builder
+	switch pretty {
+	case "oneline":
+		fmt.Fprintf(&b, "%s %s\n", c.Sha, c.Subject())
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "commit %s\n", c.Sha)
+	if len(c.Parents) > 1 {
+		shorts := []string{}
+		for _, parent := range c.Parents {
+			shorts = append(shorts, parent[:7])
+		}
+		fmt.Fprintf(&b, "Merge: %s\n", strings.Join(shorts, " "))
+	}
+	if pretty == "fuller" {
+		fmt.Fprintf(&b, "Author:     %s <%s>\n", c.Author.Name, c.Author.Email)
+	} else {
+		fmt.Fprintf(&b, "Author: %s <%s>\n", c.Author.Name, c.Author.Email)
+	}
+	switch pretty {
+	case "medium":
+		fmt.Fprintf(&b, "Date:   %s\n", c.Author.When.Format(git.DateLayout))
+	case "full":
+		fmt.Fprintf(&b, "Commit: %s <%s>\n", c.Committer.Name, c.Committer.Email)
+	case "fuller":
+		fmt.Fprintf(&b, "AuthorDate: %s\n", c.Author.When.Format(git.DateLayout))
+		fmt.Fprintf(&b, "Commit:     %s <%s>\n", c.Committer.Name, c.Committer.Email)
+		fmt.Fprintf(&b, "CommitDate: %s\n", c.Committer.When.Format(git.DateLayout))
+	}
+	b.WriteString("\n")
+
+	message := strings.TrimRight(c.Message, "\n")
+	if pretty == "short" {
+		// only the first paragraph
+		message = strings.SplitN(strings.TrimLeft(message, "\n"), "\n\n", 2)[0]
+	}
+	for _, line := range strings.Split(message, "\n") {
+		fmt.Fprintf(&b, "    %s\n", line)
+	}
+	return b.String()
+}
+
+// Expand the placeholders of --format.
+// ref: https://git-scm.com/docs/pretty-formats
+func formatCommit(c *git.Commit, format string) string {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 >= len(format) {
+			b.WriteByte(format[i])
+			continue
+		}
+		i++
+		switch format[i] {
+		case '%':
+			b.WriteByte('%')
+		case 'n':
+			b.WriteByte('\n')
+		case 'H':
+			b.WriteString(c.Sha)
+		case 'h':
+			b.WriteString(c.Sha[:7])
+		case 'T':
+			b.WriteString(c.Tree)
+		case 't':
+			b.WriteString(c.Tree[:7])
+		case 'P':
+			b.WriteString(strings.Join(c.Parents, " "))
+		case 'p':
+			shorts := []string{}
+			for _, parent := range c.Parents {
+				shorts = append(shorts, parent[:7])
+			}
+			b.WriteString(strings.Join(shorts, " "))
+		case 's':
+			b.WriteString(c.Subject())
+		case 'b':
+			b.WriteString(c.Body())
+		case 'B':
+			b.WriteString(c.Message)
+		case 'a', 'c':
+			sig := c.Author
+			if format[i] == 'c' {
+				sig = c.Committer
+			}
+			if i+1 >= len(format) {
+				b.WriteByte('%')
+				b.WriteByte(format[i])
+				continue
+			}
+			i++
+			switch format[i] {
+			case 'n':
+				b.WriteString(sig.Name)
+			case 'e':
+				b.WriteString(sig.Email)
+			case 'd':
+				b.WriteString(sig.When.Format(git.DateLayout))
+			case 't':
+				fmt.Fprintf(&b, "%d", sig.When.Unix())
+			case 'i':
+				b.WriteString(sig.When.Format("2006-01-02 15:04:05 -0700"))
+			case 'I':
+				b.WriteString(sig.When.Format("2006-01-02T15:04:05-07:00"))
+			case 's':
+				b.WriteString(sig.When.Format("2006-01-02"))
+			default:
+				// unknown placeholders are printed as is
+				b.WriteString(format[i-2 : i+1])
+			}
+		default:
+			b.WriteString(format[i-1 : i+1])
+		}
+	}
+	return b.String()
+}
@@ -3,11 +3,17 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/git"
 )
 
 var ExitCodeOK int = 0
 var ExitCodeError int = 1
 
+const usage = "usage: mygit [-C <path>] [--git-dir=<path>] [--work-tree=<path>] <command> [<args>...]"
+
 type Status struct {
 	exitCode int
 	err      error
@@ -16,39 +22,150 @@ type Status struct {
 // Usage: your_git.sh <command> <arg1> <arg2> ...
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "usage: mygit <command> [<args>...]\n")
+		fmt.Fprintf(os.Stderr, "%s\n", usage)
 		os.Exit(1)
 	}
-	if status := run(os.Args[1:]); status.err != nil {
+	status := run(os.Args[1:])
+	if status.err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", status.err)
-		os.Exit(1)
 	}
+	os.Exit(status.exitCode)
 }
 
 func run(args []string) *Status {
-	var result *Status
+	args, status := parseGlobalOptions(args)
+	if status != nil {
+		return status
+	}
+	if len(args) == 0 {
+		return &Status{
+			exitCode: 129,
+			err:      fmt.Errorf("%s", usage),
+		}
+	}
+
+	// The repository is looked up once for all commands. Commands which work
+	// outside a repository get a nil repo.
+	repo, repoErr := git.DiscoverRepository(".")
+	withRepo := func(cmd func(*git.Repository, []string) *Status) *Status {
+		if repoErr != nil {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: %s", repoErr),
+			}
+		}
+		return cmd(repo, args[1:])
+	}
+	withWorkTree := func(cmd func(*git.Repository, []string) *Status) *Status {
+		if repoErr == nil && repo.WorkTree == "" {
+			return &Status{
+				exitCode: 128,
+				err:      fmt.Errorf("fatal: this operation must be run in a work tree"),
+			}
+		}
+		return withRepo(cmd)
+	}
+	if repoErr != nil {
+		repo = nil
+	}
 
-	switch command := os.Args[1]; command {
+	var result *Status
+	switch command := args[0]; command {
 	case "init":
-		result = initCmd(".")
+		result = initCmd(args[1:])
 
 	case "cat-file":
-		result = catFileCmd()
+		result = withRepo(catFileCmd)
 
 	case "hash-object":
-		result = hashObjectCmd()
+		result = hashObjectCmd(repo, args[1:])
 
 	case "ls-tree":
-		result = lsTreeCmd()
+		result = withRepo(lsTreeCmd)
 
 	case "write-tree":
-		result = writeTreeCmd()
+		result = withRepo(writeTreeCmd)
 
 	case "commit-tree":
-		result = createCommitCmd()
+		result = withRepo(createCommitCmd)
 
 	case "clone":
-		result = cloneCmd()
+		result = cloneCmd(args[1:])
+
+	case "add":
+		result = withWorkTree(addCmd)
+
+	case "rm":
+		result = withWorkTree(rmCmd)
+
+	case "ls-files":
+		result = withWorkTree(lsFilesCmd)
+
+	case "status":
+		result = withWorkTree(statusCmd)
+
+	case "commit":
+		result = withWorkTree(commitCmd)
+
+	case "config":
+		result = configCmd(repo, args[1:])
+
+	case "log":
+		result = withRepo(logCmd)
+
+	case "rev-parse":
+		result = withRepo(revParseCmd)
+
+	case "index-pack":
+		result = indexPackCmd(repo, args[1:])
+
+	case "pack-objects":
+		result = withRepo(packObjectsCmd)
+
+	case "repack":
+		result = withRepo(repackCmd)
+
+	case "pack-refs":
+		result = withRepo(packRefsCmd)
+
+	case "prune":
+		result = withRepo(pruneCmd)
+
+	case "gc":
+		result = withRepo(gcCmd)
+
+	case "update-ref":
+		result = withRepo(updateRefCmd)
+
+	case "symbolic-ref":
+		result = withRepo(symbolicRefCmd)
+
+	case "show-ref":
+		result = withRepo(showRefCmd)
+
+	case "for-each-ref":
+		result = withRepo(forEachRefCmd)
+
+	case "reflog":
+		result = withRepo(reflogCmd)
+
+	case "branch":
+		result = withRepo(branchCmd)
+
+	case "checkout":
+		result = withWorkTree(checkoutCmd)
+
+	case "switch":
+		result = withWorkTree(switchCmd)
+
+	case "reset":
+		result = withRepo(resetCmd)
+
+	case "check-ignore":
+		result = withWorkTree(checkIgnoreCmd)
+
+	case "clean":
+		result = withWorkTree(cleanCmd)
 
 	default:
 		return &Status{
@@ -62,3 +179,132 @@ func run(args []string) *Status {
 		err:      result.err,
 	}
 }
+
+// Handle the options before the command and return the remaining arguments:
+// -C <path> changes the directory (relative to the previous -C), and
+// --git-dir and --work-tree are passed on as GIT_DIR and GIT_WORK_TREE.
+func parseGlobalOptions(args []string) ([]string, *Status) {
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		option, value, hasValue := args[0], "", false
+		if eq := strings.Index(option, "="); eq >= 0 && strings.HasPrefix(option, "--") {
+			option, value, hasValue = option[:eq], option[eq+1:], true
+		}
+		switch option {
+		case "-C", "--git-dir", "--work-tree":
+		default:
+			return nil, &Status{
+				exitCode: 129,
+				err:      fmt.Errorf("unknown option: %s\n%s", args[0], usage),
+			}
+		}
+		args = args[1:]
+		if !hasValue {
+			if len(args) == 0 {
+				return nil, &Status{
+					exitCode: 129,
+					err:      fmt.Errorf("no directory given for %s", option),
+				}
+			}
+			value, args = args[0], args[1:]
+		}
+
+		switch option {
+		case "-C":
+			// An empty path is ignored like in git.
+			if value == "" {
+				continue
+			}
+			if err := os.Chdir(value); err != nil {
+				if pathErr, ok := err.(*os.PathError); ok {
+					err = pathErr.Err
+				}
+				return nil, &Status{
+					exitCode: 128,
+					err:      fmt.Errorf("fatal: cannot change to '%s': %s", value, err),
+				}
+			}
+		case "--git-dir":
+			os.Setenv("GIT_DIR", value)
+		case "--work-tree":
+			os.Setenv("GIT_WORK_TREE", value)
+		}
+	}
+	return args, nil
+}
+
+// Return the path of the current directory in the working tree with a
+// trailing slash ("" at the top). inside is false if the current directory is
+// not in the working tree or is in the git directory.
+func workTreePrefix(repo *git.Repository) (prefix string, inside bool) {
+	if repo.WorkTree == "" || isInsideDir(repo.GitDir) {
+		return "", false
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", false
+	}
+	top, err := filepath.Abs(repo.WorkTree)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(top, cwd)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	if rel == "." {
+		return "", true
+	}
+	return filepath.ToSlash(rel) + "/", true
+}
+
+// Report whether the current directory is dir or under it.
+func isInsideDir(dir string) bool {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return false
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(abs, cwd)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Return the git directory as git rev-parse --git-dir shows it: as given by
+// GIT_DIR, relative if it is the current directory or its .git, otherwise
+// absolute.
+func displayGitDir(repo *git.Repository) string {
+	if env := os.Getenv("GIT_DIR"); env != "" {
+		return env
+	}
+	gitDir, err := filepath.Abs(repo.GitDir)
+	if err != nil {
+		return repo.GitDir
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(cwd, gitDir); err == nil && (rel == "." || rel == ".git") {
+			return rel
+		}
+	}
+	return gitDir
+}
+
+// Return the path of name (relative to the top of the working tree) relative
+// to the current directory, as git shows paths to the user.
+func relativePath(repo *git.Repository, name string) string {
+	prefix, inside := workTreePrefix(repo)
+	if !inside || prefix == "" {
+		return name
+	}
+	rel, err := filepath.Rel(filepath.FromSlash(prefix), filepath.FromSlash(name))
+	if err != nil {
+		return name
+	}
+	rel = filepath.ToSlash(rel)
+	if strings.HasSuffix(name, "/") {
+		// untracked directories
+		rel += "/"
+	}
+	return rel
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/codecrafters-io/git-starter-go/pkg/git"
+)
+
+// Quote the path in the same way as git (core.quotePath=true).
+func quotePath(name string, quoteSpace bool) string {
+	needsQuote := false
+	var quoted strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '"' || c == '\\':
+			needsQuote = true
+			quoted.WriteByte('\\')
+			quoted.WriteByte(c)
+		case c == '\t':
+			needsQuote = true
+			quoted.WriteString("\\t")
+		case c == '\n':
+			needsQuote = true
+			quoted.WriteString("\\n")
+		case c < 0x20 || c >= 0x7f:
+			needsQuote = true
+			quoted.WriteString(fmt.Sprintf("\\%03o", c))
+		case c == ' ' && quoteSpace:
+			needsQuote = true
+			quoted.WriteByte(c)
+		default:
+			quoted.WriteByte(c)
+		}
+	}
+	if !needsQuote {
+		return name
+	}
+	return "\"" + quoted.String() + "\""
+}
+
+// Paths are relative to the current directory, except in the porcelain format.
+func printShortStatus(repo *git.Repository, status *git.RepoStatus, showBranch, porcelain bool) {
+	displayPath := func(name string) string {
+		if porcelain {
+			return quotePath(name, true)
+		}
+		return quotePath(relativePath(repo, name), true)
+	}
+	if showBranch {
+		branch := strings.TrimPrefix(status.Ref, "refs/heads/")
+		switch {
+		case status.Ref == "":
+			fmt.Println("## HEAD (no branch)")
+		case status.HeadSha == "":
+			fmt.Printf("## No commits yet on %s\n", branch)
+		default:
+			fmt.Printf("## %s\n", branch)
+		}
+	}
+	for _, c := range status.Changes {
+		fmt.Printf("%c%c %s\n", c.Staged, c.Unstaged, displayPath(c.Name))
+	}
+	for _, name := range status.Untracked {
+		fmt.Printf("?? %s\n", displayPath(name))
+	}
+}
+
+func printLongStatus(repo *git.Repository, status *git.RepoStatus) {
+	displayPath := func(name string) string {
+		return quotePath(relativePath(repo, name), false)
+	}
+	if status.Ref == "" {
+		fmt.Printf("HEAD detached at %s\n", status.HeadSha[:7])
+	} else {
+		fmt.Printf("On branch %s\n", strings.TrimPrefix(status.Ref, "refs/heads/"))
+	}
+	if status.HeadSha == "" {
+		fmt.Print("\nNo commits yet\n\n")
+	}
+
+	labels := map[byte]string{
+		'A': "new file:",
+		'M': "modified:",
+		'D': "deleted:",
+		'T': "typechange:",
+		'U': "both modified:",
+	}
+	staged, unstaged, unmerged := []git.FileStatus{}, []git.FileStatus{}, []git.FileStatus{}
+	for _, c := range status.Changes {
+		if c.Staged == 'U' {
+			unmerged = append(unmerged, c)
+			continue
+		}
+		if c.Staged != ' ' {
+			staged = append(staged, c)
+		}
+		if c.Unstaged != ' ' {
+			unstaged = append(unstaged, c)
+		}
+	}
+
+	if len(unmerged) > 0 {
+		fmt.Print("Unmerged paths:\n")
+		fmt.Print("  (use \"git add <file>...\" to mark resolution)\n")
+		for _, c := range unmerged {
+			fmt.Printf("\t%-16s%s\n", labels['U'], displayPath(c.Name))
+		}
+		fmt.Println()
+	}
+	if len(staged) > 0 {
+		fmt.Print("Changes to be committed:\n")
+		if status.HeadSha == "" {
+			fmt.Print("  (use \"git rm --cached <file>...\" to unstage)\n")
+		} else {
+			fmt.Print("  (use \"git restore --staged <file>...\" to unstage)\n")
+		}
+		for _, c := range staged {
+			fmt.Printf("\t%-12s%s\n", labels[c.Staged], displayPath(c.Name))
+		}
+		fmt.Println()
+	}
+	if len(unstaged) > 0 {
+		fmt.Print("Changes not staged for commit:\n")
+		fmt.Print("  (use \"git add/rm <file>...\" to update what will be committed)\n")
+		fmt.Print("  (use \"git restore <file>...\" to discard changes in working directory)\n")
+		for _, c := range unstaged {
+			fmt.Printf("\t%-12s%s\n", labels[c.Unstaged], displayPath(c.Name))
+		}
+		fmt.Println()
+	}
+	if len(status.Untracked) > 0 {
+		fmt.Print("Untracked files:\n")
+		fmt.Print("  (use \"git add <file>...\" to include in what will be committed)\n")
+		for _, name := range status.Untracked {
+			fmt.Printf("\t%s\n", displayPath(name))
+		}
+		fmt.Println()
+	}
+
+	switch {
+	case len(staged) > 0 || len(unmerged) > 0:
+	case len(unstaged) > 0:
+		fmt.Println("no changes added to commit (use \"git add\" and/or \"git commit -a\")")
+	case len(status.Untracked) > 0:
+		fmt.Println("nothing added to commit but untracked files present (use \"git add\" to track)")
+	case status.HeadSha == "":
+		fmt.Println("nothing to commit (create/copy files and use \"git add\" to track)")
+	default:
+		fmt.Println("nothing to commit, working tree clean")
+	}
+}
@@ -0,0 +1,416 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// Report whether name can be used as a branch name (e.g. "topic" for
+// refs/heads/topic).
+func IsValidBranchName(name string) bool {
+	return name != "HEAD" && !strings.HasPrefix(name, "-") && isValidRefName("refs/heads/"+name)
+}
+
+// Return the current branch (e.g. "master"), "" when HEAD is detached.
+func CurrentBranch(repo *Repository) (string, error) {
+	ref, err := ReadSymbolicRef(repo, "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(ref, "refs/heads/"), nil
+}
+
+// Create the branch at the commit startSha. startName is how the start point
+// was given, e.g. "HEAD~1", and only goes into the reflog. With force an
+// existing branch is reset to startSha unless it is checked out.
+// ref: https://git-scm.com/docs/git-branch
+func CreateBranch(repo *Repository, name, startSha, startName string, force bool) error {
+	if !IsValidBranchName(name) {
+		return fmt.Errorf("'%s' is not a valid branch name", name)
+	}
+	ref := "refs/heads/" + name
+	currentSha, err := readRef(repo, ref)
+	if err != nil {
+		return err
+	}
+	if currentSha == "" {
+		return UpdateRef(repo, ref, startSha, zeroSha, "branch: Created from "+startName)
+	}
+	if !force {
+		return fmt.Errorf("a branch named '%s' already exists", name)
+	}
+	if current, err := CurrentBranch(repo); err != nil {
+		return err
+	} else if current == name {
+		return fmt.Errorf("cannot force update the branch '%s' checked out at '%s'", name, repo.WorkTree)
+	}
+	return UpdateRef(repo, ref, startSha, currentSha, "branch: Reset to "+startName)
+}
+
+// Rename the branch with its reflog and config. HEAD follows the branch if it
+// is checked out. With force an existing branch newName is overwritten.
+func RenameBranch(repo *Repository, oldName, newName string, force bool) error {
+	oldRef, newRef := "refs/heads/"+oldName, "refs/heads/"+newName
+	sha, err := readRef(repo, oldRef)
+	if err != nil {
+		return err
+	}
+	if sha == "" {
+		return fmt.Errorf("No branch named '%s'.", oldName)
+	}
+	if !IsValidBranchName(newName) {
+		return fmt.Errorf("'%s' is not a valid branch name", newName)
+	}
+	existingSha, err := readRef(repo, newRef)
+	if err != nil {
+		return err
+	}
+	if existingSha != "" && !force && oldName != newName {
+		return fmt.Errorf("a branch named '%s' already exists", newName)
+	}
+	current, err := CurrentBranch(repo)
+	if err != nil {
+		return err
+	}
+
+	// The reflog moves with the branch, so the refs are updated without
+	// logging and the old reflog is copied afterwards.
+	reflog, err := repo.FS.ReadFile(reflogPath(repo, oldRef))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if oldName != newName {
+		t := NewRefTransaction(repo)
+		t.noLog = true
+		t.Delete(oldRef, sha, false)
+		t.Update(newRef, sha, "", false)
+		if err := t.Commit(); err != nil {
+			return err
+		}
+		if reflog != nil {
+			logPath := reflogPath(repo, newRef)
+			if err := repo.FS.MkdirAll(path.Dir(logPath), 0755); err != nil {
+				return err
+			}
+			if err := writeFileLocked(repo.FS, logPath, reflog); err != nil {
+				return err
+			}
+		} else if err := deleteReflog(repo, newRef); err != nil {
+			return err
+		}
+	}
+
+	config, err := ReadConfigFiles(repo, true)
+	if err != nil {
+		return err
+	}
+	message := fmt.Sprintf("Branch: renamed %s to %s", oldRef, newRef)
+	if shouldLogRef(repo, config, newRef) {
+		if err := appendReflog(repo, newRef, sha, sha, message); err != nil {
+			return err
+		}
+	}
+	if current == oldName {
+		if err := WriteSymbolicRef(repo, "HEAD", newRef, ""); err != nil {
+			return err
+		}
+		if shouldLogRef(repo, config, "HEAD") {
+			if err := appendReflog(repo, "HEAD", sha, sha, message); err != nil {
+				return err
+			}
+		}
+	}
+	if oldName == newName {
+		return nil
+	}
+	return editConfig(repo, func(cf *ConfigFile) (bool, error) {
+		cf.RemoveSection("branch." + newName)
+		return cf.RenameSection("branch."+oldName, "branch."+newName), nil
+	})
+}
+
+// Delete the branch and its config and return the commit it pointed to. The
+// checked out branch can't be deleted.
+func DeleteBranch(repo *Repository, name string) (string, error) {
+	ref := "refs/heads/" + name
+	sha, err := readRef(repo, ref)
+	if err != nil {
+		return "", err
+	}
+	if sha == "" {
+		return "", fmt.Errorf("branch '%s' not found.", name)
+	}
+	if current, err := CurrentBranch(repo); err != nil {
+		return "", err
+	} else if current == name {
+		return "", fmt.Errorf("Cannot delete branch '%s' checked out at '%s'", name, repo.WorkTree)
+	}
+	if err := DeleteRef(repo, ref, sha); err != nil {
+		return "", err
+	}
+	return sha, editConfig(repo, func(cf *ConfigFile) (bool, error) {
+		return cf.RemoveSection("branch." + name), nil
+	})
+}
+
+// DeletedBranch is the outcome of deleting one of the branches given to
+// DeleteBranches.
+type DeletedBranch struct {
+	Name string
+	Sha  string // the commit the branch pointed to
+	Err  error
+}
+
+// Delete the branches, or the remote-tracking branches (e.g. "origin/main")
+// with remotes, like git branch -d: unless force, a branch must be merged
+// into HEAD. Like git, the remaining branches are still deleted after an
+// error, which is reported in the result of its branch.
+func DeleteBranches(repo *Repository, names []string, remotes, force bool) ([]DeletedBranch, error) {
+	_, headSha, err := ReadHead(repo)
+	if err != nil {
+		return nil, err
+	}
+	results := []DeletedBranch{}
+	for _, name := range names {
+		result := DeletedBranch{Name: name}
+		if remotes {
+			ref := "refs/remotes/" + name
+			if result.Sha, _ = ResolveRevision(repo, ref); result.Sha == "" {
+				result.Err = fmt.Errorf("remote-tracking branch '%s' not found.", name)
+			} else {
+				result.Err = DeleteRef(repo, ref, result.Sha)
+			}
+			results = append(results, result)
+			continue
+		}
+
+		if sha, _ := ResolveRevision(repo, "refs/heads/"+name); sha != "" && !force {
+			merged := false
+			if headSha != "" {
+				merged, result.Err = IsAncestor(repo, sha, headSha)
+			}
+			if result.Err == nil && !merged {
+				result.Err = fmt.Errorf("The branch '%s' is not fully merged.\nIf you are sure you want to delete it, run 'git branch -D %s'.", name, name)
+			}
+		}
+		if result.Err == nil {
+			result.Sha, result.Err = DeleteBranch(repo, name)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// ListedBranch is a branch as git branch lists it.
+type ListedBranch struct {
+	Ref     Ref
+	Name    string // as shown, e.g. "master" or "remotes/origin/main"
+	Current bool
+}
+
+// List the local branches, the remote-tracking branches with remotes or both
+// with all, after a detached HEAD. Patterns filter the names as shown. With
+// containsSha only the branches which contain that commit are listed.
+func ListBranches(repo *Repository, patterns []string, all, remotes bool, containsSha string) ([]ListedBranch, error) {
+	headRef, headSha, err := ReadHead(repo)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := ListRefs(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	branches := []ListedBranch{}
+	if headRef == "" && headSha != "" && len(patterns) == 0 && !remotes {
+		detached := Ref{Name: "HEAD", Sha: headSha}
+		branches = append(branches, ListedBranch{Ref: detached, Name: fmt.Sprintf("(HEAD detached at %s)", ShortenSha(repo, headSha, 7)), Current: true})
+	}
+	for _, ref := range refs {
+		name := ""
+		switch {
+		case strings.HasPrefix(ref.Name, "refs/heads/") && !remotes:
+			name = strings.TrimPrefix(ref.Name, "refs/heads/")
+		case strings.HasPrefix(ref.Name, "refs/remotes/") && remotes:
+			name = strings.TrimPrefix(ref.Name, "refs/remotes/")
+		case strings.HasPrefix(ref.Name, "refs/remotes/") && all:
+			name = strings.TrimPrefix(ref.Name, "refs/")
+		default:
+			continue
+		}
+		if len(patterns) > 0 {
+			matched := false
+			for _, pattern := range patterns {
+				matched = matched || MatchRefPattern(pattern, name)
+			}
+			if !matched {
+				continue
+			}
+		}
+		branches = append(branches, ListedBranch{Ref: ref, Name: name, Current: ref.Name == headRef})
+	}
+	if containsSha == "" {
+		return branches, nil
+	}
+
+	kept := []ListedBranch{}
+	for _, branch := range branches {
+		ok, err := IsAncestor(repo, containsSha, branch.Ref.Sha)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			kept = append(kept, branch)
+		}
+	}
+	return kept, nil
+}
+
+// Make upstream (e.g. refs/remotes/origin/main or refs/heads/master) the
+// upstream of the branch by setting branch.<name>.remote and .merge. A
+// remote-tracking branch is mapped back to the branch of its remote through
+// the fetch refspecs of the remotes.
+func SetUpstream(repo *Repository, branch, upstream string) error {
+	remote, merge := "", ""
+	if strings.HasPrefix(upstream, "refs/heads/") {
+		remote, merge = ".", upstream
+	} else {
+		config, err := ReadConfigFiles(repo, true)
+		if err != nil {
+			return err
+		}
+		remote, merge = remoteBranchOf(config, upstream)
+		if remote == "" {
+			return fmt.Errorf("Cannot setup tracking information; starting point '%s' is not a branch.", ShortenRefName(upstream))
+		}
+	}
+	return editConfig(repo, func(cf *ConfigFile) (bool, error) {
+		if err := cf.Set("branch."+branch+".remote", remote, true); err != nil {
+			return false, err
+		}
+		return true, cf.Set("branch."+branch+".merge", merge, true)
+	})
+}
+
+// Return the upstream which a new branch created from start (as given, e.g.
+// "origin/main") tracks according to branch.autoSetupMerge: a
+// remote-tracking branch which one of the remotes fetches, or with "always"
+// also a local branch. Returns "" when the branch tracks nothing.
+func AutoUpstream(repo *Repository, start string) (string, error) {
+	config, err := ReadConfigFiles(repo, true)
+	if err != nil {
+		return "", err
+	}
+	setting, _ := config.Get("branch.autosetupmerge")
+	setting = strings.ToLower(setting)
+	if enabled, err := parseConfigBool(setting); setting != "" && err == nil && !enabled {
+		return "", nil
+	}
+	ref, _, err := DwimRef(repo, start)
+	if err != nil {
+		return "", nil
+	}
+	switch {
+	case strings.HasPrefix(ref, "refs/remotes/"):
+		if remote, _ := remoteBranchOf(config, ref); remote != "" {
+			return ref, nil
+		}
+	case strings.HasPrefix(ref, "refs/heads/") && setting == "always":
+		return ref, nil
+	}
+	return "", nil
+}
+
+// Tracking tells how a branch relates to its upstream.
+type Tracking struct {
+	Upstream string // e.g. "refs/remotes/origin/main"
+	Gone     bool   // the upstream doesn't exist (any more)
+	Ahead    int    // commits of the branch which the upstream doesn't have
+	Behind   int    // commits of the upstream which the branch doesn't have
+}
+
+// Return how the branch (e.g. refs/heads/main) relates to its upstream, nil
+// if it has no upstream.
+func BranchTracking(repo *Repository, ref string) (*Tracking, error) {
+	if !strings.HasPrefix(ref, "refs/heads/") {
+		return nil, nil
+	}
+	upstream, err := UpstreamRef(repo, ref)
+	if err != nil {
+		return nil, nil
+	}
+	tracking := &Tracking{Upstream: upstream}
+	upstreamSha, _ := ResolveRevision(repo, upstream)
+	if upstreamSha == "" {
+		tracking.Gone = true
+		return tracking, nil
+	}
+	sha, err := ResolveRevision(repo, ref)
+	if err != nil {
+		return nil, err
+	}
+	if tracking.Ahead, tracking.Behind, err = AheadBehind(repo, sha, upstreamSha); err != nil {
+		return nil, err
+	}
+	return tracking, nil
+}
+
+// Remove the upstream configuration of the branch. Returns false if the
+// branch had no upstream.
+func UnsetUpstream(repo *Repository, branch string) (bool, error) {
+	found := false
+	err := editConfig(repo, func(cf *ConfigFile) (bool, error) {
+		removedRemote, err := cf.Unset("branch."+branch+".remote", true)
+		if err != nil {
+			return false, err
+		}
+		removedMerge, err := cf.Unset("branch."+branch+".merge", true)
+		found = removedRemote || removedMerge
+		return found, err
+	})
+	return found, err
+}
+
+// Find the remote and its branch which the remote-tracking ref is fetched
+// from, e.g. "origin" and "refs/heads/main" for refs/remotes/origin/main with
+// the refspec +refs/heads/*:refs/remotes/origin/*.
+func remoteBranchOf(config *Config, ref string) (remote, merge string) {
+	for _, entry := range config.Entries {
+		if entry.Section != "remote" || entry.Key != "fetch" || entry.Subsection == "" {
+			continue
+		}
+		refspec := strings.TrimPrefix(entry.Value, "+")
+		colon := strings.IndexByte(refspec, ':')
+		if colon < 0 {
+			continue
+		}
+		src, dst := refspec[:colon], refspec[colon+1:]
+		if !strings.HasSuffix(src, "*") || !strings.HasSuffix(dst, "*") {
+			if dst == ref {
+				return entry.Subsection, src
+			}
+			continue
+		}
+		dstPrefix := strings.TrimSuffix(dst, "*")
+		if strings.HasPrefix(ref, dstPrefix) {
+			return entry.Subsection, strings.TrimSuffix(src, "*") + strings.TrimPrefix(ref, dstPrefix)
+		}
+	}
+	return "", ""
+}
+
+// Edit the config file of the repository. The file is saved if edit
+// returns true.
+func editConfig(repo *Repository, edit func(cf *ConfigFile) (bool, error)) error {
+	cf, err := OpenConfigFile(repo.FS, path.Join(repo.GitDir, "config"))
+	if err != nil {
+		return err
+	}
+	changed, err := edit(cf)
+	if err != nil || !changed {
+		return err
+	}
+	return cf.Save()
+}
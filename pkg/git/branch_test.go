@@ -0,0 +1,229 @@
+package git
+
+import (
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestBranches(t *testing.T) {
+	repo := newTestRepository(t)
+	first := writeTestCommit(t, repo, "first", map[string]string{"a": "1\n"})
+	second := writeTestCommit(t, repo, "second", map[string]string{"a": "2\n"}, first)
+	if err := UpdateRef(repo, "HEAD", second, zeroSha, "commit: second"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CreateBranch(repo, "topic", first, "HEAD~1", false); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestReflog(t, repo, "refs/heads/topic"); !reflect.DeepEqual(got, []string{"branch: Created from HEAD~1"}) {
+		t.Errorf("reflog of topic = %q", got)
+	}
+	for _, tt := range []struct {
+		name  string
+		force bool
+	}{{"topic", false}, {"main", true}, {"-topic", false}, {"HEAD", false}, {"a..b", false}} {
+		if err := CreateBranch(repo, tt.name, first, "HEAD~1", tt.force); err == nil {
+			t.Errorf("CreateBranch(%q, force=%v) succeeded", tt.name, tt.force)
+		}
+	}
+	if err := CreateBranch(repo, "topic", second, "main", true); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestRefs(t, repo, "refs/heads/topic"); got[0] != second {
+		t.Errorf("topic = %s, want %s", got[0], second)
+	}
+
+	// Renaming the checked out branch takes HEAD, the reflog and the config
+	// along.
+	if err := SetUpstream(repo, "main", "refs/heads/topic"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RenameBranch(repo, "main", "topic", false); err == nil {
+		t.Error("RenameBranch() overwrote a branch without force")
+	}
+	if err := RenameBranch(repo, "main", "renamed", false); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestRefs(t, repo, "refs/heads/main", "refs/heads/renamed"); got[0] != "" || got[1] != second {
+		t.Errorf("main, renamed = %q", got)
+	}
+	if branch, err := CurrentBranch(repo); err != nil || branch != "renamed" {
+		t.Errorf("CurrentBranch() = %q, %v", branch, err)
+	}
+	want := []string{"Branch: renamed refs/heads/main to refs/heads/renamed", "commit: second"}
+	if got := readTestReflog(t, repo, "refs/heads/renamed"); !reflect.DeepEqual(got, want) {
+		t.Errorf("reflog of renamed = %q, want %q", got, want)
+	}
+	if HasReflog(repo, "refs/heads/main") {
+		t.Error("the reflog of main still exists")
+	}
+	if upstream, err := UpstreamRef(repo, "refs/heads/renamed"); err != nil || upstream != "refs/heads/topic" {
+		t.Errorf("UpstreamRef(renamed) = %q, %v", upstream, err)
+	}
+	if _, ok := GetConfigValue(repo, "branch.main.merge"); ok {
+		t.Error("the config of main still exists")
+	}
+
+	if _, err := DeleteBranch(repo, "renamed"); err == nil {
+		t.Error("DeleteBranch() deleted the current branch")
+	}
+	if _, err := DeleteBranch(repo, "none"); err == nil {
+		t.Error("DeleteBranch() deleted a missing branch")
+	}
+	if err := SetUpstream(repo, "topic", "refs/heads/renamed"); err != nil {
+		t.Fatal(err)
+	}
+	if sha, err := DeleteBranch(repo, "topic"); err != nil || sha != second {
+		t.Errorf("DeleteBranch(topic) = %s, %v", sha, err)
+	}
+	if _, ok := GetConfigValue(repo, "branch.topic.remote"); ok {
+		t.Error("the config of topic still exists")
+	}
+	if tracking, err := BranchTracking(repo, "refs/heads/renamed"); err != nil || !tracking.Gone {
+		t.Errorf("BranchTracking(renamed) = %+v, %v, want the upstream gone", tracking, err)
+	}
+	if found, err := UnsetUpstream(repo, "renamed"); err != nil || !found {
+		t.Errorf("UnsetUpstream() = %v, %v", found, err)
+	}
+	if tracking, err := BranchTracking(repo, "refs/heads/renamed"); err != nil || tracking != nil {
+		t.Errorf("BranchTracking() without upstream = %+v, %v", tracking, err)
+	}
+}
+
+func TestBranchTracking(t *testing.T) {
+	repo := newTestRepository(t)
+	base := writeTestCommit(t, repo, "base", map[string]string{"a": "1\n"})
+	local := writeTestCommit(t, repo, "local", map[string]string{"a": "2\n"}, base)
+	remote1 := writeTestCommit(t, repo, "remote 1", map[string]string{"a": "3\n"}, base)
+	remote2 := writeTestCommit(t, repo, "remote 2", map[string]string{"a": "4\n"}, remote1)
+	for ref, sha := range map[string]string{"refs/heads/main": local, "refs/remotes/origin/main": remote2} {
+		if err := UpdateRef(repo, ref, sha, "", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cf, err := OpenConfigFile(repo.FS, path.Join(repo.GitDir, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cf.Set("remote.origin.fetch", "+refs/heads/*:refs/remotes/origin/*", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := cf.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := IsAncestor(repo, base, local); err != nil || !ok {
+		t.Errorf("IsAncestor(base, local) = %v, %v", ok, err)
+	}
+	if ok, err := IsAncestor(repo, local, remote2); err != nil || ok {
+		t.Errorf("IsAncestor(local, remote2) = %v, %v", ok, err)
+	}
+
+	upstream, err := AutoUpstream(repo, "origin/main")
+	if err != nil || upstream != "refs/remotes/origin/main" {
+		t.Fatalf("AutoUpstream(origin/main) = %q, %v", upstream, err)
+	}
+	if upstream, err := AutoUpstream(repo, "main"); err != nil || upstream != "" {
+		t.Errorf("AutoUpstream(main) = %q, %v, want nothing", upstream, err)
+	}
+	if err := SetUpstream(repo, "main", upstream); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{"branch.main.remote": "origin", "branch.main.merge": "refs/heads/main"} {
+		if value, _ := GetConfigValue(repo, key); value != want {
+			t.Errorf("%s = %q, want %q", key, value, want)
+		}
+	}
+	if err := SetUpstream(repo, "main", "refs/remotes/other/main"); err == nil {
+		t.Error("SetUpstream() accepted a ref no remote fetches")
+	}
+	tracking, err := BranchTracking(repo, "refs/heads/main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Tracking{Upstream: "refs/remotes/origin/main", Ahead: 1, Behind: 2}); *tracking != want {
+		t.Errorf("BranchTracking() = %+v, want %+v", *tracking, want)
+	}
+}
+
+func TestListAndDeleteBranches(t *testing.T) {
+	repo := newTestRepository(t)
+	first := writeTestCommit(t, repo, "first", map[string]string{"a": "1\n"})
+	second := writeTestCommit(t, repo, "second", map[string]string{"a": "2\n"}, first)
+	for ref, sha := range map[string]string{
+		"refs/heads/main":          first,
+		"refs/heads/merged":        first,
+		"refs/heads/topic":         second,
+		"refs/heads/feature/x":     second,
+		"refs/remotes/origin/main": second,
+	} {
+		if err := UpdateRef(repo, ref, sha, "", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names := func(branches []ListedBranch) []string {
+		names := []string{}
+		for _, branch := range branches {
+			if branch.Current {
+				names = append(names, "*"+branch.Name)
+			} else {
+				names = append(names, branch.Name)
+			}
+		}
+		return names
+	}
+
+	tests := []struct {
+		patterns     []string
+		all, remotes bool
+		contains     string
+		want         []string
+	}{
+		{want: []string{"feature/x", "*main", "merged", "topic"}},
+		{remotes: true, want: []string{"origin/main"}},
+		{all: true, want: []string{"feature/x", "*main", "merged", "topic", "remotes/origin/main"}},
+		{patterns: []string{"feature/*", "merged"}, want: []string{"feature/x", "merged"}},
+		{contains: second, want: []string{"feature/x", "topic"}},
+	}
+	for _, tt := range tests {
+		branches, err := ListBranches(repo, tt.patterns, tt.all, tt.remotes, tt.contains)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := names(branches); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ListBranches(%q, all=%v, remotes=%v, contains=%.7s) = %q, want %q", tt.patterns, tt.all, tt.remotes, tt.contains, got, tt.want)
+		}
+	}
+
+	// Only merged branches are deleted without force, the others still are
+	// after an error.
+	results, err := DeleteBranches(repo, []string{"topic", "merged", "none"}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[0].Err == nil || results[1].Err != nil || results[1].Sha != first || results[2].Err == nil {
+		t.Errorf("DeleteBranches() = %+v", results)
+	}
+	if results, err := DeleteBranches(repo, []string{"topic"}, false, true); err != nil || results[0].Err != nil || results[0].Sha != second {
+		t.Errorf("DeleteBranches(force) = %+v, %v", results, err)
+	}
+	if results, err := DeleteBranches(repo, []string{"origin/main", "origin/none"}, true, false); err != nil || results[0].Err != nil || results[1].Err == nil {
+		t.Errorf("DeleteBranches(remotes) = %+v, %v", results, err)
+	}
+
+	// A detached HEAD comes first.
+	tx := NewRefTransaction(repo)
+	tx.Update("HEAD", second, "", false)
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	branches, err := ListBranches(repo, nil, false, false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := names(branches), []string{"*(HEAD detached at " + second[:7] + ")", "feature/x", "main"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ListBranches() = %q, want %q", got, want)
+	}
+}
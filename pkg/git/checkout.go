@@ -0,0 +1,381 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CheckoutConflictError is returned when switching trees would lose local
+// changes: modified files whose content differs between the trees, and
+// untracked files which are in the way of files of the new tree.
+type CheckoutConflictError struct {
+	Modified  []string
+	Untracked []string
+}
+
+func (e *CheckoutConflictError) Error() string {
+	var b strings.Builder
+	if len(e.Modified) > 0 {
+		b.WriteString("Your local changes to the following files would be overwritten by checkout:\n")
+		for _, name := range e.Modified {
+			fmt.Fprintf(&b, "\t%s\n", name)
+		}
+		b.WriteString("Please commit your changes or stash them before you switch branches.\n")
+	}
+	if len(e.Untracked) > 0 {
+		if b.Len() > 0 {
+			b.WriteString("error: ")
+		}
+		b.WriteString("The following untracked working tree files would be overwritten by checkout:\n")
+		for _, name := range e.Untracked {
+			fmt.Fprintf(&b, "\t%s\n", name)
+		}
+		b.WriteString("Please move or remove them before you switch branches.\n")
+	}
+	b.WriteString("Aborting")
+	return b.String()
+}
+
+// Update the index and the working tree from the tree oldTreeSha (usually
+// the tree of HEAD) to newTreeSha, like git read-tree -m -u. Either tree may
+// be "" for an empty tree.
+//
+// Only the files which differ between the two trees are touched, so local
+// changes to other files are kept. A file which differs is refused if it has
+// staged or unstaged changes, or if it is untracked and would be overwritten;
+// nothing is changed then and a *CheckoutConflictError is returned.
+// With force the index and the working tree are reset to newTreeSha
+// entirely, discarding all local changes to tracked files.
+func CheckoutTree(repo *Repository, oldTreeSha, newTreeSha string, force bool) error {
+	oldFiles, newFiles := map[string]TreeChild{}, map[string]TreeChild{}
+	if oldTreeSha != "" {
+		if err := flattenTree(repo, oldTreeSha, "", oldFiles); err != nil {
+			return err
+		}
+	}
+	if newTreeSha != "" {
+		if err := flattenTree(repo, newTreeSha, "", newFiles); err != nil {
+			return err
+		}
+	}
+	idx, err := ReadIndex(repo)
+	if err != nil {
+		return err
+	}
+	indexed := map[string]*IndexEntry{}
+	unmerged := map[string]bool{}
+	for i := range idx.Entries {
+		entry := &idx.Entries[i]
+		if entry.Stage() != 0 {
+			unmerged[entry.Name] = true
+			continue
+		}
+		indexed[entry.Name] = entry
+	}
+	if len(unmerged) > 0 && !force {
+		return fmt.Errorf("you need to resolve your current index first")
+	}
+
+	names := map[string]bool{}
+	for name := range oldFiles {
+		names[name] = true
+	}
+	for name := range newFiles {
+		names[name] = true
+	}
+	if force {
+		for name := range indexed {
+			names[name] = true
+		}
+		for name := range unmerged {
+			names[name] = true
+		}
+	}
+	sorted := []string{}
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var ignore *IgnoreMatcher
+	if !force {
+		if ignore, err = NewIgnoreMatcher(repo); err != nil {
+			return err
+		}
+	}
+	conflicts := &CheckoutConflictError{}
+	removals, writes := []string{}, []string{}
+	for _, name := range sorted {
+		oldFile, inOld := oldFiles[name]
+		newFile, inNew := newFiles[name]
+		entry, inIndex := indexed[name]
+		dirty := false
+		if inIndex {
+			if dirty, err = IsWorktreeModified(repo, entry); err != nil {
+				return err
+			}
+		}
+
+		if force {
+			switch {
+			case inNew && (!inIndex || unmerged[name] || dirty || !entryMatchesTree(entry, newFile)):
+				writes = append(writes, name)
+			case inNew:
+				// Restore a deleted file.
+				if _, err := repo.FS.Lstat(worktreePath(repo, name)); os.IsNotExist(err) {
+					writes = append(writes, name)
+				}
+			case inIndex || unmerged[name]:
+				removals = append(removals, name)
+			}
+			continue
+		}
+
+		if inOld == inNew && oldFile == newFile {
+			// The same in both trees: local changes are kept.
+			continue
+		}
+		matchesOld := inIndex == inOld && (!inIndex || entryMatchesTree(entry, oldFile))
+		matchesNew := inIndex == inNew && (!inIndex || entryMatchesTree(entry, newFile))
+		switch {
+		case matchesNew:
+			// Already staged as in the new tree.
+			continue
+		case !matchesOld || dirty:
+			conflicts.Modified = append(conflicts.Modified, name)
+			continue
+		case !inIndex && inNew:
+			untracked, err := isUntrackedInTheWay(repo, name, idx, ignore)
+			if err != nil {
+				return err
+			}
+			if untracked {
+				conflicts.Untracked = append(conflicts.Untracked, name)
+				continue
+			}
+		}
+		if inNew {
+			writes = append(writes, name)
+		} else {
+			removals = append(removals, name)
+		}
+	}
+	if len(conflicts.Modified) > 0 || len(conflicts.Untracked) > 0 {
+		return conflicts
+	}
+
+	// Removing first makes room for files which replace a directory.
+	for _, name := range removals {
+		if err := RemoveWorktreeFile(repo, name); err != nil {
+			return err
+		}
+		idx.Remove(name)
+	}
+	for _, name := range writes {
+		entry, err := checkoutFile(repo, name, newFiles[name])
+		if err != nil {
+			return err
+		}
+		idx.Add(entry)
+	}
+	idx.sort()
+	return idx.Write(repo)
+}
+
+// Update the working tree and the index for HEAD to become the commit, see
+// CheckoutTree. HEAD itself is not changed.
+func CheckoutCommit(repo *Repository, commitSha string, force bool) error {
+	_, headSha, err := ReadHead(repo)
+	if err != nil {
+		return err
+	}
+	headTree := ""
+	if headSha != "" {
+		if headTree, err = ReadCommitTree(repo, headSha); err != nil {
+			return err
+		}
+	}
+	newTree, err := ReadCommitTree(repo, commitSha)
+	if err != nil {
+		return err
+	}
+	return CheckoutTree(repo, headTree, newTree, force)
+}
+
+// Restore the files matching the paths (files or directories, "." for
+// everything) in the working tree from the index, or from the tree if treeSha
+// is not "", which then also updates the index. Returns the number of files
+// which were checked out; files which are already up to date are skipped.
+func CheckoutPaths(repo *Repository, treeSha string, paths []string) (int, error) {
+	idx, err := ReadIndex(repo)
+	if err != nil {
+		return 0, err
+	}
+	files := map[string]TreeChild{}
+	if treeSha != "" {
+		if err := flattenTree(repo, treeSha, "", files); err != nil {
+			return 0, err
+		}
+	} else {
+		for _, entry := range idx.Entries {
+			if entry.Stage() != 0 {
+				continue
+			}
+			files[entry.Name] = TreeChild{Mode: fmt.Sprintf("%o", entry.Mode), Name: entry.Name, Sha: entry.ShaString()}
+		}
+	}
+
+	matched := []string{}
+	for _, p := range paths {
+		found := false
+		for name := range files {
+			if p == "." || name == p || strings.HasPrefix(name, p+"/") {
+				matched = append(matched, name)
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("pathspec '%s' did not match any file(s) known to git", p)
+		}
+	}
+	sort.Strings(matched)
+
+	indexed := map[string]IndexEntry{}
+	for _, entry := range idx.Entries {
+		if entry.Stage() == 0 {
+			indexed[entry.Name] = entry
+		}
+	}
+	count := 0
+	for i, name := range matched {
+		if i > 0 && matched[i-1] == name {
+			continue
+		}
+		if entry, ok := indexed[name]; ok && entryMatchesTree(&entry, files[name]) {
+			// Files which are up to date are left alone.
+			if _, err := repo.FS.Lstat(worktreePath(repo, name)); err == nil {
+				dirty, err := IsWorktreeModified(repo, &entry)
+				if err != nil {
+					return 0, err
+				}
+				if !dirty {
+					continue
+				}
+			}
+		}
+		entry, err := checkoutFile(repo, name, files[name])
+		if err != nil {
+			return 0, err
+		}
+		// Keep the stat info in sync so that the file isn't shown as modified.
+		idx.Remove(name)
+		idx.Add(entry)
+		count++
+	}
+	idx.sort()
+	return count, idx.Write(repo)
+}
+
+// Report whether the index entry has the mode and content of the tree entry.
+func entryMatchesTree(entry *IndexEntry, file TreeChild) bool {
+	return entry.ShaString() == file.Sha && fmt.Sprintf("%o", entry.Mode) == file.Mode
+}
+
+// Report whether a file which isn't tracked would be overwritten by creating
+// the file name: an untracked file at that path or at one of its parent
+// directories, or a directory there with untracked files in it. Ignored
+// files may be overwritten.
+func isUntrackedInTheWay(repo *Repository, name string, idx *Index, ignore *IgnoreMatcher) (bool, error) {
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		info, err := repo.FS.Lstat(worktreePath(repo, dir))
+		if err == nil && !info.IsDir() {
+			if _, tracked := idx.Find(dir); tracked {
+				return false, nil
+			}
+			ignored, err := ignore.IsIgnored(dir, false)
+			return !ignored, err
+		}
+	}
+	if _, err := repo.FS.Lstat(worktreePath(repo, name)); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	files, err := ListUntrackedFiles(repo, idx, name, ignore)
+	if err != nil {
+		return false, err
+	}
+	for _, file := range files {
+		if !file.Ignored && !strings.HasSuffix(file.Name, "/") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Write the file of the tree entry into the working tree, replacing what is
+// there, and return its index entry.
+func checkoutFile(repo *Repository, name string, file TreeChild) (IndexEntry, error) {
+	filePath := worktreePath(repo, name)
+	if err := repo.FS.MkdirAll(path.Dir(filePath), 0755); err != nil {
+		return IndexEntry{}, err
+	}
+	// What is left in the way is ignored or being overwritten with force,
+	// except for the directory of a submodule.
+	if info, err := repo.FS.Lstat(filePath); err == nil && !(info.IsDir() && file.Mode == "160000") {
+		if err := removeAll(repo.FS, filePath); err != nil {
+			return IndexEntry{}, err
+		}
+	}
+	entry, err := indexEntryFromTree(name, file)
+	if err != nil {
+		return IndexEntry{}, err
+	}
+
+	switch {
+	case file.Mode == "160000":
+		// A submodule is checked out as an empty directory.
+		if err := repo.FS.MkdirAll(filePath, 0755); err != nil {
+			return IndexEntry{}, err
+		}
+		return entry, nil
+	case file.Mode == "120000":
+		target, err := ReadObjectContent(repo, file.Sha)
+		if err != nil {
+			return IndexEntry{}, err
+		}
+		if err := repo.FS.Symlink(string(target), filePath); err != nil {
+			return IndexEntry{}, err
+		}
+	default:
+		content, err := ReadObjectContent(repo, file.Sha)
+		if err != nil {
+			return IndexEntry{}, err
+		}
+		perm, err := getPerm(file.Mode)
+		if err != nil {
+			return IndexEntry{}, err
+		}
+		if err := repo.FS.WriteFile(filePath, content, perm); err != nil {
+			return IndexEntry{}, err
+		}
+	}
+
+	info, err := repo.FS.Lstat(filePath)
+	if err != nil {
+		return IndexEntry{}, err
+	}
+	mode := entry.Mode
+	entry = newIndexEntry(name, info, entry.Sha)
+	entry.Mode = mode
+	return entry, nil
+}
+
+// Return the path of the file in the working tree.
+func worktreePath(repo *Repository, name string) string {
+	return filepath.Join(repo.WorkTree, filepath.FromSlash(name))
+}
@@ -0,0 +1,115 @@
+package git
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// Create a memory repository with main checked out at a commit of the files.
+func newTestCheckout(t *testing.T, files map[string]string) (*Repository, string) {
+	t.Helper()
+	repo := newTestRepository(t)
+	commit := writeTestCommit(t, repo, "first", files)
+	if err := UpdateRef(repo, "HEAD", commit, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := RestoreRepository(repo, commit); err != nil {
+		t.Fatal(err)
+	}
+	return repo, commit
+}
+
+func assertTestFiles(t *testing.T, repo *Repository, files map[string]string) {
+	t.Helper()
+	for name, want := range files {
+		content, err := repo.FS.ReadFile("/" + name)
+		if want == "" {
+			if err == nil {
+				t.Errorf("%s exists", name)
+			}
+		} else if err != nil || string(content) != want {
+			t.Errorf("content of %s = %q, %v, want %q", name, content, err, want)
+		}
+	}
+}
+
+func TestCheckoutCommit(t *testing.T) {
+	repo, first := newTestCheckout(t, map[string]string{"a": "1\n", "dir/b": "2\n", "keep": "k\n"})
+	second := writeTestCommit(t, repo, "second", map[string]string{"a": "2\n", "c": "new\n", "keep": "k\n"}, first)
+
+	// Local changes to files which differ between the commits are refused.
+	for name, content := range map[string]string{"a": "changed\n", "c": "untracked\n", "keep": "kept\n"} {
+		if err := repo.FS.WriteFile("/"+name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := CheckoutCommit(repo, second, false)
+	var conflict *CheckoutConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("CheckoutCommit() error = %v, want a conflict", err)
+	}
+	if want := (&CheckoutConflictError{Modified: []string{"a"}, Untracked: []string{"c"}}); !reflect.DeepEqual(conflict, want) {
+		t.Errorf("conflict = %+v, want %+v", conflict, want)
+	}
+	assertTestFiles(t, repo, map[string]string{"a": "changed\n", "dir/b": "2\n", "c": "untracked\n"})
+
+	// Other local changes are kept.
+	if err := repo.FS.WriteFile("/a", []byte("1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.FS.Remove("/c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckoutCommit(repo, second, false); err != nil {
+		t.Fatal(err)
+	}
+	assertTestFiles(t, repo, map[string]string{"a": "2\n", "dir/b": "", "c": "new\n", "keep": "kept\n"})
+	if err := UpdateRef(repo, "HEAD", second, first, ""); err != nil {
+		t.Fatal(err)
+	}
+	status, err := GetStatus(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []FileStatus{{Name: "keep", Staged: ' ', Unstaged: 'M'}}; !reflect.DeepEqual(status.Changes, want) {
+		t.Errorf("changes = %+v, want %+v", status.Changes, want)
+	}
+
+	// With force, everything is reset.
+	if err := CheckoutCommit(repo, first, true); err != nil {
+		t.Fatal(err)
+	}
+	assertTestFiles(t, repo, map[string]string{"a": "1\n", "dir/b": "2\n", "c": "", "keep": "k\n"})
+}
+
+func TestCheckoutPaths(t *testing.T) {
+	repo, first := newTestCheckout(t, map[string]string{"a": "1\n", "dir/b": "2\n", "dir/c": "3\n"})
+	tree, err := ReadCommitTree(repo, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"a": "changed\n", "dir/b": "changed\n"} {
+		if err := repo.FS.WriteFile("/"+name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n, err := CheckoutPaths(repo, "", []string{"a"}); err != nil || n != 1 {
+		t.Errorf("CheckoutPaths(a) = %d, %v, want 1 file", n, err)
+	}
+	if n, err := CheckoutPaths(repo, tree, []string{"dir"}); err != nil || n != 1 {
+		t.Errorf("CheckoutPaths(dir) = %d, %v, want 1 file", n, err)
+	}
+	assertTestFiles(t, repo, map[string]string{"a": "1\n", "dir/b": "2\n", "dir/c": "3\n"})
+	if _, err := CheckoutPaths(repo, "", []string{"none"}); err == nil {
+		t.Error("CheckoutPaths() accepted a path which matches nothing")
+	}
+	status, err := GetStatus(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Changes) != 0 {
+		t.Errorf("changes = %+v, want none", status.Changes)
+	}
+}
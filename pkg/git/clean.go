@@ -0,0 +1,125 @@
+package git
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// CleanOptions select what Clean removes.
+type CleanOptions struct {
+	Directories bool // also untracked directories (-d)
+	Ignored     bool // also ignored files (-x)
+	OnlyIgnored bool // only ignored files (-X)
+	DryRun      bool // only report what would be removed
+}
+
+// Remove the untracked files which match the paths (files or directories,
+// "." for everything) and return them, sorted; directories end with "/".
+// Files in untracked directories (which have no tracked files) are only
+// removed with opts.Directories, and such a directory is removed as a whole
+// when everything in it is removed.
+// ref: https://git-scm.com/docs/git-clean
+func Clean(repo *Repository, paths []string, opts CleanOptions) ([]string, error) {
+	idx, err := ReadIndex(repo)
+	if err != nil {
+		return nil, err
+	}
+	var ignore *IgnoreMatcher
+	if !opts.Ignored {
+		if ignore, err = NewIgnoreMatcher(repo); err != nil {
+			return nil, err
+		}
+	}
+	trackedDirs := map[string]bool{}
+	for _, entry := range idx.Entries {
+		for dir := path.Dir(entry.Name); dir != "."; dir = path.Dir(dir) {
+			trackedDirs[dir] = true
+		}
+	}
+	matches := func(name string) bool {
+		name = strings.TrimSuffix(name, "/")
+		for _, p := range paths {
+			if p == "." || name == p || strings.HasPrefix(name, p+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	files, err := ListUntrackedFiles(repo, idx, ".", ignore)
+	if err != nil {
+		return nil, err
+	}
+	// Decide what to remove per untracked directory: dirs[d] is false once
+	// something in d must stay.
+	removed, dirs := []string{}, map[string]bool{}
+	for _, file := range files {
+		if !matches(file.Name) {
+			continue
+		}
+		// Without opts.Ignored there is no ignore matcher, so nothing is ignored.
+		keep := file.Ignored != opts.OnlyIgnored
+		inUntrackedDir := false
+		for dir := path.Dir(strings.TrimSuffix(file.Name, "/")); dir != "."; dir = path.Dir(dir) {
+			if !trackedDirs[dir] {
+				inUntrackedDir = true
+				if _, ok := dirs[dir]; !ok {
+					dirs[dir] = true
+				}
+				if keep {
+					dirs[dir] = false
+				}
+			}
+		}
+		if keep {
+			continue
+		}
+		if (strings.HasSuffix(file.Name, "/") || inUntrackedDir) && !opts.Directories {
+			continue
+		}
+		removed = append(removed, file.Name)
+	}
+
+	// Replace the files of the directories which are removed as a whole,
+	// collapsing to the top most one within the paths.
+	if opts.Directories {
+		collapsed := []string{}
+		for _, name := range removed {
+			top := ""
+			for dir := path.Dir(strings.TrimSuffix(name, "/")); dir != "."; dir = path.Dir(dir) {
+				if remove, ok := dirs[dir]; ok && remove && matches(dir) && !matchesBelow(paths, dir) {
+					top = dir + "/"
+				}
+			}
+			if top == "" {
+				collapsed = append(collapsed, name)
+			} else if len(collapsed) == 0 || collapsed[len(collapsed)-1] != top {
+				collapsed = append(collapsed, top)
+			}
+		}
+		removed = collapsed
+	}
+	sort.Strings(removed)
+
+	if opts.DryRun {
+		return removed, nil
+	}
+	for _, name := range removed {
+		if err := removeAll(repo.FS, worktreePath(repo, strings.TrimSuffix(name, "/"))); err != nil {
+			return nil, err
+		}
+	}
+	return removed, nil
+}
+
+// Report whether one of the paths is inside the directory, so that the
+// directory itself isn't removed.
+func matchesBelow(paths []string, dir string) bool {
+	for _, p := range paths {
+		if strings.HasPrefix(p, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,329 @@
+package git
+
+import (
+	"bytes"
+	"container/heap"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type CommitHeader struct {
+	Key   string
+	Value string // continuation lines are joined with "\n"
+}
+
+type Commit struct {
+	Sha          string
+	Tree         string
+	Parents      []string
+	Author       Signature
+	Committer    Signature
+	ExtraHeaders []CommitHeader // e.g. gpgsig, encoding, mergetag
+	Message      string
+}
+
+// Read the commit object.
+func ReadCommit(repo *Repository, sha string) (*Commit, error) {
+	objReader, err := repo.Objects.Get(sha)
+	if err != nil {
+		return nil, err
+	}
+	defer objReader.Close()
+	if objReader.Type != "commit" {
+		return nil, fmt.Errorf("object %s is a %s, not a commit", sha, objReader.Type)
+	}
+	commitBuf, err := objReader.ReadContents()
+	if err != nil {
+		return nil, err
+	}
+	return parseCommit(sha, commitBuf)
+}
+
+// Parse the content of a commit object.
+// ref: https://git-scm.com/book/en/v2/Git-Internals-Git-Objects#_git_commit_objects
+func parseCommit(sha string, commitBuf []byte) (*Commit, error) {
+	commit := &Commit{Sha: sha}
+	headerEnd := bytes.Index(commitBuf, []byte("\n\n"))
+	headerBuf := commitBuf
+	if headerEnd >= 0 {
+		headerBuf = commitBuf[:headerEnd]
+		commit.Message = string(commitBuf[headerEnd+2:])
+	}
+
+	headers := []CommitHeader{}
+	for _, line := range strings.Split(string(headerBuf), "\n") {
+		if strings.HasPrefix(line, " ") && len(headers) > 0 {
+			// continuation line of a multi-line header (e.g. gpgsig)
+			headers[len(headers)-1].Value += "\n" + line[1:]
+			continue
+		}
+		kv := strings.SplitN(line, " ", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid commit header in %s: %q", sha, line)
+		}
+		headers = append(headers, CommitHeader{Key: kv[0], Value: kv[1]})
+	}
+
+	for _, header := range headers {
+		var err error
+		switch header.Key {
+		case "tree":
+			commit.Tree = header.Value
+		case "parent":
+			commit.Parents = append(commit.Parents, header.Value)
+		case "author":
+			commit.Author, err = parseSignature(header.Value)
+		case "committer":
+			commit.Committer, err = parseSignature(header.Value)
+		default:
+			commit.ExtraHeaders = append(commit.ExtraHeaders, header)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in %s: %s", header.Key, sha, err)
+		}
+	}
+	if commit.Tree == "" {
+		return nil, errors.New(fmt.Sprintf("Invalid commit blob: %s", string(commitBuf)))
+	}
+	return commit, nil
+}
+
+// Format the commit as the content of a commit object. Sha is ignored.
+func (c *Commit) encode() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "tree %s\n", c.Tree)
+	for _, parent := range c.Parents {
+		fmt.Fprintf(&buf, "parent %s\n", parent)
+	}
+	fmt.Fprintf(&buf, "author %s\n", c.Author)
+	fmt.Fprintf(&buf, "committer %s\n", c.Committer)
+	for _, header := range c.ExtraHeaders {
+		fmt.Fprintf(&buf, "%s %s\n", header.Key, strings.ReplaceAll(header.Value, "\n", "\n "))
+	}
+	buf.WriteString("\n")
+	buf.WriteString(c.Message)
+	return buf.Bytes()
+}
+
+// Write the commit object and return its sha. Unlike WriteCommitObject, the
+// author and the committer are taken from c rather than the environment.
+func WriteCommit(repo *Repository, c *Commit) (string, error) {
+	return repo.Objects.Put("commit", c.encode())
+}
+
+// Subject returns the first paragraph of the message joined into a line.
+func (c *Commit) Subject() string {
+	return messageSubject(c.Message)
+}
+
+// Body returns the message after the first paragraph.
+func (c *Commit) Body() string {
+	return messageBody(c.Message)
+}
+
+// Return the first paragraph of a commit or tag message joined into a line.
+func messageSubject(message string) string {
+	paragraph := strings.SplitN(strings.TrimLeft(message, "\n"), "\n\n", 2)[0]
+	lines := strings.Split(strings.TrimSpace(paragraph), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	return strings.Join(lines, " ")
+}
+
+// Return the message after the first paragraph.
+func messageBody(message string) string {
+	parts := strings.SplitN(strings.TrimLeft(message, "\n"), "\n\n", 2)
+	if len(parts) < 2 {
+		return ""
+	}
+	return strings.TrimLeft(parts[1], "\n")
+}
+
+// commitQueue is a priority queue of commits ordered by committer date (newest first).
+type commitQueue []*Commit
+
+func (q commitQueue) Len() int { return len(q) }
+func (q commitQueue) Less(i, j int) bool {
+	return q[i].Committer.When.After(q[j].Committer.When)
+}
+func (q commitQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *commitQueue) Push(x interface{}) {
+	*q = append(*q, x.(*Commit))
+}
+func (q *commitQueue) Pop() interface{} {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return c
+}
+
+// CommitWalker walks the history from the start commits in date order.
+// When paths are given, commits which don't touch them are skipped and only
+// the parent the commit is identical to (for the paths) is followed, like
+// git's default history simplification.
+type CommitWalker struct {
+	repo  *Repository
+	paths []string
+	queue commitQueue
+	seen  map[string]bool
+}
+
+// Start a walk from the commits, only showing those touching the paths if any.
+func NewCommitWalker(repo *Repository, starts []string, paths []string) (*CommitWalker, error) {
+	w := &CommitWalker{repo: repo, paths: paths, seen: map[string]bool{}}
+	for _, sha := range starts {
+		if err := w.push(sha); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+func (w *CommitWalker) push(sha string) error {
+	if w.seen[sha] {
+		return nil
+	}
+	w.seen[sha] = true
+	commit, err := ReadCommit(w.repo, sha)
+	if err != nil {
+		return err
+	}
+	heap.Push(&w.queue, commit)
+	return nil
+}
+
+// Next returns the next commit to show, or nil at the end of the history.
+func (w *CommitWalker) Next() (*Commit, error) {
+	for w.queue.Len() > 0 {
+		commit := heap.Pop(&w.queue).(*Commit)
+		if len(w.paths) == 0 {
+			for _, parent := range commit.Parents {
+				if err := w.push(parent); err != nil {
+					return nil, err
+				}
+			}
+			return commit, nil
+		}
+
+		show, parents, err := w.simplify(commit)
+		if err != nil {
+			return nil, err
+		}
+		for _, parent := range parents {
+			if err := w.push(parent); err != nil {
+				return nil, err
+			}
+		}
+		if show {
+			return commit, nil
+		}
+	}
+	return nil, nil
+}
+
+// Decide whether the commit changes the paths and which parents to follow.
+func (w *CommitWalker) simplify(commit *Commit) (show bool, parents []string, _ error) {
+	if len(commit.Parents) == 0 {
+		// The root commit is shown if it has any of the paths.
+		for _, p := range w.paths {
+			_, sha, err := lookupTreePath(w.repo, commit.Tree, p)
+			if err != nil {
+				return false, nil, err
+			}
+			if sha != "" {
+				return true, nil, nil
+			}
+		}
+		return false, nil, nil
+	}
+	for _, parent := range commit.Parents {
+		parentCommit, err := ReadCommit(w.repo, parent)
+		if err != nil {
+			return false, nil, err
+		}
+		same, err := w.treesame(commit.Tree, parentCommit.Tree)
+		if err != nil {
+			return false, nil, err
+		}
+		if same {
+			// Follow only the parent which has the same content.
+			return false, []string{parent}, nil
+		}
+	}
+	return true, commit.Parents, nil
+}
+
+// Report whether the paths have the same content in both trees.
+func (w *CommitWalker) treesame(treeSha, otherTreeSha string) (bool, error) {
+	for _, p := range w.paths {
+		_, sha, err := lookupTreePath(w.repo, treeSha, p)
+		if err != nil {
+			return false, err
+		}
+		_, otherSha, err := lookupTreePath(w.repo, otherTreeSha, p)
+		if err != nil {
+			return false, err
+		}
+		if sha != otherSha {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Return the set of commits reachable from the start commits.
+func reachableCommits(repo *Repository, starts ...string) (map[string]bool, error) {
+	walker, err := NewCommitWalker(repo, starts, nil)
+	if err != nil {
+		return nil, err
+	}
+	reachable := map[string]bool{}
+	for {
+		commit, err := walker.Next()
+		if err != nil {
+			return nil, err
+		}
+		if commit == nil {
+			return reachable, nil
+		}
+		reachable[commit.Sha] = true
+	}
+}
+
+// Report whether ancestor is reachable from commit (a commit is its own ancestor).
+func IsAncestor(repo *Repository, ancestor, commit string) (bool, error) {
+	if ancestor == commit {
+		return true, nil
+	}
+	reachable, err := reachableCommits(repo, commit)
+	if err != nil {
+		return false, err
+	}
+	return reachable[ancestor], nil
+}
+
+// Count the commits reachable from commit but not from base (ahead) and the
+// other way around (behind), like "ahead 1, behind 2" in git status.
+func AheadBehind(repo *Repository, commit, base string) (ahead, behind int, _ error) {
+	fromCommit, err := reachableCommits(repo, commit)
+	if err != nil {
+		return 0, 0, err
+	}
+	fromBase, err := reachableCommits(repo, base)
+	if err != nil {
+		return 0, 0, err
+	}
+	for sha := range fromCommit {
+		if !fromBase[sha] {
+			ahead++
+		}
+	}
+	for sha := range fromBase {
+		if !fromCommit[sha] {
+			behind++
+		}
+	}
+	return ahead, behind, nil
+}
@@ -0,0 +1,935 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ref: https://git-scm.com/docs/git-config#_configuration_file
+
+const maxIncludeDepth = 10
+
+type ConfigEntry struct {
+	Section    string // lower case, e.g. "remote"
+	Subsection string // case sensitive, e.g. "origin"
+	Key        string // lower case, e.g. "url"
+	Value      string
+	NoValue    bool   // "key" without "=", which means true for booleans
+	File       string // the file which defined the entry
+}
+
+// Config is the merged view of the config files. Entries keep the order in
+// which they appear, so the last one wins for single valued keys.
+type Config struct {
+	Entries []ConfigEntry
+}
+
+// Name returns the canonical name such as "remote.origin.url".
+func (e *ConfigEntry) Name() string {
+	if e.Subsection != "" {
+		return e.Section + "." + e.Subsection + "." + e.Key
+	}
+	return e.Section + "." + e.Key
+}
+
+// Split "section.subsection.key" into its parts. Section and key are
+// case insensitive, the subsection is not.
+func SplitConfigKey(key string) (section, subsection, name string, _ error) {
+	first := strings.Index(key, ".")
+	last := strings.LastIndex(key, ".")
+	if first < 0 || last == len(key)-1 || first == 0 {
+		return "", "", "", fmt.Errorf("key does not contain a section: %s", key)
+	}
+	section = strings.ToLower(key[:first])
+	name = strings.ToLower(key[last+1:])
+	if first != last {
+		subsection = key[first+1 : last]
+	}
+	if !isValidConfigName(section, true) || !isValidConfigName(name, false) {
+		return "", "", "", fmt.Errorf("invalid key: %s", key)
+	}
+	return section, subsection, name, nil
+}
+
+func isValidConfigName(name string, allowDot bool) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		isAlpha := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		isDigit := c >= '0' && c <= '9'
+		switch {
+		case isAlpha:
+		case (isDigit || c == '-') && i > 0:
+		case c == '.' && allowDot:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Return the system, global and local config files (in the order they are applied).
+// There is no local config file if repo is nil, i.e. outside a repository.
+func ConfigFiles(repo *Repository) (system string, global []string, local string) {
+	if os.Getenv("GIT_CONFIG_NOSYSTEM") == "" {
+		system = "/etc/gitconfig"
+		if env, ok := os.LookupEnv("GIT_CONFIG_SYSTEM"); ok {
+			system = env
+		}
+	}
+
+	if env, ok := os.LookupEnv("GIT_CONFIG_GLOBAL"); ok {
+		global = []string{env}
+	} else {
+		xdg := os.Getenv("XDG_CONFIG_HOME")
+		home, err := os.UserHomeDir()
+		if xdg == "" && err == nil {
+			xdg = filepath.Join(home, ".config")
+		}
+		if xdg != "" {
+			global = append(global, filepath.Join(xdg, "git", "config"))
+		}
+		if err == nil {
+			global = append(global, filepath.Join(home, ".gitconfig"))
+		}
+	}
+
+	if repo != nil {
+		local = path.Join(repo.GitDir, "config")
+	}
+	return system, global, local
+}
+
+// Load the system, global and local config files. Missing files are ignored.
+func LoadConfig(repo *Repository) (*Config, error) {
+	return ReadConfigFiles(repo, true)
+}
+
+func ReadConfigFiles(repo *Repository, includes bool) (*Config, error) {
+	system, global, local := ConfigFiles(repo)
+	files := []string{}
+	if system != "" {
+		files = append(files, system)
+	}
+	files = append(files, global...)
+
+	var fsys FS = OSFS{}
+	gitDir := ""
+	if repo != nil {
+		files = append(files, local)
+		fsys = repo.FS
+		var err error
+		if gitDir, err = filepath.Abs(repo.GitDir); err != nil {
+			return nil, err
+		}
+	}
+	config := &Config{}
+	for _, file := range files {
+		entries, err := ReadConfigFile(fsys, file, gitDir, includes, 0)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		config.Entries = append(config.Entries, entries...)
+	}
+	return config, nil
+}
+
+// Read a single config file, and the files it includes if includes is true.
+func ReadConfigFile(fsys FS, file, gitDir string, includes bool, depth int) ([]ConfigEntry, error) {
+	if depth > maxIncludeDepth {
+		return nil, fmt.Errorf("exceeded maximum include depth (%d) while including %s", maxIncludeDepth, file)
+	}
+	content, err := fsys.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := parseConfig(content)
+	if err != nil {
+		return nil, fmt.Errorf("bad config file %s: %s", file, err)
+	}
+
+	entries := []ConfigEntry{}
+	for _, entry := range parsed {
+		entry.File = file
+		entries = append(entries, entry)
+		if !includes || entry.Key != "path" || entry.NoValue {
+			continue
+		}
+		include := false
+		switch entry.Section {
+		case "include":
+			include = entry.Subsection == ""
+		case "includeif":
+			include = matchIncludeCondition(entry.Subsection, file, gitDir)
+		}
+		if !include {
+			continue
+		}
+		includePath := expandConfigPath(entry.Value, file)
+		included, err := ReadConfigFile(fsys, includePath, gitDir, includes, depth+1)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		entries = append(entries, included...)
+	}
+	return entries, nil
+}
+
+// Expand "~/" and resolve a relative path against the directory of the config file.
+func expandConfigPath(p, configFile string) string {
+	if strings.HasPrefix(p, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, p[2:])
+		}
+	}
+	if !filepath.IsAbs(p) {
+		return filepath.Join(filepath.Dir(configFile), p)
+	}
+	return p
+}
+
+// Evaluate the condition of [includeIf "<condition>"]. Only gitdir: and
+// gitdir/i: are supported.
+func matchIncludeCondition(condition, configFile, gitDir string) bool {
+	flags := wmPathname
+	var pattern string
+	switch {
+	case strings.HasPrefix(condition, "gitdir:"):
+		pattern = strings.TrimPrefix(condition, "gitdir:")
+	case strings.HasPrefix(condition, "gitdir/i:"):
+		pattern = strings.TrimPrefix(condition, "gitdir/i:")
+		flags |= wmCasefold
+	default:
+		return false
+	}
+
+	if strings.HasPrefix(pattern, "./") {
+		pattern = filepath.Join(filepath.Dir(configFile), pattern[2:])
+	} else if strings.HasPrefix(pattern, "~/") {
+		pattern = expandConfigPath(pattern, configFile)
+	} else if !filepath.IsAbs(pattern) {
+		pattern = "**/" + pattern
+	}
+	if strings.HasSuffix(pattern, "/") || strings.HasSuffix(condition, "/") {
+		pattern = strings.TrimSuffix(pattern, "/") + "/**"
+	}
+
+	dirs := []string{filepath.ToSlash(gitDir)}
+	if resolved, err := filepath.EvalSymlinks(gitDir); err == nil {
+		dirs = append(dirs, filepath.ToSlash(resolved))
+	}
+	for _, dir := range dirs {
+		if wildmatch(filepath.ToSlash(pattern), dir, flags) {
+			return true
+		}
+	}
+	return false
+}
+
+// configParser reads the config file syntax byte by byte like git's config.c.
+type configParser struct {
+	buf  []byte
+	pos  int
+	line int
+}
+
+func (p *configParser) next() (byte, bool) {
+	if p.pos >= len(p.buf) {
+		return 0, false
+	}
+	c := p.buf[p.pos]
+	p.pos++
+	// Treat "\r\n" as "\n".
+	if c == '\r' && p.pos < len(p.buf) && p.buf[p.pos] == '\n' {
+		c = '\n'
+		p.pos++
+	}
+	if c == '\n' {
+		p.line++
+	}
+	return c, true
+}
+
+func (p *configParser) peek() (byte, bool) {
+	if p.pos >= len(p.buf) {
+		return 0, false
+	}
+	return p.buf[p.pos], true
+}
+
+func (p *configParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", p.line+1, fmt.Sprintf(format, args...))
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+// Parse the content of a config file into entries.
+func parseConfig(content []byte) ([]ConfigEntry, error) {
+	// Skip UTF-8 BOM.
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	p := &configParser{buf: content}
+	entries := []ConfigEntry{}
+	section, subsection := "", ""
+	for {
+		c, ok := p.next()
+		if !ok {
+			return entries, nil
+		}
+		switch {
+		case isSpace(c):
+			continue
+		case c == '#' || c == ';':
+			p.skipLine()
+		case c == '[':
+			var err error
+			if section, subsection, err = p.parseSectionHeader(); err != nil {
+				return nil, err
+			}
+		case isAlpha(c):
+			if section == "" {
+				return nil, p.errorf("key outside of section")
+			}
+			entry, err := p.parseEntry(c)
+			if err != nil {
+				return nil, err
+			}
+			entry.Section = section
+			entry.Subsection = subsection
+			entries = append(entries, *entry)
+		default:
+			return nil, p.errorf("unexpected character %q", c)
+		}
+	}
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func (p *configParser) skipLine() {
+	for {
+		c, ok := p.next()
+		if !ok || c == '\n' {
+			return
+		}
+	}
+}
+
+// Parse "[section]", "[section "subsection"]" or the deprecated "[section.subsection]".
+// The leading "[" has already been consumed.
+func (p *configParser) parseSectionHeader() (section, subsection string, _ error) {
+	name := []byte{}
+	for {
+		c, ok := p.next()
+		if !ok {
+			return "", "", p.errorf("unterminated section header")
+		}
+		if c == ']' {
+			s := strings.ToLower(string(name))
+			if dot := strings.Index(s, "."); dot >= 0 {
+				// [section.subsection] is lower cased.
+				return s[:dot], s[dot+1:], nil
+			}
+			if s == "" {
+				return "", "", p.errorf("empty section name")
+			}
+			return s, "", nil
+		}
+		if isSpace(c) {
+			break
+		}
+		if !isAlpha(c) && !(c >= '0' && c <= '9') && c != '-' && c != '.' {
+			return "", "", p.errorf("invalid section name")
+		}
+		name = append(name, c)
+	}
+
+	// [section "subsection"]
+	for {
+		c, ok := p.next()
+		if !ok {
+			return "", "", p.errorf("unterminated section header")
+		}
+		if isSpace(c) {
+			continue
+		}
+		if c != '"' {
+			return "", "", p.errorf("invalid section header")
+		}
+		break
+	}
+	sub := []byte{}
+	for {
+		c, ok := p.next()
+		if !ok || c == '\n' {
+			return "", "", p.errorf("unterminated subsection name")
+		}
+		if c == '"' {
+			break
+		}
+		if c == '\\' {
+			if c, ok = p.next(); !ok || c == '\n' {
+				return "", "", p.errorf("unterminated subsection name")
+			}
+		}
+		sub = append(sub, c)
+	}
+	if c, ok := p.next(); !ok || c != ']' {
+		return "", "", p.errorf("invalid section header")
+	}
+	return strings.ToLower(string(name)), string(sub), nil
+}
+
+// Parse "key = value". The first character of the key has already been consumed.
+func (p *configParser) parseEntry(first byte) (*ConfigEntry, error) {
+	key := []byte{first}
+	for {
+		c, ok := p.peek()
+		if !ok || !(isAlpha(c) || (c >= '0' && c <= '9') || c == '-') {
+			break
+		}
+		p.next()
+		key = append(key, c)
+	}
+	entry := &ConfigEntry{Key: strings.ToLower(string(key))}
+
+	// Skip spaces before "=".
+	for {
+		c, ok := p.peek()
+		if !ok || c == '\n' || c == '#' || c == ';' {
+			// "key" alone means true.
+			entry.NoValue = true
+			if ok && c != '\n' {
+				p.skipLine()
+			}
+			return entry, nil
+		}
+		if c == ' ' || c == '\t' || c == '\r' {
+			p.next()
+			continue
+		}
+		if c != '=' {
+			return nil, p.errorf("invalid key %q", string(key))
+		}
+		p.next()
+		break
+	}
+
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	entry.Value = value
+	return entry, nil
+}
+
+// Parse the value after "=" until the end of the line, handling quotes,
+// escape sequences, comments and line continuations.
+func (p *configParser) parseValue() (string, error) {
+	value := []byte{}
+	quote, comment := false, false
+	spaces := 0
+	for {
+		c, ok := p.next()
+		if !ok {
+			if quote {
+				return "", p.errorf("unterminated quote")
+			}
+			return string(value), nil
+		}
+		if c == '\n' {
+			if quote {
+				return "", p.errorf("unterminated quote")
+			}
+			return string(value), nil
+		}
+		if comment {
+			continue
+		}
+		if isSpace(c) && !quote {
+			// Whitespace is kept only between words.
+			if len(value) > 0 {
+				spaces++
+			}
+			continue
+		}
+		if !quote && (c == ';' || c == '#') {
+			comment = true
+			continue
+		}
+		for ; spaces > 0; spaces-- {
+			value = append(value, ' ')
+		}
+		switch c {
+		case '\\':
+			c, ok = p.next()
+			if !ok {
+				return "", p.errorf("bad escape at end of file")
+			}
+			switch c {
+			case '\n':
+				// line continuation
+			case 't':
+				value = append(value, '\t')
+			case 'b':
+				if len(value) > 0 {
+					value = value[:len(value)-1]
+				}
+			case 'n':
+				value = append(value, '\n')
+			case '\\', '"':
+				value = append(value, c)
+			default:
+				return "", p.errorf("invalid escape sequence \\%c", c)
+			}
+		case '"':
+			quote = !quote
+		default:
+			value = append(value, c)
+		}
+	}
+}
+
+// Get returns the last value of the key. ok is false when the key is not set.
+func (c *Config) Get(key string) (value string, ok bool) {
+	values := c.GetAll(key)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[len(values)-1], true
+}
+
+// GetAll returns all values of a multi-valued key in order. A key without
+// "=" has an empty value (use GetBool to read it as true).
+func (c *Config) GetAll(key string) []string {
+	values := []string{}
+	for _, entry := range c.Lookup(key) {
+		values = append(values, entry.Value)
+	}
+	return values
+}
+
+func (c *Config) Lookup(key string) []ConfigEntry {
+	section, subsection, name, err := SplitConfigKey(key)
+	if err != nil {
+		return nil
+	}
+	entries := []ConfigEntry{}
+	for _, entry := range c.Entries {
+		if entry.Section == section && entry.Subsection == subsection && entry.Key == name {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// GetBool returns the boolean value of the key, or defaultValue if it's not set.
+func (c *Config) GetBool(key string, defaultValue bool) (bool, error) {
+	entries := c.Lookup(key)
+	if len(entries) == 0 {
+		return defaultValue, nil
+	}
+	last := entries[len(entries)-1]
+	if last.NoValue {
+		return true, nil
+	}
+	return parseConfigBool(last.Value)
+}
+
+// GetInt returns the integer value of the key, or defaultValue if it's not set.
+func (c *Config) GetInt(key string, defaultValue int64) (int64, error) {
+	value, ok := c.Get(key)
+	if !ok {
+		return defaultValue, nil
+	}
+	return parseConfigInt(value)
+}
+
+func parseConfigBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0", "":
+		return false, nil
+	}
+	// Any other integer is also a boolean.
+	if n, err := parseConfigInt(value); err == nil {
+		return n != 0, nil
+	}
+	return false, fmt.Errorf("bad boolean config value '%s'", value)
+}
+
+// Parse an integer with an optional k, m or g suffix (1024 based).
+func parseConfigInt(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, errors.New("bad numeric config value ''")
+	}
+	multiplier := int64(1)
+	switch value[len(value)-1] {
+	case 'k', 'K':
+		multiplier = 1 << 10
+	case 'm', 'M':
+		multiplier = 1 << 20
+	case 'g', 'G':
+		multiplier = 1 << 30
+	}
+	if multiplier != 1 {
+		value = value[:len(value)-1]
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad numeric config value '%s'", value)
+	}
+	return n * multiplier, nil
+}
+
+// Return the value of the key (e.g. "user.name") from the config files.
+// ok is false when the key is not set or the config can't be read.
+func GetConfigValue(repo *Repository, key string) (value string, ok bool) {
+	config, err := LoadConfig(repo)
+	if err != nil {
+		return "", false
+	}
+	return config.Get(key)
+}
+
+// configLine is a line of a config file kept verbatim for editing, with the
+// key it defines if any.
+type configLine struct {
+	raw        string // including continuation lines and the trailing newline
+	section    string
+	subsection string
+	key        string // "" for section headers, comments and blank lines
+	header     bool
+}
+
+// ConfigFile is a config file which can be edited without losing comments
+// and formatting.
+type ConfigFile struct {
+	fsys  FS
+	path  string
+	lines []configLine
+}
+
+// Open the config file for editing; a missing file is created by Save.
+func OpenConfigFile(fsys FS, file string) (*ConfigFile, error) {
+	content, err := fsys.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	// Make sure the file is valid before editing it.
+	if _, err := parseConfig(content); err != nil {
+		return nil, fmt.Errorf("bad config file %s: %s", file, err)
+	}
+
+	cf := &ConfigFile{fsys: fsys, path: file}
+	section, subsection := "", ""
+	rawLines := strings.SplitAfter(string(content), "\n")
+	for i := 0; i < len(rawLines); i++ {
+		raw := rawLines[i]
+		if raw == "" {
+			continue
+		}
+		trimmed := strings.TrimSpace(raw)
+		// Join the continuation lines of a value.
+		for trimmed != "" && isAlpha(trimmed[0]) && endsWithContinuation(raw) && i+1 < len(rawLines) {
+			i++
+			raw += rawLines[i]
+		}
+		line := configLine{raw: raw}
+		if strings.HasPrefix(trimmed, "[") {
+			p := &configParser{buf: []byte(trimmed[1:])}
+			if s, sub, err := p.parseSectionHeader(); err == nil {
+				section, subsection = s, sub
+			}
+			line.header = true
+		} else if trimmed != "" && isAlpha(trimmed[0]) {
+			if entries, err := parseConfig([]byte("[x]\n" + raw)); err == nil && len(entries) == 1 {
+				line.key = entries[0].Key
+			}
+		}
+		line.section, line.subsection = section, subsection
+		cf.lines = append(cf.lines, line)
+	}
+	return cf, nil
+}
+
+// Report whether the line ends with an odd number of backslashes.
+func endsWithContinuation(raw string) bool {
+	trimmed := strings.TrimRight(raw, "\r\n")
+	backslashes := len(trimmed) - len(strings.TrimRight(trimmed, "\\"))
+	return backslashes%2 == 1
+}
+
+// Write the config file through a lock file.
+func (cf *ConfigFile) Save() error {
+	var buf bytes.Buffer
+	for _, line := range cf.lines {
+		buf.WriteString(line.raw)
+	}
+	if err := cf.fsys.MkdirAll(filepath.Dir(cf.path), 0755); err != nil {
+		return err
+	}
+	lockPath := cf.path + ".lock"
+	lockFile, err := cf.fsys.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("could not lock config file %s: %s", cf.path, err)
+	}
+	if _, err := lockFile.Write(buf.Bytes()); err != nil {
+		lockFile.Close()
+		cf.fsys.Remove(lockPath)
+		return err
+	}
+	if err := lockFile.Close(); err != nil {
+		cf.fsys.Remove(lockPath)
+		return err
+	}
+	return cf.fsys.Rename(lockPath, cf.path)
+}
+
+// Return the indexes of the lines which define the key.
+func (cf *ConfigFile) find(section, subsection, key string) []int {
+	found := []int{}
+	for i, line := range cf.lines {
+		if line.key == key && line.section == section && line.subsection == subsection {
+			found = append(found, i)
+		}
+	}
+	return found
+}
+
+// Format "\tkey = value\n" quoting the value if needed.
+func formatConfigLine(key, value string) string {
+	needsQuote := strings.TrimSpace(value) != value || strings.ContainsAny(value, "#;")
+	var escaped strings.Builder
+	for _, c := range value {
+		switch c {
+		case '\\':
+			escaped.WriteString("\\\\")
+		case '"':
+			escaped.WriteString("\\\"")
+		case '\n':
+			escaped.WriteString("\\n")
+		case '\t':
+			escaped.WriteString("\\t")
+		default:
+			escaped.WriteRune(c)
+		}
+	}
+	if needsQuote {
+		return fmt.Sprintf("\t%s = \"%s\"\n", key, escaped.String())
+	}
+	return fmt.Sprintf("\t%s = %s\n", key, escaped.String())
+}
+
+func formatSectionHeader(section, subsection string) string {
+	if subsection == "" {
+		return fmt.Sprintf("[%s]\n", section)
+	}
+	escaped := strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(subsection)
+	return fmt.Sprintf("[%s \"%s\"]\n", section, escaped)
+}
+
+// Set the single valued key. With replaceAll all existing values are replaced,
+// otherwise it fails if the key has multiple values.
+func (cf *ConfigFile) Set(key, value string, replaceAll bool) error {
+	section, subsection, name, err := SplitConfigKey(key)
+	if err != nil {
+		return err
+	}
+	found := cf.find(section, subsection, name)
+	if len(found) > 1 && !replaceAll {
+		return fmt.Errorf("warning: %s has multiple values\nerror: cannot overwrite multiple values with a single value", key)
+	}
+	if len(found) == 0 {
+		return cf.Add(key, value)
+	}
+	// Replace the last one and remove the others.
+	last := found[len(found)-1]
+	cf.lines[last].raw = formatConfigLine(key[strings.LastIndex(key, ".")+1:], value)
+	cf.removeLines(found[:len(found)-1])
+	return nil
+}
+
+// Add a new value to the key, keeping the existing values.
+func (cf *ConfigFile) Add(key, value string) error {
+	section, subsection, name, err := SplitConfigKey(key)
+	if err != nil {
+		return err
+	}
+	// New lines keep the case given by the user.
+	line := configLine{
+		raw:        formatConfigLine(key[strings.LastIndex(key, ".")+1:], value),
+		section:    section,
+		subsection: subsection,
+		key:        name,
+	}
+
+	// Insert after the last line of the last matching section.
+	insertAt := -1
+	for i, l := range cf.lines {
+		if l.section == section && l.subsection == subsection && (l.header || l.key != "") {
+			insertAt = i + 1
+		}
+	}
+	if insertAt < 0 {
+		if n := len(cf.lines); n > 0 && !strings.HasSuffix(cf.lines[n-1].raw, "\n") {
+			cf.lines[n-1].raw += "\n"
+		}
+		cf.lines = append(cf.lines, configLine{
+			raw:        formatSectionHeader(key[:strings.Index(key, ".")], subsection),
+			section:    section,
+			subsection: subsection,
+			header:     true,
+		}, line)
+		return nil
+	}
+	if !strings.HasSuffix(cf.lines[insertAt-1].raw, "\n") {
+		cf.lines[insertAt-1].raw += "\n"
+	}
+	cf.lines = append(cf.lines[:insertAt], append([]configLine{line}, cf.lines[insertAt:]...)...)
+	return nil
+}
+
+// Remove the key. With all every value is removed, otherwise it fails if
+// the key has multiple values. Returns false if the key was not set.
+func (cf *ConfigFile) Unset(key string, all bool) (bool, error) {
+	section, subsection, name, err := SplitConfigKey(key)
+	if err != nil {
+		return false, err
+	}
+	found := cf.find(section, subsection, name)
+	if len(found) == 0 {
+		return false, nil
+	}
+	if len(found) > 1 && !all {
+		return false, fmt.Errorf("warning: %s has multiple values", key)
+	}
+	cf.removeLines(found)
+	cf.removeEmptySection(section, subsection)
+	return true, nil
+}
+
+// Remove the section (e.g. "branch.topic") with all its keys. Returns false
+// if the section doesn't exist.
+func (cf *ConfigFile) RemoveSection(name string) bool {
+	section, subsection := splitSectionName(name)
+	found := false
+	lines := []configLine{}
+	for _, line := range cf.lines {
+		if line.section == section && line.subsection == subsection {
+			found = true
+			continue
+		}
+		lines = append(lines, line)
+	}
+	cf.lines = lines
+	return found
+}
+
+// Rename the section (e.g. "branch.old" to "branch.new"), keeping its keys.
+// Returns false if the section doesn't exist.
+func (cf *ConfigFile) RenameSection(oldName, newName string) bool {
+	section, subsection := splitSectionName(oldName)
+	newSection, newSubsection := splitSectionName(newName)
+	found := false
+	for i, line := range cf.lines {
+		if line.section != section || line.subsection != subsection {
+			continue
+		}
+		found = true
+		if line.header {
+			cf.lines[i].raw = formatSectionHeader(newName[:strings.Index(newName+".", ".")], newSubsection)
+		}
+		cf.lines[i].section, cf.lines[i].subsection = newSection, newSubsection
+	}
+	return found
+}
+
+// Split "section.subsection" into the lower case section and the subsection.
+func splitSectionName(name string) (section, subsection string) {
+	if dot := strings.Index(name, "."); dot >= 0 {
+		return strings.ToLower(name[:dot]), name[dot+1:]
+	}
+	return strings.ToLower(name), ""
+}
+
+func (cf *ConfigFile) removeLines(indexes []int) {
+	remove := map[int]bool{}
+	for _, i := range indexes {
+		remove[i] = true
+	}
+	lines := []configLine{}
+	for i, line := range cf.lines {
+		if !remove[i] {
+			lines = append(lines, line)
+		}
+	}
+	cf.lines = lines
+}
+
+// Remove the section header if the section has no keys or comments any more.
+func (cf *ConfigFile) removeEmptySection(section, subsection string) {
+	for i := 0; i < len(cf.lines); i++ {
+		if !cf.lines[i].header || cf.lines[i].section != section || cf.lines[i].subsection != subsection {
+			continue
+		}
+		empty := true
+		for j := i + 1; j < len(cf.lines) && !cf.lines[j].header; j++ {
+			if strings.TrimSpace(cf.lines[j].raw) != "" {
+				empty = false
+				break
+			}
+		}
+		if empty {
+			cf.removeLines([]int{i})
+			i--
+		}
+	}
+}
+
+// Canonicalize the value for --type=bool, int or path.
+func FormatConfigValue(entry ConfigEntry, valueType string) (string, error) {
+	value := entry.Value
+	switch valueType {
+	case "":
+		return value, nil
+	case "bool":
+		if entry.NoValue {
+			return "true", nil
+		}
+		b, err := parseConfigBool(value)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatBool(b), nil
+	case "int":
+		n, err := parseConfigInt(value)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(n, 10), nil
+	case "path":
+		if strings.HasPrefix(value, "~/") {
+			if home, err := os.UserHomeDir(); err == nil {
+				return filepath.Join(home, value[2:]), nil
+			}
+		}
+		return value, nil
+	}
+	return "", fmt.Errorf("unrecognized --type argument, %s", valueType)
+}
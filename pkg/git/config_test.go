@@ -0,0 +1,245 @@
+package git
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string // name=value, name for keys without a value
+		wantErr bool
+	}{
+		{
+			name:    "sections and subsections",
+			content: "[core]\n\tbare = false\n[remote \"origin\"]\n\turl = https://example.com/repo.git\n",
+			want:    []string{"core.bare=false", "remote.origin.url=https://example.com/repo.git"},
+		},
+		{
+			name:    "case",
+			content: "[Core]\n\tIgnoreCase = true\n[Branch \"Topic\"]\n\tRemote = origin\n",
+			want:    []string{"core.ignorecase=true", "branch.Topic.remote=origin"},
+		},
+		{
+			name:    "old style subsection",
+			content: "[branch.topic]\n\tremote = origin\n",
+			want:    []string{"branch.topic.remote=origin"},
+		},
+		{
+			name:    "comments and whitespace",
+			content: "# comment\n; comment\n[a]\n  b   =   c d   # comment\n",
+			want:    []string{"a.b=c d"},
+		},
+		{
+			name:    "quotes and escapes",
+			content: "[a]\n\tb = \" x \" y\n\tc = \"#\\\"\\\\\\t\"\n\td = 1\\n2\n",
+			want:    []string{"a.b= x  y", "a.c=#\"\\\t", "a.d=1\n2"},
+		},
+		{
+			name:    "continuation lines",
+			content: "[a]\n\tb = one \\\n  two\n",
+			want:    []string{"a.b=one   two"},
+		},
+		{
+			name:    "no value",
+			content: "[a]\n\tflag\n\tempty =\n",
+			want:    []string{"a.flag", "a.empty="},
+		},
+		{
+			name:    "several values",
+			content: "[a]\n\tb = 1\n\tb = 2\n[a]\n\tb = 3\n",
+			want:    []string{"a.b=1", "a.b=2", "a.b=3"},
+		},
+		{name: "unterminated section", content: "[a\n\tb = 1\n", wantErr: true},
+		{name: "key outside a section", content: "b = 1\n", wantErr: true},
+		{name: "unterminated quote", content: "[a]\n\tb = \"1\n", wantErr: true},
+		{name: "bad key", content: "[a]\n\t1b = 1\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := parseConfig([]byte(tt.content))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseConfig() = %v, want an error", entries)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, e := range entries {
+				if e.NoValue {
+					got = append(got, e.Name())
+				} else {
+					got = append(got, e.Name()+"="+e.Value)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseConfig() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigFileEdits(t *testing.T) {
+	const original = "# settings\n[core]\n\tbare = false ; keep\n[remote \"origin\"]\n\turl = old\n\tfetch = a\n\tfetch = b\n"
+	tests := []struct {
+		name    string
+		edit    func(cf *ConfigFile) error
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "set a new key in an existing section",
+			edit: func(cf *ConfigFile) error { return cf.Set("core.editor", "vi", false) },
+			want: "# settings\n[core]\n\tbare = false ; keep\n\teditor = vi\n[remote \"origin\"]\n\turl = old\n\tfetch = a\n\tfetch = b\n",
+		},
+		{
+			name: "replace a value",
+			edit: func(cf *ConfigFile) error { return cf.Set("remote.origin.url", "new", false) },
+			want: "# settings\n[core]\n\tbare = false ; keep\n[remote \"origin\"]\n\turl = new\n\tfetch = a\n\tfetch = b\n",
+		},
+		{
+			name: "set in a new section",
+			edit: func(cf *ConfigFile) error { return cf.Set("branch.Topic.merge", "refs/heads/topic", false) },
+			want: original + "[branch \"Topic\"]\n\tmerge = refs/heads/topic\n",
+		},
+		{
+			name: "quote values",
+			edit: func(cf *ConfigFile) error { return cf.Set("a.b", " x#\"\\", false) },
+			want: original + "[a]\n\tb = \" x#\\\"\\\\\"\n",
+		},
+		{
+			name:    "set a key with several values",
+			edit:    func(cf *ConfigFile) error { return cf.Set("remote.origin.fetch", "c", false) },
+			wantErr: true,
+		},
+		{
+			name: "replace all values",
+			edit: func(cf *ConfigFile) error { return cf.Set("remote.origin.fetch", "c", true) },
+			want: "# settings\n[core]\n\tbare = false ; keep\n[remote \"origin\"]\n\turl = old\n\tfetch = c\n",
+		},
+		{
+			name: "add a value",
+			edit: func(cf *ConfigFile) error { return cf.Add("remote.origin.fetch", "c") },
+			want: original + "\tfetch = c\n",
+		},
+		{
+			name: "unset the last key of a section",
+			edit: func(cf *ConfigFile) error {
+				_, err := cf.Unset("core.bare", false)
+				return err
+			},
+			want: "# settings\n[remote \"origin\"]\n\turl = old\n\tfetch = a\n\tfetch = b\n",
+		},
+		{
+			name: "unset all values",
+			edit: func(cf *ConfigFile) error {
+				_, err := cf.Unset("remote.origin.fetch", true)
+				return err
+			},
+			want: "# settings\n[core]\n\tbare = false ; keep\n[remote \"origin\"]\n\turl = old\n",
+		},
+		{
+			name: "remove a section",
+			edit: func(cf *ConfigFile) error {
+				cf.RemoveSection("remote.origin")
+				return nil
+			},
+			want: "# settings\n[core]\n\tbare = false ; keep\n",
+		},
+		{
+			name: "rename a section",
+			edit: func(cf *ConfigFile) error {
+				cf.RenameSection("remote.origin", "remote.upstream")
+				return nil
+			},
+			want: "# settings\n[core]\n\tbare = false ; keep\n[remote \"upstream\"]\n\turl = old\n\tfetch = a\n\tfetch = b\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := NewMemoryFS()
+			if err := fsys.WriteFile("/config", []byte(original), 0644); err != nil {
+				t.Fatal(err)
+			}
+			cf, err := OpenConfigFile(fsys, "/config")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = tt.edit(cf)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := cf.Save(); err != nil {
+				t.Fatal(err)
+			}
+			content, err := fsys.ReadFile("/config")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != tt.want {
+				t.Errorf("config file = %q, want %q", content, tt.want)
+			}
+			// The file stays valid.
+			if _, err := ReadConfigFile(fsys, "/config", "/.git", false, 0); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestConfigRoundTrip(t *testing.T) {
+	fsys := NewMemoryFS()
+	cf, err := OpenConfigFile(fsys, "/config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]string{
+		"user.name":            "A U Thor",
+		"core.bare":            "false",
+		"remote.origin.url":    "https://example.com/a b.git",
+		"branch.Topic.remote":  "origin",
+		"alias.lg":             "log --oneline # short",
+		"a.tricky":             "\ttab \"quote\" back\\slash\nnewline ",
+		"include.path":         "~/other",
+		"color.ui":             "",
+		"http.sslverify":       "yes",
+		"remote.origin.fetch":  "+refs/heads/*:refs/remotes/origin/*",
+		"section.with.dot.key": "v",
+	}
+	for key, value := range values {
+		if err := cf.Set(key, value, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cf.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ReadConfigFile(fsys, "/config", "/.git", false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{Entries: entries}
+	for key, want := range values {
+		if got, ok := config.Get(key); !ok || got != want {
+			t.Errorf("Get(%q) = %q, %v, want %q", key, got, ok, want)
+		}
+	}
+	if verify, err := config.GetBool("http.sslVerify", false); err != nil || !verify {
+		t.Errorf("GetBool() = %v, %v, want true", verify, err)
+	}
+	if len(entries) != len(values) {
+		t.Errorf("read %d entries, want %d", len(entries), len(values))
+	}
+}
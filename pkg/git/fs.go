@@ -0,0 +1,455 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FS is the filesystem holding the git directory and the working tree of a
+// repository. The methods behave like the functions of the same name in os.
+type FS interface {
+	Open(name string) (File, error)
+	OpenFile(name string, flag int, perm fs.FileMode) (File, error)
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	Stat(name string) (fs.FileInfo, error)
+	Lstat(name string) (fs.FileInfo, error)
+	// ReadDir returns the entries sorted by name.
+	ReadDir(name string) ([]fs.DirEntry, error)
+	Readlink(name string) (string, error)
+	Symlink(oldname, newname string) error
+	MkdirAll(name string, perm fs.FileMode) error
+	Remove(name string) error
+	Rename(oldpath, newpath string) error
+	Chmod(name string, mode fs.FileMode) error
+}
+
+type File interface {
+	io.Reader
+	io.Writer
+	io.Closer
+}
+
+// OSFS is the filesystem of the operating system.
+type OSFS struct{}
+
+func (OSFS) Open(name string) (File, error) { return os.Open(name) }
+func (OSFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	return os.OpenFile(name, flag, perm)
+}
+func (OSFS) ReadFile(name string) ([]byte, error) { return os.ReadFile(name) }
+func (OSFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+func (OSFS) Stat(name string) (fs.FileInfo, error)        { return os.Stat(name) }
+func (OSFS) Lstat(name string) (fs.FileInfo, error)       { return os.Lstat(name) }
+func (OSFS) ReadDir(name string) ([]fs.DirEntry, error)   { return os.ReadDir(name) }
+func (OSFS) Readlink(name string) (string, error)         { return os.Readlink(name) }
+func (OSFS) Symlink(oldname, newname string) error        { return os.Symlink(oldname, newname) }
+func (OSFS) MkdirAll(name string, perm fs.FileMode) error { return os.MkdirAll(name, perm) }
+func (OSFS) Remove(name string) error                     { return os.Remove(name) }
+func (OSFS) Rename(oldpath, newpath string) error         { return os.Rename(oldpath, newpath) }
+func (OSFS) Chmod(name string, mode fs.FileMode) error    { return os.Chmod(name, mode) }
+
+// Write data to name through name.lock, so that readers never see a partially
+// written file and concurrent writers fail instead of overwriting each other.
+func writeFileLocked(fsys FS, name string, data []byte) error {
+	lockPath := name + ".lock"
+	lockFile, err := fsys.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to create %s: %s", lockPath, err)
+	}
+	if _, err := lockFile.Write(data); err != nil {
+		lockFile.Close()
+		fsys.Remove(lockPath)
+		return err
+	}
+	if err := lockFile.Close(); err != nil {
+		fsys.Remove(lockPath)
+		return err
+	}
+	return fsys.Rename(lockPath, name)
+}
+
+// Call fn for root and everything under it in lexical order, like
+// filepath.WalkDir. Returning fs.SkipDir from fn for a directory skips it.
+func walkFS(fsys FS, root string, fn func(name string, d fs.DirEntry) error) error {
+	info, err := fsys.Lstat(root)
+	if err != nil {
+		return err
+	}
+	err = walkFSEntry(fsys, root, fs.FileInfoToDirEntry(info), fn)
+	if err == fs.SkipDir {
+		return nil
+	}
+	return err
+}
+
+func walkFSEntry(fsys FS, name string, d fs.DirEntry, fn func(name string, d fs.DirEntry) error) error {
+	if err := fn(name, d); err != nil || !d.IsDir() {
+		return err
+	}
+	entries, err := fsys.ReadDir(name)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		err := walkFSEntry(fsys, filepath.Join(name, entry.Name()), entry, fn)
+		if err == fs.SkipDir && entry.IsDir() {
+			continue
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove name and, if it is a directory, everything in it.
+func removeAll(fsys FS, name string) error {
+	names := []string{}
+	if err := walkFS(fsys, name, func(p string, d fs.DirEntry) error {
+		names = append(names, p)
+		return nil
+	}); err != nil {
+		return err
+	}
+	// Children come after their directory.
+	for i := len(names) - 1; i >= 0; i-- {
+		if err := fsys.Remove(names[i]); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// MemoryFS is a filesystem kept in memory. Absolute and relative names are
+// the same, e.g. "/a/b" and "a/b" are the same file.
+type MemoryFS struct {
+	nodes map[string]*memNode
+}
+
+type memNode struct {
+	mode    fs.FileMode // with fs.ModeDir or fs.ModeSymlink for directories and symlinks
+	data    []byte      // the content or the target of a symlink
+	modTime time.Time
+}
+
+func NewMemoryFS() *MemoryFS {
+	return &MemoryFS{nodes: map[string]*memNode{
+		".": {mode: fs.ModeDir | 0755, modTime: time.Now()},
+	}}
+}
+
+func memPath(name string) string {
+	name = strings.TrimLeft(path.Clean(filepath.ToSlash(name)), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func memPathError(op, name string, err error) error {
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// Follow the symlinks at name.
+func (m *MemoryFS) resolve(op, name string) (string, *memNode, error) {
+	p := memPath(name)
+	for i := 0; i < 40; i++ {
+		node, ok := m.nodes[p]
+		if !ok {
+			return "", nil, memPathError(op, name, fs.ErrNotExist)
+		}
+		if node.mode&fs.ModeSymlink == 0 {
+			return p, node, nil
+		}
+		target := string(node.data)
+		if !path.IsAbs(target) {
+			target = path.Join(path.Dir(p), target)
+		}
+		p = memPath(target)
+	}
+	return "", nil, memPathError(op, name, errors.New("too many levels of symbolic links"))
+}
+
+// Check that the parent directory of p exists.
+func (m *MemoryFS) checkParent(op, name, p string) error {
+	parent, ok := m.nodes[path.Dir(p)]
+	if !ok {
+		return memPathError(op, name, fs.ErrNotExist)
+	}
+	if !parent.mode.IsDir() {
+		return memPathError(op, name, errors.New("not a directory"))
+	}
+	return nil
+}
+
+func (m *MemoryFS) Open(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (m *MemoryFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	p, node, err := m.resolve("open", name)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) || flag&os.O_CREATE == 0 {
+			return nil, err
+		}
+		p = memPath(name)
+		if err := m.checkParent("open", name, p); err != nil {
+			return nil, err
+		}
+		node = &memNode{mode: perm.Perm(), modTime: time.Now()}
+		m.nodes[p] = node
+	} else if flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+		return nil, memPathError("open", name, fs.ErrExist)
+	} else if node.mode.IsDir() && flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		return nil, memPathError("open", name, errors.New("is a directory"))
+	}
+	if flag&os.O_TRUNC != 0 {
+		node.data = nil
+		node.modTime = time.Now()
+	}
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	return &memFile{
+		node:     node,
+		name:     name,
+		readable: flag&os.O_WRONLY == 0,
+		writable: writable,
+		append:   flag&os.O_APPEND != 0,
+	}, nil
+}
+
+func (m *MemoryFS) ReadFile(name string) ([]byte, error) {
+	_, node, err := m.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if node.mode.IsDir() {
+		return nil, memPathError("read", name, errors.New("is a directory"))
+	}
+	return append([]byte{}, node.data...), nil
+}
+
+func (m *MemoryFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	f, err := m.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (m *MemoryFS) Stat(name string) (fs.FileInfo, error) {
+	p, node, err := m.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return newMemFileInfo(p, node), nil
+}
+
+func (m *MemoryFS) Lstat(name string) (fs.FileInfo, error) {
+	p := memPath(name)
+	node, ok := m.nodes[p]
+	if !ok {
+		return nil, memPathError("lstat", name, fs.ErrNotExist)
+	}
+	return newMemFileInfo(p, node), nil
+}
+
+func (m *MemoryFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	p, node, err := m.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if !node.mode.IsDir() {
+		return nil, memPathError("readdirent", name, errors.New("not a directory"))
+	}
+	entries := []fs.DirEntry{}
+	for childPath, child := range m.nodes {
+		if childPath != "." && path.Dir(childPath) == p {
+			entries = append(entries, fs.FileInfoToDirEntry(newMemFileInfo(childPath, child)))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+func (m *MemoryFS) Readlink(name string) (string, error) {
+	node, ok := m.nodes[memPath(name)]
+	if !ok {
+		return "", memPathError("readlink", name, fs.ErrNotExist)
+	}
+	if node.mode&fs.ModeSymlink == 0 {
+		return "", memPathError("readlink", name, errors.New("invalid argument"))
+	}
+	return string(node.data), nil
+}
+
+func (m *MemoryFS) Symlink(oldname, newname string) error {
+	p := memPath(newname)
+	if _, ok := m.nodes[p]; ok {
+		return memPathError("symlink", newname, fs.ErrExist)
+	}
+	if err := m.checkParent("symlink", newname, p); err != nil {
+		return err
+	}
+	m.nodes[p] = &memNode{mode: fs.ModeSymlink | 0777, data: []byte(oldname), modTime: time.Now()}
+	return nil
+}
+
+func (m *MemoryFS) MkdirAll(name string, perm fs.FileMode) error {
+	p := memPath(name)
+	if p == "." {
+		return nil
+	}
+	if err := m.MkdirAll(path.Dir(p), perm); err != nil {
+		return err
+	}
+	if _, node, err := m.resolve("mkdir", p); err == nil {
+		if !node.mode.IsDir() {
+			return memPathError("mkdir", name, errors.New("not a directory"))
+		}
+		return nil
+	}
+	m.nodes[p] = &memNode{mode: fs.ModeDir | perm.Perm(), modTime: time.Now()}
+	return nil
+}
+
+func (m *MemoryFS) Remove(name string) error {
+	p := memPath(name)
+	node, ok := m.nodes[p]
+	if !ok || p == "." {
+		return memPathError("remove", name, fs.ErrNotExist)
+	}
+	if node.mode.IsDir() {
+		for childPath := range m.nodes {
+			if childPath != "." && path.Dir(childPath) == p {
+				return memPathError("remove", name, errors.New("directory not empty"))
+			}
+		}
+	}
+	delete(m.nodes, p)
+	return nil
+}
+
+func (m *MemoryFS) Rename(oldpath, newpath string) error {
+	oldP, newP := memPath(oldpath), memPath(newpath)
+	node, ok := m.nodes[oldP]
+	if !ok {
+		return memPathError("rename", oldpath, fs.ErrNotExist)
+	}
+	if oldP == newP {
+		return nil
+	}
+	if err := m.checkParent("rename", newpath, newP); err != nil {
+		return err
+	}
+	if existing, ok := m.nodes[newP]; ok && existing.mode.IsDir() {
+		return memPathError("rename", newpath, fs.ErrExist)
+	}
+	if node.mode.IsDir() {
+		if strings.HasPrefix(newP, oldP+"/") {
+			return memPathError("rename", newpath, errors.New("invalid argument"))
+		}
+		for childPath, child := range m.nodes {
+			if strings.HasPrefix(childPath, oldP+"/") {
+				delete(m.nodes, childPath)
+				m.nodes[newP+childPath[len(oldP):]] = child
+			}
+		}
+	}
+	delete(m.nodes, oldP)
+	m.nodes[newP] = node
+	return nil
+}
+
+func (m *MemoryFS) Chmod(name string, mode fs.FileMode) error {
+	_, node, err := m.resolve("chmod", name)
+	if err != nil {
+		return err
+	}
+	node.mode = node.mode&^fs.ModePerm | mode.Perm()
+	return nil
+}
+
+// memFile is an opened file of a MemoryFS.
+type memFile struct {
+	node     *memNode
+	name     string
+	offset   int
+	readable bool
+	writable bool
+	append   bool
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	if !f.readable {
+		return 0, memPathError("read", f.name, fs.ErrPermission)
+	}
+	if f.node.mode.IsDir() {
+		return 0, memPathError("read", f.name, errors.New("is a directory"))
+	}
+	if f.offset >= len(f.node.data) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[f.offset:])
+	f.offset += n
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	if !f.writable {
+		return 0, memPathError("write", f.name, fs.ErrPermission)
+	}
+	if f.append {
+		f.offset = len(f.node.data)
+	}
+	if end := f.offset + len(p); end > len(f.node.data) {
+		f.node.data = append(f.node.data, make([]byte, end-len(f.node.data))...)
+	}
+	n := copy(f.node.data[f.offset:], p)
+	f.offset += n
+	f.node.modTime = time.Now()
+	return n, nil
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
+
+// memFileInfo is the fs.FileInfo of a MemoryFS node at the time of the call.
+type memFileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func newMemFileInfo(p string, node *memNode) *memFileInfo {
+	return &memFileInfo{
+		name:    path.Base(p),
+		size:    int64(len(node.data)),
+		mode:    node.mode,
+		modTime: node.modTime,
+	}
+}
+
+func (i *memFileInfo) Name() string       { return i.name }
+func (i *memFileInfo) Size() int64        { return i.size }
+func (i *memFileInfo) Mode() fs.FileMode  { return i.mode }
+func (i *memFileInfo) ModTime() time.Time { return i.modTime }
+func (i *memFileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *memFileInfo) Sys() interface{}   { return nil }
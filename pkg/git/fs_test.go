@@ -0,0 +1,105 @@
+package git
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestMemoryFS(t *testing.T) {
+	fsys := NewMemoryFS()
+	if err := fsys.WriteFile("/a/b", []byte("x"), 0644); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("WriteFile() without the parent directory = %v, want ErrNotExist", err)
+	}
+	if err := fsys.MkdirAll("/a/c", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.WriteFile("/a/b", []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Absolute and relative names are the same.
+	if content, err := fsys.ReadFile("a/b"); err != nil || string(content) != "content" {
+		t.Errorf("ReadFile(a/b) = %q, %v", content, err)
+	}
+	if _, err := fsys.OpenFile("/a/b", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("OpenFile(O_EXCL) = %v, want ErrExist", err)
+	}
+
+	if err := fsys.Symlink("b", "/a/link"); err != nil {
+		t.Fatal(err)
+	}
+	if target, err := fsys.Readlink("/a/link"); err != nil || target != "b" {
+		t.Errorf("Readlink() = %q, %v", target, err)
+	}
+	if content, err := fsys.ReadFile("/a/link"); err != nil || string(content) != "content" {
+		t.Errorf("ReadFile(link) = %q, %v", content, err)
+	}
+	if info, err := fsys.Lstat("/a/link"); err != nil || info.Mode()&fs.ModeSymlink == 0 {
+		t.Errorf("Lstat(link) = %v, %v, want a symlink", info, err)
+	}
+
+	if err := fsys.Rename("/a/b", "/a/c/d"); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := fsys.ReadDir("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if want := []string{"c", "link"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ReadDir(/a) = %q, want %q", names, want)
+	}
+	if err := fsys.Remove("/a/c"); err == nil {
+		t.Error("Remove() removed a directory which isn't empty")
+	}
+}
+
+func TestMemoryRepositoryCheckout(t *testing.T) {
+	repo := newTestRepository(t)
+	commit := writeTestCommit(t, repo, "first", map[string]string{"a": "1\n", "dir/b": "2\n", "run.sh": "#!/bin/sh\n"})
+	if err := UpdateRef(repo, "HEAD", commit, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := RestoreRepository(repo, commit); err != nil {
+		t.Fatal(err)
+	}
+
+	if content, err := repo.FS.ReadFile("/dir/b"); err != nil || string(content) != "2\n" {
+		t.Errorf("ReadFile(dir/b) = %q, %v", content, err)
+	}
+	if info, err := repo.FS.Stat("/run.sh"); err != nil || info.Mode().Perm()&0100 == 0 {
+		t.Errorf("Stat(run.sh) = %v, %v, want an executable", info, err)
+	}
+	status, err := GetStatus(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Changes) != 0 || len(status.Untracked) != 0 {
+		t.Errorf("status after checkout = %+v, want clean", status)
+	}
+
+	if err := repo.FS.WriteFile("/a", []byte("changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.FS.WriteFile("/new", []byte("new\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	status, err = GetStatus(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &RepoStatus{
+		Ref:       "refs/heads/main",
+		HeadSha:   commit,
+		Changes:   []FileStatus{{Name: "a", Staged: ' ', Unstaged: 'M'}},
+		Untracked: []string{"new"},
+	}
+	if !reflect.DeepEqual(status, want) {
+		t.Errorf("status = %+v, want %+v", status, want)
+	}
+}
@@ -0,0 +1,334 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Housekeeping of the object database: repack, prune and gc.
+// ref: https://git-scm.com/docs/git-gc
+
+const DefaultPruneExpire = "2.weeks.ago"
+
+// Return the objects which keep other objects reachable: HEAD, the refs,
+// the reflog entries and the blobs in the index. names has the paths of
+// the index blobs.
+func reachabilityTips(repo *Repository) ([]string, map[string]string, error) {
+	tips := []string{}
+	names := map[string]string{}
+
+	_, headSha, err := ReadHead(repo)
+	if err != nil {
+		return nil, nil, err
+	}
+	if headSha != "" {
+		tips = append(tips, headSha)
+	}
+	refs, err := ListRefs(repo)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, ref := range refs {
+		tips = append(tips, ref.Sha)
+	}
+
+	// Reflogs may refer to objects which are already gone.
+	logsDir := path.Join(repo.GitDir, "logs")
+	logs, err := listFilesRecursively(repo.FS, logsDir, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, ref := range logs {
+		entries, err := readReflog(repo, ref)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, entry := range entries {
+			for _, sha := range []string{entry.OldSha, entry.NewSha} {
+				if sha != zeroSha && repo.Objects.Has(sha) {
+					tips = append(tips, sha)
+				}
+			}
+		}
+	}
+
+	idx, err := ReadIndex(repo)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, entry := range idx.Entries {
+		if entry.Mode == modeGitlink {
+			continue
+		}
+		sha := entry.ShaString()
+		tips = append(tips, sha)
+		names[sha] = entry.Name
+	}
+	return tips, names, nil
+}
+
+// List the files under dir as slash separated paths relative to dir.
+func listFilesRecursively(fsys FS, dir, prefix string) ([]string, error) {
+	files, err := fsys.ReadDir(path.Join(dir, prefix))
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, file := range files {
+		name := path.Join(prefix, file.Name())
+		if file.IsDir() {
+			children, err := listFilesRecursively(fsys, dir, name)
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, children...)
+		} else {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// List the shas of the loose objects.
+func listLooseObjects(db *ObjectDatabase) ([]string, error) {
+	shas := []string{}
+	err := db.Loose.Iterate(func(sha string) error {
+		shas = append(shas, sha)
+		return nil
+	})
+	return shas, err
+}
+
+// Remove the loose objects which are also in a pack.
+func prunePacked(db *ObjectDatabase) error {
+	loose, err := listLooseObjects(db)
+	if err != nil {
+		return err
+	}
+	for _, sha := range loose {
+		if db.Packs.Has(sha) {
+			if err := db.Loose.remove(sha); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Pack the reachable objects into a new pack. Only loose objects are packed
+// unless all is set. With deleteOld, the packs made redundant by the new
+// pack and the loose objects in it are removed. With loosen, the unreachable
+// objects of those packs are written out as loose objects dated like their
+// pack instead of being dropped, so that prune can expire them (repack -A).
+// Return the name of the new pack, or "" if there was nothing to pack.
+func Repack(repo *Repository, all, loosen, deleteOld bool, window, depth int) (string, error) {
+	db, err := repo.objectDatabase()
+	if err != nil {
+		return "", err
+	}
+	tips, names, err := reachabilityTips(repo)
+	if err != nil {
+		return "", err
+	}
+	objects, err := ListObjects(repo, tips, nil, names)
+	if err != nil {
+		return "", err
+	}
+	if !all {
+		unpacked := []PackObject{}
+		for _, object := range objects {
+			if !db.Packs.Has(object.Sha) {
+				unpacked = append(unpacked, object)
+			}
+		}
+		objects = unpacked
+	}
+	if len(objects) == 0 {
+		return "", nil
+	}
+
+	packDir := db.Packs.Dir
+	name, err := WritePackFiles(repo, path.Join(packDir, "pack"), objects, window, depth)
+	if err != nil {
+		return "", err
+	}
+	if !deleteOld {
+		return name, nil
+	}
+	if all {
+		// Every reachable object is in the new pack.
+		files, err := ioutil.ReadDir(packDir)
+		if err != nil {
+			return "", err
+		}
+		for _, file := range files {
+			packName := strings.TrimSuffix(file.Name(), ".pack")
+			if !strings.HasPrefix(file.Name(), "pack-") || packName == file.Name() || packName == "pack-"+name {
+				continue
+			}
+			if _, err := os.Stat(path.Join(packDir, packName+".keep")); err == nil {
+				continue
+			}
+			if loosen {
+				if err := loosenUnreachable(db, path.Join(packDir, packName), objects); err != nil {
+					return "", err
+				}
+			}
+			for _, ext := range []string{".pack", ".idx"} {
+				if err := os.Remove(path.Join(packDir, packName+ext)); err != nil && !os.IsNotExist(err) {
+					return "", err
+				}
+			}
+		}
+		db.Packs.Reload()
+	}
+	return name, prunePacked(db)
+}
+
+// Write the objects of the pack (the path without .pack or .idx) which are
+// not in reachable and not loose yet as loose objects with the modification
+// time of the pack.
+func loosenUnreachable(db *ObjectDatabase, packName string, reachable []PackObject) error {
+	isReachable := map[string]bool{}
+	for _, object := range reachable {
+		isReachable[object.Sha] = true
+	}
+	pack, err := openPackFile(packName+".pack", packName+".idx")
+	if err != nil {
+		return err
+	}
+	defer pack.file.Close()
+	info, err := pack.file.Stat()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < pack.index.count(); i++ {
+		sha := pack.index.sha(i)
+		if isReachable[sha] || db.Loose.Has(sha) {
+			continue
+		}
+		offset, err := pack.index.offset(i)
+		if err != nil {
+			return err
+		}
+		obj, err := pack.readObjectAt(db, offset)
+		if err != nil {
+			return err
+		}
+		objType, err := obj.typeString()
+		if err != nil {
+			return err
+		}
+		if _, err := db.Loose.Put(objType, obj.Buf); err != nil {
+			return err
+		}
+		if err := os.Chtimes(db.Loose.objectPath(sha), info.ModTime(), info.ModTime()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove the unreachable loose objects which were modified before expire.
+// Return the removed objects.
+func PruneLooseObjects(repo *Repository, expire time.Time, dryRun bool) ([]string, error) {
+	db, err := repo.objectDatabase()
+	if err != nil {
+		return nil, err
+	}
+	tips, names, err := reachabilityTips(repo)
+	if err != nil {
+		return nil, err
+	}
+	reachable, err := ListObjects(repo, tips, nil, names)
+	if err != nil {
+		return nil, err
+	}
+	isReachable := map[string]bool{}
+	for _, object := range reachable {
+		isReachable[object.Sha] = true
+	}
+
+	loose, err := listLooseObjects(db)
+	if err != nil {
+		return nil, err
+	}
+	pruned := []string{}
+	for _, sha := range loose {
+		if isReachable[sha] {
+			continue
+		}
+		info, err := os.Stat(db.Loose.objectPath(sha))
+		if err != nil {
+			return nil, err
+		}
+		if !info.ModTime().Before(expire) {
+			continue
+		}
+		if !dryRun {
+			if err := db.Loose.remove(sha); err != nil {
+				return nil, err
+			}
+		}
+		pruned = append(pruned, sha)
+	}
+	return pruned, nil
+}
+
+// Parse an expiry date such as "2.weeks.ago", "now", "yesterday", "never" or
+// an absolute date. "never" returns the zero time so that nothing expires.
+func ParseExpiryDate(s string, now time.Time) (time.Time, error) {
+	switch s {
+	case "now":
+		return now, nil
+	case "yesterday":
+		return now.AddDate(0, 0, -1), nil
+	case "never":
+		return time.Time{}, nil
+	}
+
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == '.' || r == ' '
+	})
+	if len(fields) >= 3 && len(fields)%2 == 1 && fields[len(fields)-1] == "ago" {
+		t := now
+		for i := 0; i+1 < len(fields); i += 2 {
+			n, err := strconv.Atoi(fields[i])
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid expiry date: %s", s)
+			}
+			switch strings.TrimSuffix(fields[i+1], "s") {
+			case "second":
+				t = t.Add(-time.Duration(n) * time.Second)
+			case "minute":
+				t = t.Add(-time.Duration(n) * time.Minute)
+			case "hour":
+				t = t.Add(-time.Duration(n) * time.Hour)
+			case "day":
+				t = t.AddDate(0, 0, -n)
+			case "week":
+				t = t.AddDate(0, 0, -7*n)
+			case "month":
+				t = t.AddDate(0, -n, 0)
+			case "year":
+				t = t.AddDate(-n, 0, 0)
+			default:
+				return time.Time{}, fmt.Errorf("invalid expiry date: %s", s)
+			}
+		}
+		return t, nil
+	}
+
+	t, err := parseGitDate(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid expiry date: %s", s)
+	}
+	return t, nil
+}
@@ -0,0 +1,287 @@
+package git
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateDelta(t *testing.T) {
+	base := []byte(strings.Repeat("the quick brown fox jumps over the lazy dog\n", 20))
+	target := append(append([]byte("a new first line\n"), base[:400]...), []byte("and a new tail\n")...)
+	delta := createDelta(base, target, len(target))
+	if delta == nil {
+		t.Fatal("createDelta() = nil")
+	}
+	if len(delta) >= len(target)/2 {
+		t.Errorf("len(delta) = %d, want less than half of %d", len(delta), len(target))
+	}
+	result, err := readDeltified(bytes.NewBuffer(delta), &Object{Type: objBlob, Buf: base})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(result.Bytes(), target) {
+		t.Errorf("applying the delta = %q, want %q", result.Bytes(), target)
+	}
+
+	if delta := createDelta(base, []byte("unrelated"), 5); delta != nil {
+		t.Errorf("createDelta() = %q, want nil above maxLen", delta)
+	}
+}
+
+// Write a loose blob which no ref reaches, modified at mtime.
+func writeUnreachableBlob(t *testing.T, db *ObjectDatabase, content string, mtime time.Time) string {
+	t.Helper()
+	sha, err := db.Put("blob", []byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(db.Loose.objectPath(sha), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	return sha
+}
+
+func TestRepackAndPrune(t *testing.T) {
+	repo := newTestDiskRepository(t)
+	db, err := repo.objectDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := strings.Repeat("some line of the file\n", 50)
+	first := writeTestCommit(t, repo, "first", map[string]string{"a.txt": content})
+	second := writeTestCommit(t, repo, "second", map[string]string{"a.txt": content + "one more line\n"}, first)
+	if err := UpdateRef(repo, "refs/heads/main", second, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	old := writeUnreachableBlob(t, db, "old garbage\n", now.Add(-30*24*time.Hour))
+	recent := writeUnreachableBlob(t, db, "recent garbage\n", now.Add(-time.Hour))
+
+	reachable, err := ListObjects(repo, []string{second}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reachable) != 6 {
+		t.Fatalf("len(ListObjects()) = %d, want 2 commits, 2 trees and 2 blobs", len(reachable))
+	}
+
+	name, err := Repack(repo, true, false, true, 10, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name == "" {
+		t.Fatal("Repack() wrote no pack")
+	}
+	loose, err := listLooseObjects(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loose) != 2 {
+		t.Errorf("loose objects after repack = %v, want the two unreachable blobs", loose)
+	}
+	for _, object := range reachable {
+		if _, found, err := db.Packs.find(object.Sha); !found || err != nil {
+			t.Errorf("find(%s) = %v, %v", object.Sha, found, err)
+		}
+	}
+
+	// Nothing new to pack.
+	if name, err := Repack(repo, false, false, true, 10, 50); name != "" || err != nil {
+		t.Errorf("Repack() = %q, %v, want nothing to pack", name, err)
+	}
+
+	expire, err := ParseExpiryDate(DefaultPruneExpire, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pruned, err := PruneLooseObjects(repo, expire, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 1 || pruned[0] != old {
+		t.Errorf("PruneLooseObjects(dry run) = %v, want [%s]", pruned, old)
+	}
+	if !db.Has(old) {
+		t.Error("the dry run removed the object")
+	}
+	if _, err := PruneLooseObjects(repo, expire, false); err != nil {
+		t.Fatal(err)
+	}
+	if db.Has(old) {
+		t.Errorf("%s was not pruned", old)
+	}
+	if !db.Has(recent) {
+		t.Errorf("%s is younger than the expiry but was pruned", recent)
+	}
+}
+
+// Write the blob into a pack of its own, modified at mtime, and remove the
+// loose copy.
+func writeUnreachablePackedBlob(t *testing.T, repo *Repository, db *ObjectDatabase, content string, mtime time.Time) string {
+	t.Helper()
+	sha := writeUnreachableBlob(t, db, content, mtime)
+	objects, err := ListObjects(repo, []string{sha}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, err := WritePackFiles(repo, path.Join(db.Packs.Dir, "pack"), objects, 10, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ext := range []string{".pack", ".idx"} {
+		if err := os.Chtimes(path.Join(db.Packs.Dir, "pack-"+name+ext), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Packs.Reload()
+	if err := prunePacked(db); err != nil {
+		t.Fatal(err)
+	}
+	return sha
+}
+
+func TestRepackLoosensUnreachable(t *testing.T) {
+	repo := newTestDiskRepository(t)
+	db, err := repo.objectDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := writeTestCommit(t, repo, "first", map[string]string{"a.txt": "a\n"})
+	if err := UpdateRef(repo, "refs/heads/main", commit, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	old := writeUnreachablePackedBlob(t, repo, db, "old garbage\n", now.Add(-30*24*time.Hour))
+	recent := writeUnreachablePackedBlob(t, repo, db, "recent garbage\n", now.Add(-time.Hour))
+
+	// Like gc: repack -A -d, then prune the loose objects older than the
+	// expiry. The recent object must survive.
+	if _, err := Repack(repo, true, true, true, 10, 50); err != nil {
+		t.Fatal(err)
+	}
+	if db.Packs.Has(old) || db.Packs.Has(recent) {
+		t.Error("unreachable objects are still packed")
+	}
+	if !db.Loose.Has(old) || !db.Loose.Has(recent) {
+		t.Fatal("unreachable packed objects were not loosened")
+	}
+	expire, err := ParseExpiryDate(DefaultPruneExpire, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pruned, err := PruneLooseObjects(repo, expire, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 1 || pruned[0] != old {
+		t.Errorf("PruneLooseObjects() = %v, want [%s]", pruned, old)
+	}
+	if content, err := ReadObjectContent(repo, recent); err != nil || string(content) != "recent garbage\n" {
+		t.Errorf("ReadObjectContent(recent) = %q, %v", content, err)
+	}
+
+	// Without loosen (repack -a -d), unreachable packed objects are dropped.
+	writeUnreachablePackedBlob(t, repo, db, "more garbage\n", now)
+	if err := db.Loose.remove(recent); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Repack(repo, true, false, true, 10, 50); err != nil {
+		t.Fatal(err)
+	}
+	loose, err := listLooseObjects(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loose) != 0 {
+		t.Errorf("loose objects after repack -a -d = %v, want none", loose)
+	}
+}
+
+func TestParseExpiryDate(t *testing.T) {
+	now := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"now", now},
+		{"never", time.Time{}},
+		{"2.weeks.ago", now.AddDate(0, 0, -14)},
+		{"1.day.ago", now.AddDate(0, 0, -1)},
+		{"3 hours ago", now.Add(-3 * time.Hour)},
+		{"1.year.2.months.ago", now.AddDate(-1, -2, 0)},
+		{"1700000000 +0000", time.Unix(1700000000, 0)},
+	}
+	for _, tt := range tests {
+		got, err := ParseExpiryDate(tt.in, now)
+		if err != nil {
+			t.Errorf("ParseExpiryDate(%q) error: %v", tt.in, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("ParseExpiryDate(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+	for _, in := range []string{"soon", "2.fortnights.ago", "x.days.ago"} {
+		if _, err := ParseExpiryDate(in, now); err == nil {
+			t.Errorf("ParseExpiryDate(%q) succeeded", in)
+		}
+	}
+}
+
+func TestPackRefs(t *testing.T) {
+	repo := newTestDiskRepository(t)
+	commit := writeTestCommit(t, repo, "first", map[string]string{"a.txt": "a\n"})
+	for _, ref := range []string{"refs/heads/main", "refs/heads/topic", "refs/tags/v1"} {
+		if err := UpdateRef(repo, ref, commit, "", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Without all, only tags are packed.
+	if err := PackRefs(repo, false, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(repo.GitDir, "refs", "tags", "v1")); !os.IsNotExist(err) {
+		t.Error("the loose tag was not pruned")
+	}
+	if _, err := os.Stat(filepath.Join(repo.GitDir, "refs", "heads", "main")); err != nil {
+		t.Error("the branch was packed without all")
+	}
+
+	if err := PackRefs(repo, true, true); err != nil {
+		t.Fatal(err)
+	}
+	packed, err := readPackedRefs(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packed) != 3 {
+		t.Errorf("readPackedRefs() = %v, want 3 refs", packed)
+	}
+	refs, err := ListRefs(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 3 {
+		t.Errorf("ListRefs() = %v, want 3 refs", refs)
+	}
+	for _, ref := range []string{"refs/heads/main", "refs/heads/topic", "refs/tags/v1"} {
+		if sha, err := readRef(repo, ref); sha != commit || err != nil {
+			t.Errorf("readRef(%s) = %s, %v, want %s", ref, sha, err, commit)
+		}
+	}
+
+	// A loose ref takes precedence over the packed one.
+	second := writeTestCommit(t, repo, "second", map[string]string{"a.txt": "b\n"}, commit)
+	if err := UpdateRef(repo, "refs/heads/main", second, commit, ""); err != nil {
+		t.Fatal(err)
+	}
+	if sha, err := readRef(repo, "refs/heads/main"); sha != second || err != nil {
+		t.Errorf("readRef(refs/heads/main) = %s, %v, want %s", sha, err, second)
+	}
+}
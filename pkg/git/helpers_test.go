@@ -0,0 +1,126 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// Create an empty in-memory repository on the branch main.
+func newTestRepository(t *testing.T) *Repository {
+	t.Helper()
+	repo, err := NewMemoryRepository("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+// Create an empty repository on the branch main in a temporary directory,
+// for the code which only works on an object database on disk.
+func newTestDiskRepository(t *testing.T) *Repository {
+	t.Helper()
+	workTree := t.TempDir()
+	for _, dir := range []string{"objects", "refs/heads", "refs/tags"} {
+		if err := os.MkdirAll(filepath.Join(workTree, ".git", dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(workTree, ".git", "HEAD"), []byte("ref: refs/heads/main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	repo := OpenRepository(workTree)
+	t.Cleanup(func() {
+		if db, err := repo.objectDatabase(); err == nil {
+			db.Packs.Reload()
+		}
+	})
+	return repo
+}
+
+// The time of the next test commit: each commit is a minute younger than the
+// previous one so that the date order of the history is stable.
+var testCommitTime = time.Unix(1700000000, 0).UTC()
+
+// Write a tree with the files (path to content, a content starting with
+// "#!" is executable) and return its sha.
+func writeTestTree(t *testing.T, repo *Repository, files map[string]string) string {
+	t.Helper()
+	entries := []IndexEntry{}
+	for name, content := range files {
+		sha, err := repo.Objects.Put("blob", []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mode := "100644"
+		if len(content) > 1 && content[:2] == "#!" {
+			mode = "100755"
+		}
+		entry, err := indexEntryFromTree(name, TreeChild{Mode: mode, Sha: sha})
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	sha, err := writeTreeEntries(repo, entries, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprintf("%x", sha)
+}
+
+// Write a commit of the files on top of the parents and return its sha.
+func writeTestCommit(t *testing.T, repo *Repository, message string, files map[string]string, parents ...string) string {
+	t.Helper()
+	testCommitTime = testCommitTime.Add(time.Minute)
+	sig := Signature{Name: "A U Thor", Email: "author@example.com", When: testCommitTime}
+	sha, err := WriteCommit(repo, &Commit{
+		Tree:      writeTestTree(t, repo, files),
+		Parents:   parents,
+		Author:    sig,
+		Committer: sig,
+		Message:   message + "\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sha
+}
+
+// Read the files of the tree (path to content).
+func readTestTree(t *testing.T, repo *Repository, treeSha string) map[string]string {
+	t.Helper()
+	files := map[string]TreeChild{}
+	if err := flattenTree(repo, treeSha, "", files); err != nil {
+		t.Fatal(err)
+	}
+	contents := map[string]string{}
+	for name, file := range files {
+		content, err := ReadObjectContent(repo, file.Sha)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[name] = string(content)
+	}
+	return contents
+}
+
+// Set the environment variable until the end of the test.
+func setTestEnv(t *testing.T, key, value string) {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
@@ -0,0 +1,184 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DateLayout is the default date format of git log.
+const DateLayout = "Mon Jan 2 15:04:05 2006 -0700"
+
+// Signature is the identity recorded in the author and committer lines.
+type Signature struct {
+	Name  string
+	Email string
+	When  time.Time
+}
+
+// Format the signature as in commit objects: "name <email> 1688000000 +0900".
+func (s Signature) String() string {
+	return fmt.Sprintf("%s <%s> %d %s", s.Name, s.Email, s.When.Unix(), s.When.Format("-0700"))
+}
+
+// Parse "name <email> 1688000000 +0900" in commit objects.
+func parseSignature(s string) (Signature, error) {
+	emailStart := strings.Index(s, "<")
+	emailEnd := strings.LastIndex(s, ">")
+	if emailStart < 0 || emailEnd < emailStart {
+		return Signature{}, fmt.Errorf("invalid signature: %s", s)
+	}
+	sig := Signature{
+		Name:  strings.TrimSpace(s[:emailStart]),
+		Email: s[emailStart+1 : emailEnd],
+	}
+	when, err := parseGitDate(strings.TrimSpace(s[emailEnd+1:]))
+	if err != nil {
+		return Signature{}, fmt.Errorf("invalid date in signature: %s", s)
+	}
+	sig.When = when
+	return sig, nil
+}
+
+// Get the author or committer identity (kind is "AUTHOR" or "COMMITTER").
+// GIT_<kind>_NAME, GIT_<kind>_EMAIL and GIT_<kind>_DATE override user.name,
+// user.email in the config and the current time.
+func getIdent(repo *Repository, kind string) (Signature, error) {
+	sig := Signature{When: time.Now()}
+
+	if name, ok := os.LookupEnv("GIT_" + kind + "_NAME"); ok {
+		sig.Name = name
+	} else if name, ok := GetConfigValue(repo, "user.name"); ok {
+		sig.Name = name
+	}
+	if email, ok := os.LookupEnv("GIT_" + kind + "_EMAIL"); ok {
+		sig.Email = email
+	} else if email, ok := GetConfigValue(repo, "user.email"); ok {
+		sig.Email = email
+	} else if email, ok := os.LookupEnv("EMAIL"); ok {
+		sig.Email = email
+	}
+
+	// Fall back to the login name and host name like git does.
+	if sig.Name == "" || sig.Email == "" {
+		username := "unknown"
+		if u, err := user.Current(); err == nil {
+			username = u.Username
+			if sig.Name == "" && u.Name != "" {
+				sig.Name = u.Name
+			}
+		}
+		if sig.Name == "" {
+			sig.Name = username
+		}
+		if sig.Email == "" {
+			hostname, err := os.Hostname()
+			if err != nil {
+				hostname = "localhost"
+			}
+			sig.Email = fmt.Sprintf("%s@%s", username, hostname)
+		}
+	}
+	// Angle brackets and newlines would break the commit object.
+	sig.Name = strings.Trim(sig.Name, " <>\n")
+	sig.Email = strings.Trim(sig.Email, " <>\n")
+
+	if date, ok := os.LookupEnv("GIT_" + kind + "_DATE"); ok {
+		when, err := parseGitDate(date)
+		if err != nil {
+			return Signature{}, fmt.Errorf("invalid date format: %s", date)
+		}
+		sig.When = when
+	}
+	return sig, nil
+}
+
+var (
+	// "1112911993 +0200" or "@1112911993 +0200" (git's internal format)
+	rawDateRegexp = regexp.MustCompile(`^@?(\d+)(?:\s+([+-]\d{4}))?$`)
+	// "2005-04-07T22:13:13", "2005-04-07 22:13:13.123 +0200", "2005-04-07T22:13:13Z"...
+	isoDateRegexp = regexp.MustCompile(`^(\d{4})[-.](\d{2})[-.](\d{2})(?:[T ](\d{2}):(\d{2})(?::(\d{2})(?:[.,]\d+)?)?)?\s*(Z|[+-]\d{2}:?\d{2})?$`)
+)
+
+// Parse dates in the formats accepted by GIT_AUTHOR_DATE and GIT_COMMITTER_DATE:
+// git internal format, RFC 2822 and ISO 8601.
+// ref: https://git-scm.com/docs/git-commit#_date_formats
+func parseGitDate(date string) (time.Time, error) {
+	date = strings.TrimSpace(date)
+
+	if m := rawDateRegexp.FindStringSubmatch(date); m != nil {
+		sec, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		loc := time.Local
+		if m[2] != "" {
+			if loc, err = parseTimezone(m[2]); err != nil {
+				return time.Time{}, err
+			}
+		}
+		return time.Unix(sec, 0).In(loc), nil
+	}
+
+	if m := isoDateRegexp.FindStringSubmatch(date); m != nil {
+		fields := make([]int, 6)
+		for i := range fields {
+			if m[i+1] != "" {
+				fields[i], _ = strconv.Atoi(m[i+1])
+			}
+		}
+		loc := time.Local
+		if m[7] == "Z" {
+			loc = time.UTC
+		} else if m[7] != "" {
+			var err error
+			if loc, err = parseTimezone(strings.Replace(m[7], ":", "", 1)); err != nil {
+				return time.Time{}, err
+			}
+		}
+		return time.Date(fields[0], time.Month(fields[1]), fields[2], fields[3], fields[4], fields[5], 0, loc), nil
+	}
+
+	// RFC 2822, with or without the day of week and seconds.
+	for _, layout := range []string{
+		"Mon, 2 Jan 2006 15:04:05 -0700",
+		"Mon, 2 Jan 2006 15:04 -0700",
+		"2 Jan 2006 15:04:05 -0700",
+		"2 Jan 2006 15:04 -0700",
+		DateLayout,
+		"Mon Jan 2 15:04:05 2006",
+	} {
+		if t, err := time.Parse(layout, date); err == nil {
+			if !strings.Contains(layout, "-0700") {
+				t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("unknown date format")
+}
+
+// Parse "+0900" into a fixed time zone.
+func parseTimezone(tz string) (*time.Location, error) {
+	if len(tz) != 5 || (tz[0] != '+' && tz[0] != '-') {
+		return nil, fmt.Errorf("invalid time zone: %s", tz)
+	}
+	hours, err := strconv.Atoi(tz[1:3])
+	if err != nil {
+		return nil, err
+	}
+	minutes, err := strconv.Atoi(tz[3:5])
+	if err != nil {
+		return nil, err
+	}
+	offset := hours*3600 + minutes*60
+	if tz[0] == '-' {
+		offset = -offset
+	}
+	return time.FixedZone("", offset), nil
+}
@@ -0,0 +1,58 @@
+package git
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseGitDate(t *testing.T) {
+	tests := []struct {
+		date    string
+		want    int64 // Unix time
+		offset  int   // seconds east of UTC
+		wantErr bool
+	}{
+		{date: "1112911993 +0200", want: 1112911993, offset: 7200},
+		{date: "@1112911993 -0130", want: 1112911993, offset: -5400},
+		{date: "  1112911993 +0000\n", want: 1112911993},
+		{date: "2005-04-07T22:13:13Z", want: 1112911993},
+		{date: "2005-04-07T22:13:13+02:00", want: 1112904793, offset: 7200},
+		{date: "2005-04-07 22:13:13.123 +0200", want: 1112904793, offset: 7200},
+		{date: "2005.04.07 22:13 -0500", want: 1112929980, offset: -18000},
+		{date: "Thu, 07 Apr 2005 22:13:13 +0200", want: 1112904793, offset: 7200},
+		{date: "7 Apr 2005 22:13 +0200", want: 1112904780, offset: 7200},
+		{date: "Thu Apr 7 22:13:13 2005 +0200", want: 1112904793, offset: 7200},
+		{date: "yesterday", wantErr: true},
+		{date: "1112911993 +02", wantErr: true},
+		{date: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.date, func(t *testing.T) {
+			got, err := parseGitDate(tt.date)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseGitDate() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, offset := got.Zone(); got.Unix() != tt.want || offset != tt.offset {
+				t.Errorf("parseGitDate() = %d %+d, want %d %+d", got.Unix(), offset, tt.want, tt.offset)
+			}
+		})
+	}
+}
+
+func TestParseGitDateWithoutTimeZone(t *testing.T) {
+	// Dates without a time zone are local.
+	got, err := parseGitDate("2005-04-07 22:13:13")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2005, time.April, 7, 22, 13, 13, 0, time.Local)
+	if !got.Equal(want) {
+		t.Errorf("parseGitDate() = %v, want %v", got, want)
+	}
+}
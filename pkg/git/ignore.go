@@ -0,0 +1,315 @@
+package git
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// IgnorePattern is a line of a .gitignore file, of $GIT_DIR/info/exclude or
+// of the file of core.excludesFile.
+// ref: https://git-scm.com/docs/gitignore
+type IgnorePattern struct {
+	Text    string // the line as written, e.g. "!/build/"
+	Source  string // the file, e.g. ".gitignore" or "sub/.gitignore"
+	Line    int
+	Negated bool // "!": re-include the matching files
+
+	base     string // the directory of the .gitignore file with a trailing "/", "" for the top
+	pattern  string // without "!", a leading "/" and a trailing "/"
+	dirOnly  bool   // a trailing "/": only match directories
+	basename bool   // no "/": match the file name at any depth
+}
+
+// Parse the content of an ignore file. base is the directory whose files
+// the patterns apply to, e.g. "sub/".
+func parseIgnoreFile(content []byte, source, base string) []IgnorePattern {
+	text := strings.TrimPrefix(string(content), "\xef\xbb\xbf")
+	patterns := []IgnorePattern{}
+	for i, line := range strings.Split(text, "\n") {
+		line = trimTrailingSpaces(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		p := IgnorePattern{Text: line, Source: source, Line: i + 1, base: base}
+		pattern := line
+		if strings.HasPrefix(pattern, "!") {
+			p.Negated = true
+			pattern = pattern[1:]
+		}
+		if strings.HasSuffix(pattern, "/") {
+			p.dirOnly = true
+			pattern = strings.TrimSuffix(pattern, "/")
+		}
+		p.basename = !strings.Contains(pattern, "/")
+		p.pattern = strings.TrimPrefix(pattern, "/")
+		if p.pattern == "" {
+			continue
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns
+}
+
+// Remove the trailing spaces which aren't escaped with a backslash.
+func trimTrailingSpaces(line string) string {
+	lastSpace := -1
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case ' ':
+			if lastSpace < 0 {
+				lastSpace = i
+			}
+		case '\\':
+			i++
+			if i >= len(line) {
+				return line
+			}
+			lastSpace = -1
+		default:
+			lastSpace = -1
+		}
+	}
+	if lastSpace >= 0 {
+		return line[:lastSpace]
+	}
+	return line
+}
+
+// Report whether the pattern matches the path name (relative to the top of
+// the working tree).
+func (p *IgnorePattern) matches(name string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if !strings.HasPrefix(name, p.base) {
+		return false
+	}
+	rel := name[len(p.base):]
+	if p.basename {
+		return wildmatch(p.pattern, path.Base(rel), 0)
+	}
+	return wildmatch(p.pattern, rel, wmPathname)
+}
+
+// Return the last pattern of the list which matches, nil if none does.
+func lastMatchingPattern(patterns []IgnorePattern, name string, isDir bool) *IgnorePattern {
+	for i := len(patterns) - 1; i >= 0; i-- {
+		if patterns[i].matches(name, isDir) {
+			return &patterns[i]
+		}
+	}
+	return nil
+}
+
+// IgnoreMatcher decides which files of the working tree are ignored. The
+// .gitignore files are read as their directories are looked at.
+type IgnoreMatcher struct {
+	repo     *Repository
+	excludes [][]IgnorePattern          // info/exclude, then core.excludesFile
+	dirs     map[string][]IgnorePattern // the patterns of <dir>/.gitignore by dir, "" for the top
+}
+
+// Create the matcher for the working tree of the repository with
+// $GIT_DIR/info/exclude and the file of core.excludesFile (by default
+// $XDG_CONFIG_HOME/git/ignore).
+func NewIgnoreMatcher(repo *Repository) (*IgnoreMatcher, error) {
+	m := &IgnoreMatcher{repo: repo, dirs: map[string][]IgnorePattern{}}
+
+	source := filepath.Join(repo.GitDir, "info", "exclude")
+	if rel, err := filepath.Rel(repo.WorkTree, source); err == nil && !strings.HasPrefix(rel, "..") {
+		source = rel
+	}
+	if err := m.addExcludeFile(filepath.Join(repo.GitDir, "info", "exclude"), filepath.ToSlash(source)); err != nil {
+		return nil, err
+	}
+
+	config, err := LoadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+	excludesFile, ok := config.Get("core.excludesfile")
+	if ok && strings.HasPrefix(excludesFile, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			excludesFile = filepath.Join(home, excludesFile[2:])
+		}
+	} else if !ok {
+		xdg := os.Getenv("XDG_CONFIG_HOME")
+		if home, err := os.UserHomeDir(); xdg == "" && err == nil {
+			xdg = filepath.Join(home, ".config")
+		}
+		if xdg != "" {
+			excludesFile = filepath.Join(xdg, "git", "ignore")
+		}
+	}
+	if excludesFile != "" {
+		if err := m.addExcludeFile(excludesFile, excludesFile); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Add the patterns of the file, which may not exist.
+func (m *IgnoreMatcher) addExcludeFile(file, source string) error {
+	content, err := m.repo.FS.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	m.excludes = append(m.excludes, parseIgnoreFile(content, source, ""))
+	return nil
+}
+
+// Return the pattern which decides whether the path (relative to the top of
+// the working tree) is ignored, nil if no pattern matches. The pattern is
+// negated if the path is explicitly not ignored. A path in an ignored
+// directory is ignored by the pattern of the directory, and can't be
+// re-included.
+func (m *IgnoreMatcher) Match(name string, isDir bool) (*IgnorePattern, error) {
+	for i := 0; i < len(name); i++ {
+		if name[i] != '/' {
+			continue
+		}
+		p, err := m.match(name[:i], true)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil && !p.Negated {
+			return p, nil
+		}
+	}
+	return m.match(name, isDir)
+}
+
+// Report whether the path is ignored, see Match.
+func (m *IgnoreMatcher) IsIgnored(name string, isDir bool) (bool, error) {
+	p, err := m.Match(name, isDir)
+	return p != nil && !p.Negated, err
+}
+
+// Match the path against the patterns without looking at its directories:
+// the .gitignore files of deeper directories take precedence, then
+// info/exclude, then core.excludesFile. Within a file the last matching
+// pattern wins.
+func (m *IgnoreMatcher) match(name string, isDir bool) (*IgnorePattern, error) {
+	for dir := path.Dir(name); ; dir = path.Dir(dir) {
+		if dir == "." {
+			dir = ""
+		}
+		patterns, err := m.dirPatterns(dir)
+		if err != nil {
+			return nil, err
+		}
+		if p := lastMatchingPattern(patterns, name, isDir); p != nil {
+			return p, nil
+		}
+		if dir == "" {
+			break
+		}
+	}
+	for _, patterns := range m.excludes {
+		if p := lastMatchingPattern(patterns, name, isDir); p != nil {
+			return p, nil
+		}
+	}
+	return nil, nil
+}
+
+// Return the patterns of the .gitignore file of the directory.
+func (m *IgnoreMatcher) dirPatterns(dir string) ([]IgnorePattern, error) {
+	if patterns, ok := m.dirs[dir]; ok {
+		return patterns, nil
+	}
+	source := path.Join(dir, ".gitignore")
+	var patterns []IgnorePattern
+	info, err := m.repo.FS.Stat(worktreePath(m.repo, source))
+	if err == nil && info.Mode().IsRegular() {
+		content, err := m.repo.FS.ReadFile(worktreePath(m.repo, source))
+		if err != nil {
+			return nil, err
+		}
+		base := ""
+		if dir != "" {
+			base = dir + "/"
+		}
+		patterns = parseIgnoreFile(content, source, base)
+	} else if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	m.dirs[dir] = patterns
+	return patterns, nil
+}
+
+// UntrackedFile is a file of the working tree which is not in the index, or
+// a directory (the name ends with "/") which is empty or ignored: git
+// doesn't look into ignored directories.
+type UntrackedFile struct {
+	Name    string
+	Ignored bool
+}
+
+// List the untracked files under name ("." for the whole working tree),
+// sorted. With ignore nil no file is ignored.
+func ListUntrackedFiles(repo *Repository, idx *Index, name string, ignore *IgnoreMatcher) ([]UntrackedFile, error) {
+	tracked := map[string]bool{}
+	trackedDirs := map[string]bool{}
+	for _, entry := range idx.Entries {
+		tracked[entry.Name] = true
+		for dir := path.Dir(entry.Name); dir != "."; dir = path.Dir(dir) {
+			trackedDirs[dir] = true
+		}
+	}
+
+	files := []UntrackedFile{}
+	err := walkFS(repo.FS, worktreePath(repo, name), func(p string, d fs.DirEntry) error {
+		if d.Name() == ".git" {
+			// also a "gitdir: <path>" file
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(repo.WorkTree, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." || (d.IsDir() && trackedDirs[rel]) {
+			return nil
+		}
+		if !d.IsDir() && tracked[rel] {
+			return nil
+		}
+		ignored := false
+		if ignore != nil {
+			if ignored, err = ignore.IsIgnored(rel, d.IsDir()); err != nil {
+				return err
+			}
+		}
+		if !d.IsDir() {
+			files = append(files, UntrackedFile{Name: rel, Ignored: ignored})
+			return nil
+		}
+		entries, err := repo.FS.ReadDir(p)
+		if err != nil {
+			return err
+		}
+		if ignored || len(entries) == 0 {
+			files = append(files, UntrackedFile{Name: rel + "/", Ignored: ignored})
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return files, nil
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+	return files, err
+}
@@ -0,0 +1,69 @@
+package git
+
+import "testing"
+
+func TestIgnoreMatcher(t *testing.T) {
+	repo := newTestRepository(t)
+	files := map[string]string{
+		".gitignore":        "# build output\n*.o\n/build/\n!keep.o\ndoc/*.html\nlogs/\n\\#hash\ntrailing  \n",
+		"sub/.gitignore":    "*.txt\n!important.txt\n/local\n",
+		".git/info/exclude": "secret\n",
+	}
+	for name, content := range files {
+		if err := repo.FS.MkdirAll(worktreePath(repo, name+"/.."), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.FS.WriteFile(worktreePath(repo, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := NewIgnoreMatcher(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		isDir   bool
+		want    bool
+		pattern string // the deciding pattern, "" for none
+	}{
+		{name: "a.o", want: true, pattern: "*.o"},
+		{name: "deep/dir/a.o", want: true, pattern: "*.o"},
+		{name: "keep.o", pattern: "!keep.o"},
+		{name: "a.c"},
+		{name: "build", isDir: true, want: true, pattern: "/build/"},
+		{name: "build", isDir: false},
+		{name: "build/out.c", want: true, pattern: "/build/"},
+		{name: "sub/build", isDir: true},
+		{name: "doc/index.html", want: true, pattern: "doc/*.html"},
+		{name: "doc/api/index.html"},
+		{name: "x/logs/today", want: true, pattern: "logs/"},
+		{name: "#hash", want: true, pattern: `\#hash`},
+		{name: "trailing", want: true, pattern: "trailing"},
+		{name: "secret", want: true, pattern: "secret"},
+		{name: "sub/notes.txt", want: true, pattern: "*.txt"},
+		{name: "sub/important.txt", pattern: "!important.txt"},
+		{name: "notes.txt"},
+		{name: "sub/local", want: true, pattern: "/local"},
+		{name: "sub/deeper/local"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := m.Match(tt.name, tt.isDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pattern := ""
+			if p != nil {
+				pattern = p.Text
+			}
+			if pattern != tt.pattern {
+				t.Errorf("Match() = %q, want %q", pattern, tt.pattern)
+			}
+			if ignored, _ := m.IsIgnored(tt.name, tt.isDir); ignored != tt.want {
+				t.Errorf("IsIgnored() = %v, want %v", ignored, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,554 @@
+package git
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ref: https://git-scm.com/docs/index-format
+const (
+	indexSignature = "DIRC"
+	indexVersion   = 2
+
+	// Length of the fixed part of an index entry (ctime ... flags).
+	indexEntryHeaderLen = 62
+
+	indexFlagAssumeValid = uint16(0x8000)
+	indexFlagExtended    = uint16(0x4000)
+	indexFlagStageMask   = uint16(0x3000)
+	indexFlagStageShift  = 12
+	indexFlagNameMask    = uint16(0x0fff)
+
+	// Extended flags of version 3 entries.
+	indexExtFlagSkipWorktree = uint16(0x4000)
+	indexExtFlagIntentToAdd  = uint16(0x2000)
+
+	modeRegular    = uint32(0100644)
+	modeExecutable = uint32(0100755)
+	modeSymlink    = uint32(0120000)
+	modeGitlink    = uint32(0160000)
+	modeTree       = uint32(040000)
+)
+
+type IndexEntry struct {
+	CtimeSec      uint32
+	CtimeNsec     uint32
+	MtimeSec      uint32
+	MtimeNsec     uint32
+	Dev           uint32
+	Ino           uint32
+	Mode          uint32
+	Uid           uint32
+	Gid           uint32
+	Size          uint32
+	Sha           [20]byte
+	Flags         uint16
+	ExtendedFlags uint16 // skip-worktree and intent-to-add (index version 3)
+	Name          string // slash separated path relative to the top of the working tree.
+}
+
+type Index struct {
+	Version uint32
+	Entries []IndexEntry
+}
+
+func (e *IndexEntry) Stage() int {
+	return int((e.Flags & indexFlagStageMask) >> indexFlagStageShift)
+}
+
+func (e *IndexEntry) ShaString() string {
+	return fmt.Sprintf("%x", e.Sha)
+}
+
+func indexPath(repo *Repository) string {
+	return path.Join(repo.GitDir, "index")
+}
+
+// Read $repo/.git/index. Returns an empty index if the file doesn't exist yet.
+func ReadIndex(repo *Repository) (*Index, error) {
+	content, err := repo.FS.ReadFile(indexPath(repo))
+	if os.IsNotExist(err) {
+		return &Index{Version: indexVersion}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return parseIndex(content)
+}
+
+func parseIndex(content []byte) (*Index, error) {
+	checksumLen := 20
+	if len(content) < 12+checksumLen {
+		return nil, errors.New("index file is too short")
+	}
+	// verify the trailing checksum
+	body := content[:len(content)-checksumLen]
+	checksum := sha1.Sum(body)
+	if !bytes.Equal(checksum[:], content[len(content)-checksumLen:]) {
+		return nil, errors.New("index file is corrupt: bad checksum")
+	}
+
+	if string(body[:4]) != indexSignature {
+		return nil, fmt.Errorf("invalid index signature: %q", body[:4])
+	}
+	version := binary.BigEndian.Uint32(body[4:8])
+	if version != 2 && version != 3 {
+		return nil, fmt.Errorf("unsupported index version: %d", version)
+	}
+	numEntries := binary.BigEndian.Uint32(body[8:12])
+
+	index := &Index{Version: version}
+	pos := 12
+	for i := uint32(0); i < numEntries; i++ {
+		entry, entryLen, err := parseIndexEntry(body[pos:], version)
+		if err != nil {
+			return nil, err
+		}
+		index.Entries = append(index.Entries, *entry)
+		pos += entryLen
+	}
+	// The remaining bytes are extensions (e.g. TREE). They are optional and
+	// we don't write them, so just ignore them here.
+	return index, nil
+}
+
+// Parse an index entry and return it with the length of the entry including padding.
+func parseIndexEntry(buf []byte, version uint32) (*IndexEntry, int, error) {
+	if len(buf) < indexEntryHeaderLen {
+		return nil, 0, errors.New("index entry is too short")
+	}
+	entry := IndexEntry{}
+	for i, field := range []*uint32{
+		&entry.CtimeSec, &entry.CtimeNsec, &entry.MtimeSec, &entry.MtimeNsec,
+		&entry.Dev, &entry.Ino, &entry.Mode, &entry.Uid, &entry.Gid, &entry.Size,
+	} {
+		*field = binary.BigEndian.Uint32(buf[i*4 : i*4+4])
+	}
+	copy(entry.Sha[:], buf[40:60])
+	entry.Flags = binary.BigEndian.Uint16(buf[60:62])
+
+	nameStart := indexEntryHeaderLen
+	if version >= 3 && entry.Flags&indexFlagExtended != 0 {
+		if len(buf) < nameStart+2 {
+			return nil, 0, errors.New("index entry is too short")
+		}
+		entry.ExtendedFlags = binary.BigEndian.Uint16(buf[nameStart:])
+		nameStart += 2
+	}
+	nameLen := bytes.IndexByte(buf[nameStart:], 0)
+	if nameLen < 0 {
+		return nil, 0, errors.New("index entry name is not terminated")
+	}
+	entry.Name = string(buf[nameStart : nameStart+nameLen])
+
+	// The name is padded with 1-8 NUL bytes so that the entry length is a multiple of 8.
+	entryLen := nameStart + nameLen
+	entryLen += 8 - entryLen%8
+	if entryLen > len(buf) {
+		return nil, 0, errors.New("index entry is too short")
+	}
+	return &entry, entryLen, nil
+}
+
+// Write the index to $repo/.git/index through a lock file.
+func (idx *Index) Write(repo *Repository) error {
+	idx.sort()
+
+	// Extended flags need version 3.
+	version := uint32(indexVersion)
+	for _, entry := range idx.Entries {
+		if entry.isExtended() {
+			version = 3
+			break
+		}
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	buf.WriteString(indexSignature)
+	binary.Write(buf, binary.BigEndian, version)
+	binary.Write(buf, binary.BigEndian, uint32(len(idx.Entries)))
+	for _, entry := range idx.Entries {
+		writeIndexEntry(buf, &entry)
+	}
+	checksum := sha1.Sum(buf.Bytes())
+	buf.Write(checksum[:])
+
+	return writeFileLocked(repo.FS, indexPath(repo), buf.Bytes())
+}
+
+func writeIndexEntry(buf *bytes.Buffer, entry *IndexEntry) {
+	for _, field := range []uint32{
+		entry.CtimeSec, entry.CtimeNsec, entry.MtimeSec, entry.MtimeNsec,
+		entry.Dev, entry.Ino, entry.Mode, entry.Uid, entry.Gid, entry.Size,
+	} {
+		binary.Write(buf, binary.BigEndian, field)
+	}
+	buf.Write(entry.Sha[:])
+
+	nameLen := len(entry.Name)
+	if nameLen > int(indexFlagNameMask) {
+		nameLen = int(indexFlagNameMask)
+	}
+	flags := entry.Flags&^indexFlagNameMask | uint16(nameLen)
+	headerLen := indexEntryHeaderLen
+	if entry.isExtended() {
+		flags |= indexFlagExtended
+		headerLen += 2
+	}
+	binary.Write(buf, binary.BigEndian, flags)
+	if entry.isExtended() {
+		binary.Write(buf, binary.BigEndian, entry.ExtendedFlags)
+	}
+	buf.WriteString(entry.Name)
+
+	padding := 8 - (headerLen+len(entry.Name))%8
+	buf.Write(make([]byte, padding))
+}
+
+func (e *IndexEntry) isExtended() bool {
+	return e.Flags&indexFlagExtended != 0 || e.ExtendedFlags != 0
+}
+
+// Sort entries by name, then by stage, as git does.
+func (idx *Index) sort() {
+	sort.SliceStable(idx.Entries, func(i, j int) bool {
+		if idx.Entries[i].Name != idx.Entries[j].Name {
+			return idx.Entries[i].Name < idx.Entries[j].Name
+		}
+		return idx.Entries[i].Stage() < idx.Entries[j].Stage()
+	})
+}
+
+// Return the position of the first entry named name, or where it would be
+// inserted.
+func (idx *Index) search(name string) int {
+	return sort.Search(len(idx.Entries), func(i int) bool {
+		return idx.Entries[i].Name >= name
+	})
+}
+
+// Find the entry named name with the lowest stage. The entries must be
+// sorted, which they are after ReadIndex and Add.
+func (idx *Index) Find(name string) (*IndexEntry, bool) {
+	if i := idx.search(name); i < len(idx.Entries) && idx.Entries[i].Name == name {
+		return &idx.Entries[i], true
+	}
+	return nil, false
+}
+
+// Add or replace the entry which has the same name, keeping the entries
+// sorted.
+func (idx *Index) Add(entry IndexEntry) {
+	// A file replaces a directory of the same name and vice versa.
+	idx.Remove(entry.Name + "/")
+	for dir := path.Dir(entry.Name); dir != "."; dir = path.Dir(dir) {
+		idx.removeExact(dir)
+	}
+	idx.removeExact(entry.Name)
+	i := idx.search(entry.Name)
+	idx.Entries = append(idx.Entries, IndexEntry{})
+	copy(idx.Entries[i+1:], idx.Entries[i:])
+	idx.Entries[i] = entry
+}
+
+func (idx *Index) removeExact(name string) bool {
+	removed := false
+	entries := idx.Entries[:0]
+	for _, entry := range idx.Entries {
+		if entry.Name == name {
+			removed = true
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	idx.Entries = entries
+	return removed
+}
+
+// Remove the entry named name, or every entry under name when it ends with "/".
+func (idx *Index) Remove(name string) bool {
+	if !strings.HasSuffix(name, "/") {
+		return idx.removeExact(name)
+	}
+	removed := false
+	entries := idx.Entries[:0]
+	for _, entry := range idx.Entries {
+		if strings.HasPrefix(entry.Name, name) {
+			removed = true
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	idx.Entries = entries
+	return removed
+}
+
+// Return the entries whose name is equal to or under pathspec.
+func (idx *Index) Match(pathspec string) []IndexEntry {
+	if pathspec == "" || pathspec == "." {
+		return idx.Entries
+	}
+	matched := []IndexEntry{}
+	for _, entry := range idx.Entries {
+		if entry.Name == pathspec || strings.HasPrefix(entry.Name, pathspec+"/") {
+			matched = append(matched, entry)
+		}
+	}
+	return matched
+}
+
+// Create the index entry for the file in the working tree.
+func newIndexEntry(name string, info os.FileInfo, sha [20]byte) IndexEntry {
+	entry := IndexEntry{
+		Name: name,
+		Mode: fileMode(info),
+		Size: uint32(info.Size()),
+		Sha:  sha,
+	}
+	fillStatInfo(&entry, info)
+	return entry
+}
+
+// Report whether the file looks unchanged since the entry was recorded,
+// so that the file doesn't need to be hashed again.
+func (e *IndexEntry) StatMatches(info os.FileInfo) bool {
+	stat := IndexEntry{}
+	fillStatInfo(&stat, info)
+	return e.MtimeSec == stat.MtimeSec &&
+		e.MtimeNsec == stat.MtimeNsec &&
+		e.CtimeSec == stat.CtimeSec &&
+		e.CtimeNsec == stat.CtimeNsec &&
+		e.Ino == stat.Ino &&
+		e.Size == uint32(info.Size()) &&
+		e.Mode == fileMode(info)
+}
+
+// Convert the file mode of the working tree into a git mode.
+func fileMode(info os.FileInfo) uint32 {
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		return modeSymlink
+	case info.IsDir():
+		return modeTree
+	case info.Mode().Perm()&0111 != 0:
+		return modeExecutable
+	default:
+		return modeRegular
+	}
+}
+
+// Write the file as a blob object and return the index entry for it.
+func HashWorktreeFile(repo *Repository, name string) (IndexEntry, error) {
+	filePath := filepath.Join(repo.WorkTree, filepath.FromSlash(name))
+	info, err := repo.FS.Lstat(filePath)
+	if err != nil {
+		return IndexEntry{}, err
+	}
+	var content []byte
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := repo.FS.Readlink(filePath)
+		if err != nil {
+			return IndexEntry{}, err
+		}
+		content = []byte(target)
+	} else {
+		content, err = repo.FS.ReadFile(filePath)
+		if err != nil {
+			return IndexEntry{}, err
+		}
+	}
+	sha, err := writeObject(repo, "blob", content)
+	if err != nil {
+		return IndexEntry{}, err
+	}
+	return newIndexEntry(name, info, sha), nil
+}
+
+// Report whether the file in the working tree differs from the index entry.
+// A missing file is not considered as modified.
+func IsWorktreeModified(repo *Repository, entry *IndexEntry) (bool, error) {
+	filePath := filepath.Join(repo.WorkTree, filepath.FromSlash(entry.Name))
+	info, err := repo.FS.Lstat(filePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if entry.StatMatches(info) {
+		return false, nil
+	}
+	if fileMode(info) != entry.Mode {
+		return true, nil
+	}
+	var content []byte
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := repo.FS.Readlink(filePath)
+		if err != nil {
+			return false, err
+		}
+		content = []byte(target)
+	} else if content, err = repo.FS.ReadFile(filePath); err != nil {
+		return false, err
+	}
+	hash, err := CreateHash("blob", content)
+	if err != nil {
+		return false, err
+	}
+	return hash != entry.ShaString(), nil
+}
+
+// Remove the file from the working tree and then its parent directories if they become empty.
+func RemoveWorktreeFile(repo *Repository, name string) error {
+	if err := repo.FS.Remove(filepath.Join(repo.WorkTree, filepath.FromSlash(name))); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		// os.Remove fails for non-empty directories.
+		if err := repo.FS.Remove(filepath.Join(repo.WorkTree, filepath.FromSlash(dir))); err != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// Convert the path given on the command line into a slash separated path
+// relative to the top of the working tree.
+func NormalizePath(repo *Repository, p string) (string, error) {
+	absRepo, err := filepath.Abs(repo.WorkTree)
+	if err != nil {
+		return "", err
+	}
+	absPath, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absRepo, absPath)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("'%s' is outside repository", p)
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == ".git" || strings.HasPrefix(rel, ".git/") {
+		return "", fmt.Errorf("'%s' is inside the .git directory", p)
+	}
+	return rel, nil
+}
+
+// Build tree objects from the index and return the sha of the root tree.
+func WriteTreeFromIndex(repo *Repository, idx *Index) (sha [20]byte, _ error) {
+	for _, entry := range idx.Entries {
+		if entry.Stage() != 0 {
+			return sha, fmt.Errorf("%s: unmerged (stage %d)", entry.Name, entry.Stage())
+		}
+	}
+	return writeTreeEntries(repo, idx.Entries, "")
+}
+
+// Write the tree for the entries under prefix (e.g. "dir/sub/").
+func writeTreeEntries(repo *Repository, entries []IndexEntry, prefix string) (sha [20]byte, _ error) {
+	type treeEntry struct {
+		mode uint32
+		name string
+		sha  [20]byte
+	}
+	children := []treeEntry{}
+	for i := 0; i < len(entries); {
+		name := strings.TrimPrefix(entries[i].Name, prefix)
+		slash := strings.Index(name, "/")
+		if slash < 0 {
+			children = append(children, treeEntry{mode: entries[i].Mode, name: name, sha: entries[i].Sha})
+			i++
+			continue
+		}
+		// Collect the entries in the same sub directory.
+		dir := name[:slash]
+		subPrefix := prefix + dir + "/"
+		j := i
+		for j < len(entries) && strings.HasPrefix(entries[j].Name, subPrefix) {
+			j++
+		}
+		subSha, err := writeTreeEntries(repo, entries[i:j], subPrefix)
+		if err != nil {
+			return sha, err
+		}
+		children = append(children, treeEntry{mode: modeTree, name: dir, sha: subSha})
+		i = j
+	}
+
+	// Trees are sorted as if directory names had a trailing "/".
+	sort.Slice(children, func(i, j int) bool {
+		return treeSortKey(children[i].name, children[i].mode) < treeSortKey(children[j].name, children[j].mode)
+	})
+	var treeBuffer bytes.Buffer
+	for _, child := range children {
+		treeBuffer.WriteString(fmt.Sprintf("%o %s\x00", child.mode, child.name))
+		treeBuffer.Write(child.sha[:])
+	}
+	return writeObject(repo, "tree", treeBuffer.Bytes())
+}
+
+func treeSortKey(name string, mode uint32) string {
+	if mode == modeTree {
+		return name + "/"
+	}
+	return name
+}
+
+// Create the index entry (without stat info) for the tree entry.
+func indexEntryFromTree(name string, file TreeChild) (IndexEntry, error) {
+	var sha [20]byte
+	rawSha, err := hex.DecodeString(file.Sha)
+	if err != nil || len(rawSha) != len(sha) {
+		return IndexEntry{}, fmt.Errorf("invalid sha for %s: %s", name, file.Sha)
+	}
+	copy(sha[:], rawSha)
+	var mode uint32
+	if _, err := fmt.Sscanf(file.Mode, "%o", &mode); err != nil {
+		return IndexEntry{}, err
+	}
+	return IndexEntry{Mode: mode, Sha: sha, Name: name}, nil
+}
+
+// Read the tree recursively into index entries (used after checking out files).
+func readTreeIntoIndex(repo *Repository, treeSha, prefix string, idx *Index) error {
+	treeBuf, err := ReadObjectContent(repo, treeSha)
+	if err != nil {
+		return err
+	}
+	tree, err := ParseTree(treeBuf)
+	if err != nil {
+		return err
+	}
+	for _, child := range tree.Children {
+		name := prefix + child.Name
+		if !isBlob(child.Mode) && child.Mode != "120000" && child.Mode != "160000" {
+			if err := readTreeIntoIndex(repo, child.Sha, name+"/", idx); err != nil {
+				return err
+			}
+			continue
+		}
+		entry, err := indexEntryFromTree(name, child)
+		if err != nil {
+			return err
+		}
+		// Record the stat info when the file exists in the working tree so that
+		// it isn't considered as modified.
+		if info, err := repo.FS.Lstat(worktreePath(repo, name)); err == nil {
+			mode := entry.Mode
+			entry = newIndexEntry(name, info, entry.Sha)
+			entry.Mode = mode
+		}
+		idx.Entries = append(idx.Entries, entry)
+	}
+	return nil
+}
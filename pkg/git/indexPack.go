@@ -0,0 +1,343 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"sort"
+)
+
+// Equivalent of git index-pack: store a packfile as it is received and
+// generate its .idx, instead of exploding it into loose objects.
+// ref: https://git-scm.com/docs/git-index-pack
+
+// An object in the pack being indexed.
+type packEntry struct {
+	offset     int64
+	crc        uint32
+	sha        []byte
+	objType    byte
+	baseOffset int64  // for OFS_DELTA
+	baseSha    string // for REF_DELTA
+}
+
+// Reader which records the bytes consumed from the pack stream.
+// zlib reads through ReadByte, so it never consumes past the end of an object.
+type packStreamReader struct {
+	reader *bufio.Reader
+	out    io.Writer // receives the consumed bytes
+	hasher hash.Hash // checksum of the whole pack
+	crc    hash.Hash32
+	offset int64
+}
+
+func newPackStreamReader(r io.Reader, out io.Writer) *packStreamReader {
+	return &packStreamReader{
+		reader: bufio.NewReader(r),
+		out:    out,
+		hasher: sha1.New(),
+		crc:    crc32.NewIEEE(),
+	}
+}
+
+func (r *packStreamReader) consumed(b []byte) error {
+	r.hasher.Write(b)
+	r.crc.Write(b)
+	r.offset += int64(len(b))
+	_, err := r.out.Write(b)
+	return err
+}
+
+func (r *packStreamReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if writeErr := r.consumed(p[:n]); writeErr != nil {
+		return n, writeErr
+	}
+	return n, err
+}
+
+func (r *packStreamReader) ReadByte() (byte, error) {
+	b, err := r.reader.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	return b, r.consumed([]byte{b})
+}
+
+// Read the pack from r, store it under $repo/.git/objects/pack and write its index.
+// Return the pack checksum which names the pack.
+func IndexPackStream(repo *Repository, r io.Reader) (string, error) {
+	db, err := repo.objectDatabase()
+	if err != nil {
+		return "", err
+	}
+	packDir := db.Packs.Dir
+	if err := os.MkdirAll(packDir, 0755); err != nil {
+		return "", err
+	}
+	tmpPack, err := os.CreateTemp(packDir, "tmp_pack_")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmpPack.Name())
+	defer tmpPack.Close()
+
+	writer := bufio.NewWriter(tmpPack)
+	entries, checksum, err := readPackEntries(newPackStreamReader(r, writer))
+	if err != nil {
+		return "", err
+	}
+	if err := writer.Flush(); err != nil {
+		return "", err
+	}
+	if err := resolvePackEntries(repo.Objects, tmpPack, entries); err != nil {
+		return "", err
+	}
+
+	name := hex.EncodeToString(checksum)
+	packPath := path.Join(packDir, "pack-"+name+".pack")
+	idxPath := path.Join(packDir, "pack-"+name+".idx")
+	if _, err := os.Stat(idxPath); err == nil {
+		// The same pack is already there.
+		return name, nil
+	}
+	if err := os.Chmod(tmpPack.Name(), 0444); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmpPack.Name(), packPath); err != nil {
+		return "", err
+	}
+	if err := writePackIndex(idxPath, entries, checksum); err != nil {
+		return "", err
+	}
+	db.Packs.Reload()
+	return name, nil
+}
+
+// Write the index of an existing packfile to idxPath. repo may be nil outside
+// a repository, then the pack must not refer to objects outside itself.
+func IndexPackFile(repo *Repository, packPath, idxPath string) (string, error) {
+	var bases ObjectStore
+	if repo != nil {
+		bases = repo.Objects
+	}
+	packFile, err := os.Open(packPath)
+	if err != nil {
+		return "", err
+	}
+	defer packFile.Close()
+
+	entries, checksum, err := readPackEntries(newPackStreamReader(packFile, io.Discard))
+	if err != nil {
+		return "", err
+	}
+	if err := resolvePackEntries(bases, packFile, entries); err != nil {
+		return "", err
+	}
+	if err := writePackIndex(idxPath, entries, checksum); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(checksum), nil
+}
+
+// Read the entries of the pack sequentially and verify the trailing checksum.
+// Non-delta objects are hashed while they are decompressed; deltas are
+// resolved later by resolvePackEntries.
+func readPackEntries(r *packStreamReader) ([]*packEntry, []byte, error) {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, fmt.Errorf("error reading pack header: %s", err)
+	}
+	if string(header[:4]) != packSignature {
+		return nil, nil, fmt.Errorf("invalid pack signature")
+	}
+	if version := binary.BigEndian.Uint32(header[4:8]); version != 2 && version != 3 {
+		return nil, nil, fmt.Errorf("unsupported pack version: %d", version)
+	}
+	numObjects := binary.BigEndian.Uint32(header[8:12])
+
+	entries := make([]*packEntry, 0, numObjects)
+	for i := uint32(0); i < numObjects; i++ {
+		entry := &packEntry{offset: r.offset}
+		r.crc.Reset()
+		objType, objLen, err := readObjectTypeAndLen(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		entry.objType = objType
+
+		var hasher hash.Hash
+		switch objType {
+		case objCommit, objTree, objBlob, objTag:
+			hasher = sha1.New()
+			typeString, _ := (&Object{Type: objType}).typeString()
+			fmt.Fprintf(hasher, "%s %d\x00", typeString, objLen)
+		case objOfsDelta:
+			negativeOffset, err := readOffset(r)
+			if err != nil {
+				return nil, nil, err
+			}
+			if negativeOffset <= 0 || negativeOffset > entry.offset {
+				return nil, nil, fmt.Errorf("invalid delta base offset at %d", entry.offset)
+			}
+			entry.baseOffset = entry.offset - negativeOffset
+		case objRefDelta:
+			if entry.baseSha, err = readSha(r); err != nil {
+				return nil, nil, err
+			}
+		default:
+			return nil, nil, fmt.Errorf("invalid object type %d at %d", objType, entry.offset)
+		}
+
+		decompressedReader, err := zlib.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		var dst io.Writer = io.Discard
+		if hasher != nil {
+			dst = hasher
+		}
+		n, err := io.Copy(dst, decompressedReader)
+		if err != nil {
+			return nil, nil, err
+		}
+		if n != int64(objLen) {
+			return nil, nil, fmt.Errorf("expected obj len: %d, but got: %d", objLen, n)
+		}
+		if hasher != nil {
+			entry.sha = hasher.Sum(nil)
+		}
+		entry.crc = r.crc.Sum32()
+		entries = append(entries, entry)
+	}
+
+	checksum := r.hasher.Sum(nil)
+	trailer := make([]byte, 20)
+	if _, err := io.ReadFull(r.reader, trailer); err != nil {
+		return nil, nil, fmt.Errorf("error reading pack checksum: %s", err)
+	}
+	if !bytes.Equal(checksum, trailer) {
+		return nil, nil, fmt.Errorf("pack checksum mismatch: expected %x, but got %x", checksum, trailer)
+	}
+	if _, err := r.out.Write(trailer); err != nil {
+		return nil, nil, err
+	}
+	if _, err := r.reader.ReadByte(); err != io.EOF {
+		return nil, nil, fmt.Errorf("pack has trailing garbage")
+	}
+	return entries, checksum, nil
+}
+
+// Calculate the shas of the deltified entries by applying their delta chains.
+// The bases of REF_DELTA objects which aren't in the pack are read from bases.
+func resolvePackEntries(bases ObjectStore, file *os.File, entries []*packEntry) error {
+	pack := &packFile{
+		path:          file.Name(),
+		file:          file,
+		cache:         make(map[int64]Object),
+		objectOffsets: make(map[string]int64),
+	}
+	pending := []*packEntry{}
+	for _, entry := range entries {
+		if entry.sha != nil {
+			pack.objectOffsets[hex.EncodeToString(entry.sha)] = entry.offset
+		} else {
+			pending = append(pending, entry)
+		}
+	}
+
+	// A REF_DELTA base can be a delta which appears later in the pack,
+	// so repeat until no more entries can be resolved.
+	for len(pending) > 0 {
+		unresolved := []*packEntry{}
+		for _, entry := range pending {
+			obj, err := pack.readObjectAt(bases, entry.offset)
+			if errors.Is(err, errUnknownDeltaBase) {
+				unresolved = append(unresolved, entry)
+				continue
+			} else if err != nil {
+				return err
+			}
+			sha, err := obj.sha()
+			if err != nil {
+				return err
+			}
+			entry.sha, _ = hex.DecodeString(sha)
+			pack.objectOffsets[sha] = entry.offset
+		}
+		if len(unresolved) == len(pending) {
+			return fmt.Errorf("%d objects with unresolved delta base", len(unresolved))
+		}
+		pending = unresolved
+	}
+	return nil
+}
+
+// Write the v2 pack index for the entries.
+// ref: https://git-scm.com/docs/pack-format#_version_2_pack_idx_files_support_packs_larger_than_4_gib_and
+func writePackIndex(idxPath string, entries []*packEntry, packChecksum []byte) error {
+	sorted := make([]*packEntry, len(entries))
+	copy(sorted, entries)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i].sha, sorted[j].sha) < 0
+	})
+
+	buf := bytes.NewBuffer([]byte{})
+	buf.WriteString(packIndexSignature)
+	binary.Write(buf, binary.BigEndian, uint32(packIndexVersion))
+	var fanout [256]uint32
+	for _, entry := range sorted {
+		fanout[entry.sha[0]]++
+	}
+	for i := 1; i < 256; i++ {
+		fanout[i] += fanout[i-1]
+	}
+	binary.Write(buf, binary.BigEndian, fanout)
+	for _, entry := range sorted {
+		buf.Write(entry.sha)
+	}
+	for _, entry := range sorted {
+		binary.Write(buf, binary.BigEndian, entry.crc)
+	}
+	largeOffsets := []uint64{}
+	for _, entry := range sorted {
+		if entry.offset < int64(packLargeOffsetFlag) {
+			binary.Write(buf, binary.BigEndian, uint32(entry.offset))
+		} else {
+			binary.Write(buf, binary.BigEndian, packLargeOffsetFlag|uint32(len(largeOffsets)))
+			largeOffsets = append(largeOffsets, uint64(entry.offset))
+		}
+	}
+	binary.Write(buf, binary.BigEndian, largeOffsets)
+	buf.Write(packChecksum)
+	checksum := sha1.Sum(buf.Bytes())
+	buf.Write(checksum[:])
+
+	// Write to a temporary file so that readers never see a partial index.
+	tmpIdx, err := os.CreateTemp(path.Dir(idxPath), "tmp_idx_")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpIdx.Name())
+	if _, err := tmpIdx.Write(buf.Bytes()); err != nil {
+		tmpIdx.Close()
+		return err
+	}
+	if err := tmpIdx.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpIdx.Name(), 0444); err != nil {
+		return err
+	}
+	return os.Rename(tmpIdx.Name(), idxPath)
+}
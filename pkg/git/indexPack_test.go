@@ -0,0 +1,93 @@
+package git
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestIndexPackStream(t *testing.T) {
+	repo := newTestDiskRepository(t)
+	base := "hello, world\nthis is the base object\n"
+	second := "hello, world\nthis is the second object\n"
+	third := "HEAD: hello, world\nthis is the second object\n"
+	fourth := "hello, world\nthis is the base object\nwith a line\n"
+	pack, offsets := buildTestPack(t, []testPackObject{
+		// A REF_DELTA whose base comes later in the pack.
+		{objType: objRefDelta, baseSha: testBlobSha(base), content: buildTestDelta(len(base), len(fourth), [2]int{0, len(base)}, "with a line\n")},
+		{objType: objBlob, content: []byte(base)},
+		{objType: objOfsDelta, base: 1, content: buildTestDelta(len(base), len(second), [2]int{0, 25}, "second object\n")},
+		// A chain: third is a delta of the delta.
+		{objType: objOfsDelta, base: 2, content: buildTestDelta(len(second), len(third), "HEAD: ", [2]int{0, len(second)})},
+	})
+	name, err := IndexPackStream(repo, bytes.NewReader(pack))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := hex.EncodeToString(pack[len(pack)-20:]); name != want {
+		t.Errorf("IndexPackStream() = %s, want %s", name, want)
+	}
+	packDir := filepath.Join(repo.GitDir, "objects", "pack")
+	stored, err := ioutil.ReadFile(filepath.Join(packDir, "pack-"+name+".pack"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stored, pack) {
+		t.Error("the stored pack differs from the received one")
+	}
+	index, err := ioutil.ReadFile(filepath.Join(packDir, "pack-"+name+".idx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shas := []string{testBlobSha(fourth), testBlobSha(base), testBlobSha(second), testBlobSha(third)}
+	if want := buildTestPackIndex(t, pack, offsets, shas); !bytes.Equal(index, want) {
+		t.Error("the written index differs from the expected one")
+	}
+
+	for _, want := range []string{base, second, third, fourth} {
+		content, err := ReadObjectContent(repo, testBlobSha(want))
+		if err != nil {
+			t.Errorf("ReadObjectContent(%q) error: %v", want, err)
+			continue
+		}
+		if string(content) != want {
+			t.Errorf("ReadObjectContent() = %q, want %q", content, want)
+		}
+	}
+
+	// Indexing the stored pack again gives the same index.
+	idxPath := filepath.Join(t.TempDir(), "pack.idx")
+	if _, err := IndexPackFile(repo, filepath.Join(packDir, "pack-"+name+".pack"), idxPath); err != nil {
+		t.Fatal(err)
+	}
+	if again, err := ioutil.ReadFile(idxPath); err != nil || !bytes.Equal(again, index) {
+		t.Errorf("IndexPackFile() wrote a different index, %v", err)
+	}
+}
+
+func TestIndexPackStreamErrors(t *testing.T) {
+	repo := newTestDiskRepository(t)
+	unknownBase, _ := buildTestPack(t, []testPackObject{
+		{objType: objBlob, content: []byte("base\n")},
+		{objType: objRefDelta, baseSha: testBlobSha("missing\n"), content: buildTestDelta(8, 1, "x")},
+	})
+	if _, err := IndexPackStream(repo, bytes.NewReader(unknownBase)); err == nil {
+		t.Error("IndexPackStream() succeeded, want an error for the unknown base")
+	}
+
+	corrupted, _ := buildTestPack(t, []testPackObject{{objType: objBlob, content: []byte("base\n")}})
+	corrupted[len(corrupted)-1] ^= 0xff
+	if _, err := IndexPackStream(repo, bytes.NewReader(corrupted)); err == nil {
+		t.Error("IndexPackStream() accepted a bad checksum")
+	}
+
+	entries, err := filepath.Glob(filepath.Join(repo.GitDir, "objects", "pack", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("failed indexing left %v", entries)
+	}
+}
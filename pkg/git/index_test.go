@@ -0,0 +1,211 @@
+package git
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Return an index entry with the name, stage and arbitrary other fields.
+func testIndexEntry(name string, stage int) IndexEntry {
+	entry := IndexEntry{
+		CtimeSec: 1700000000, CtimeNsec: 1, MtimeSec: 1700000001, MtimeNsec: 2,
+		Dev: 3, Ino: 4, Mode: modeRegular, Uid: 1000, Gid: 1000, Size: uint32(len(name)),
+		Flags: uint16(stage) << indexFlagStageShift,
+		Name:  name,
+	}
+	copy(entry.Sha[:], name)
+	return entry
+}
+
+func TestIndexRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		entries   []IndexEntry
+		wantNames []string // name:stage in the written order
+	}{
+		{name: "empty", entries: []IndexEntry{}, wantNames: []string{}},
+		{
+			name:      "sorted by name",
+			entries:   []IndexEntry{testIndexEntry("b", 0), testIndexEntry("a/c", 0), testIndexEntry("a", 0), testIndexEntry("a-b", 0)},
+			wantNames: []string{"a:0", "a-b:0", "a/c:0", "b:0"},
+		},
+		{
+			name:      "conflict stages",
+			entries:   []IndexEntry{testIndexEntry("x", 3), testIndexEntry("x", 1), testIndexEntry("w", 0), testIndexEntry("x", 2)},
+			wantNames: []string{"w:0", "x:1", "x:2", "x:3"},
+		},
+		{
+			name: "names of every padding length",
+			entries: []IndexEntry{
+				testIndexEntry("1", 0), testIndexEntry("12", 0), testIndexEntry("123", 0), testIndexEntry("1234", 0),
+				testIndexEntry("12345", 0), testIndexEntry("123456", 0), testIndexEntry("1234567", 0), testIndexEntry("12345678", 0),
+			},
+			wantNames: []string{"1:0", "12:0", "123:0", "1234:0", "12345:0", "123456:0", "1234567:0", "12345678:0"},
+		},
+		{
+			name:      "long and unusual names",
+			entries:   []IndexEntry{testIndexEntry(strings.Repeat("d/", 100)+"f", 0), testIndexEntry("sp ace/ü\tx", 0)},
+			wantNames: []string{strings.Repeat("d/", 100) + "f:0", "sp ace/ü\tx:0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newTestRepository(t)
+			idx := &Index{Version: indexVersion, Entries: tt.entries}
+			if err := idx.Write(repo); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ReadIndex(repo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := []string{}
+			for i := range got.Entries {
+				names = append(names, got.Entries[i].Name+":"+string(rune('0'+got.Entries[i].Stage())))
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("entries = %q, want %q", names, tt.wantNames)
+			}
+			for i := range got.Entries {
+				want := idx.Entries[i]
+				// The flags record the length of the name.
+				want.Flags |= uint16(len(want.Name))
+				if !reflect.DeepEqual(got.Entries[i], want) {
+					t.Errorf("entry %d = %+v, want %+v", i, got.Entries[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestReadIndexErrors(t *testing.T) {
+	repo := newTestRepository(t)
+	idx := &Index{Version: indexVersion, Entries: []IndexEntry{testIndexEntry("a", 0)}}
+	if err := idx.Write(repo); err != nil {
+		t.Fatal(err)
+	}
+	content, err := repo.FS.ReadFile(indexPath(repo))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	corrupt := append([]byte{}, content...)
+	corrupt[len(corrupt)-21] ^= 1
+	tests := []struct {
+		name    string
+		content []byte
+	}{
+		{"too short", content[:20]},
+		{"bad checksum", corrupt},
+		{"bad signature", append([]byte("XXXX"), content[4:]...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseIndex(tt.content); err == nil {
+				t.Error("parseIndex() succeeded, want an error")
+			}
+		})
+	}
+
+	// A missing index is empty.
+	if err := repo.FS.Remove(indexPath(repo)); err != nil {
+		t.Fatal(err)
+	}
+	if idx, err := ReadIndex(repo); err != nil || len(idx.Entries) != 0 {
+		t.Errorf("ReadIndex() = %v, %v, want an empty index", idx, err)
+	}
+}
+
+func TestIndexEdits(t *testing.T) {
+	idx := &Index{Version: indexVersion}
+	for _, name := range []string{"a", "dir/b", "dir/sub/c", "dir-x"} {
+		idx.Add(testIndexEntry(name, 0))
+	}
+	// Add keeps the entries sorted.
+	names := func() []string {
+		names := []string{}
+		for _, entry := range idx.Entries {
+			names = append(names, entry.Name)
+		}
+		return names
+	}
+
+	if entries := idx.Match("dir"); len(entries) != 2 {
+		t.Errorf("Match(dir) = %d entries, want 2", len(entries))
+	}
+	for _, name := range []string{"a", "dir/b", "dir/sub/c", "dir-x"} {
+		if entry, ok := idx.Find(name); !ok || entry.Name != name {
+			t.Errorf("Find(%s) = %v, %v", name, entry, ok)
+		}
+	}
+	if _, ok := idx.Find("dir"); ok {
+		t.Error("Find(dir) found a directory")
+	}
+	// A file replaces the directory of the same name and vice versa.
+	idx.Add(testIndexEntry("dir", 0))
+	if got, want := names(), []string{"a", "dir", "dir-x"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after Add(dir) = %q, want %q", got, want)
+	}
+	idx.Add(testIndexEntry("a/b", 0))
+	if got, want := names(), []string{"a/b", "dir", "dir-x"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after Add(a/b) = %q, want %q", got, want)
+	}
+	if !idx.Remove("a/") || idx.Remove("a/") {
+		t.Error("Remove(a/) should remove once")
+	}
+	if got, want := names(), []string{"dir", "dir-x"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after Remove(a/) = %q, want %q", got, want)
+	}
+}
+
+func TestIndexFindStages(t *testing.T) {
+	idx := &Index{Version: indexVersion, Entries: []IndexEntry{
+		testIndexEntry("a", 0), testIndexEntry("b", 1), testIndexEntry("b", 2), testIndexEntry("b", 3), testIndexEntry("c", 0),
+	}}
+	if entry, ok := idx.Find("b"); !ok || entry.Stage() != 1 {
+		t.Errorf("Find(b) = %v, %v, want stage 1", entry, ok)
+	}
+	// Adding a resolved entry replaces all the stages.
+	idx.Add(testIndexEntry("b", 0))
+	if len(idx.Entries) != 3 || idx.Entries[1].Name != "b" || idx.Entries[1].Stage() != 0 {
+		t.Errorf("entries after Add(b) = %+v", idx.Entries)
+	}
+}
+
+func TestIndexExtendedFlags(t *testing.T) {
+	repo := newTestRepository(t)
+	skipped := testIndexEntry("skipped", 0)
+	skipped.Flags |= indexFlagExtended
+	skipped.ExtendedFlags = indexExtFlagSkipWorktree
+	added := testIndexEntry("intent-to-add", 0)
+	added.Flags |= indexFlagExtended
+	added.ExtendedFlags = indexExtFlagIntentToAdd
+	idx := &Index{Version: indexVersion, Entries: []IndexEntry{skipped, testIndexEntry("plain", 0), added}}
+	if err := idx.Write(repo); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadIndex(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != 3 {
+		t.Errorf("version = %d, want 3 for extended flags", got.Version)
+	}
+	for i, want := range []IndexEntry{added, testIndexEntry("plain", 0), skipped} {
+		want.Flags |= uint16(len(want.Name))
+		if !reflect.DeepEqual(got.Entries[i], want) {
+			t.Errorf("entry %d = %+v, want %+v", i, got.Entries[i], want)
+		}
+	}
+
+	// Without extended flags, the index stays at version 2.
+	idx.Entries = []IndexEntry{testIndexEntry("plain", 0)}
+	if err := idx.Write(repo); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ReadIndex(repo); err != nil || got.Version != 2 {
+		t.Errorf("ReadIndex() = %v, %v, want version 2", got, err)
+	}
+}
@@ -0,0 +1,154 @@
+package git
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+const DefaultBranch = "master"
+
+// InitOptions are the options of InitRepository.
+type InitOptions struct {
+	Bare          bool
+	InitialBranch string // DefaultBranch if empty
+	TemplateDir   string // files copied into the git directory, none if empty
+	ObjectFormat  string // only "sha1" is supported
+}
+
+// Create a repository, or reinitialize an existing one, with the git
+// directory gitDir and the working tree workTree ("" for a bare repository).
+// Reinitializing keeps HEAD, the refs and the config and only adds what is
+// missing, e.g. new template files. reinit reports whether the repository
+// already existed.
+// ref: https://git-scm.com/docs/git-init
+func InitRepository(gitDir, workTree string, opts InitOptions) (repo *Repository, reinit bool, _ error) {
+	repo = &Repository{
+		WorkTree: workTree,
+		GitDir:   gitDir,
+		Objects:  NewObjectDatabase(path.Join(gitDir, "objects")),
+		FS:       OSFS{},
+	}
+	reinit, err := repo.initialize(opts)
+	if err != nil {
+		return nil, false, err
+	}
+	return repo, reinit, nil
+}
+
+// Create the files and directories of the git directory which are missing.
+func (repo *Repository) initialize(opts InitOptions) (reinit bool, _ error) {
+	switch opts.ObjectFormat {
+	case "", "sha1":
+	case "sha256":
+		return false, fmt.Errorf("object format '%s' is not supported", opts.ObjectFormat)
+	default:
+		return false, fmt.Errorf("unknown hash algorithm '%s'", opts.ObjectFormat)
+	}
+	branch := opts.InitialBranch
+	if branch == "" {
+		branch = DefaultBranch
+	}
+	if !isValidRefName("refs/heads/" + branch) {
+		return false, fmt.Errorf("invalid initial branch name: '%s'", branch)
+	}
+
+	headPath := path.Join(repo.GitDir, "HEAD")
+	if _, err := repo.FS.Stat(headPath); err == nil {
+		reinit = true
+	}
+
+	dirs := []string{"refs/heads", "refs/tags", "objects/info", "objects/pack", "info", "hooks"}
+	for _, dir := range dirs {
+		if err := repo.FS.MkdirAll(path.Join(repo.GitDir, dir), 0755); err != nil {
+			return false, err
+		}
+	}
+	if opts.TemplateDir != "" {
+		if err := copyTemplates(repo, opts.TemplateDir); err != nil {
+			return false, err
+		}
+	}
+
+	if !reinit {
+		head := []byte("ref: refs/heads/" + branch + "\n")
+		if err := repo.FS.WriteFile(headPath, head, 0644); err != nil {
+			return false, err
+		}
+	}
+	return reinit, initConfig(repo, opts.Bare)
+}
+
+// Copy the files of the template directory which are not in the git
+// directory yet. A missing template directory is ignored like in git.
+func copyTemplates(repo *Repository, templateDir string) error {
+	if _, err := os.Stat(templateDir); os.IsNotExist(err) {
+		return nil
+	}
+	return filepath.WalkDir(templateDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(templateDir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		dest := path.Join(repo.GitDir, filepath.ToSlash(rel))
+		if _, err := repo.FS.Lstat(dest); err == nil {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return repo.FS.MkdirAll(dest, info.Mode().Perm())
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return repo.FS.Symlink(target, dest)
+		default:
+			content, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			return repo.FS.WriteFile(dest, content, info.Mode().Perm())
+		}
+	})
+}
+
+// Set the core.* config of a new repository. Keys which are already set,
+// e.g. when reinitializing, are kept.
+func initConfig(repo *Repository, bare bool) error {
+	cf, err := OpenConfigFile(repo.FS, path.Join(repo.GitDir, "config"))
+	if err != nil {
+		return err
+	}
+	values := [][2]string{
+		{"repositoryformatversion", "0"},
+		{"filemode", "true"},
+		{"bare", fmt.Sprint(bare)},
+	}
+	if !bare {
+		values = append(values, [2]string{"logallrefupdates", "true"})
+	}
+	changed := false
+	for _, kv := range values {
+		if len(cf.find("core", "", kv[0])) > 0 {
+			continue
+		}
+		if err := cf.Add("core."+kv[0], kv[1]); err != nil {
+			return err
+		}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return cf.Save()
+}
@@ -0,0 +1,402 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// MergeOptions name the two sides in the conflict markers, e.g. "HEAD" and
+// "topic". They default to "ours" and "theirs".
+type MergeOptions struct {
+	OursLabel   string
+	TheirsLabel string
+}
+
+// MergeConflict is a file which both sides changed in different ways. A side
+// is the zero TreeChild if the file doesn't exist there.
+type MergeConflict struct {
+	Name   string
+	Base   TreeChild
+	Ours   TreeChild
+	Theirs TreeChild
+}
+
+// MergeResult is the outcome of a three-way merge.
+type MergeResult struct {
+	Base      string // the merge base commit, "" for unrelated histories or MergeTrees
+	Tree      string // the merged tree; conflicting text files have conflict markers
+	Conflicts []MergeConflict
+}
+
+// Return the best common ancestor of the commits: the most recent commit
+// reachable from both. It is "" if the histories are unrelated.
+// ref: https://git-scm.com/docs/git-merge-base
+func MergeBase(repo *Repository, a, b string) (string, error) {
+	fromA, err := reachableCommits(repo, a)
+	if err != nil {
+		return "", err
+	}
+	walker, err := NewCommitWalker(repo, []string{b}, nil)
+	if err != nil {
+		return "", err
+	}
+	for {
+		commit, err := walker.Next()
+		if err != nil || commit == nil {
+			return "", err
+		}
+		if fromA[commit.Sha] {
+			return commit.Sha, nil
+		}
+	}
+}
+
+// Merge the commit theirs into ours on top of their merge base. Only
+// objects are written: the index, the working tree and the refs don't
+// change, so a commit can be made from the result with WriteCommit.
+// ref: https://git-scm.com/docs/git-merge
+func MergeCommits(repo *Repository, ours, theirs string, opts MergeOptions) (*MergeResult, error) {
+	base, err := MergeBase(repo, ours, theirs)
+	if err != nil {
+		return nil, err
+	}
+	baseTree := ""
+	if base != "" {
+		if baseTree, err = ReadCommitTree(repo, base); err != nil {
+			return nil, err
+		}
+	}
+	oursTree, err := ReadCommitTree(repo, ours)
+	if err != nil {
+		return nil, err
+	}
+	theirsTree, err := ReadCommitTree(repo, theirs)
+	if err != nil {
+		return nil, err
+	}
+	result, err := MergeTrees(repo, baseTree, oursTree, theirsTree, opts)
+	if err != nil {
+		return nil, err
+	}
+	result.Base = base
+	return result, nil
+}
+
+// Merge the changes from baseTree to theirsTree into oursTree (any of them
+// may be "" for the empty tree) file by file. Text files changed on both
+// sides are merged line by line. Whatever can't be merged is reported as a
+// conflict: the tree then has the text with conflict markers, or our side
+// of the file (their side if we deleted it).
+func MergeTrees(repo *Repository, baseTree, oursTree, theirsTree string, opts MergeOptions) (*MergeResult, error) {
+	if opts.OursLabel == "" {
+		opts.OursLabel = "ours"
+	}
+	if opts.TheirsLabel == "" {
+		opts.TheirsLabel = "theirs"
+	}
+	trees := []string{baseTree, oursTree, theirsTree}
+	files := make([]map[string]TreeChild, len(trees))
+	names := map[string]bool{}
+	for i, treeSha := range trees {
+		files[i] = map[string]TreeChild{}
+		if treeSha == "" {
+			continue
+		}
+		if err := flattenTree(repo, treeSha, "", files[i]); err != nil {
+			return nil, err
+		}
+		for name := range files[i] {
+			names[name] = true
+		}
+	}
+
+	result := &MergeResult{}
+	merged := map[string]TreeChild{}
+	for name := range names {
+		base, ours, theirs := files[0][name], files[1][name], files[2][name]
+		switch {
+		case ours == theirs:
+		case base == ours:
+			ours = theirs
+		case base == theirs:
+		default:
+			file, clean, err := mergeFile(repo, base, ours, theirs, opts)
+			if err != nil {
+				return nil, err
+			}
+			if !clean {
+				result.Conflicts = append(result.Conflicts, MergeConflict{Name: name, Base: base, Ours: ours, Theirs: theirs})
+			}
+			ours = file
+		}
+		if ours != (TreeChild{}) {
+			merged[name] = ours
+		}
+	}
+
+	// A file where the other side has a directory moves out of the way, to
+	// <name>~<label> like git.
+	inTheWay := []string{}
+	for name := range merged {
+		if hasFilesUnder(merged, name) {
+			inTheWay = append(inTheWay, name)
+		}
+	}
+	for _, name := range inTheWay {
+		file := merged[name]
+		label := opts.OursLabel
+		if files[1][name] != file {
+			label = opts.TheirsLabel
+		}
+		delete(merged, name)
+		merged[name+"~"+label] = file
+		result.Conflicts = append(result.Conflicts, MergeConflict{Name: name, Base: files[0][name], Ours: files[1][name], Theirs: files[2][name]})
+	}
+	sort.Slice(result.Conflicts, func(i, j int) bool {
+		return result.Conflicts[i].Name < result.Conflicts[j].Name
+	})
+
+	entries := []IndexEntry{}
+	for name, file := range merged {
+		entry, err := indexEntryFromTree(name, file)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	sha, err := writeTreeEntries(repo, entries, "")
+	if err != nil {
+		return nil, err
+	}
+	result.Tree = fmt.Sprintf("%x", sha)
+	return result, nil
+}
+
+// Report whether one of the files is in the directory dir.
+func hasFilesUnder(files map[string]TreeChild, dir string) bool {
+	for name := range files {
+		for d := path.Dir(name); d != "."; d = path.Dir(d) {
+			if d == dir {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Merge a file which both sides changed. Regular files are merged line by
+// line (with an empty base if both sides added the file); for anything else
+// (a deleted side, symlinks, binary files) our side is kept, or theirs if
+// we deleted the file. Returns the merged file and whether it merged
+// cleanly.
+func mergeFile(repo *Repository, base, ours, theirs TreeChild, opts MergeOptions) (TreeChild, bool, error) {
+	isRegular := func(f TreeChild) bool {
+		return f.Mode == "100644" || f.Mode == "100755"
+	}
+	if !isRegular(ours) || !isRegular(theirs) || base != (TreeChild{}) && !isRegular(base) {
+		if ours == (TreeChild{}) {
+			return theirs, false, nil
+		}
+		return ours, false, nil
+	}
+
+	// The executable bit merges like the content.
+	mode, modeClean := ours.Mode, true
+	switch {
+	case ours.Mode == theirs.Mode:
+	case base.Mode == ours.Mode:
+		mode = theirs.Mode
+	case base.Mode != theirs.Mode:
+		modeClean = false
+	}
+
+	contents := make([][]byte, 3)
+	for i, file := range []TreeChild{base, ours, theirs} {
+		if file == (TreeChild{}) {
+			continue
+		}
+		content, err := ReadObjectContent(repo, file.Sha)
+		if err != nil {
+			return TreeChild{}, false, err
+		}
+		if bytes.IndexByte(content, 0) >= 0 {
+			// binary
+			return ours, false, nil
+		}
+		contents[i] = content
+	}
+	content, clean := mergeLines(contents[0], contents[1], contents[2], opts)
+	sha, err := repo.Objects.Put("blob", content)
+	if err != nil {
+		return TreeChild{}, false, err
+	}
+	return TreeChild{Mode: mode, Name: ours.Name, Sha: sha}, clean && modeClean, nil
+}
+
+// Merge the changes from base to theirs into ours line by line (diff3).
+// Where both sides changed the same lines differently, both versions are
+// kept between conflict markers. Returns whether there was no conflict.
+func mergeLines(base, ours, theirs []byte, opts MergeOptions) ([]byte, bool) {
+	b, o, t := splitLines(base), splitLines(ours), splitLines(theirs)
+	toOurs, toTheirs := matchLines(b, o), matchLines(b, t)
+
+	var out bytes.Buffer
+	clean := true
+	write := func(lines []string) {
+		for _, line := range lines {
+			out.WriteString(line)
+		}
+	}
+	writeSide := func(marker string, lines []string) {
+		out.WriteString(marker + "\n")
+		write(lines)
+		if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+			out.WriteString("\n")
+		}
+	}
+	bi, oi, ti := 0, 0, 0
+	for {
+		// Lines which are the same in all three.
+		n := 0
+		for bi+n < len(b) && toOurs[bi+n] == oi+n && toTheirs[bi+n] == ti+n {
+			n++
+		}
+		if n > 0 {
+			write(b[bi : bi+n])
+			bi, oi, ti = bi+n, oi+n, ti+n
+			continue
+		}
+
+		// A chunk which changed on at least one side ends at the next base
+		// line which both sides kept.
+		end := bi
+		for end < len(b) && (toOurs[end] < 0 || toTheirs[end] < 0) {
+			end++
+		}
+		oEnd, tEnd := len(o), len(t)
+		if end < len(b) {
+			oEnd, tEnd = toOurs[end], toTheirs[end]
+		}
+		if end == len(b) && bi == end && oi == oEnd && ti == tEnd {
+			break
+		}
+		baseChunk, oursChunk, theirsChunk := b[bi:end], o[oi:oEnd], t[ti:tEnd]
+		switch {
+		case equalLines(oursChunk, baseChunk):
+			write(theirsChunk)
+		case equalLines(theirsChunk, baseChunk), equalLines(oursChunk, theirsChunk):
+			write(oursChunk)
+		default:
+			clean = false
+			writeSide("<<<<<<< "+opts.OursLabel, oursChunk)
+			writeSide("=======", theirsChunk)
+			out.WriteString(">>>>>>> " + opts.TheirsLabel + "\n")
+		}
+		bi, oi, ti = end, oEnd, tEnd
+	}
+	return out.Bytes(), clean
+}
+
+// Split the content into lines which keep their "\n".
+func splitLines(content []byte) []string {
+	lines := []string{}
+	for len(content) > 0 {
+		end := bytes.IndexByte(content, '\n') + 1
+		if end == 0 {
+			end = len(content)
+		}
+		lines = append(lines, string(content[:end]))
+		content = content[end:]
+	}
+	return lines
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Match the lines of a with the lines of b along a shortest edit script
+// (Myers' algorithm): return for each line of a the index of the same line
+// in b, -1 if it was removed.
+func matchLines(a, b []string) []int {
+	matches := make([]int, len(a))
+	for i := range matches {
+		matches[i] = -1
+	}
+	// The common prefix and suffix match as they are.
+	start := 0
+	for start < len(a) && start < len(b) && a[start] == b[start] {
+		matches[start] = start
+		start++
+	}
+	endA, endB := len(a), len(b)
+	for endA > start && endB > start && a[endA-1] == b[endB-1] {
+		endA, endB = endA-1, endB-1
+		matches[endA] = endB
+	}
+	a, b = a[start:endA], b[start:endB]
+
+	// v[k] is the furthest x on diagonal k = x-y; trace[d] keeps v before
+	// step d for diagonals -d-1..d+1 to find the path back.
+	n, m := len(a), len(b)
+	max := n + m
+	v := make([]int, 2*max+3)
+	offset := max + 1
+	trace := [][]int{}
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		done := false
+		for k := -d; k <= d && !done; k += 2 {
+			x := v[offset+k-1] + 1
+			if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+				x = v[offset+k+1]
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+			done = x >= n && y >= m
+		}
+		if done {
+			break
+		}
+	}
+
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d]
+		at := func(k int) int { return prev[k+d+1] }
+		k := x - y
+		prevK := k - 1
+		if k == -d || k != d && at(k-1) < at(k+1) {
+			prevK = k + 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x, y = x-1, y-1
+			matches[start+x] = start + y
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		x, y = x-1, y-1
+		matches[start+x] = start + y
+	}
+	return matches
+}
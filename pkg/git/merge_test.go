@@ -0,0 +1,230 @@
+package git
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeLines(t *testing.T) {
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		want               string
+		wantClean          bool
+	}{
+		{
+			name: "unchanged",
+			base: "a\nb\n", ours: "a\nb\n", theirs: "a\nb\n",
+			want: "a\nb\n", wantClean: true,
+		},
+		{
+			name: "only theirs changed",
+			base: "a\nb\nc\n", ours: "a\nb\nc\n", theirs: "a\nB\nc\n",
+			want: "a\nB\nc\n", wantClean: true,
+		},
+		{
+			name: "changes in different places",
+			base: "a\nb\nc\nd\ne\n", ours: "A\nb\nc\nd\ne\n", theirs: "a\nb\nc\nd\nE\n",
+			want: "A\nb\nc\nd\nE\n", wantClean: true,
+		},
+		{
+			name: "the same change on both sides",
+			base: "a\nb\n", ours: "a\nx\n", theirs: "a\nx\n",
+			want: "a\nx\n", wantClean: true,
+		},
+		{
+			name: "insertions at both ends",
+			base: "b\n", ours: "a\nb\n", theirs: "b\nc\n",
+			want: "a\nb\nc\n", wantClean: true,
+		},
+		{
+			name: "deletion and unrelated change",
+			base: "a\nb\nc\nd\n", ours: "a\nc\nd\n", theirs: "a\nb\nc\nD\n",
+			want: "a\nc\nD\n", wantClean: true,
+		},
+		{
+			name: "conflicting changes",
+			base: "a\nb\nc\n", ours: "a\nours\nc\n", theirs: "a\ntheirs\nc\n",
+			want: "a\n<<<<<<< ours\nours\n=======\ntheirs\n>>>>>>> theirs\nc\n",
+		},
+		{
+			name: "conflicting insertions",
+			base: "a\n", ours: "a\nx\n", theirs: "a\ny\n",
+			want: "a\n<<<<<<< ours\nx\n=======\ny\n>>>>>>> theirs\n",
+		},
+		{
+			name: "no base",
+			base: "", ours: "same\nours\n", theirs: "same\ntheirs\n",
+			want: "<<<<<<< ours\nsame\nours\n=======\nsame\ntheirs\n>>>>>>> theirs\n",
+		},
+		{
+			name: "missing newline at the end",
+			base: "a", ours: "b", theirs: "c",
+			want: "<<<<<<< ours\nb\n=======\nc\n>>>>>>> theirs\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, clean := mergeLines([]byte(tt.base), []byte(tt.ours), []byte(tt.theirs), MergeOptions{OursLabel: "ours", TheirsLabel: "theirs"})
+			if string(got) != tt.want || clean != tt.wantClean {
+				t.Errorf("mergeLines() = %q, %v, want %q, %v", got, clean, tt.want, tt.wantClean)
+			}
+		})
+	}
+}
+
+func TestMatchLines(t *testing.T) {
+	tests := []struct {
+		a, b []string
+		want []int
+	}{
+		{[]string{}, []string{"x"}, []int{}},
+		{[]string{"a", "b", "c"}, []string{"a", "b", "c"}, []int{0, 1, 2}},
+		{[]string{"a", "b", "c"}, []string{"a", "c"}, []int{0, -1, 1}},
+		{[]string{"a", "b", "c", "a", "b", "b", "a"}, []string{"c", "b", "a", "b", "a", "c"}, []int{-1, -1, 0, 2, 3, -1, 4}},
+		{[]string{"x", "y"}, []string{"z"}, []int{-1, -1}},
+	}
+	for _, tt := range tests {
+		got := matchLines(tt.a, tt.b)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("matchLines(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestMergeTrees(t *testing.T) {
+	tests := []struct {
+		name               string
+		base, ours, theirs map[string]string
+		want               map[string]string
+		wantConflicts      []string
+	}{
+		{
+			name:   "files changed on one side",
+			base:   map[string]string{"a": "1\n", "b": "1\n", "c": "1\n"},
+			ours:   map[string]string{"a": "2\n", "b": "1\n"},
+			theirs: map[string]string{"a": "1\n", "b": "2\n", "c": "1\n", "d/e": "new\n"},
+			want:   map[string]string{"a": "2\n", "b": "2\n", "d/e": "new\n"},
+		},
+		{
+			name:   "both sides changed a file",
+			base:   map[string]string{"a": "1\n2\n3\n4\n"},
+			ours:   map[string]string{"a": "one\n2\n3\n4\n"},
+			theirs: map[string]string{"a": "1\n2\n3\nfour\n"},
+			want:   map[string]string{"a": "one\n2\n3\nfour\n"},
+		},
+		{
+			name:          "content conflict",
+			base:          map[string]string{"a": "1\n"},
+			ours:          map[string]string{"a": "2\n"},
+			theirs:        map[string]string{"a": "3\n"},
+			want:          map[string]string{"a": "<<<<<<< HEAD\n2\n=======\n3\n>>>>>>> topic\n"},
+			wantConflicts: []string{"a"},
+		},
+		{
+			name:          "modified and deleted",
+			base:          map[string]string{"a": "1\n", "b": "1\n"},
+			ours:          map[string]string{"b": "1\n"},
+			theirs:        map[string]string{"a": "2\n", "b": "1\n"},
+			want:          map[string]string{"a": "2\n", "b": "1\n"},
+			wantConflicts: []string{"a"},
+		},
+		{
+			name:   "added the same on both sides",
+			base:   map[string]string{},
+			ours:   map[string]string{"a": "1\n"},
+			theirs: map[string]string{"a": "1\n"},
+			want:   map[string]string{"a": "1\n"},
+		},
+		{
+			name:          "file and directory",
+			base:          map[string]string{},
+			ours:          map[string]string{"a": "file\n"},
+			theirs:        map[string]string{"a/b": "in a directory\n"},
+			want:          map[string]string{"a~HEAD": "file\n", "a/b": "in a directory\n"},
+			wantConflicts: []string{"a"},
+		},
+		{
+			name:   "mode change and content change",
+			base:   map[string]string{"run": "# run\n1\n2\n3\n"},
+			ours:   map[string]string{"run": "#!/bin/sh\n1\n2\n3\n"},
+			theirs: map[string]string{"run": "# run\n1\n2\nthree\n"},
+			want:   map[string]string{"run": "#!/bin/sh\n1\n2\nthree\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newTestRepository(t)
+			base, ours, theirs := writeTestTree(t, repo, tt.base), writeTestTree(t, repo, tt.ours), writeTestTree(t, repo, tt.theirs)
+			result, err := MergeTrees(repo, base, ours, theirs, MergeOptions{OursLabel: "HEAD", TheirsLabel: "topic"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := readTestTree(t, repo, result.Tree); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("merged files = %q, want %q", got, tt.want)
+			}
+			conflicts := []string{}
+			for _, c := range result.Conflicts {
+				conflicts = append(conflicts, c.Name)
+			}
+			if len(tt.wantConflicts) == 0 {
+				tt.wantConflicts = []string{}
+			}
+			if !reflect.DeepEqual(conflicts, tt.wantConflicts) {
+				t.Errorf("conflicts = %q, want %q", conflicts, tt.wantConflicts)
+			}
+		})
+	}
+}
+
+func TestMergeTreesKeepsTheExecutableBit(t *testing.T) {
+	repo := newTestRepository(t)
+	base := writeTestTree(t, repo, map[string]string{"run": "# run\n1\n2\n3\n"})
+	ours := writeTestTree(t, repo, map[string]string{"run": "#!/bin/sh\n1\n2\n3\n"})
+	theirs := writeTestTree(t, repo, map[string]string{"run": "# run\n1\n2\nthree\n"})
+	result, err := MergeTrees(repo, base, ours, theirs, MergeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mode, _, err := lookupTreePath(repo, result.Tree, "run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode != "100755" {
+		t.Errorf("mode = %s, want 100755", mode)
+	}
+}
+
+func TestMergeCommits(t *testing.T) {
+	repo := newTestRepository(t)
+	root := writeTestCommit(t, repo, "root", map[string]string{"a": "1\n2\n3\n"})
+	ours := writeTestCommit(t, repo, "ours", map[string]string{"a": "one\n2\n3\n"}, root)
+	theirs := writeTestCommit(t, repo, "theirs", map[string]string{"a": "1\n2\nthree\n", "b": "new\n"}, root)
+
+	result, err := MergeCommits(repo, ours, theirs, MergeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Base != root {
+		t.Errorf("Base = %s, want %s", result.Base, root)
+	}
+	if len(result.Conflicts) != 0 {
+		t.Errorf("Conflicts = %v, want none", result.Conflicts)
+	}
+	want := map[string]string{"a": "one\n2\nthree\n", "b": "new\n"}
+	if got := readTestTree(t, repo, result.Tree); !reflect.DeepEqual(got, want) {
+		t.Errorf("merged files = %q, want %q", got, want)
+	}
+
+	// Merging again after a merge commit uses the new base.
+	merge := writeTestCommit(t, repo, "merge", want, ours, theirs)
+	next := writeTestCommit(t, repo, "next", map[string]string{"a": "one\n2\nthree\n", "b": "newer\n"}, theirs)
+	if base, err := MergeBase(repo, merge, next); err != nil || base != theirs {
+		t.Errorf("MergeBase() = %s, %v, want %s", base, err, theirs)
+	}
+
+	unrelated := writeTestCommit(t, repo, "unrelated", map[string]string{"c": "1\n"})
+	if base, err := MergeBase(repo, ours, unrelated); err != nil || base != "" {
+		t.Errorf("MergeBase() of unrelated histories = %q, %v, want \"\"", base, err)
+	}
+}
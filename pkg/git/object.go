@@ -0,0 +1,572 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ref: https://github.com/git/git/blob/830b4a04c45bf0a6db26defe02ed1f490acd18ee/Documentation/gitformat-pack.txt#L70-L79
+	objCommit   = 1
+	objTree     = 2
+	objBlob     = 3
+	objTag      = 4
+	objOfsDelta = 6
+	objRefDelta = 7
+
+	msbMask      = uint8(0b10000000)
+	remMask      = uint8(0b01111111)
+	objMask      = uint8(0b01110000)
+	firstRemMask = uint8(0b00001111)
+)
+
+// GitObjectReader streams the content of an object. It must be closed.
+type GitObjectReader struct {
+	reader      io.Reader
+	closer      io.Closer // nil for objects read into memory
+	ContentSize int64
+	Type        string // "tree", "commit", "blob", "tag"
+	Sha         string
+}
+
+type Object struct {
+	Type byte // object type.
+	Buf  []byte
+}
+
+// Write the tree of the directory dir of the working tree and return its
+// sha. The .git directory and ignored files are left out.
+func WriteTreeObject(repo *Repository, dir string) (sha [20]byte, _ error) {
+	rel, err := filepath.Rel(repo.WorkTree, dir)
+	if err != nil {
+		return sha, err
+	}
+	rel = filepath.ToSlash(rel)
+	ignore, err := NewIgnoreMatcher(repo)
+	if err != nil {
+		return sha, err
+	}
+	files, err := ListUntrackedFiles(repo, &Index{}, rel, ignore)
+	if err != nil {
+		return sha, err
+	}
+	entries := []IndexEntry{}
+	for _, file := range files {
+		// Ignored and empty directories have no files to record.
+		if file.Ignored || strings.HasSuffix(file.Name, "/") {
+			continue
+		}
+		entry, err := HashWorktreeFile(repo, file.Name)
+		if err != nil {
+			return sha, err
+		}
+		entries = append(entries, entry)
+	}
+	prefix := ""
+	if rel != "." {
+		prefix = rel + "/"
+	}
+	return writeTreeEntries(repo, entries, prefix)
+}
+
+func WriteBlobObject(repo *Repository, file string, mode fs.FileMode) (sha [20]byte, _ error) {
+	content, err := repo.FS.ReadFile(file)
+	if err != nil {
+		return sha, err
+	}
+	return writeObject(repo, "blob", content)
+}
+
+// Write a commit object. parents is empty for a root commit and has two or
+// more commits for a merge commit.
+func WriteCommitObject(repo *Repository, treeSha string, parents []string, message string) (sha [20]byte, _ error) {
+	author, err := getIdent(repo, "AUTHOR")
+	if err != nil {
+		return sha, err
+	}
+	committer, err := getIdent(repo, "COMMITTER")
+	if err != nil {
+		return sha, err
+	}
+
+	if !strings.HasSuffix(message, "\n") {
+		message += "\n"
+	}
+	commit := &Commit{
+		Tree:      treeSha,
+		Parents:   parents,
+		Author:    author,
+		Committer: committer,
+		Message:   message,
+	}
+	return writeObject(repo, "commit", commit.encode())
+}
+
+// Store the object in the repository and return its raw sha.
+func writeObject(repo *Repository, objType string, content []byte) (sha [20]byte, _ error) {
+	shaStr, err := repo.Objects.Put(objType, content)
+	if err != nil {
+		return sha, err
+	}
+	raw, err := hex.DecodeString(shaStr)
+	if err != nil {
+		return sha, err
+	}
+	copy(sha[:], raw)
+	return sha, nil
+}
+
+// Calculate the object name of content stored as an object of objType.
+func CreateHash(objType string, content []byte) (string, error) {
+	hasher := sha1.New()
+	header := []byte(fmt.Sprintf("%s %d\x00", objType, len(content)))
+	if _, err := hasher.Write(header); err != nil {
+		return "", fmt.Errorf("error writing content to create hash: %s", err)
+	}
+	if _, err := hasher.Write(content); err != nil {
+		return "", fmt.Errorf("error writing content to create hash: %s", err)
+	}
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
+
+// Check that content is well-formed as an object of objType, so that
+// hash-object doesn't store corrupt trees, commits or tags.
+func ValidateObject(objType string, content []byte) error {
+	switch objType {
+	case "blob":
+		return nil
+	case "tree":
+		tree, err := ParseTree(content)
+		if err != nil {
+			return err
+		}
+		for _, child := range tree.Children {
+			if _, err := strconv.ParseUint(child.Mode, 8, 32); err != nil || child.Name == "" || strings.Contains(child.Name, "/") {
+				return fmt.Errorf("corrupt tree")
+			}
+		}
+		return nil
+	case "commit":
+		lines := strings.Split(string(content), "\n")
+		if !strings.HasPrefix(lines[0], "tree ") || !isFullSha(lines[0][len("tree "):]) {
+			return fmt.Errorf("corrupt commit")
+		}
+		for _, line := range lines[1:] {
+			if !strings.HasPrefix(line, "parent ") {
+				break
+			}
+			if !isFullSha(line[len("parent "):]) {
+				return fmt.Errorf("corrupt commit")
+			}
+		}
+		if _, err := parseCommit("", content); err != nil {
+			return fmt.Errorf("corrupt commit")
+		}
+		return nil
+	case "tag":
+		lines := strings.SplitN(string(content), "\n", 3)
+		if len(lines) < 3 || !strings.HasPrefix(lines[0], "object ") || !isFullSha(lines[0][len("object "):]) {
+			return fmt.Errorf("corrupt tag")
+		}
+		switch strings.TrimPrefix(lines[1], "type ") {
+		case "blob", "tree", "commit", "tag":
+			if strings.HasPrefix(lines[1], "type ") {
+				return nil
+			}
+		}
+		return fmt.Errorf("corrupt tag")
+	}
+	return fmt.Errorf("invalid object type \"%s\"", objType)
+}
+
+func FetchLatestCommitHash(repositoryURL string) (string, error) {
+	// $ curl 'https://github.com/taxintt/codecrafters-git-go/info/refs?service=git-upload-pack' --output -
+	// 2023/06/27 23:40:54 SHA: 4b825dc642cb6eb9a060e54bf8d69288fbee4904
+	// 001e# service=git-upload-pack
+	// 0000
+	// 0155 39065120688df73291eb9ec890bd5fd72e2bc9f1 HEADmulti_ack thin-pack side-band side-band-64k ofs-delta shallow deepen-since deepen-not deepen-relative no-progress include-tag multi_ack_detailed allow-tip-sha1-in-want allow-reachable-sha1-in-want no-done symref=HEAD:refs/heads/master filter object-format=sha1 agent=git/github-3b381533b78b
+	// 003f 39065120688df73291eb9ec890bd5fd72e2bc9f1 refs/heads/master
+	// 0000%
+	resp, err := http.Get(fmt.Sprintf("%s/info/refs?service=git-upload-pack", repositoryURL))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	buf := bytes.NewBuffer([]byte{})
+	if _, err := io.Copy(buf, resp.Body); err != nil {
+		return "", err
+	}
+
+	reader := bufio.NewReader(buf)
+	// read "001e# service=git-upload-pack\n"
+	if _, err := readPacketLine(reader); err != nil {
+		return "", err
+	}
+	// read "0000"
+	if _, err := readPacketLine(reader); err != nil {
+		return "", err
+	}
+	// read "0155 <commit sha> HEADmulti_ack..."
+	// 0155 39065120688df73291eb9ec890bd5fd72e2bc9f1 HEADmulti_ack
+	head, err := readPacketLine(reader)
+	if err != nil {
+		return "", err
+	}
+
+	// extract commit sha from head
+	commitHash := strings.Split(string(head), " ")[0]
+	return commitHash, nil
+}
+
+// read packet line sequentially from reader
+func readPacketLine(reader io.Reader) ([]byte, error) {
+	// e.g.) string(hex)=001e → size=30
+	hex := make([]byte, 4)
+	if _, err := io.ReadFull(reader, hex); err != nil {
+		return []byte{}, err
+	}
+	size, err := strconv.ParseInt(string(hex), 16, 64)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	// Return immediately for "0000".
+	if size == 0 {
+		return []byte{}, nil
+	}
+
+	// read content and write to buf
+	buf := make([]byte, size-4)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return []byte{}, err
+	}
+	return buf, nil
+}
+
+// write $repo/.git/refs/heads/<branch> and record message in its reflog
+func WriteBranchRefFile(repo *Repository, branch string, commitSha string, message string) error {
+	return UpdateRef(repo, "refs/heads/"+branch, commitSha, "", message)
+}
+
+// Fetch the pack of the objects reachable from commitSha and store it in the repository.
+func FetchObjects(repo *Repository, gitRepositoryURL, commitSha string) error {
+	packfile, err := fetchPackfile(gitRepositoryURL, commitSha)
+	if err != nil {
+		return err
+	}
+	defer packfile.Close()
+	_, err = IndexPackStream(repo, packfile)
+	return err
+}
+
+type packfileResponse struct {
+	io.Reader
+	body io.Closer
+}
+
+func (r *packfileResponse) Close() error {
+	return r.body.Close()
+}
+
+// Request the pack and return the response body positioned at the start of the packfile.
+func fetchPackfile(gitUrl, commitSha string) (io.ReadCloser, error) {
+	buf := bytes.NewBuffer([]byte{})
+
+	// write no-progress for Packfile negotiation
+	buf.WriteString(packetLine(fmt.Sprintf("want %s no-progress ofs-delta\n", commitSha)))
+	buf.WriteString("0000")
+	buf.WriteString(packetLine("done\n"))
+
+	// do Packfile negotiation
+	uploadPackUrl := fmt.Sprintf("%s/git-upload-pack", gitUrl)
+	resp, err := http.Post(uploadPackUrl, "application/x-git-upload-pack-request", buf)
+	if err != nil {
+		return nil, fmt.Errorf("error in git-upload-pack request: %s", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("git-upload-pack request failed: %s", resp.Status)
+	}
+	reader := bufio.NewReader(resp.Body)
+	// skip like "0008NAK\n"
+	if _, err := readPacketLine(reader); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return &packfileResponse{Reader: reader, body: resp.Body}, nil
+}
+
+func packetLine(rawLine string) string {
+	size := len(rawLine) + 4
+	return fmt.Sprintf("%04x%s", size, rawLine)
+}
+
+func readSha(reader io.Reader) (string, error) {
+	sha := make([]byte, 20)
+	if _, err := io.ReadFull(reader, sha); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha), nil
+}
+
+// Read objects. Update data.
+func readObjectTypeAndLen(reader io.ByteReader) (byte, int, error) {
+	num := 0
+	b, err := reader.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	objType := (b & objMask) >> 4
+	num += int(b & firstRemMask)
+	if (b & msbMask) == 0 {
+		return objType, num, nil
+	}
+	i := 0
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, 0, err
+		}
+		num += int(b&remMask) << (4 + 7*i)
+		if (b & msbMask) == 0 {
+			break
+		}
+		i++
+	}
+	// log.Printf("[Debug] varint num: %d\n", num)
+	// log.Printf("[Debug] read data: %b\n", data[:i+1])
+	return objType, num, nil
+}
+
+// Read the negative offset of OFS_DELTA object.
+// ref: https://git-scm.com/docs/pack-format#_pack_pack_files_have_the_following_format
+func readOffset(reader io.ByteReader) (int64, error) {
+	b, err := reader.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	offset := int64(b & remMask)
+	for (b & msbMask) != 0 {
+		b, err = reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		// Each continuation byte adds 2^7 + 2^14 + ... so that encodings are not redundant.
+		offset = ((offset + 1) << 7) | int64(b&remMask)
+	}
+	return offset, nil
+}
+
+func decompressObject(reader io.Reader) (*bytes.Buffer, error) {
+	decompressedReader, err := zlib.NewReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	decompressed := bytes.NewBuffer([]byte{})
+	if _, err := io.Copy(decompressed, decompressedReader); err != nil {
+		return nil, err
+	}
+	return decompressed, nil
+}
+
+// ref: https://git-scm.com/docs/pack-format#_deltified_representation
+func readDeltified(reader *bytes.Buffer, baseObj *Object) (*bytes.Buffer, error) {
+	// srcObjLen, err := binary.ReadUvarint(reader)
+	_, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	// log.Printf("[Debug] base len: %d\n", srcObjLen)
+	dstObjLen, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	// log.Printf("[Debug] deltified len: %d\n", dstObjLen)
+	result := bytes.NewBuffer([]byte{})
+	for reader.Len() > 0 {
+		firstByte, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		// log.Printf("[Debug] first byte: %b\n", firstByte)
+		if (firstByte & msbMask) == 0 {
+			// Add new data.
+			n := int64(firstByte & remMask)
+			if _, err := io.CopyN(result, reader, n); err != nil {
+				return nil, err
+			}
+		} else { // msb == 1
+			// Copy data.
+			offset := 0
+			size := 0
+			// Check offset byte.
+			for i := 0; i < 4; i++ {
+				if (firstByte>>i)&1 > 0 { // i-bit is present.
+					b, err := reader.ReadByte()
+					if err != nil {
+						return nil, err
+					}
+					offset += int(b) << (i * 8)
+				}
+			}
+			// Check size byte.
+			for i := 4; i < 7; i++ {
+				if (firstByte>>i)&1 > 0 { // i-bit is present.
+					b, err := reader.ReadByte()
+					if err != nil {
+						return nil, err
+					}
+					size += int(b) << ((i - 4) * 8)
+				}
+			}
+			// Size zero is automatically converted to 0x10000.
+			if size == 0 {
+				size = 0x10000
+			}
+			// log.Printf("[Debug] offset: %d\n", offset)
+			// log.Printf("[Debug] size: %d\n", size)
+			// log.Printf("[Debug] size: %b\n", size)
+			if _, err := result.Write(baseObj.Buf[offset : offset+size]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if result.Len() != int(dstObjLen) {
+		return nil, errors.New(fmt.Sprintf("Invalid deltified buf: expected: %d, but got: %d", dstObjLen, result.Len()))
+	}
+	return result, nil
+}
+
+func (o *Object) sha() (string, error) {
+	b, err := o.wrappedBuf()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha1.Sum(b)), nil
+}
+
+func (o *Object) wrappedBuf() ([]byte, error) {
+	t, err := o.typeString()
+	if err != nil {
+		return []byte{}, err
+	}
+	wrappedBuf, err := wrapContent(o.Buf, t)
+	if err != nil {
+		return []byte{}, err
+	}
+	return wrappedBuf.Bytes(), nil
+}
+
+func (o *Object) typeString() (string, error) {
+	switch o.Type {
+	case objCommit:
+		return "commit", nil
+	case objTree:
+		return "tree", nil
+	case objBlob:
+		return "blob", nil
+	case objTag:
+		return "tag", nil
+	default:
+		return "", errors.New(fmt.Sprintf("Invalid type: %d", o.Type))
+	}
+}
+
+func ParseObjectType(objectType string) (byte, error) {
+	switch objectType {
+	case "commit":
+		return objCommit, nil
+	case "tree":
+		return objTree, nil
+	case "blob":
+		return objBlob, nil
+	case "tag":
+		return objTag, nil
+	default:
+		return 0, fmt.Errorf("invalid object type: %s", objectType)
+	}
+}
+
+// Wrap content and returns a git object.
+func wrapContent(contents []byte, objectType string) (*bytes.Buffer, error) {
+	// header format = "blob #{content.bytesize}\0"
+	// see https://git-scm.com/book/en/v2/Git-Internals-Git-Objects for details.
+	outerContents := bytes.NewBuffer([]byte{})
+	outerContents.WriteString(fmt.Sprintf("%s %d\x00", objectType, len(contents)))
+	if _, err := io.Copy(outerContents, bytes.NewReader(contents)); err != nil {
+		return nil, err
+	}
+	return outerContents, nil
+}
+
+func RestoreRepository(repo *Repository, commitSha string) error {
+	// Parse commit and get tree sha.
+	treeSha, err := ReadCommitTree(repo, commitSha)
+	if err != nil {
+		return err
+	}
+	// Traverse tree objects.
+	if err := traverseTree(repo, "", treeSha); err != nil {
+		return err
+	}
+	// Record the restored files in the index.
+	idx := &Index{Version: indexVersion}
+	if err := readTreeIntoIndex(repo, treeSha, "", idx); err != nil {
+		return err
+	}
+	return idx.Write(repo)
+}
+
+// Read the commit object and return the sha of its tree.
+func ReadCommitTree(repo *Repository, commitSha string) (string, error) {
+	commit, err := ReadCommit(repo, commitSha)
+	if err != nil {
+		return "", err
+	}
+	return commit.Tree, nil
+}
+
+func ReadObjectContent(repo *Repository, objSha string) ([]byte, error) {
+	objReader, err := repo.Objects.Get(objSha)
+	if err != nil {
+		return []byte{}, err
+	}
+	defer objReader.Close()
+	contents, err := objReader.ReadContents()
+	if err != nil {
+		return []byte{}, err
+	}
+	return contents, nil
+}
+
+func (g *GitObjectReader) Read(p []byte) (int, error) {
+	return g.reader.Read(p)
+}
+
+func (g *GitObjectReader) ReadContents() ([]byte, error) {
+	contents := make([]byte, g.ContentSize)
+	if _, err := io.ReadFull(g.reader, contents); err != nil {
+		return []byte{}, err
+	}
+	return contents, nil
+}
+
+func (g *GitObjectReader) Close() error {
+	if g.closer == nil {
+		return nil
+	}
+	return g.closer.Close()
+}
@@ -0,0 +1,327 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+)
+
+// Storage of objects. A repository on disk keeps them as loose objects and
+// in packs, see ObjectDatabase.
+
+// Returned by ObjectStore.Get when the object isn't in the store.
+var ErrObjectNotFound = errors.New("object not found")
+
+var errNoObjectDatabase = errors.New("the objects are not stored on disk")
+
+// ObjectStore stores objects by their sha.
+type ObjectStore interface {
+	// Open the object for streaming its content. The reader must be closed.
+	Get(sha string) (*GitObjectReader, error)
+	// Report whether the object is in the store without reading it.
+	Has(sha string) bool
+	// Store content as an object of objType and return its sha.
+	// Storing an object which is already there does nothing.
+	Put(objType string, content []byte) (string, error)
+	// Call fn with the sha of each object in the store.
+	Iterate(fn func(sha string) error) error
+}
+
+func objectNotFound(sha string) error {
+	return fmt.Errorf("%w: %s", ErrObjectNotFound, sha)
+}
+
+// Read the whole object from the store.
+func readStoredObject(store ObjectStore, sha string) (Object, error) {
+	objReader, err := store.Get(sha)
+	if err != nil {
+		return Object{}, err
+	}
+	defer objReader.Close()
+	content, err := objReader.ReadContents()
+	if err != nil {
+		return Object{}, err
+	}
+	objType, err := ParseObjectType(objReader.Type)
+	if err != nil {
+		return Object{}, err
+	}
+	return Object{Type: objType, Buf: content}, nil
+}
+
+// LooseObjectStore keeps each object in its own zlib compressed file under
+// Dir, e.g. Dir/ab/cdef... for the object abcdef...
+type LooseObjectStore struct {
+	Dir string
+}
+
+func NewLooseObjectStore(dir string) *LooseObjectStore {
+	return &LooseObjectStore{Dir: dir}
+}
+
+func (s *LooseObjectStore) objectPath(sha string) string {
+	return path.Join(s.Dir, sha[:2], sha[2:])
+}
+
+func (s *LooseObjectStore) Get(sha string) (*GitObjectReader, error) {
+	if !isFullSha(sha) {
+		return nil, objectNotFound(sha)
+	}
+	objectFile, err := os.Open(s.objectPath(sha))
+	if os.IsNotExist(err) {
+		return nil, objectNotFound(sha)
+	} else if err != nil {
+		return nil, err
+	}
+	objectFileDecompressed, err := zlib.NewReader(objectFile)
+	if err != nil {
+		objectFile.Close()
+		return nil, err
+	}
+	objectFileReader := bufio.NewReader(objectFileDecompressed)
+	// Read the object type (includes the space character after).
+	// e.g. tree for tree object.
+	objectType, err := objectFileReader.ReadString(' ')
+	if err != nil {
+		objectFile.Close()
+		return nil, err
+	}
+	objectType = objectType[:len(objectType)-1] // Remove the trailing space character
+	// Read the object size (includes the null byte after)
+	// e.g. 100 as the ascii string.
+	objectSizeStr, err := objectFileReader.ReadString(0)
+	if err != nil {
+		objectFile.Close()
+		return nil, err
+	}
+	objectSizeStr = objectSizeStr[:len(objectSizeStr)-1] // Remove the trailing null byte
+	size, err := strconv.ParseInt(objectSizeStr, 10, 64)
+	if err != nil {
+		objectFile.Close()
+		return nil, err
+	}
+	return &GitObjectReader{
+		reader:      io.LimitReader(objectFileReader, size),
+		closer:      objectFile,
+		Type:        objectType,
+		Sha:         sha,
+		ContentSize: size,
+	}, nil
+}
+
+func (s *LooseObjectStore) Has(sha string) bool {
+	if !isFullSha(sha) {
+		return false
+	}
+	_, err := os.Stat(s.objectPath(sha))
+	return err == nil
+}
+
+func (s *LooseObjectStore) Put(objType string, content []byte) (string, error) {
+	data, err := wrapContent(content, objType)
+	if err != nil {
+		return "", err
+	}
+	sha, err := CreateHash(objType, content)
+	if err != nil {
+		return "", err
+	}
+	objectPath := s.objectPath(sha)
+	if _, err := os.Stat(objectPath); !os.IsNotExist(err) {
+		// already exists or unexpected errors
+		return sha, err
+	}
+	if err := os.MkdirAll(path.Dir(objectPath), 0755); err != nil {
+		return "", err
+	}
+	// Write to a temporary file first so that nobody reads a partial object.
+	tmpFile, err := ioutil.TempFile(path.Dir(objectPath), "tmp_obj_")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmpFile.Name())
+	writer := zlib.NewWriter(tmpFile)
+	if _, err := writer.Write(data.Bytes()); err != nil {
+		tmpFile.Close()
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		tmpFile.Close()
+		return "", err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmpFile.Name(), 0444); err != nil {
+		return "", err
+	}
+	return sha, os.Rename(tmpFile.Name(), objectPath)
+}
+
+func (s *LooseObjectStore) Iterate(fn func(sha string) error) error {
+	dirs, err := ioutil.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 {
+			continue
+		}
+		files, err := ioutil.ReadDir(path.Join(s.Dir, dir.Name()))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if sha := dir.Name() + file.Name(); isFullSha(sha) {
+				if err := fn(sha); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Remove the loose object and its directory if it becomes empty.
+func (s *LooseObjectStore) remove(sha string) error {
+	objectPath := s.objectPath(sha)
+	if err := os.Remove(objectPath); err != nil {
+		return err
+	}
+	os.Remove(path.Dir(objectPath)) // fails unless empty
+	return nil
+}
+
+// ObjectDatabase is the object directory of a repository on disk (usually
+// .git/objects). New objects are written as loose objects.
+type ObjectDatabase struct {
+	Dir   string
+	Loose *LooseObjectStore
+	Packs *PackObjectStore
+}
+
+func NewObjectDatabase(dir string) *ObjectDatabase {
+	db := &ObjectDatabase{
+		Dir:   dir,
+		Loose: NewLooseObjectStore(dir),
+		Packs: NewPackObjectStore(path.Join(dir, "pack")),
+	}
+	// Thin packs have REF_DELTA objects whose bases are anywhere in the repository.
+	db.Packs.bases = db
+	return db
+}
+
+func (db *ObjectDatabase) Get(sha string) (*GitObjectReader, error) {
+	objReader, err := db.Loose.Get(sha)
+	if errors.Is(err, ErrObjectNotFound) {
+		return db.Packs.Get(sha)
+	}
+	return objReader, err
+}
+
+func (db *ObjectDatabase) Has(sha string) bool {
+	return db.Loose.Has(sha) || db.Packs.Has(sha)
+}
+
+func (db *ObjectDatabase) Put(objType string, content []byte) (string, error) {
+	sha, err := CreateHash(objType, content)
+	if err != nil {
+		return "", err
+	}
+	if db.Packs.Has(sha) {
+		return sha, nil
+	}
+	return db.Loose.Put(objType, content)
+}
+
+// Iterate calls fn once for each object even if it is both loose and packed.
+func (db *ObjectDatabase) Iterate(fn func(sha string) error) error {
+	seen := map[string]bool{}
+	visit := func(sha string) error {
+		if seen[sha] {
+			return nil
+		}
+		seen[sha] = true
+		return fn(sha)
+	}
+	if err := db.Loose.Iterate(visit); err != nil {
+		return err
+	}
+	return db.Packs.Iterate(visit)
+}
+
+// MemoryObjectStore keeps the objects in memory. Nothing is written to disk.
+type MemoryObjectStore struct {
+	objects map[string]Object
+}
+
+func NewMemoryObjectStore() *MemoryObjectStore {
+	return &MemoryObjectStore{objects: make(map[string]Object)}
+}
+
+func (s *MemoryObjectStore) Get(sha string) (*GitObjectReader, error) {
+	obj, ok := s.objects[sha]
+	if !ok {
+		return nil, objectNotFound(sha)
+	}
+	return newObjectReader(sha, obj)
+}
+
+func (s *MemoryObjectStore) Has(sha string) bool {
+	_, ok := s.objects[sha]
+	return ok
+}
+
+func (s *MemoryObjectStore) Put(objType string, content []byte) (string, error) {
+	t, err := ParseObjectType(objType)
+	if err != nil {
+		return "", err
+	}
+	sha, err := CreateHash(objType, content)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := s.objects[sha]; !ok {
+		s.objects[sha] = Object{Type: t, Buf: append([]byte{}, content...)}
+	}
+	return sha, nil
+}
+
+// Iterate visits the objects in the order of their shas.
+func (s *MemoryObjectStore) Iterate(fn func(sha string) error) error {
+	shas := make([]string, 0, len(s.objects))
+	for sha := range s.objects {
+		shas = append(shas, sha)
+	}
+	sort.Strings(shas)
+	for _, sha := range shas {
+		if err := fn(sha); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Return a reader of an object which is already in memory.
+func newObjectReader(sha string, obj Object) (*GitObjectReader, error) {
+	objType, err := obj.typeString()
+	if err != nil {
+		return nil, err
+	}
+	return &GitObjectReader{
+		reader:      bytes.NewReader(obj.Buf),
+		Type:        objType,
+		Sha:         sha,
+		ContentSize: int64(len(obj.Buf)),
+	}, nil
+}
@@ -0,0 +1,71 @@
+package git
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestObjectStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) ObjectStore{
+		"memory": func(t *testing.T) ObjectStore { return NewMemoryObjectStore() },
+		"loose":  func(t *testing.T) ObjectStore { return NewLooseObjectStore(t.TempDir()) },
+		"database": func(t *testing.T) ObjectStore {
+			db := NewObjectDatabase(t.TempDir())
+			t.Cleanup(db.Packs.Reload)
+			return db
+		},
+	}
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			seen := map[string]bool{}
+			want := []string{}
+			for _, content := range []string{"one\n", "two\n", "one\n"} {
+				sha, err := store.Put("blob", []byte(content))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if sha != testBlobSha(content) {
+					t.Errorf("Put(%q) = %s, want %s", content, sha, testBlobSha(content))
+				}
+				if !seen[sha] {
+					seen[sha] = true
+					want = append(want, sha)
+				}
+			}
+
+			obj, err := readStoredObject(store, testBlobSha("two\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if obj.Type != objBlob || string(obj.Buf) != "two\n" {
+				t.Errorf("object = %d %q, want blob %q", obj.Type, obj.Buf, "two\n")
+			}
+			if !store.Has(testBlobSha("one\n")) {
+				t.Error("Has(one) = false")
+			}
+			missing := testBlobSha("missing\n")
+			if store.Has(missing) {
+				t.Error("Has(missing) = true")
+			}
+			if _, err := store.Get(missing); !errors.Is(err, ErrObjectNotFound) {
+				t.Errorf("Get(missing) error = %v, want ErrObjectNotFound", err)
+			}
+
+			got := []string{}
+			if err := store.Iterate(func(sha string) error {
+				got = append(got, sha)
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(got)
+			sort.Strings(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Iterate() = %v, want %v", got, want)
+			}
+		})
+	}
+}
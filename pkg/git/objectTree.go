@@ -0,0 +1,248 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type TreeChild struct {
+	Mode string // 100XXX for blob, 40000 for tree.
+	Name string
+	Sha  string
+}
+type Tree struct {
+	Children []TreeChild
+}
+
+// Write the files of the tree into the working tree under curDir.
+func traverseTree(repo *Repository, curDir, treeSha string) error {
+	treeBuf, err := ReadObjectContent(repo, treeSha)
+	if err != nil {
+		return err
+	}
+	tree, err := ParseTree(treeBuf)
+	if err != nil {
+		return err
+	}
+	for _, child := range tree.Children {
+		filePath := path.Join(repo.WorkTree, curDir, child.Name)
+		switch {
+		case isBlob(child.Mode), child.Mode == "120000":
+			// Create a file
+			blobBuf, err := ReadObjectContent(repo, child.Sha)
+			if err != nil {
+				return err
+			}
+			if err := repo.FS.MkdirAll(path.Dir(filePath), 0755); err != nil {
+				return err
+			}
+			if child.Mode == "120000" {
+				if err := repo.FS.Symlink(string(blobBuf), filePath); err != nil {
+					return err
+				}
+				continue
+			}
+			perm, err := getPerm(child.Mode)
+			if err != nil {
+				return err
+			}
+			if err := repo.FS.WriteFile(filePath, blobBuf, perm); err != nil {
+				return err
+			}
+		case child.Mode == "160000":
+			// A submodule is checked out as an empty directory.
+			if err := repo.FS.MkdirAll(filePath, 0755); err != nil {
+				return err
+			}
+		default:
+			// traverse recursively.
+			childDir := path.Join(curDir, child.Name)
+			if err := traverseTree(repo, childDir, child.Sha); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func ParseTree(treeBuf []byte) (*Tree, error) {
+	children := make([]TreeChild, 0)
+	contentsReader := bufio.NewReader(bytes.NewReader(treeBuf))
+	for {
+		// Read the mode of the entry (including the space character after)
+		mode, err := contentsReader.ReadString(' ')
+		if err == io.EOF && mode == "" {
+			break // We've reached the end of the file
+		} else if err == io.EOF {
+			return nil, fmt.Errorf("too-short tree object")
+		} else if err != nil {
+			return nil, err
+		}
+		mode = mode[:len(mode)-1] // Trim the space suffix.
+		// Read the name of the entry (including the null-byte character after)
+		entryName, err := contentsReader.ReadString(0)
+		if err != nil {
+			return nil, err
+		}
+		entryName = entryName[:len(entryName)-1] // Trim the null-byte character suffix.
+		sha := make([]byte, 20)
+		_, err = io.ReadFull(contentsReader, sha)
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			return nil, fmt.Errorf("too-short tree object")
+		} else if err != nil {
+			return nil, err
+		}
+		children = append(children, TreeChild{
+			Name: entryName,
+			Mode: mode,
+			Sha:  fmt.Sprintf("%x", sha),
+		})
+	}
+	tree := Tree{
+		Children: children,
+	}
+	return &tree, nil
+}
+
+// Read the tree recursively and collect non-tree entries keyed by their full path.
+func flattenTree(repo *Repository, treeSha, prefix string, files map[string]TreeChild) error {
+	treeBuf, err := ReadObjectContent(repo, treeSha)
+	if err != nil {
+		return err
+	}
+	tree, err := ParseTree(treeBuf)
+	if err != nil {
+		return err
+	}
+	for _, child := range tree.Children {
+		name := prefix + child.Name
+		if child.Mode == "40000" {
+			if err := flattenTree(repo, child.Sha, name+"/", files); err != nil {
+				return err
+			}
+			continue
+		}
+		files[name] = TreeChild{Mode: child.Mode, Name: name, Sha: child.Sha}
+	}
+	return nil
+}
+
+// TreeChange is a file which differs between two trees. Old is the zero
+// TreeChild for an added file and New for a deleted one.
+type TreeChange struct {
+	Name string
+	Old  TreeChild
+	New  TreeChild
+}
+
+// Compare two trees file by file. Either tree may be "" for an empty tree.
+// Returns the changes sorted by name.
+func DiffTrees(repo *Repository, oldTreeSha, newTreeSha string) ([]TreeChange, error) {
+	oldFiles := map[string]TreeChild{}
+	newFiles := map[string]TreeChild{}
+	if oldTreeSha != "" {
+		if err := flattenTree(repo, oldTreeSha, "", oldFiles); err != nil {
+			return nil, err
+		}
+	}
+	if newTreeSha != "" {
+		if err := flattenTree(repo, newTreeSha, "", newFiles); err != nil {
+			return nil, err
+		}
+	}
+	changes := []TreeChange{}
+	for name, oldFile := range oldFiles {
+		if newFile, ok := newFiles[name]; !ok || newFile != oldFile {
+			changes = append(changes, TreeChange{Name: name, Old: oldFile, New: newFile})
+		}
+	}
+	for name, newFile := range newFiles {
+		if _, ok := oldFiles[name]; !ok {
+			changes = append(changes, TreeChange{Name: name, New: newFile})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+	return changes, nil
+}
+
+// Find the entry at the slash separated path in the tree.
+// Returns empty mode and sha if the path doesn't exist.
+func lookupTreePath(repo *Repository, treeSha, p string) (mode, sha string, _ error) {
+	p = strings.Trim(p, "/")
+	if p == "" || p == "." {
+		return "40000", treeSha, nil
+	}
+	components := strings.Split(p, "/")
+	sha = treeSha
+	mode = "40000"
+	for _, component := range components {
+		if mode != "40000" {
+			// a file can't have children
+			return "", "", nil
+		}
+		treeBuf, err := ReadObjectContent(repo, sha)
+		if err != nil {
+			return "", "", err
+		}
+		tree, err := ParseTree(treeBuf)
+		if err != nil {
+			return "", "", err
+		}
+		found := false
+		for _, child := range tree.Children {
+			if child.Name == component {
+				mode, sha, found = child.Mode, child.Sha, true
+				break
+			}
+		}
+		if !found {
+			return "", "", nil
+		}
+	}
+	return mode, sha, nil
+}
+
+// Return the type of the object the entry points to.
+func (c TreeChild) ObjectType() string {
+	switch c.Mode {
+	case "40000":
+		return "tree"
+	case "160000":
+		return "commit" // submodule
+	default:
+		return "blob"
+	}
+}
+
+// Return the mode padded to 6 digits as git prints it (e.g. "040000").
+func (c TreeChild) PaddedMode() string {
+	if len(c.Mode) < 6 {
+		return strings.Repeat("0", 6-len(c.Mode)) + c.Mode
+	}
+	return c.Mode
+}
+
+func isBlob(mode string) bool {
+	return strings.HasPrefix(mode, "100")
+}
+
+func getPerm(mode string) (os.FileMode, error) {
+	if !isBlob(mode) {
+		return 0, errors.New(fmt.Sprintf("Invalid mode: %s", mode))
+	}
+	perm, err := strconv.ParseInt(mode[3:], 8, 64)
+	if err != nil {
+		return 0, err
+	}
+	return os.FileMode(perm), nil
+}
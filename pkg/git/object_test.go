@@ -0,0 +1,124 @@
+package git
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+// testPackObject is an entry of a packfile built by buildTestPack: a whole
+// object, or a delta against the entry at index base.
+type testPackObject struct {
+	objType byte
+	content []byte // the object, or the delta instructions
+	base    int    // for objOfsDelta
+	baseSha string // for objRefDelta
+}
+
+// Build a version 2 packfile of the objects and return it with the offset
+// of each object.
+func buildTestPack(t *testing.T, objects []testPackObject) ([]byte, []int64) {
+	t.Helper()
+	var buf bytes.Buffer
+	buf.WriteString("PACK")
+	binary.Write(&buf, binary.BigEndian, uint32(2))
+	binary.Write(&buf, binary.BigEndian, uint32(len(objects)))
+	offsets := []int64{}
+	for _, o := range objects {
+		offset := int64(buf.Len())
+		offsets = append(offsets, offset)
+
+		// type and size: 3 bits of type, 4 bits of size, then 7 bits per byte.
+		size := len(o.content)
+		b := o.objType<<4 | byte(size&0x0f)
+		size >>= 4
+		for size > 0 {
+			buf.WriteByte(b | 0x80)
+			b = byte(size & 0x7f)
+			size >>= 7
+		}
+		buf.WriteByte(b)
+
+		switch o.objType {
+		case objOfsDelta:
+			buf.Write(encodeTestOffset(offset - offsets[o.base]))
+		case objRefDelta:
+			sha, err := hex.DecodeString(o.baseSha)
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf.Write(sha)
+		}
+		w := zlib.NewWriter(&buf)
+		if _, err := w.Write(o.content); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checksum := sha1.Sum(buf.Bytes())
+	buf.Write(checksum[:])
+	return buf.Bytes(), offsets
+}
+
+// Encode the negative offset of an OFS_DELTA entry, the inverse of readOffset.
+func encodeTestOffset(offset int64) []byte {
+	encoded := []byte{byte(offset & 0x7f)}
+	for offset >>= 7; offset > 0; offset >>= 7 {
+		offset--
+		encoded = append([]byte{byte(0x80 | offset&0x7f)}, encoded...)
+	}
+	return encoded
+}
+
+// Build delta instructions which turn a base of baseLen bytes into a
+// result of resultLen bytes. Each op is either a string to insert or
+// a [2]int{offset, size} to copy from the base.
+func buildTestDelta(baseLen, resultLen int, ops ...interface{}) []byte {
+	var buf bytes.Buffer
+	varint := make([]byte, binary.MaxVarintLen64)
+	buf.Write(varint[:binary.PutUvarint(varint, uint64(baseLen))])
+	buf.Write(varint[:binary.PutUvarint(varint, uint64(resultLen))])
+	for _, op := range ops {
+		switch op := op.(type) {
+		case string:
+			buf.WriteByte(byte(len(op)))
+			buf.WriteString(op)
+		case [2]int:
+			cmd, args := byte(0x80), []byte{}
+			for i := 0; i < 4; i++ {
+				if b := byte(op[0] >> (8 * i)); b != 0 {
+					cmd |= 1 << i
+					args = append(args, b)
+				}
+			}
+			for i := 0; i < 3; i++ {
+				if b := byte(op[1] >> (8 * i)); b != 0 {
+					cmd |= 1 << (4 + i)
+					args = append(args, b)
+				}
+			}
+			buf.WriteByte(cmd)
+			buf.Write(args)
+		}
+	}
+	return buf.Bytes()
+}
+
+func testBlobSha(content string) string {
+	return fmt.Sprintf("%x", sha1.Sum([]byte(fmt.Sprintf("blob %d\x00%s", len(content), content))))
+}
+
+func TestReadOffset(t *testing.T) {
+	for _, offset := range []int64{1, 127, 128, 129, 16511, 16512, 1 << 20} {
+		got, err := readOffset(bytes.NewReader(encodeTestOffset(offset)))
+		if err != nil || got != offset {
+			t.Errorf("readOffset(encodeTestOffset(%d)) = %d, %v", offset, got, err)
+		}
+	}
+}
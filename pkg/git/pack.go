@@ -0,0 +1,429 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Reading objects from the packfiles in .git/objects/pack.
+// ref: https://git-scm.com/docs/pack-format
+
+const (
+	packSignature      = "PACK"
+	packIndexSignature = "\xfftOc"
+	packIndexVersion   = 2
+
+	// A 4 byte offset with the MSB set is an index into the 8 byte offset table.
+	packLargeOffsetFlag = uint32(0x80000000)
+
+	// Resolved objects are kept to avoid re-applying delta chains which
+	// share the same bases. Large objects are not kept to bound memory.
+	packCacheMaxEntries = 256
+	packCacheMaxObjSize = 1 << 20
+)
+
+// v2 pack index
+// ref: https://git-scm.com/docs/pack-format#_version_2_pack_idx_files_support_packs_larger_than_4_gib_and
+type packIndex struct {
+	fanout       [256]uint32
+	shas         []byte // sorted object names (20 bytes each)
+	crcs         []byte // CRC32 of the packed data of each object (4 bytes each)
+	offsets      []byte // 4 bytes each
+	largeOffsets []byte // 8 bytes each
+	packChecksum []byte
+}
+
+// Returned when the base of a REF_DELTA object can't be found.
+var errUnknownDeltaBase = errors.New("unknown delta base object")
+
+type packFile struct {
+	path  string
+	index *packIndex
+	file  *os.File
+	cache map[int64]Object
+	// Used instead of index while the index of the pack is being built.
+	objectOffsets map[string]int64
+}
+
+func parsePackIndex(content []byte) (*packIndex, error) {
+	headerLen := 8 + 256*4
+	if len(content) < headerLen+40 || string(content[:4]) != packIndexSignature {
+		return nil, fmt.Errorf("unsupported pack index")
+	}
+	if version := binary.BigEndian.Uint32(content[4:8]); version != packIndexVersion {
+		return nil, fmt.Errorf("unsupported pack index version: %d", version)
+	}
+	checksum := sha1.Sum(content[:len(content)-20])
+	if !bytes.Equal(checksum[:], content[len(content)-20:]) {
+		return nil, fmt.Errorf("pack index checksum mismatch")
+	}
+
+	idx := &packIndex{}
+	for i := range idx.fanout {
+		idx.fanout[i] = binary.BigEndian.Uint32(content[8+i*4:])
+	}
+	count := int(idx.fanout[255])
+	rest := content[headerLen : len(content)-40]
+	if len(rest) < count*(20+4+4) {
+		return nil, fmt.Errorf("truncated pack index")
+	}
+	idx.shas, rest = rest[:count*20], rest[count*20:]
+	idx.crcs, rest = rest[:count*4], rest[count*4:]
+	idx.offsets, rest = rest[:count*4], rest[count*4:]
+	if len(rest)%8 != 0 {
+		return nil, fmt.Errorf("invalid pack index size")
+	}
+	idx.largeOffsets = rest
+	idx.packChecksum = content[len(content)-40 : len(content)-20]
+	return idx, nil
+}
+
+func (idx *packIndex) count() int {
+	return int(idx.fanout[255])
+}
+
+func (idx *packIndex) sha(i int) string {
+	return hex.EncodeToString(idx.shas[i*20 : i*20+20])
+}
+
+func (idx *packIndex) crc32(i int) uint32 {
+	return binary.BigEndian.Uint32(idx.crcs[i*4:])
+}
+
+func (idx *packIndex) offset(i int) (int64, error) {
+	offset := binary.BigEndian.Uint32(idx.offsets[i*4:])
+	if offset&packLargeOffsetFlag == 0 {
+		return int64(offset), nil
+	}
+	large := int(offset &^ packLargeOffsetFlag)
+	if (large+1)*8 > len(idx.largeOffsets) {
+		return 0, fmt.Errorf("invalid large offset in pack index")
+	}
+	return int64(binary.BigEndian.Uint64(idx.largeOffsets[large*8:])), nil
+}
+
+// Return the position of the object in the index.
+func (idx *packIndex) find(sha []byte) (int, bool) {
+	lo := 0
+	if sha[0] > 0 {
+		lo = int(idx.fanout[sha[0]-1])
+	}
+	hi := int(idx.fanout[sha[0]])
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(idx.shas[(lo+i)*20:(lo+i)*20+20], sha) >= 0
+	})
+	if i < hi && bytes.Equal(idx.shas[i*20:i*20+20], sha) {
+		return i, true
+	}
+	return 0, false
+}
+
+func openPackFile(packPath, idxPath string) (*packFile, error) {
+	content, err := os.ReadFile(idxPath)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := parsePackIndex(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", idxPath, err)
+	}
+
+	file, err := os.Open(packPath)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(file, header); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if string(header[:4]) != packSignature {
+		file.Close()
+		return nil, fmt.Errorf("%s: not a packfile", packPath)
+	}
+	if version := binary.BigEndian.Uint32(header[4:8]); version != 2 && version != 3 {
+		file.Close()
+		return nil, fmt.Errorf("%s: unsupported pack version: %d", packPath, version)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	trailer := make([]byte, 20)
+	if _, err := file.ReadAt(trailer, info.Size()-20); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if !bytes.Equal(trailer, idx.packChecksum) {
+		file.Close()
+		return nil, fmt.Errorf("%s: does not match the index %s", packPath, idxPath)
+	}
+
+	return &packFile{
+		path:  packPath,
+		index: idx,
+		file:  file,
+		cache: make(map[int64]Object),
+	}, nil
+}
+
+// Return the offset of the object in this pack.
+func (p *packFile) objectOffset(sha string) (int64, bool, error) {
+	if p.index == nil {
+		offset, ok := p.objectOffsets[sha]
+		return offset, ok, nil
+	}
+	rawSha, err := hex.DecodeString(sha)
+	if err != nil || len(rawSha) != 20 {
+		return 0, false, nil
+	}
+	i, ok := p.index.find(rawSha)
+	if !ok {
+		return 0, false, nil
+	}
+	offset, err := p.index.offset(i)
+	return offset, err == nil, err
+}
+
+// PackObjectStore reads the objects in the packs under Dir (usually
+// .git/objects/pack). Packs are added with IndexPackStream and
+// WritePackFiles, not object by object.
+type PackObjectStore struct {
+	Dir string
+	// Where the bases of REF_DELTA objects which aren't in the same pack are read from.
+	bases  ObjectStore
+	packs  []*packFile
+	loaded bool
+}
+
+func NewPackObjectStore(dir string) *PackObjectStore {
+	return &PackObjectStore{Dir: dir}
+}
+
+// Open the packs in the directory. Packs without an index are skipped.
+func (s *PackObjectStore) load() ([]*packFile, error) {
+	if s.loaded {
+		return s.packs, nil
+	}
+	idxFiles, err := filepath.Glob(path.Join(s.Dir, "*.idx"))
+	if err != nil {
+		return nil, err
+	}
+	packs := []*packFile{}
+	for _, idxFile := range idxFiles {
+		packPath := strings.TrimSuffix(idxFile, ".idx") + ".pack"
+		if _, err := os.Stat(packPath); os.IsNotExist(err) {
+			continue
+		}
+		pack, err := openPackFile(packPath, idxFile)
+		if err != nil {
+			return nil, err
+		}
+		packs = append(packs, pack)
+	}
+	s.packs, s.loaded = packs, true
+	return packs, nil
+}
+
+// Close the opened packs so that packs added or removed since are seen.
+func (s *PackObjectStore) Reload() {
+	for _, pack := range s.packs {
+		pack.file.Close()
+	}
+	s.packs, s.loaded = nil, false
+}
+
+// Read the object at offset in the pack, resolving delta chains.
+func (p *packFile) readObjectAt(bases ObjectStore, offset int64) (Object, error) {
+	if obj, ok := p.cache[offset]; ok {
+		return obj, nil
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(p.file, offset, 1<<62))
+	objType, objLen, err := readObjectTypeAndLen(reader)
+	if err != nil {
+		return Object{}, err
+	}
+	var baseObj Object
+	switch objType {
+	case objOfsDelta:
+		negativeOffset, err := readOffset(reader)
+		if err != nil {
+			return Object{}, err
+		}
+		if negativeOffset <= 0 || negativeOffset > offset {
+			return Object{}, fmt.Errorf("%s: invalid delta base offset at %d", p.path, offset)
+		}
+		baseObj, err = p.readObjectAt(bases, offset-negativeOffset)
+		if err != nil {
+			return Object{}, err
+		}
+	case objRefDelta:
+		baseObjSha, err := readSha(reader)
+		if err != nil {
+			return Object{}, err
+		}
+		// The base is usually in the same pack, but thin packs refer to
+		// objects which are already in the repository.
+		baseOffset, ok, err := p.objectOffset(baseObjSha)
+		if err != nil {
+			return Object{}, err
+		}
+		if ok {
+			baseObj, err = p.readObjectAt(bases, baseOffset)
+		} else if bases != nil && bases.Has(baseObjSha) {
+			baseObj, err = readStoredObject(bases, baseObjSha)
+		} else {
+			err = fmt.Errorf("%w: %s", errUnknownDeltaBase, baseObjSha)
+		}
+		if err != nil {
+			return Object{}, err
+		}
+	case objCommit, objTree, objBlob, objTag:
+	default:
+		return Object{}, fmt.Errorf("%s: invalid object type %d at %d", p.path, objType, offset)
+	}
+
+	decompressed, err := decompressObject(reader)
+	if err != nil {
+		return Object{}, err
+	}
+	if objLen != decompressed.Len() {
+		return Object{}, fmt.Errorf("%s: expected obj len: %d, but got: %d", p.path, objLen, decompressed.Len())
+	}
+	obj := Object{
+		Type: objType,
+		Buf:  decompressed.Bytes(),
+	}
+	if objType == objOfsDelta || objType == objRefDelta {
+		deltified, err := readDeltified(decompressed, &baseObj)
+		if err != nil {
+			return Object{}, err
+		}
+		obj = Object{
+			Type: baseObj.Type,
+			Buf:  deltified.Bytes(),
+		}
+	}
+
+	if len(obj.Buf) <= packCacheMaxObjSize {
+		if len(p.cache) >= packCacheMaxEntries {
+			p.cache = make(map[int64]Object)
+		}
+		p.cache[offset] = obj
+	}
+	return obj, nil
+}
+
+// Find the object in the packs.
+func (s *PackObjectStore) find(sha string) (Object, bool, error) {
+	packs, err := s.load()
+	if err != nil {
+		return Object{}, false, err
+	}
+	for _, pack := range packs {
+		offset, ok, err := pack.objectOffset(sha)
+		if err != nil {
+			return Object{}, false, err
+		}
+		if !ok {
+			continue
+		}
+		obj, err := pack.readObjectAt(s.bases, offset)
+		if err != nil {
+			return Object{}, false, err
+		}
+		return obj, true, nil
+	}
+	return Object{}, false, nil
+}
+
+// Packed objects are read into memory as a whole to resolve their deltas.
+func (s *PackObjectStore) Get(sha string) (*GitObjectReader, error) {
+	obj, found, err := s.find(sha)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, objectNotFound(sha)
+	}
+	return newObjectReader(sha, obj)
+}
+
+// Report whether the object is in one of the packs without reading it.
+func (s *PackObjectStore) Has(sha string) bool {
+	rawSha, err := hex.DecodeString(sha)
+	if err != nil || len(rawSha) != 20 {
+		return false
+	}
+	packs, err := s.load()
+	if err != nil {
+		return false
+	}
+	for _, pack := range packs {
+		if _, ok := pack.index.find(rawSha); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Call fn with the objects right before and after the sha in each pack
+// index, which are the ones sharing the longest prefix with it.
+func (s *PackObjectStore) neighbours(sha string, fn func(sha string)) {
+	rawSha, err := hex.DecodeString(sha)
+	if err != nil || len(rawSha) != 20 {
+		return
+	}
+	packs, err := s.load()
+	if err != nil {
+		return
+	}
+	for _, pack := range packs {
+		idx := pack.index
+		i := sort.Search(idx.count(), func(i int) bool {
+			return bytes.Compare(idx.shas[i*20:i*20+20], rawSha) >= 0
+		})
+		if i > 0 {
+			fn(idx.sha(i - 1))
+		}
+		if i < idx.count() && bytes.Equal(idx.shas[i*20:i*20+20], rawSha) {
+			i++
+		}
+		if i < idx.count() {
+			fn(idx.sha(i))
+		}
+	}
+}
+
+func (s *PackObjectStore) Put(objType string, content []byte) (string, error) {
+	return "", errors.New("objects can't be added to a pack one by one")
+}
+
+// Iterate visits the objects of each pack in the order of their index.
+func (s *PackObjectStore) Iterate(fn func(sha string) error) error {
+	packs, err := s.load()
+	if err != nil {
+		return err
+	}
+	for _, pack := range packs {
+		for i := 0; i < pack.index.count(); i++ {
+			if err := fn(pack.index.sha(i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,429 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"sort"
+)
+
+// Writing packfiles from a list of objects, with delta compression.
+// ref: https://git-scm.com/docs/git-pack-objects
+
+const (
+	DefaultPackWindow = 10
+	DefaultPackDepth  = 50
+
+	// Length of the blocks of the delta base which are indexed to find copies.
+	deltaBlockLen = 16
+	// Max length of a copy instruction.
+	deltaMaxCopyLen = 0xffffff
+	// Max length of an insert instruction.
+	deltaMaxInsertLen = 0x7f
+)
+
+// An object to be packed.
+type PackObject struct {
+	Sha      string
+	ObjType  byte
+	Size     int64
+	NameHash uint32 // hash of the path, to place similar objects close together
+}
+
+// Hash of the path used to sort objects for delta compression.
+// Files with the same basename get similar hashes.
+// ref: https://github.com/git/git/blob/master/pack-objects.h (pack_name_hash)
+func PackNameHash(name string) uint32 {
+	var hash uint32
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f' {
+			continue
+		}
+		hash = (hash >> 2) + (uint32(c) << 24)
+	}
+	return hash
+}
+
+// Collect the objects reachable from the tips, excluding the objects reachable
+// from excluded. Tips can be any type of object. names gives the paths of
+// the tips if they are known (e.g. for blobs in the index).
+func ListObjects(repo *Repository, tips, excluded []string, names map[string]string) ([]PackObject, error) {
+	seen := map[string]bool{}
+	if _, err := walkObjects(repo, excluded, nil, seen); err != nil {
+		return nil, err
+	}
+	return walkObjects(repo, tips, names, seen)
+}
+
+type pendingObject struct {
+	sha  string
+	name string
+}
+
+func walkObjects(repo *Repository, tips []string, names map[string]string, seen map[string]bool) ([]PackObject, error) {
+	objects := []PackObject{}
+	stack := []pendingObject{}
+	for i := len(tips) - 1; i >= 0; i-- {
+		stack = append(stack, pendingObject{sha: tips[i], name: names[tips[i]]})
+	}
+	for len(stack) > 0 {
+		pending := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[pending.sha] {
+			continue
+		}
+		seen[pending.sha] = true
+
+		objReader, err := repo.Objects.Get(pending.sha)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %s", pending.sha, err)
+		}
+		objType, err := ParseObjectType(objReader.Type)
+		if err != nil {
+			objReader.Close()
+			return nil, err
+		}
+		objects = append(objects, PackObject{
+			Sha:      pending.sha,
+			ObjType:  objType,
+			Size:     objReader.ContentSize,
+			NameHash: PackNameHash(pending.name),
+		})
+		if objType == objBlob {
+			objReader.Close()
+			continue
+		}
+		content, err := objReader.ReadContents()
+		objReader.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		switch objType {
+		case objCommit:
+			commit, err := parseCommit(pending.sha, content)
+			if err != nil {
+				return nil, err
+			}
+			for i := len(commit.Parents) - 1; i >= 0; i-- {
+				stack = append(stack, pendingObject{sha: commit.Parents[i]})
+			}
+			stack = append(stack, pendingObject{sha: commit.Tree})
+		case objTag:
+			// "object <sha>\ntype <type>\n..."
+			if !bytes.HasPrefix(content, []byte("object ")) || len(content) < 47 {
+				return nil, fmt.Errorf("invalid tag object %s", pending.sha)
+			}
+			stack = append(stack, pendingObject{sha: string(content[7:47])})
+		case objTree:
+			tree, err := ParseTree(content)
+			if err != nil {
+				return nil, err
+			}
+			for i := len(tree.Children) - 1; i >= 0; i-- {
+				child := tree.Children[i]
+				if child.Mode == "160000" {
+					// submodule commits are in another repository
+					continue
+				}
+				stack = append(stack, pendingObject{sha: child.Sha, name: path.Join(pending.name, child.Name)})
+			}
+		}
+	}
+	return objects, nil
+}
+
+// Writer of the pack stream which records the offset and CRC32 of each entry.
+type packWriter struct {
+	writer io.Writer
+	hasher hash.Hash
+	crc    hash.Hash32
+	offset int64
+}
+
+func (w *packWriter) Write(p []byte) (int, error) {
+	w.hasher.Write(p)
+	w.crc.Write(p)
+	w.offset += int64(len(p))
+	return w.writer.Write(p)
+}
+
+// Encode the type and size of a pack entry. This is the reverse of readObjectTypeAndLen.
+func encodePackEntryHeader(objType byte, size int64) []byte {
+	b := objType<<4 | byte(size)&firstRemMask
+	size >>= 4
+	header := []byte{}
+	for size > 0 {
+		header = append(header, b|msbMask)
+		b = byte(size) & remMask
+		size >>= 7
+	}
+	return append(header, b)
+}
+
+// Encode the negative offset of an OFS_DELTA entry. This is the reverse of readOffset.
+func encodeDeltaOffset(offset int64) []byte {
+	encoded := []byte{byte(offset) & remMask}
+	for offset >>= 7; offset > 0; offset >>= 7 {
+		offset--
+		encoded = append([]byte{byte(offset)&remMask | msbMask}, encoded...)
+	}
+	return encoded
+}
+
+// Encode a size in the header of delta data.
+func encodeDeltaSize(size int) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return buf[:binary.PutUvarint(buf, uint64(size))]
+}
+
+// Create delta data which rebuilds target from base. Returns nil if the delta
+// would be larger than maxLen.
+// ref: https://git-scm.com/docs/pack-format#_deltified_representation
+func createDelta(base, target []byte, maxLen int) []byte {
+	delta := append(encodeDeltaSize(len(base)), encodeDeltaSize(len(target))...)
+	if len(base) < deltaBlockLen {
+		return nil
+	}
+
+	// Index the blocks of the base by their content.
+	blocks := make(map[string]int, len(base)/deltaBlockLen)
+	for i := len(base) - deltaBlockLen; i >= 0; i -= deltaBlockLen {
+		blocks[string(base[i:i+deltaBlockLen])] = i
+	}
+
+	insertStart := 0
+	flushInsert := func(end int) {
+		for insertStart < end {
+			n := end - insertStart
+			if n > deltaMaxInsertLen {
+				n = deltaMaxInsertLen
+			}
+			delta = append(delta, byte(n))
+			delta = append(delta, target[insertStart:insertStart+n]...)
+			insertStart += n
+		}
+	}
+
+	for i := 0; i+deltaBlockLen <= len(target); {
+		baseOffset, ok := blocks[string(target[i:i+deltaBlockLen])]
+		if !ok {
+			i++
+			continue
+		}
+		// Extend the match backwards into the pending insert and forwards.
+		start := i
+		for start > insertStart && baseOffset > 0 && target[start-1] == base[baseOffset-1] {
+			start--
+			baseOffset--
+		}
+		end := i + deltaBlockLen
+		for end < len(target) && baseOffset+(end-start) < len(base) && target[end] == base[baseOffset+(end-start)] {
+			end++
+		}
+
+		flushInsert(start)
+		for start < end {
+			n := end - start
+			if n > deltaMaxCopyLen {
+				n = deltaMaxCopyLen
+			}
+			delta = append(delta, encodeDeltaCopy(baseOffset, n)...)
+			start += n
+			baseOffset += n
+		}
+		insertStart = end
+		i = end
+		if len(delta) > maxLen {
+			return nil
+		}
+	}
+	flushInsert(len(target))
+	if len(delta) > maxLen {
+		return nil
+	}
+	return delta
+}
+
+// Encode the instruction to copy size bytes at offset of the base.
+func encodeDeltaCopy(offset, size int) []byte {
+	instruction := []byte{msbMask}
+	for i := 0; i < 4; i++ {
+		if b := byte(offset >> (i * 8)); b != 0 {
+			instruction[0] |= 1 << i
+			instruction = append(instruction, b)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if b := byte(size >> (i * 8)); b != 0 {
+			instruction[0] |= 1 << (4 + i)
+			instruction = append(instruction, b)
+		}
+	}
+	return instruction
+}
+
+// An object in the delta window.
+type deltaCandidate struct {
+	object  PackObject
+	content []byte
+	offset  int64
+	depth   int
+}
+
+// Write a v2 pack of the objects to w. Each object is tried as a delta of
+// the previous window objects of the same type, after sorting them by type,
+// name hash and size so that similar objects are next to each other.
+// Return the entries for the pack index and the pack checksum.
+func WritePack(repo *Repository, w io.Writer, objects []PackObject, window, depth int) ([]*packEntry, []byte, error) {
+	sorted := make([]PackObject, len(objects))
+	copy(sorted, objects)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].ObjType != sorted[j].ObjType {
+			return sorted[i].ObjType < sorted[j].ObjType
+		}
+		if sorted[i].NameHash != sorted[j].NameHash {
+			return sorted[i].NameHash < sorted[j].NameHash
+		}
+		// Larger objects first, so that deltas mostly remove data.
+		return sorted[i].Size > sorted[j].Size
+	})
+
+	bufWriter := bufio.NewWriter(w)
+	pw := &packWriter{writer: bufWriter, hasher: sha1.New(), crc: crc32.NewIEEE()}
+	header := bytes.NewBuffer([]byte{})
+	header.WriteString(packSignature)
+	binary.Write(header, binary.BigEndian, uint32(2))
+	binary.Write(header, binary.BigEndian, uint32(len(sorted)))
+	if _, err := pw.Write(header.Bytes()); err != nil {
+		return nil, nil, err
+	}
+
+	entries := make([]*packEntry, 0, len(sorted))
+	candidates := []deltaCandidate{}
+	for _, object := range sorted {
+		content, err := ReadObjectContent(repo, object.Sha)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Find the smallest delta in the window.
+		var bestDelta []byte
+		var best *deltaCandidate
+		for i := range candidates {
+			candidate := &candidates[i]
+			if candidate.object.ObjType != object.ObjType || candidate.depth >= depth {
+				continue
+			}
+			// A delta isn't worth it unless it is much smaller than the object.
+			maxLen := len(content)/2 - 20
+			if bestDelta != nil && len(bestDelta) < maxLen {
+				maxLen = len(bestDelta) - 1
+			}
+			if maxLen <= 0 || int64(len(content)) < candidate.object.Size/32 {
+				continue
+			}
+			if delta := createDelta(candidate.content, content, maxLen); delta != nil {
+				bestDelta, best = delta, candidate
+			}
+		}
+
+		entry := &packEntry{offset: pw.offset, objType: object.ObjType}
+		entry.sha, _ = hex.DecodeString(object.Sha)
+		pw.crc.Reset()
+		data, entryDepth := content, 0
+		if best != nil {
+			data, entryDepth = bestDelta, best.depth+1
+			entryHeader := encodePackEntryHeader(objOfsDelta, int64(len(bestDelta)))
+			entryHeader = append(entryHeader, encodeDeltaOffset(entry.offset-best.offset)...)
+			if _, err := pw.Write(entryHeader); err != nil {
+				return nil, nil, err
+			}
+		} else if _, err := pw.Write(encodePackEntryHeader(object.ObjType, int64(len(content)))); err != nil {
+			return nil, nil, err
+		}
+		compressedWriter := zlib.NewWriter(pw)
+		if _, err := compressedWriter.Write(data); err != nil {
+			return nil, nil, err
+		}
+		if err := compressedWriter.Close(); err != nil {
+			return nil, nil, err
+		}
+		entry.crc = pw.crc.Sum32()
+		entries = append(entries, entry)
+
+		if window > 0 {
+			if len(candidates) >= window {
+				candidates = candidates[1:]
+			}
+			candidates = append(candidates, deltaCandidate{
+				object:  object,
+				content: content,
+				offset:  entry.offset,
+				depth:   entryDepth,
+			})
+		}
+	}
+
+	checksum := pw.hasher.Sum(nil)
+	if _, err := bufWriter.Write(checksum); err != nil {
+		return nil, nil, err
+	}
+	if err := bufWriter.Flush(); err != nil {
+		return nil, nil, err
+	}
+	return entries, checksum, nil
+}
+
+// Write the objects to <baseName>-<checksum>.pack with its index.
+// Return the checksum.
+func WritePackFiles(repo *Repository, baseName string, objects []PackObject, window, depth int) (string, error) {
+	dir := path.Dir(baseName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	tmpPack, err := os.CreateTemp(dir, "tmp_pack_")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmpPack.Name())
+	defer tmpPack.Close()
+
+	entries, checksum, err := WritePack(repo, tmpPack, objects, window, depth)
+	if err != nil {
+		return "", err
+	}
+	if err := tmpPack.Close(); err != nil {
+		return "", err
+	}
+	name := hex.EncodeToString(checksum)
+	packPath := fmt.Sprintf("%s-%s.pack", baseName, name)
+	idxPath := fmt.Sprintf("%s-%s.idx", baseName, name)
+	if _, err := os.Stat(idxPath); err == nil {
+		// The same pack is already there.
+		return name, nil
+	}
+	if err := os.Chmod(tmpPack.Name(), 0444); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmpPack.Name(), packPath); err != nil {
+		return "", err
+	}
+	if err := writePackIndex(idxPath, entries, checksum); err != nil {
+		return "", err
+	}
+	if db, ok := repo.Objects.(*ObjectDatabase); ok {
+		db.Packs.Reload()
+	}
+	return name, nil
+}
@@ -0,0 +1,152 @@
+package git
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// Build the version 2 index of a pack built by buildTestPack, given the
+// names of its objects in pack order.
+func buildTestPackIndex(t *testing.T, pack []byte, offsets []int64, shas []string) []byte {
+	t.Helper()
+	type entry struct {
+		sha    []byte
+		crc    uint32
+		offset int64
+	}
+	entries := []entry{}
+	for i, sha := range shas {
+		rawSha, err := hex.DecodeString(sha)
+		if err != nil {
+			t.Fatal(err)
+		}
+		end := int64(len(pack) - 20)
+		if i+1 < len(offsets) {
+			end = offsets[i+1]
+		}
+		entries = append(entries, entry{rawSha, crc32.ChecksumIEEE(pack[offsets[i]:end]), offsets[i]})
+	}
+	sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].sha, entries[j].sha) < 0 })
+
+	var buf bytes.Buffer
+	buf.WriteString(packIndexSignature)
+	binary.Write(&buf, binary.BigEndian, uint32(packIndexVersion))
+	for b := 0; b < 256; b++ {
+		n := 0
+		for _, e := range entries {
+			if int(e.sha[0]) <= b {
+				n++
+			}
+		}
+		binary.Write(&buf, binary.BigEndian, uint32(n))
+	}
+	for _, e := range entries {
+		buf.Write(e.sha)
+	}
+	for _, e := range entries {
+		binary.Write(&buf, binary.BigEndian, e.crc)
+	}
+	for _, e := range entries {
+		binary.Write(&buf, binary.BigEndian, uint32(e.offset))
+	}
+	buf.Write(pack[len(pack)-20:])
+	checksum := sha1.Sum(buf.Bytes())
+	buf.Write(checksum[:])
+	return buf.Bytes()
+}
+
+func TestPackedObjects(t *testing.T) {
+	repo := newTestDiskRepository(t)
+	base := "hello, world\nthis is the base object\n"
+	second := "hello, world\nthis is the second object\n"
+	third := "HEAD: hello, world\nthis is the second object\n"
+	fourth := "hello, world\nthis is the base object\nwith a line\n"
+	pack, offsets := buildTestPack(t, []testPackObject{
+		{objType: objBlob, content: []byte(base)},
+		{objType: objOfsDelta, base: 0, content: buildTestDelta(len(base), len(second), [2]int{0, 25}, "second object\n")},
+		{objType: objOfsDelta, base: 1, content: buildTestDelta(len(second), len(third), "HEAD: ", [2]int{0, len(second)})},
+		{objType: objRefDelta, baseSha: testBlobSha(base), content: buildTestDelta(len(base), len(fourth), [2]int{0, len(base)}, "with a line\n")},
+	})
+	shas := []string{testBlobSha(base), testBlobSha(second), testBlobSha(third), testBlobSha(fourth)}
+	index := buildTestPackIndex(t, pack, offsets, shas)
+
+	packDir := filepath.Join(repo.GitDir, "objects", "pack")
+	name := hex.EncodeToString(pack[len(pack)-20:])
+	if err := os.MkdirAll(packDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(packDir, "pack-"+name+".pack"), pack, 0444); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(packDir, "pack-"+name+".idx"), index, 0444); err != nil {
+		t.Fatal(err)
+	}
+	packs := NewPackObjectStore(packDir)
+	t.Cleanup(packs.Reload)
+
+	for _, want := range []string{base, second, third, fourth} {
+		obj, found, err := packs.find(testBlobSha(want))
+		if err != nil || !found {
+			t.Errorf("find(%q) = %v, %v", want, found, err)
+			continue
+		}
+		if obj.Type != objBlob || string(obj.Buf) != want {
+			t.Errorf("object = %d %q, want blob %q", obj.Type, obj.Buf, want)
+		}
+		if !packs.Has(testBlobSha(want)) {
+			t.Errorf("Has(%q) = false", want)
+		}
+	}
+	if _, found, err := packs.find(testBlobSha("missing\n")); found || err != nil {
+		t.Errorf("find(missing) = %v, %v", found, err)
+	}
+
+	listed := []string{}
+	if err := packs.Iterate(func(sha string) error {
+		listed = append(listed, sha)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(listed)
+	sort.Strings(shas)
+	if len(listed) != len(shas) {
+		t.Fatalf("Iterate() = %v, want %v", listed, shas)
+	}
+	for i := range shas {
+		if listed[i] != shas[i] {
+			t.Errorf("Iterate() = %v, want %v", listed, shas)
+			break
+		}
+	}
+}
+
+func TestParsePackIndexErrors(t *testing.T) {
+	pack, offsets := buildTestPack(t, []testPackObject{{objType: objBlob, content: []byte("a\n")}})
+	index := buildTestPackIndex(t, pack, offsets, []string{testBlobSha("a\n")})
+	if _, err := parsePackIndex(index); err != nil {
+		t.Fatalf("parsePackIndex() = %v", err)
+	}
+
+	corrupted := append([]byte{}, index...)
+	corrupted[len(corrupted)-30] ^= 0xff
+	if _, err := parsePackIndex(corrupted); err == nil {
+		t.Error("parsePackIndex() accepted a bad checksum")
+	}
+	if _, err := parsePackIndex(index[:100]); err == nil {
+		t.Error("parsePackIndex() accepted a truncated index")
+	}
+	version1 := append([]byte{}, index...)
+	version1[7] = 1
+	if _, err := parsePackIndex(version1); err == nil {
+		t.Error("parsePackIndex() accepted version 1")
+	}
+}
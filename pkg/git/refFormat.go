@@ -0,0 +1,324 @@
+package git
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultRefFormat is the default format of for-each-ref.
+const DefaultRefFormat = "%(objectname) %(objecttype)\t%(refname)"
+
+// refObject is what for-each-ref knows about the object a ref points to.
+type refObject struct {
+	sha     string
+	objType string
+	size    int64
+	commit  *Commit // for commits
+	tag     *Tag    // for annotated tags
+}
+
+// RefFormatter expands the %(...) atoms of for-each-ref --format.
+// ref: https://git-scm.com/docs/git-for-each-ref#_field_names
+type RefFormatter struct {
+	repo    *Repository
+	headRef string // the branch HEAD points to
+	objects map[string]*refObject
+}
+
+// Create a formatter for the refs of the repository.
+func NewRefFormatter(repo *Repository) *RefFormatter {
+	headRef, _, _ := ReadHead(repo)
+	return &RefFormatter{repo: repo, headRef: headRef, objects: map[string]*refObject{}}
+}
+
+func (f *RefFormatter) object(sha string) (*refObject, error) {
+	if obj, ok := f.objects[sha]; ok {
+		return obj, nil
+	}
+	objReader, err := f.repo.Objects.Get(sha)
+	if err != nil {
+		return nil, err
+	}
+	objReader.Close()
+	obj := &refObject{sha: sha, objType: objReader.Type, size: objReader.ContentSize}
+	switch obj.objType {
+	case "commit":
+		if obj.commit, err = ReadCommit(f.repo, sha); err != nil {
+			return nil, err
+		}
+	case "tag":
+		if obj.tag, err = ReadTag(f.repo, sha); err != nil {
+			return nil, err
+		}
+	}
+	f.objects[sha] = obj
+	return obj, nil
+}
+
+// Expand the format for the ref: %(atom), %% and %xx (a hex byte).
+func (f *RefFormatter) Format(ref Ref, format string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		switch {
+		case strings.HasPrefix(format[i:], "%%"):
+			b.WriteByte('%')
+			i++
+		case strings.HasPrefix(format[i:], "%("):
+			end := strings.IndexByte(format[i:], ')')
+			if end < 0 {
+				return "", fmt.Errorf("malformed format string %s", format[i:])
+			}
+			value, err := f.atom(ref, format[i+2:i+end])
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(value)
+			i += end
+		case format[i] == '%' && i+2 < len(format):
+			if c, err := strconv.ParseUint(format[i+1:i+3], 16, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 2
+				continue
+			}
+			b.WriteByte(format[i])
+		default:
+			b.WriteByte(format[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// Return the value of a single atom such as "refname:short" or "*objectname".
+func (f *RefFormatter) atom(ref Ref, atom string) (string, error) {
+	name, modifier := atom, ""
+	if colon := strings.IndexByte(atom, ':'); colon >= 0 {
+		name, modifier = atom[:colon], atom[colon+1:]
+	}
+
+	switch name {
+	case "refname":
+		return formatRefName(ref.Name, modifier)
+	case "symref":
+		if ref.Target == "" {
+			return "", nil
+		}
+		return formatRefName(ref.Target, modifier)
+	case "HEAD":
+		if ref.Name == f.headRef {
+			return "*", nil
+		}
+		return " ", nil
+	}
+
+	sha := ref.Sha
+	if strings.HasPrefix(name, "*") {
+		// the object an annotated tag points to
+		name = name[1:]
+		obj, err := f.object(sha)
+		if err != nil {
+			return "", err
+		}
+		if obj.tag == nil {
+			return "", nil
+		}
+		sha = obj.tag.Object
+	}
+	obj, err := f.object(sha)
+	if err != nil {
+		return "", err
+	}
+
+	switch name {
+	case "objectname":
+		switch {
+		case modifier == "":
+			return obj.sha, nil
+		case modifier == "short":
+			return ShortenSha(f.repo, obj.sha, 7), nil
+		case strings.HasPrefix(modifier, "short="):
+			n, err := strconv.Atoi(strings.TrimPrefix(modifier, "short="))
+			if err != nil {
+				return "", fmt.Errorf("positive value expected objectname:%s", modifier)
+			}
+			return ShortenSha(f.repo, obj.sha, n), nil
+		}
+	case "objecttype":
+		return obj.objType, nil
+	case "objectsize":
+		return strconv.FormatInt(obj.size, 10), nil
+	case "tree":
+		if obj.commit != nil {
+			return obj.commit.Tree, nil
+		}
+		return "", nil
+	case "parent":
+		if obj.commit != nil {
+			return strings.Join(obj.commit.Parents, " "), nil
+		}
+		return "", nil
+	case "numparent":
+		if obj.commit != nil {
+			return strconv.Itoa(len(obj.commit.Parents)), nil
+		}
+		return "", nil
+	case "object", "type", "tag":
+		if obj.tag == nil {
+			return "", nil
+		}
+		return map[string]string{"object": obj.tag.Object, "type": obj.tag.Type, "tag": obj.tag.Name}[name], nil
+	case "subject", "body", "contents":
+		message, subject, body := "", "", ""
+		switch {
+		case obj.commit != nil:
+			message, subject, body = obj.commit.Message, obj.commit.Subject(), obj.commit.Body()
+		case obj.tag != nil:
+			message, subject, body = obj.tag.Message, obj.tag.Subject(), obj.tag.Body()
+		}
+		if name != "contents" {
+			// %(subject) is %(contents:subject)
+			modifier = name
+		}
+		switch modifier {
+		case "":
+			return message, nil
+		case "subject":
+			return subject, nil
+		case "body":
+			return body, nil
+		}
+	}
+
+	for _, role := range []string{"author", "committer", "tagger", "creator"} {
+		if !strings.HasPrefix(name, role) {
+			continue
+		}
+		sig, ok := signatureOf(obj, role)
+		if !ok {
+			return "", nil
+		}
+		switch strings.TrimPrefix(name, role) {
+		case "":
+			return sig.String(), nil
+		case "name":
+			return sig.Name, nil
+		case "email":
+			if modifier == "trim" {
+				return sig.Email, nil
+			}
+			return "<" + sig.Email + ">", nil
+		case "date":
+			return formatRefDate(sig.When, modifier)
+		}
+	}
+	return "", fmt.Errorf("unknown field name: %s", atom)
+}
+
+// Return the author, committer or tagger of the object. The creator is the
+// committer of a commit or the tagger of a tag.
+func signatureOf(obj *refObject, role string) (Signature, bool) {
+	switch {
+	case obj.commit != nil && (role == "author"):
+		return obj.commit.Author, true
+	case obj.commit != nil && (role == "committer" || role == "creator"):
+		return obj.commit.Committer, true
+	case obj.tag != nil && (role == "tagger" || role == "creator"):
+		return obj.tag.Tagger, true
+	}
+	return Signature{}, false
+}
+
+// Format the ref name for the :short, :lstrip=<n> and :rstrip=<n> modifiers.
+func formatRefName(name, modifier string) (string, error) {
+	switch {
+	case modifier == "":
+		return name, nil
+	case modifier == "short":
+		return ShortenRefName(name), nil
+	case strings.HasPrefix(modifier, "lstrip=") || strings.HasPrefix(modifier, "strip=") || strings.HasPrefix(modifier, "rstrip="):
+		eq := strings.IndexByte(modifier, '=')
+		n, err := strconv.Atoi(modifier[eq+1:])
+		if err != nil {
+			return "", fmt.Errorf("Integer value expected refname:%s", modifier)
+		}
+		components := strings.Split(name, "/")
+		// A negative count keeps that many components.
+		if n < 0 {
+			n = len(components) + n
+			if n < 0 {
+				n = 0
+			}
+		}
+		if n > len(components) {
+			n = len(components)
+		}
+		if strings.HasPrefix(modifier, "rstrip=") {
+			return strings.Join(components[:len(components)-n], "/"), nil
+		}
+		return strings.Join(components[n:], "/"), nil
+	}
+	return "", fmt.Errorf("unrecognized %%(refname) argument: %s", modifier)
+}
+
+// Format the date for the :short, :iso, :iso-strict, :unix and :raw modifiers.
+func formatRefDate(when time.Time, modifier string) (string, error) {
+	switch modifier {
+	case "", "default":
+		return when.Format(DateLayout), nil
+	case "short":
+		return when.Format("2006-01-02"), nil
+	case "iso":
+		return when.Format("2006-01-02 15:04:05 -0700"), nil
+	case "iso-strict":
+		return when.Format("2006-01-02T15:04:05-07:00"), nil
+	case "unix":
+		return strconv.FormatInt(when.Unix(), 10), nil
+	case "raw":
+		return fmt.Sprintf("%d %s", when.Unix(), when.Format("-0700")), nil
+	}
+	return "", fmt.Errorf("unknown date format %s", modifier)
+}
+
+// Sort the refs by the keys of --sort (the last key is the primary one, so it
+// is applied last). A key starting with "-" sorts in descending order. Dates
+// and sizes are compared as numbers.
+func (f *RefFormatter) Sort(refs []Ref, keys []string) error {
+	for _, key := range keys {
+		descending := false
+		if strings.HasPrefix(key, "-") {
+			key, descending = key[1:], true
+		}
+		numeric := false
+		if strings.HasSuffix(key, "date") {
+			key, numeric = key+":unix", true
+		} else if strings.HasSuffix(key, "objectsize") || strings.HasSuffix(key, "numparent") {
+			numeric = true
+		}
+		values := map[string]string{}
+		for _, ref := range refs {
+			value, err := f.atom(ref, key)
+			if err != nil {
+				return err
+			}
+			values[ref.Name] = value
+		}
+		less := func(a, b string) bool {
+			if numeric {
+				x, _ := strconv.ParseInt(a, 10, 64)
+				y, _ := strconv.ParseInt(b, 10, 64)
+				return x < y
+			}
+			return a < b
+		}
+		sort.SliceStable(refs, func(i, j int) bool {
+			a, b := values[refs[i].Name], values[refs[j].Name]
+			if descending {
+				return less(b, a)
+			}
+			return less(a, b)
+		})
+	}
+	return nil
+}
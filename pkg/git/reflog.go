@@ -0,0 +1,329 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const zeroSha = "0000000000000000000000000000000000000000"
+
+// The defaults of gc.reflogExpire and gc.reflogExpireUnreachable.
+const (
+	DefaultReflogExpire            = "90.days.ago"
+	DefaultReflogExpireUnreachable = "30.days.ago"
+)
+
+// ReflogEntry is a line of $repo/.git/logs/<ref>:
+// "<old sha> <new sha> <name> <<email>> <timestamp> <tz>\t<message>"
+type ReflogEntry struct {
+	OldSha    string
+	NewSha    string
+	Committer Signature
+	Message   string
+}
+
+func reflogPath(repo *Repository, ref string) string {
+	return path.Join(repo.GitDir, "logs", ref)
+}
+
+// Read the reflog of the ref, oldest first. Returns no entries if the ref has no reflog.
+func readReflog(repo *Repository, ref string) ([]ReflogEntry, error) {
+	f, err := repo.FS.Open(reflogPath(repo, ref))
+	if os.IsNotExist(err) {
+		return []ReflogEntry{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []ReflogEntry{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		entry, err := parseReflogEntry(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reflog of %s: %s", ref, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+func parseReflogEntry(line string) (ReflogEntry, error) {
+	message := ""
+	if tab := strings.Index(line, "\t"); tab >= 0 {
+		line, message = line[:tab], line[tab+1:]
+	}
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) != 3 || !isFullSha(fields[0]) || !isFullSha(fields[1]) {
+		return ReflogEntry{}, fmt.Errorf("invalid entry: %q", line)
+	}
+	committer, err := parseSignature(fields[2])
+	if err != nil {
+		return ReflogEntry{}, err
+	}
+	return ReflogEntry{
+		OldSha:    fields[0],
+		NewSha:    fields[1],
+		Committer: committer,
+		Message:   message,
+	}, nil
+}
+
+// Format the entry as a line of the reflog. Newlines in the message are
+// replaced because each entry is a single line.
+func (e ReflogEntry) String() string {
+	line := fmt.Sprintf("%s %s %s", e.OldSha, e.NewSha, e.Committer)
+	if message := strings.TrimSpace(strings.ReplaceAll(e.Message, "\n", " ")); message != "" {
+		line += "\t" + message
+	}
+	return line + "\n"
+}
+
+// ReadReflog returns the reflog of the ref, newest first like git reflog
+// shows it: entry N is <ref>@{N}.
+func ReadReflog(repo *Repository, ref string) ([]ReflogEntry, error) {
+	entries, err := readReflog(repo, ref)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// Report whether the ref has a reflog.
+func HasReflog(repo *Repository, ref string) bool {
+	info, err := repo.FS.Stat(reflogPath(repo, ref))
+	return err == nil && info.Mode().IsRegular()
+}
+
+// List the refs which have a reflog, e.g. HEAD and refs/heads/master.
+func ListReflogs(repo *Repository) ([]string, error) {
+	refs, err := listFilesRecursively(repo.FS, path.Join(repo.GitDir, "logs"), "")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(refs)
+	return refs, nil
+}
+
+// ReflogRef returns the ref whose reflog the name refers to, e.g.
+// refs/heads/master for master.
+func ReflogRef(repo *Repository, name string) (string, error) {
+	if name == "HEAD" || name == "@" {
+		return "HEAD", nil
+	}
+	ref, _, err := DwimRef(repo, name)
+	if err != nil {
+		return "", err
+	}
+	if ref == "" {
+		if HasReflog(repo, name) {
+			return name, nil
+		}
+		return "", fmt.Errorf("ambiguous argument '%s': unknown revision or path not in the working tree.", name)
+	}
+	return ref, nil
+}
+
+// ParseReflogSelector splits a selector <ref>@{N} into the ref whose reflog
+// it refers to and N. An empty <ref> is HEAD.
+func ParseReflogSelector(repo *Repository, selector string) (ref string, n int, _ error) {
+	at := strings.LastIndex(selector, "@{")
+	if at < 0 || !strings.HasSuffix(selector, "}") {
+		return "", 0, fmt.Errorf("not a reflog: %s", selector)
+	}
+	n, err := strconv.Atoi(selector[at+2 : len(selector)-1])
+	if err != nil || n < 0 {
+		return "", 0, fmt.Errorf("not a reflog: %s", selector)
+	}
+	name := selector[:at]
+	if name == "" {
+		name = "HEAD"
+	}
+	if ref, err = ReflogRef(repo, name); err != nil {
+		return "", 0, fmt.Errorf("%s points nowhere!", selector)
+	}
+	return ref, n, nil
+}
+
+// Decide whether updates of the ref are logged: core.logAllRefUpdates is
+// true by default except in bare repositories and then only logs HEAD and
+// branches, "always" logs every ref. A ref which already has a reflog is
+// always logged.
+func shouldLogRef(repo *Repository, config *Config, ref string) bool {
+	if HasReflog(repo, ref) {
+		return true
+	}
+	value, ok := config.Get("core.logallrefupdates")
+	if ok && strings.ToLower(value) == "always" {
+		return true
+	}
+	logAll := repo.WorkTree != ""
+	if ok {
+		if b, err := parseConfigBool(value); err == nil {
+			logAll = b
+		}
+	}
+	if !logAll {
+		return false
+	}
+	for _, prefix := range []string{"refs/heads/", "refs/remotes/", "refs/notes/"} {
+		if strings.HasPrefix(ref, prefix) {
+			return true
+		}
+	}
+	return ref == "HEAD"
+}
+
+// Append an entry for the update of the ref from oldSha to newSha (zeroSha
+// when the ref didn't exist) with the committer identity.
+func appendReflog(repo *Repository, ref, oldSha, newSha, message string) error {
+	committer, err := getIdent(repo, "COMMITTER")
+	if err != nil {
+		return err
+	}
+	entry := ReflogEntry{OldSha: oldSha, NewSha: newSha, Committer: committer, Message: message}
+	logPath := reflogPath(repo, ref)
+	if err := repo.FS.MkdirAll(path.Dir(logPath), 0755); err != nil {
+		return err
+	}
+	f, err := repo.FS.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write([]byte(entry.String())); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Remove the reflog of a deleted ref.
+func deleteReflog(repo *Repository, ref string) error {
+	if err := repo.FS.Remove(reflogPath(repo, ref)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for dir := path.Dir(ref); dir != "."; dir = path.Dir(dir) {
+		if err := repo.FS.Remove(path.Join(repo.GitDir, "logs", dir)); err != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// Replace the reflog with the entries (oldest first) through a lock file.
+func writeReflog(repo *Repository, ref string, entries []ReflogEntry) error {
+	var buf strings.Builder
+	for _, entry := range entries {
+		buf.WriteString(entry.String())
+	}
+	return writeFileLocked(repo.FS, reflogPath(repo, ref), []byte(buf.String()))
+}
+
+// Remove the reflog entries older than expire, and the entries older than
+// expireUnreachable whose commit is not reachable from the current value of
+// the ref. Returns the removed entries. With dryRun nothing is changed.
+// ref: https://git-scm.com/docs/git-reflog#_options_for_expire
+func ExpireReflog(repo *Repository, ref string, expire, expireUnreachable time.Time, dryRun bool) ([]ReflogEntry, error) {
+	entries, err := readReflog(repo, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	var reachable map[string]bool
+	isReachable := func(sha string) (bool, error) {
+		if reachable == nil {
+			reachable = map[string]bool{}
+			tip, err := readRef(repo, ref)
+			if ref == "HEAD" {
+				_, tip, err = ReadHead(repo)
+			}
+			if err != nil {
+				return false, err
+			}
+			if tip != "" {
+				if reachable, err = reachableCommits(repo, tip); err != nil {
+					return false, err
+				}
+			}
+		}
+		return reachable[sha], nil
+	}
+
+	kept, expired := []ReflogEntry{}, []ReflogEntry{}
+	for _, entry := range entries {
+		when := entry.Committer.When
+		remove := !expire.IsZero() && when.Before(expire)
+		if !remove && !expireUnreachable.IsZero() && when.Before(expireUnreachable) {
+			ok, err := isReachable(entry.NewSha)
+			if err != nil {
+				return nil, err
+			}
+			remove = !ok
+		}
+		if remove {
+			expired = append(expired, entry)
+		} else {
+			kept = append(kept, entry)
+		}
+	}
+	if dryRun || len(expired) == 0 {
+		return expired, nil
+	}
+	return expired, writeReflog(repo, ref, kept)
+}
+
+// Delete the reflog entries with the given indexes (0 is the newest, as in
+// <ref>@{0}) and return them. Indexes past the oldest entry are ignored. With
+// rewrite the old sha of the entry after a deleted one is set to the new sha
+// of the entry before it, so the log stays consistent. With updateRef the ref
+// is set to the new sha of the newest remaining entry. With dryRun nothing is
+// changed.
+func DeleteReflogEntries(repo *Repository, ref string, indexes []int, rewrite, updateRef, dryRun bool) ([]ReflogEntry, error) {
+	entries, err := readReflog(repo, ref)
+	if err != nil {
+		return nil, err
+	}
+	deleted := map[int]bool{}
+	for _, n := range indexes {
+		if n >= 0 && n < len(entries) {
+			deleted[len(entries)-1-n] = true
+		}
+	}
+	kept, removed := []ReflogEntry{}, []ReflogEntry{}
+	for i, entry := range entries {
+		if deleted[i] {
+			removed = append(removed, entry)
+			continue
+		}
+		if rewrite && len(kept) > 0 {
+			entry.OldSha = kept[len(kept)-1].NewSha
+		}
+		kept = append(kept, entry)
+	}
+	if dryRun || len(removed) == 0 {
+		return removed, nil
+	}
+	if err := writeReflog(repo, ref, kept); err != nil {
+		return nil, err
+	}
+	if !updateRef || len(kept) == 0 {
+		return removed, nil
+	}
+	t := NewRefTransaction(repo)
+	t.noLog = true
+	t.Update(ref, kept[len(kept)-1].NewSha, "", true)
+	return removed, t.Commit()
+}
@@ -0,0 +1,161 @@
+package git
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Return the messages of the reflog of the ref, newest first.
+func readTestReflog(t *testing.T, repo *Repository, ref string) []string {
+	t.Helper()
+	entries, err := ReadReflog(repo, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := []string{}
+	for _, entry := range entries {
+		messages = append(messages, entry.Message)
+	}
+	return messages
+}
+
+func TestReflog(t *testing.T) {
+	setTestEnv(t, "GIT_COMMITTER_NAME", "C O Mitter")
+	setTestEnv(t, "GIT_COMMITTER_EMAIL", "committer@example.com")
+	setTestEnv(t, "GIT_COMMITTER_DATE", "1700000000 +0000")
+	repo := newTestRepository(t)
+	first := writeTestCommit(t, repo, "first", map[string]string{"a": "1\n"})
+	second := writeTestCommit(t, repo, "second", map[string]string{"a": "2\n"}, first)
+	third := writeTestCommit(t, repo, "third", map[string]string{"a": "3\n"}, second)
+
+	for _, update := range []struct{ newSha, oldSha, message string }{
+		{first, zeroSha, "commit (initial): first"},
+		{second, first, "commit: second"},
+		{third, second, "commit: third"},
+	} {
+		if err := UpdateRef(repo, "HEAD", update.newSha, update.oldSha, update.message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := UpdateRef(repo, "refs/tags/v1", first, "", "tag"); err != nil {
+		t.Fatal(err)
+	}
+
+	// HEAD and the branch it points to are both logged, tags are not.
+	want := []string{"commit: third", "commit: second", "commit (initial): first"}
+	for _, ref := range []string{"HEAD", "refs/heads/main"} {
+		if got := readTestReflog(t, repo, ref); !reflect.DeepEqual(got, want) {
+			t.Errorf("reflog of %s = %q, want %q", ref, got, want)
+		}
+	}
+	if refs, err := ListReflogs(repo); err != nil || !reflect.DeepEqual(refs, []string{"HEAD", "refs/heads/main"}) {
+		t.Errorf("ListReflogs() = %q, %v", refs, err)
+	}
+	entries, err := ReadReflog(repo, "refs/heads/main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantEntry := ReflogEntry{
+		OldSha:    zeroSha,
+		NewSha:    first,
+		Committer: Signature{Name: "C O Mitter", Email: "committer@example.com", When: time.Unix(1700000000, 0).In(time.FixedZone("", 0))},
+		Message:   "commit (initial): first",
+	}
+	if got := entries[2]; got.String() != wantEntry.String() {
+		t.Errorf("oldest entry = %q, want %q", got, wantEntry)
+	}
+
+	for rev, want := range map[string]string{"main@{0}": third, "main@{2}": first, "HEAD@{1}": second, "@{1}": second} {
+		if sha, err := ResolveRevision(repo, rev); err != nil || sha != want {
+			t.Errorf("ResolveRevision(%q) = %s, %v, want %s", rev, sha, err, want)
+		}
+	}
+	if _, err := ResolveRevision(repo, "main@{3}"); err == nil {
+		t.Error("ResolveRevision(main@{3}) succeeded")
+	}
+
+	// Deleting main@{1} with rewrite keeps the log consistent, and
+	// deleting the newest entry with updateRef moves the branch back.
+	removed, err := DeleteReflogEntries(repo, "refs/heads/main", []int{1}, true, false, false)
+	if err != nil || len(removed) != 1 || removed[0].NewSha != second {
+		t.Fatalf("DeleteReflogEntries() = %v, %v", removed, err)
+	}
+	entries, _ = ReadReflog(repo, "refs/heads/main")
+	if entries[0].OldSha != first {
+		t.Errorf("old sha of the newest entry = %s, want %s", entries[0].OldSha, first)
+	}
+	if _, err := DeleteReflogEntries(repo, "refs/heads/main", []int{0}, true, true, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestRefs(t, repo, "refs/heads/main"); got[0] != first {
+		t.Errorf("main = %s, want %s", got[0], first)
+	}
+
+	// The entries of HEAD for the commits that are no longer reachable
+	// expire first.
+	now := time.Unix(1700000000, 0)
+	expired, err := ExpireReflog(repo, "HEAD", time.Time{}, now.Add(time.Second), true)
+	if err != nil || len(expired) != 2 {
+		t.Errorf("ExpireReflog(dry run) = %v, %v, want the entries of the 2 unreachable commits", expired, err)
+	}
+	if got := readTestReflog(t, repo, "HEAD"); len(got) != 3 {
+		t.Errorf("reflog of HEAD after a dry run = %q", got)
+	}
+	if _, err := ExpireReflog(repo, "HEAD", time.Time{}, now.Add(time.Second), false); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readTestReflog(t, repo, "HEAD"), []string{"commit (initial): first"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("reflog of HEAD = %q, want %q", got, want)
+	}
+	if _, err := ExpireReflog(repo, "HEAD", now.Add(time.Second), time.Time{}, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestReflog(t, repo, "HEAD"); len(got) != 0 {
+		t.Errorf("reflog of HEAD = %q, want nothing", got)
+	}
+
+	// Deleting the branch deletes its reflog.
+	if err := WriteSymbolicRef(repo, "HEAD", "refs/heads/other", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteRef(repo, "refs/heads/main", ""); err != nil {
+		t.Fatal(err)
+	}
+	if HasReflog(repo, "refs/heads/main") {
+		t.Error("the reflog of a deleted branch still exists")
+	}
+}
+
+func TestParseReflogSelector(t *testing.T) {
+	repo := newTestRepository(t)
+	first := writeTestCommit(t, repo, "first", map[string]string{"a": "1\n"})
+	if err := UpdateRef(repo, "HEAD", first, zeroSha, "commit (initial): first"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		selector, ref string
+		n             int
+	}{
+		{"main@{0}", "refs/heads/main", 0},
+		{"refs/heads/main@{2}", "refs/heads/main", 2},
+		{"HEAD@{1}", "HEAD", 1},
+		{"@{3}", "HEAD", 3},
+	} {
+		ref, n, err := ParseReflogSelector(repo, test.selector)
+		if err != nil || ref != test.ref || n != test.n {
+			t.Errorf("ParseReflogSelector(%q) = %s, %d, %v, want %s, %d", test.selector, ref, n, err, test.ref, test.n)
+		}
+	}
+	for selector, want := range map[string]string{
+		"main":        "not a reflog: main",
+		"main@{-1}":   "not a reflog: main@{-1}",
+		"main@{now}":  "not a reflog: main@{now}",
+		"missing@{0}": "missing@{0} points nowhere!",
+	} {
+		if _, _, err := ParseReflogSelector(repo, selector); err == nil || err.Error() != want {
+			t.Errorf("ParseReflogSelector(%q) error = %v, want %q", selector, err, want)
+		}
+	}
+}
@@ -0,0 +1,771 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type Ref struct {
+	Name   string // e.g. refs/heads/master
+	Sha    string
+	Target string // the ref a symbolic ref points to, "" for other refs
+}
+
+// An entry of packed-refs. Peeled is the object an annotated tag points to.
+type packedRef struct {
+	Name   string
+	Sha    string
+	Peeled string
+}
+
+const packedRefsHeader = "# pack-refs with: peeled fully-peeled sorted \n"
+
+// Read $repo/.git/HEAD and return the ref it points to ("" for detached HEAD)
+// and the commit sha ("" when the branch has no commits yet).
+func ReadHead(repo *Repository) (ref string, sha string, _ error) {
+	content, err := repo.FS.ReadFile(path.Join(repo.GitDir, "HEAD"))
+	if err != nil {
+		return "", "", err
+	}
+	head := strings.TrimSpace(string(content))
+	if !strings.HasPrefix(head, "ref: ") {
+		// detached HEAD
+		return "", head, nil
+	}
+	ref = strings.TrimPrefix(head, "ref: ")
+	sha, err = readRef(repo, ref)
+	if err != nil {
+		return "", "", err
+	}
+	return ref, sha, nil
+}
+
+// Read the sha of the ref (e.g. refs/heads/master) from the loose ref file or
+// packed-refs. Returns "" if the ref doesn't exist.
+func readRef(repo *Repository, ref string) (string, error) {
+	refPath := path.Join(repo.GitDir, ref)
+	content, err := repo.FS.ReadFile(refPath)
+	if info, statErr := repo.FS.Stat(refPath); statErr == nil && info.IsDir() {
+		// e.g. refs/remotes/origin is a directory of refs, not a ref.
+		err = os.ErrNotExist
+	}
+	if err == nil {
+		sha := strings.TrimSpace(string(content))
+		if strings.HasPrefix(sha, "ref: ") {
+			return readRef(repo, strings.TrimPrefix(sha, "ref: "))
+		}
+		return sha, nil
+	} else if !os.IsNotExist(err) && err != os.ErrNotExist {
+		return "", err
+	}
+
+	packed, err := readPackedRefs(repo)
+	if err != nil {
+		return "", err
+	}
+	for _, packedRef := range packed {
+		if packedRef.Name == ref {
+			return packedRef.Sha, nil
+		}
+	}
+	return "", nil
+}
+
+// Read the target of the symbolic ref (e.g. "refs/heads/master" for HEAD).
+// Returns "" if name is not a symbolic ref or doesn't exist.
+func ReadSymbolicRef(repo *Repository, name string) (string, error) {
+	content, err := repo.FS.ReadFile(path.Join(repo.GitDir, name))
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		if info, statErr := repo.FS.Stat(path.Join(repo.GitDir, name)); statErr == nil && info.IsDir() {
+			return "", nil
+		}
+		return "", err
+	}
+	line := strings.TrimSpace(string(content))
+	if !strings.HasPrefix(line, "ref: ") {
+		return "", nil
+	}
+	return strings.TrimPrefix(line, "ref: "), nil
+}
+
+// Point the symbolic ref name at the ref target. If message is not "" and the
+// value of name changes, e.g. HEAD moves to another branch, the change is
+// recorded in the reflog of name.
+func WriteSymbolicRef(repo *Repository, name, target, message string) error {
+	if !isValidRefName(name) {
+		return fmt.Errorf("invalid ref name '%s'", name)
+	}
+	if !strings.HasPrefix(target, "refs/") || !isValidRefName(target) {
+		return fmt.Errorf("refusing to point %s at invalid ref '%s'", name, target)
+	}
+	refPath := path.Join(repo.GitDir, name)
+	if err := repo.FS.MkdirAll(path.Dir(refPath), 0755); err != nil {
+		return err
+	}
+	oldSha, err := readRef(repo, name)
+	if err != nil {
+		return err
+	}
+	if err := writeFileLocked(repo.FS, refPath, []byte("ref: "+target+"\n")); err != nil {
+		return err
+	}
+	newSha, err := readRef(repo, target)
+	if err != nil || message == "" || newSha == "" {
+		return err
+	}
+	config, err := ReadConfigFiles(repo, true)
+	if err != nil || !shouldLogRef(repo, config, name) {
+		return err
+	}
+	if oldSha == "" {
+		oldSha = zeroSha
+	}
+	return appendReflog(repo, name, oldSha, newSha, message)
+}
+
+// Delete the symbolic ref, but not the ref it points to.
+func DeleteSymbolicRef(repo *Repository, name string) error {
+	target, err := ReadSymbolicRef(repo, name)
+	if err != nil {
+		return err
+	}
+	if target == "" {
+		return fmt.Errorf("ref %s is not a symbolic ref", name)
+	}
+	return repo.FS.Remove(path.Join(repo.GitDir, name))
+}
+
+// The number of symbolic refs followed before giving up, like git.
+const maxSymrefDepth = 5
+
+// Follow the symbolic refs from name to the ref which holds the sha.
+func resolveRefName(repo *Repository, name string) (string, error) {
+	for i := 0; i < maxSymrefDepth; i++ {
+		target, err := ReadSymbolicRef(repo, name)
+		if err != nil {
+			return "", err
+		}
+		if target == "" {
+			return name, nil
+		}
+		name = target
+	}
+	return "", fmt.Errorf("too many levels of symbolic refs at %s", name)
+}
+
+// Update the ref (e.g. refs/heads/master or HEAD) to newSha through a lock file.
+// If oldSha is not "", the update fails unless the ref currently points to oldSha
+// (zeroSha means that the ref must not exist yet).
+// Updating a symbolic ref such as HEAD updates the ref it points to.
+// The update is recorded in the reflog with the message.
+func UpdateRef(repo *Repository, ref, newSha, oldSha, message string) error {
+	t := NewRefTransaction(repo)
+	t.Message = message
+	t.Update(ref, newSha, oldSha, true)
+	return t.Commit()
+}
+
+// Delete the ref from the loose refs and packed-refs. If oldSha is not "",
+// the ref must currently point to it.
+func DeleteRef(repo *Repository, ref, oldSha string) error {
+	t := NewRefTransaction(repo)
+	t.Delete(ref, oldSha, true)
+	return t.Commit()
+}
+
+type refUpdate struct {
+	ref    string
+	newSha string // zeroSha deletes the ref, "" only verifies oldSha
+	oldSha string // "" isn't checked, zeroSha means the ref must not exist
+	deref  bool   // update the ref which a symbolic ref points to
+	lock   File
+	// the value before the update for the reflog, zeroSha if it didn't exist
+	currentSha string
+}
+
+// RefTransaction updates several refs at once: either all of them change or
+// none. Every ref is locked and its old value checked before anything is
+// written, like git update-ref --stdin. The updates are recorded in the
+// reflogs with Message.
+type RefTransaction struct {
+	Message string
+	repo    *Repository
+	updates []*refUpdate
+	noLog   bool // e.g. reflog delete --updateref doesn't log
+}
+
+func NewRefTransaction(repo *Repository) *RefTransaction {
+	return &RefTransaction{repo: repo}
+}
+
+// Set the ref to newSha. See UpdateRef for oldSha.
+func (t *RefTransaction) Update(ref, newSha, oldSha string, deref bool) {
+	t.updates = append(t.updates, &refUpdate{ref: ref, newSha: newSha, oldSha: oldSha, deref: deref})
+}
+
+// Create the ref, which must not exist yet.
+func (t *RefTransaction) Create(ref, newSha string, deref bool) {
+	t.Update(ref, newSha, zeroSha, deref)
+}
+
+// Delete the ref. See DeleteRef for oldSha.
+func (t *RefTransaction) Delete(ref, oldSha string, deref bool) {
+	t.Update(ref, zeroSha, oldSha, deref)
+}
+
+// Check that the ref points to oldSha (zeroSha: doesn't exist) without changing it.
+func (t *RefTransaction) Verify(ref, oldSha string, deref bool) {
+	t.Update(ref, "", oldSha, deref)
+}
+
+// Lock all the refs, check their old values and apply the updates.
+func (t *RefTransaction) Commit() error {
+	repo := t.repo
+	defer t.unlock()
+
+	seen := map[string]bool{}
+	for _, u := range t.updates {
+		if u.ref != "HEAD" && !isValidRefName(u.ref) {
+			return fmt.Errorf("refusing to update ref with bad name '%s'", u.ref)
+		}
+		if u.deref {
+			resolved, err := resolveRefName(repo, u.ref)
+			if err != nil {
+				return err
+			}
+			u.ref = resolved
+		}
+		if seen[u.ref] {
+			return fmt.Errorf("multiple updates for ref '%s' not allowed", u.ref)
+		}
+		seen[u.ref] = true
+		if err := t.checkNewValue(u); err != nil {
+			return err
+		}
+
+		refPath := path.Join(repo.GitDir, u.ref)
+		if err := repo.FS.MkdirAll(path.Dir(refPath), 0755); err != nil {
+			return fmt.Errorf("cannot lock ref '%s': %s", u.ref, err)
+		}
+		lock, err := repo.FS.OpenFile(refPath+".lock", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("cannot lock ref '%s': %s", u.ref, err)
+		}
+		u.lock = lock
+	}
+
+	// Check the old values while holding the locks.
+	deleted := map[string]bool{}
+	for _, u := range t.updates {
+		currentSha, err := readRef(repo, u.ref)
+		if err != nil {
+			return err
+		}
+		u.currentSha = currentSha
+		if currentSha == "" {
+			u.currentSha = zeroSha
+		}
+		if u.oldSha != "" {
+			switch {
+			case u.oldSha == zeroSha && currentSha != "":
+				return fmt.Errorf("cannot lock ref '%s': reference already exists", u.ref)
+			case u.oldSha != zeroSha && currentSha == "":
+				return fmt.Errorf("cannot lock ref '%s': unable to resolve reference '%s'", u.ref, u.ref)
+			case u.oldSha != zeroSha && currentSha != u.oldSha:
+				return fmt.Errorf("cannot lock ref '%s': is at %s but expected %s", u.ref, currentSha, u.oldSha)
+			}
+		}
+		if u.newSha == zeroSha {
+			deleted[u.ref] = true
+		}
+	}
+
+	packed, err := readPackedRefs(repo)
+	if err != nil {
+		return err
+	}
+	inPackedRefs := false
+	for _, ref := range packed {
+		inPackedRefs = inPackedRefs || deleted[ref.Name]
+	}
+	if inPackedRefs {
+		err := rewritePackedRefs(repo, func(refs []packedRef) ([]packedRef, error) {
+			kept := []packedRef{}
+			for _, ref := range refs {
+				if !deleted[ref.Name] {
+					kept = append(kept, ref)
+				}
+			}
+			return kept, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	config, err := ReadConfigFiles(repo, true)
+	if err != nil {
+		return err
+	}
+	// Updating the branch HEAD points to also moves HEAD, so it is logged
+	// for both.
+	headRef, err := resolveRefName(repo, "HEAD")
+	if err != nil {
+		return err
+	}
+
+	for _, u := range t.updates {
+		refPath := path.Join(repo.GitDir, u.ref)
+		lock := u.lock
+		u.lock = nil
+		switch u.newSha {
+		case "":
+			lock.Close()
+			repo.FS.Remove(refPath + ".lock")
+		case zeroSha:
+			lock.Close()
+			if err := repo.FS.Remove(refPath); err != nil && !os.IsNotExist(err) {
+				repo.FS.Remove(refPath + ".lock")
+				return err
+			}
+			repo.FS.Remove(refPath + ".lock")
+			removeEmptyRefDirs(repo, u.ref)
+			if err := deleteReflog(repo, u.ref); err != nil {
+				return err
+			}
+		default:
+			if _, err := lock.Write([]byte(u.newSha + "\n")); err != nil {
+				lock.Close()
+				repo.FS.Remove(refPath + ".lock")
+				return err
+			}
+			if err := lock.Close(); err != nil {
+				repo.FS.Remove(refPath + ".lock")
+				return err
+			}
+			if err := repo.FS.Rename(refPath+".lock", refPath); err != nil {
+				return err
+			}
+			if err := t.log(config, u, u.ref); err != nil {
+				return err
+			}
+			if u.ref != "HEAD" && u.ref == headRef {
+				if err := t.log(config, u, "HEAD"); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Record the update in the reflog of ref if it is logged.
+func (t *RefTransaction) log(config *Config, u *refUpdate, ref string) error {
+	if t.noLog || !shouldLogRef(t.repo, config, ref) {
+		return nil
+	}
+	return appendReflog(t.repo, ref, u.currentSha, u.newSha, t.Message)
+}
+
+// Refuse to point a ref at a missing object or a branch at a non-commit.
+func (t *RefTransaction) checkNewValue(u *refUpdate) error {
+	if u.newSha == "" || u.newSha == zeroSha {
+		return nil
+	}
+	if !isFullSha(u.newSha) {
+		return fmt.Errorf("invalid sha for ref '%s': %s", u.ref, u.newSha)
+	}
+	objReader, err := t.repo.Objects.Get(u.newSha)
+	if err != nil {
+		return fmt.Errorf("trying to write ref '%s' with nonexistent object %s", u.ref, u.newSha)
+	}
+	objReader.Close()
+	if objReader.Type != "commit" && (u.ref == "HEAD" || strings.HasPrefix(u.ref, "refs/heads/")) {
+		return fmt.Errorf("trying to write non-commit object %s to branch '%s'", u.newSha, u.ref)
+	}
+	return nil
+}
+
+// Release the locks which are still held after a failure.
+func (t *RefTransaction) unlock() {
+	for _, u := range t.updates {
+		if u.lock != nil {
+			u.lock.Close()
+			t.repo.FS.Remove(path.Join(t.repo.GitDir, u.ref) + ".lock")
+			u.lock = nil
+		}
+	}
+}
+
+// Remove the directories of a deleted ref which became empty, but keep e.g.
+// refs/heads.
+func removeEmptyRefDirs(repo *Repository, ref string) {
+	for dir := path.Dir(ref); strings.Count(dir, "/") >= 2; dir = path.Dir(dir) {
+		if err := repo.FS.Remove(path.Join(repo.GitDir, dir)); err != nil {
+			break
+		}
+	}
+}
+
+// Resolve a value of update-ref. An empty value and the zero sha mean that
+// the ref doesn't exist.
+func ResolveRefValue(repo *Repository, value string) (string, error) {
+	if value == "" || strings.Trim(value, "0") == "" && len(value) == 40 {
+		return zeroSha, nil
+	}
+	return ResolveRevision(repo, value)
+}
+
+// Run the commands of update-ref --stdin. The updates between start and
+// commit, or all of them without start, are applied atomically. The
+// replies to start, commit etc. are written to out.
+// ref: https://git-scm.com/docs/git-update-ref#_description
+func RunRefUpdates(repo *Repository, input string, nulTerminated, deref bool, message string, out io.Writer) error {
+	// Each command is split into its fields: the command and the ref, then
+	// the values. With -z, the values are separate NUL terminated fields.
+	var commands [][]string
+	if nulTerminated {
+		fields := strings.Split(strings.TrimSuffix(input, "\x00"), "\x00")
+		valueCounts := map[string]int{"update": 2, "create": 1, "delete": 1, "verify": 1}
+		for i := 0; i < len(fields) && input != ""; i++ {
+			command := strings.SplitN(fields[i], " ", 2)
+			n := valueCounts[command[0]]
+			if i+n >= len(fields) {
+				return fmt.Errorf("%s: missing values", fields[i])
+			}
+			commands = append(commands, append(command, fields[i+1:i+1+n]...))
+			i += n
+		}
+	} else {
+		for _, line := range strings.Split(input, "\n") {
+			if line != "" {
+				commands = append(commands, strings.Split(line, " "))
+			}
+		}
+	}
+
+	newTransaction := func() *RefTransaction {
+		t := NewRefTransaction(repo)
+		t.Message = message
+		return t
+	}
+	t := newTransaction()
+	noDeref := false
+	for _, command := range commands {
+		value := func(i int) (string, error) {
+			if i >= len(command) || command[i] == "" {
+				return "", nil
+			}
+			sha, err := ResolveRefValue(repo, command[i])
+			if err != nil {
+				return "", fmt.Errorf("%s %s: invalid value '%s'", command[0], command[1], command[i])
+			}
+			return sha, nil
+		}
+		needRef := map[string]bool{"update": true, "create": true, "delete": true, "verify": true, "option": true}
+		if needRef[command[0]] && len(command) < 2 {
+			return fmt.Errorf("%s: missing <ref>", command[0])
+		}
+		refDeref := deref && !noDeref
+		noDeref = false
+
+		switch command[0] {
+		case "update", "create":
+			newSha, err := value(2)
+			if err != nil {
+				return err
+			}
+			if newSha == "" {
+				return fmt.Errorf("%s %s: missing <new-oid>", command[0], command[1])
+			}
+			if command[0] == "create" {
+				t.Create(command[1], newSha, refDeref)
+				continue
+			}
+			oldSha, err := value(3)
+			if err != nil {
+				return err
+			}
+			t.Update(command[1], newSha, oldSha, refDeref)
+		case "delete":
+			oldSha, err := value(2)
+			if err != nil {
+				return err
+			}
+			t.Delete(command[1], oldSha, refDeref)
+		case "verify":
+			oldSha, err := value(2)
+			if err != nil {
+				return err
+			}
+			if oldSha == "" {
+				// a missing value means that the ref must not exist
+				oldSha = zeroSha
+			}
+			t.Verify(command[1], oldSha, refDeref)
+		case "option":
+			if command[1] != "no-deref" {
+				return fmt.Errorf("option unknown: %s", command[1])
+			}
+			noDeref = true
+		case "start", "prepare":
+			fmt.Fprintf(out, "%s: ok\n", command[0])
+		case "commit":
+			if err := t.Commit(); err != nil {
+				return err
+			}
+			t = newTransaction()
+			fmt.Fprintln(out, "commit: ok")
+		case "abort":
+			t = newTransaction()
+			fmt.Fprintln(out, "abort: ok")
+		default:
+			return fmt.Errorf("unknown command: %s", strings.Join(command, " "))
+		}
+	}
+	return t.Commit()
+}
+
+// Read $repo/.git/packed-refs. Returns no entries if the file doesn't exist.
+// ref: https://git-scm.com/docs/git-pack-refs
+func readPackedRefs(repo *Repository) ([]packedRef, error) {
+	content, err := repo.FS.ReadFile(path.Join(repo.GitDir, "packed-refs"))
+	if os.IsNotExist(err) {
+		return []packedRef{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	refs := []packedRef{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "^"):
+			// the peeled value of the previous ref
+			if len(refs) == 0 || !isFullSha(line[1:]) {
+				return nil, fmt.Errorf("invalid packed-refs line: %q", line)
+			}
+			refs[len(refs)-1].Peeled = line[1:]
+		default:
+			fields := strings.SplitN(line, " ", 2)
+			if len(fields) != 2 || !isFullSha(fields[0]) {
+				return nil, fmt.Errorf("invalid packed-refs line: %q", line)
+			}
+			refs = append(refs, packedRef{Name: fields[1], Sha: fields[0]})
+		}
+	}
+	return refs, scanner.Err()
+}
+
+// List the loose refs under $repo/.git/refs. Symbolic refs have the sha of
+// the ref they point to and are skipped if it doesn't exist.
+func listLooseRefs(repo *Repository) ([]Ref, error) {
+	gitDir := repo.GitDir
+	refs := []Ref{}
+	err := walkFS(repo.FS, path.Join(gitDir, "refs"), func(p string, d fs.DirEntry) error {
+		if d.IsDir() || strings.HasSuffix(p, ".lock") {
+			return nil
+		}
+		content, err := repo.FS.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(gitDir, p)
+		if err != nil {
+			return err
+		}
+		ref := Ref{Name: filepath.ToSlash(name), Sha: strings.TrimSpace(string(content))}
+		if strings.HasPrefix(ref.Sha, "ref: ") {
+			ref.Target = strings.TrimPrefix(ref.Sha, "ref: ")
+			if ref.Sha, err = readRef(repo, ref.Target); err != nil {
+				return err
+			}
+		}
+		if !isFullSha(ref.Sha) {
+			return nil
+		}
+		refs = append(refs, ref)
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return refs, nil
+	}
+	return refs, err
+}
+
+// List the refs in the loose ref files and packed-refs, sorted by name.
+// Loose refs take precedence over packed ones.
+func ListRefs(repo *Repository) ([]Ref, error) {
+	loose, err := listLooseRefs(repo)
+	if err != nil {
+		return nil, err
+	}
+	packed, err := readPackedRefs(repo)
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string]Ref{}
+	for _, ref := range packed {
+		byName[ref.Name] = Ref{Name: ref.Name, Sha: ref.Sha}
+	}
+	for _, ref := range loose {
+		byName[ref.Name] = ref
+	}
+	refs := []Ref{}
+	for _, ref := range byName {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].Name < refs[j].Name
+	})
+	return refs, nil
+}
+
+// Move loose refs into packed-refs. Tags and refs which are already packed
+// are always packed; other refs only with all. Symbolic refs stay loose. The
+// loose files are removed when prune is set.
+func PackRefs(repo *Repository, all, prune bool) error {
+	pruned := []Ref{}
+	err := rewritePackedRefs(repo, func(packed []packedRef) ([]packedRef, error) {
+		loose, err := listLooseRefs(repo)
+		if err != nil {
+			return nil, err
+		}
+		byName := map[string]int{}
+		for i, ref := range packed {
+			byName[ref.Name] = i
+		}
+		for _, ref := range loose {
+			i, isPacked := byName[ref.Name]
+			if ref.Target != "" || !all && !isPacked && !strings.HasPrefix(ref.Name, "refs/tags/") {
+				continue
+			}
+			peeled, err := PeelObject(repo, ref.Sha, "")
+			if err != nil {
+				return nil, err
+			}
+			entry := packedRef{Name: ref.Name, Sha: ref.Sha}
+			if peeled != ref.Sha {
+				entry.Peeled = peeled
+			}
+			if isPacked {
+				packed[i] = entry
+			} else {
+				packed = append(packed, entry)
+			}
+			pruned = append(pruned, ref)
+		}
+		return packed, nil
+	})
+	if err != nil || !prune {
+		return err
+	}
+
+	for _, ref := range pruned {
+		// Leave the loose ref if it was updated in the meantime.
+		refPath := path.Join(repo.GitDir, ref.Name)
+		if content, err := repo.FS.ReadFile(refPath); err != nil || strings.TrimSpace(string(content)) != ref.Sha {
+			continue
+		}
+		if err := repo.FS.Remove(refPath); err != nil {
+			return err
+		}
+		removeEmptyRefDirs(repo, ref.Name)
+	}
+	return nil
+}
+
+// Rewrite packed-refs with the refs returned by update while holding its lock.
+func rewritePackedRefs(repo *Repository, update func([]packedRef) ([]packedRef, error)) error {
+	lockPath := path.Join(repo.GitDir, "packed-refs.lock")
+	lockFile, err := repo.FS.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to lock packed-refs: %s", err)
+	}
+	defer repo.FS.Remove(lockPath) // no-op after the rename succeeds
+
+	packed, err := readPackedRefs(repo)
+	if err != nil {
+		lockFile.Close()
+		return err
+	}
+	if packed, err = update(packed); err != nil {
+		lockFile.Close()
+		return err
+	}
+	sort.Slice(packed, func(i, j int) bool {
+		return packed[i].Name < packed[j].Name
+	})
+
+	writer := bufio.NewWriter(lockFile)
+	writer.WriteString(packedRefsHeader)
+	for _, ref := range packed {
+		fmt.Fprintf(writer, "%s %s\n", ref.Sha, ref.Name)
+		if ref.Peeled != "" {
+			fmt.Fprintf(writer, "^%s\n", ref.Peeled)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		lockFile.Close()
+		return err
+	}
+	if err := lockFile.Close(); err != nil {
+		return err
+	}
+	return repo.FS.Rename(lockPath, path.Join(repo.GitDir, "packed-refs"))
+}
+
+// Report whether the ref name matches the pattern of for-each-ref: either
+// literally up to a slash (refs/heads matches refs/heads/master) or as a glob.
+func MatchRefPattern(pattern, name string) bool {
+	prefix := strings.TrimSuffix(pattern, "/")
+	if name == prefix || strings.HasPrefix(name, prefix+"/") {
+		return true
+	}
+	return wildmatch(pattern, name, wmPathname)
+}
+
+// Report whether name is a valid ref name like git check-ref-format: no
+// component starts with "." or ends with ".lock", and there is no "..", "@{",
+// "//", control character, space or any of ~^:?*[\.
+func isValidRefName(name string) bool {
+	if name == "" || name == "@" || strings.HasSuffix(name, "/") || strings.HasSuffix(name, ".") ||
+		strings.Contains(name, "..") || strings.Contains(name, "@{") {
+		return false
+	}
+	for _, component := range strings.Split(name, "/") {
+		if component == "" || strings.HasPrefix(component, ".") || strings.HasSuffix(component, ".lock") {
+			return false
+		}
+	}
+	for _, c := range name {
+		if c < 0x20 || c == 0x7f || strings.ContainsRune(" ~^:?*[\\", c) {
+			return false
+		}
+	}
+	return true
+}
+
+func isFullSha(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,262 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Return the sha of each ref, "" if it doesn't exist.
+func readTestRefs(t *testing.T, repo *Repository, refs ...string) []string {
+	t.Helper()
+	shas := []string{}
+	for _, ref := range refs {
+		sha, err := readRef(repo, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shas = append(shas, sha)
+	}
+	return shas
+}
+
+func TestRefTransaction(t *testing.T) {
+	repo := newTestRepository(t)
+	first := writeTestCommit(t, repo, "first", map[string]string{"a": "1\n"})
+	second := writeTestCommit(t, repo, "second", map[string]string{"a": "2\n"}, first)
+
+	tx := NewRefTransaction(repo)
+	tx.Create("refs/heads/main", first, true)
+	tx.Create("refs/heads/topic", first, true)
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// One failing update cancels the others.
+	tx = NewRefTransaction(repo)
+	tx.Update("refs/heads/main", second, first, true)
+	tx.Create("refs/heads/topic", second, true)
+	if err := tx.Commit(); err == nil {
+		t.Error("creating an existing ref succeeded")
+	}
+	if got, want := readTestRefs(t, repo, "refs/heads/main", "refs/heads/topic"), []string{first, first}; !reflect.DeepEqual(got, want) {
+		t.Errorf("refs after the failed transaction = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		name string
+		run  func(tx *RefTransaction)
+	}{
+		{"wrong old value", func(tx *RefTransaction) { tx.Update("refs/heads/main", second, second, true) }},
+		{"missing ref", func(tx *RefTransaction) { tx.Delete("refs/heads/none", first, true) }},
+		{"verify a missing ref", func(tx *RefTransaction) { tx.Verify("refs/heads/main", zeroSha, true) }},
+		{"missing object", func(tx *RefTransaction) { tx.Update("refs/heads/main", testBlobSha("nothing\n"), "", true) }},
+		{"branch to a tree", func(tx *RefTransaction) {
+			tree, _ := ReadCommitTree(repo, first)
+			tx.Update("refs/heads/main", tree, "", true)
+		}},
+		{"invalid name", func(tx *RefTransaction) { tx.Update("refs/heads/a..b", first, "", true) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := NewRefTransaction(repo)
+			tt.run(tx)
+			if err := tx.Commit(); err == nil {
+				t.Error("Commit() succeeded, want an error")
+			}
+			if got := readTestRefs(t, repo, "refs/heads/main"); got[0] != first {
+				t.Errorf("main = %s, want %s", got[0], first)
+			}
+		})
+	}
+
+	if err := DeleteRef(repo, "refs/heads/topic", first); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateRef(repo, "refs/heads/main", second, first, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readTestRefs(t, repo, "refs/heads/main", "refs/heads/topic"), []string{second, ""}; !reflect.DeepEqual(got, want) {
+		t.Errorf("refs = %v, want %v", got, want)
+	}
+}
+
+func TestSymbolicRefs(t *testing.T) {
+	repo := newTestRepository(t)
+	commit := writeTestCommit(t, repo, "first", map[string]string{"a": "1\n"})
+	if target, err := ReadSymbolicRef(repo, "HEAD"); err != nil || target != "refs/heads/main" {
+		t.Errorf("ReadSymbolicRef(HEAD) = %q, %v", target, err)
+	}
+	if err := WriteSymbolicRef(repo, "HEAD", "refs/heads/topic", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteSymbolicRef(repo, "HEAD", "topic", ""); err == nil {
+		t.Error("WriteSymbolicRef() accepted a target outside refs/")
+	}
+
+	// Updating HEAD updates the branch it points to.
+	if err := UpdateRef(repo, "HEAD", commit, zeroSha, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestRefs(t, repo, "refs/heads/topic", "refs/heads/main"); got[0] != commit || got[1] != "" {
+		t.Errorf("topic, main = %v, want %s and nothing", got, commit)
+	}
+	ref, sha, err := ReadHead(repo)
+	if err != nil || ref != "refs/heads/topic" || sha != commit {
+		t.Errorf("ReadHead() = %s, %s, %v", ref, sha, err)
+	}
+
+	if err := WriteSymbolicRef(repo, "refs/heads/alias", "refs/heads/topic", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteSymbolicRef(repo, "refs/heads/alias"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestRefs(t, repo, "refs/heads/alias", "refs/heads/topic"); got[0] != "" || got[1] != commit {
+		t.Errorf("alias, topic = %v, want nothing and %s", got, commit)
+	}
+	if err := DeleteSymbolicRef(repo, "refs/heads/topic"); err == nil {
+		t.Error("DeleteSymbolicRef() deleted a regular ref")
+	}
+}
+
+func TestRunRefUpdates(t *testing.T) {
+	repo := newTestRepository(t)
+	first := writeTestCommit(t, repo, "first", map[string]string{"a": "1\n"})
+	second := writeTestCommit(t, repo, "second", map[string]string{"a": "2\n"}, first)
+
+	var out bytes.Buffer
+	input := fmt.Sprintf("start\ncreate refs/heads/a %s\nupdate refs/heads/b %s\ncommit\nupdate refs/heads/a %s %s\n", first, second, second, first)
+	if err := RunRefUpdates(repo, input, false, true, "", &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "start: ok\ncommit: ok\n" {
+		t.Errorf("output = %q", out.String())
+	}
+	if got, want := readTestRefs(t, repo, "refs/heads/a", "refs/heads/b"), []string{second, second}; !reflect.DeepEqual(got, want) {
+		t.Errorf("refs = %v, want %v", got, want)
+	}
+
+	// With -z, the values are separate fields and empty values are allowed.
+	input = strings.Join([]string{"delete refs/heads/a", second, "update refs/heads/b", "HEAD~0", "", ""}, "\x00")
+	if err := RunRefUpdates(repo, input, true, true, "", &out); err == nil {
+		t.Error("RunRefUpdates() resolved HEAD of an unborn branch")
+	}
+	input = strings.Join([]string{"delete refs/heads/a", second, "update refs/heads/b", first, "", ""}, "\x00")
+	if err := RunRefUpdates(repo, input, true, true, "", &out); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readTestRefs(t, repo, "refs/heads/a", "refs/heads/b"), []string{"", first}; !reflect.DeepEqual(got, want) {
+		t.Errorf("refs = %v, want %v", got, want)
+	}
+
+	for _, input := range []string{"update refs/heads/b\n", "frobnicate refs/heads/b\n", "option deref\n", "verify refs/heads/b " + second + "\n"} {
+		if err := RunRefUpdates(repo, input, false, true, "", &out); err == nil {
+			t.Errorf("RunRefUpdates(%q) succeeded", input)
+		}
+	}
+}
+
+func TestRefNames(t *testing.T) {
+	for name, want := range map[string]bool{
+		"refs/heads/main":       true,
+		"refs/heads/feature/x":  true,
+		"HEAD":                  true,
+		"":                      false,
+		"@":                     false,
+		"refs/heads/a..b":       false,
+		"refs/heads/.hidden":    false,
+		"refs/heads/x.lock":     false,
+		"refs/heads/a@{1}":      false,
+		"refs/heads/with space": false,
+		"refs/heads/":           false,
+		"refs//heads":           false,
+		"refs/heads/a~1":        false,
+	} {
+		if got := isValidRefName(name); got != want {
+			t.Errorf("isValidRefName(%q) = %v, want %v", name, got, want)
+		}
+	}
+
+	for _, tt := range []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"refs/heads", "refs/heads/main", true},
+		{"refs/heads/", "refs/heads/main", true},
+		{"refs/heads", "refs/headsx/main", false},
+		{"refs/tags/v*", "refs/tags/v1", true},
+		{"refs/tags/v*", "refs/tags/v1/rc", false},
+	} {
+		if got := MatchRefPattern(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("MatchRefPattern(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRefFormatter(t *testing.T) {
+	repo := newTestRepository(t)
+	first := writeTestCommit(t, repo, "first\n\nthe body", map[string]string{"a": "1\n"})
+	second := writeTestCommit(t, repo, "second", map[string]string{"a": "2\n"}, first)
+	tag, err := repo.Objects.Put("tag", []byte(fmt.Sprintf("object %s\ntype commit\ntag v1\ntagger T Agger <tagger@example.com> 1600000000 +0200\n\nrelease\n", first)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ref, sha := range map[string]string{"refs/heads/main": second, "refs/heads/old": first, "refs/tags/v1": tag} {
+		if err := UpdateRef(repo, ref, sha, "", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	main := Ref{Name: "refs/heads/main", Sha: second}
+	old := Ref{Name: "refs/heads/old", Sha: first}
+	v1 := Ref{Name: "refs/tags/v1", Sha: tag}
+
+	f := NewRefFormatter(repo)
+	tests := []struct {
+		ref    Ref
+		format string
+		want   string
+	}{
+		{main, DefaultRefFormat, second + " commit\trefs/heads/main"},
+		{main, "%(HEAD) %(refname:short) %(refname:lstrip=-1) %(refname:rstrip=1)", "* main main refs/heads"},
+		{old, "%(HEAD)%(numparent) %(parent)", " 0 "},
+		{main, "%(parent) %(subject)", first + " second"},
+		{old, "%(contents:subject)|%(body)", "first|the body\n"},
+		{main, "%(authorname) %(authoremail) %(authoremail:trim)", "A U Thor <author@example.com> author@example.com"},
+		{old, "%(committerdate:unix) %(creatordate:short)", fmt.Sprintf("%d %s", testCommitTime.Add(-time.Minute).Unix(), testCommitTime.Format("2006-01-02"))},
+		{v1, "%(objecttype) %(*objecttype) %(*objectname) %(tag) %(type)", "tag commit " + first + " v1 commit"},
+		{v1, "%(taggername) %(taggerdate:raw) %(creatordate:iso)", "T Agger 1600000000 +0200 2020-09-13 14:26:40 +0200"},
+		{v1, "%(subject) %(authorname)", "release "},
+		{main, "100%% %41%42", "100% AB"},
+	}
+	for _, tt := range tests {
+		got, err := f.Format(tt.ref, tt.format)
+		if err != nil {
+			t.Errorf("Format(%s, %q) error: %v", tt.ref.Name, tt.format, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Format(%s, %q) = %q, want %q", tt.ref.Name, tt.format, got, tt.want)
+		}
+	}
+	for _, format := range []string{"%(nonsense)", "%(refname:bogus)", "%(authordate:bogus)"} {
+		if _, err := f.Format(main, format); err == nil {
+			t.Errorf("Format(%q) succeeded", format)
+		}
+	}
+
+	refs := []Ref{v1, old, main}
+	if err := f.Sort(refs, []string{"refname", "-committerdate"}); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, ref := range refs {
+		names = append(names, ref.Name)
+	}
+	if want := []string{"refs/heads/main", "refs/heads/old", "refs/tags/v1"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("sorted refs = %q, want %q", names, want)
+	}
+}
@@ -0,0 +1,206 @@
+// Package git reads and writes git repositories. The mygit command is a thin
+// wrapper around it.
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Repository is a git repository: the objects, refs, index and config under
+// GitDir and the files checked out in WorkTree. GitDir and WorkTree are paths
+// in FS.
+type Repository struct {
+	WorkTree string
+	GitDir   string
+	Objects  ObjectStore
+	FS       FS
+}
+
+// Open the repository whose working tree is workTree, with the git directory
+// at workTree/.git.
+func OpenRepository(workTree string) *Repository {
+	gitDir := path.Join(workTree, ".git")
+	return &Repository{
+		WorkTree: workTree,
+		GitDir:   gitDir,
+		Objects:  NewObjectDatabase(path.Join(gitDir, "objects")),
+		FS:       OSFS{},
+	}
+}
+
+// Returned by DiscoverRepository when no repository is found.
+var ErrNotRepository = errors.New("not a git repository (or any of the parent directories): .git")
+
+// Find the repository of dir like git does: GIT_DIR if it is set, otherwise
+// the first of dir and its parents which has a .git directory, a .git file
+// with "gitdir: <path>" or is a bare repository itself. The search doesn't go
+// up into the directories in GIT_CEILING_DIRECTORIES. GIT_WORK_TREE and
+// GIT_OBJECT_DIRECTORY override the working tree and the object directory.
+// WorkTree is "" for a bare repository.
+// ref: https://git-scm.com/docs/git#_the_git_repository
+func DiscoverRepository(dir string) (*Repository, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var gitDir, workTree string
+	if env := os.Getenv("GIT_DIR"); env != "" {
+		gitDir = env
+		if !filepath.IsAbs(gitDir) {
+			gitDir = filepath.Join(absDir, gitDir)
+		}
+		if !isGitDirectory(gitDir) {
+			return nil, fmt.Errorf("not a git repository: '%s'", env)
+		}
+		// Without GIT_WORK_TREE, the current directory is the top of the working tree.
+		workTree = absDir
+	} else {
+		gitDir, workTree, err = findGitDir(absDir, ceilingDirectories())
+		if err != nil {
+			return nil, err
+		}
+	}
+	if isBareRepository(gitDir) {
+		workTree = ""
+	}
+	if env := os.Getenv("GIT_WORK_TREE"); env != "" {
+		if workTree, err = filepath.Abs(env); err != nil {
+			return nil, err
+		}
+	}
+
+	objectsDir := path.Join(gitDir, "objects")
+	if env := os.Getenv("GIT_OBJECT_DIRECTORY"); env != "" {
+		objectsDir = env
+	}
+	return &Repository{
+		WorkTree: workTree,
+		GitDir:   gitDir,
+		Objects:  NewObjectDatabase(objectsDir),
+		FS:       OSFS{},
+	}, nil
+}
+
+// Walk up from dir and return the git directory and the working tree
+// (which is "" for a bare repository).
+func findGitDir(dir string, ceilings []string) (gitDir, workTree string, _ error) {
+	for {
+		dotGit := filepath.Join(dir, ".git")
+		if info, err := os.Stat(dotGit); err == nil {
+			if !info.IsDir() {
+				gitDir, err := readGitFile(dotGit)
+				if err != nil {
+					return "", "", err
+				}
+				return gitDir, dir, nil
+			}
+			if isGitDirectory(dotGit) {
+				return dotGit, dir, nil
+			}
+		}
+		if isGitDirectory(dir) {
+			return dir, "", nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", "", ErrNotRepository
+		}
+		for _, ceiling := range ceilings {
+			if parent == ceiling {
+				return "", "", ErrNotRepository
+			}
+		}
+		dir = parent
+	}
+}
+
+// Read the path of the git directory from a .git file ("gitdir: <path>"), as
+// used by worktrees and submodules.
+func readGitFile(file string) (string, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	line := strings.TrimRight(string(content), "\r\n")
+	if !strings.HasPrefix(line, "gitdir: ") {
+		return "", fmt.Errorf("invalid gitfile format: %s", file)
+	}
+	gitDir := strings.TrimPrefix(line, "gitdir: ")
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(filepath.Dir(file), gitDir)
+	}
+	if !isGitDirectory(gitDir) {
+		return "", fmt.Errorf("not a git repository: %s", gitDir)
+	}
+	return gitDir, nil
+}
+
+// Report whether dir looks like a git directory: it has HEAD, refs and objects
+// (unless GIT_OBJECT_DIRECTORY moves them elsewhere).
+func isGitDirectory(dir string) bool {
+	if info, err := os.Stat(filepath.Join(dir, "HEAD")); err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	if info, err := os.Stat(filepath.Join(dir, "refs")); err != nil || !info.IsDir() {
+		return false
+	}
+	if os.Getenv("GIT_OBJECT_DIRECTORY") != "" {
+		return true
+	}
+	info, err := os.Stat(filepath.Join(dir, "objects"))
+	return err == nil && info.IsDir()
+}
+
+// Report whether core.bare is set in the config of the git directory.
+func isBareRepository(gitDir string) bool {
+	entries, err := ReadConfigFile(OSFS{}, filepath.Join(gitDir, "config"), gitDir, false, 0)
+	if err != nil {
+		return false
+	}
+	config := &Config{Entries: entries}
+	bare, err := config.GetBool("core.bare", false)
+	return err == nil && bare
+}
+
+// Return the absolute paths in GIT_CEILING_DIRECTORIES.
+func ceilingDirectories() []string {
+	ceilings := []string{}
+	for _, dir := range filepath.SplitList(os.Getenv("GIT_CEILING_DIRECTORIES")) {
+		if filepath.IsAbs(dir) {
+			ceilings = append(ceilings, filepath.Clean(dir))
+		}
+	}
+	return ceilings
+}
+
+// Create an empty repository which is kept entirely in memory: the objects in
+// a MemoryObjectStore, and the git directory and the working tree in a MemoryFS.
+// HEAD points to the unborn branch. Like InitRepository without templates.
+func NewMemoryRepository(branch string) (*Repository, error) {
+	repo := &Repository{
+		WorkTree: "/",
+		GitDir:   "/.git",
+		Objects:  NewMemoryObjectStore(),
+		FS:       NewMemoryFS(),
+	}
+	if _, err := repo.initialize(InitOptions{InitialBranch: branch}); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// Return the object database on disk. Packing and pruning only work on it.
+func (repo *Repository) objectDatabase() (*ObjectDatabase, error) {
+	db, ok := repo.Objects.(*ObjectDatabase)
+	if !ok {
+		return nil, errNoObjectDatabase
+	}
+	return db, nil
+}
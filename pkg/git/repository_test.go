@@ -0,0 +1,109 @@
+package git
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Create the files (path to content, "" for a directory) under root.
+func createTestFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if content == "" {
+			if err := os.MkdirAll(p, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDiscoverRepository(t *testing.T) {
+	root := t.TempDir()
+	gitDir := func(dir string) map[string]string {
+		return map[string]string{
+			dir + "/HEAD":    "ref: refs/heads/main\n",
+			dir + "/refs":    "",
+			dir + "/objects": "",
+		}
+	}
+	for _, files := range []map[string]string{
+		gitDir("work/.git"),
+		{"work/sub/dir": ""},
+		gitDir("bare.git"),
+		{"bare.git/config": "[core]\n\tbare = true\n"},
+		gitDir("separate"),
+		{"linked/.git": "gitdir: ../separate\n"},
+		{"outside/dir": ""},
+		{"broken/.git": "nonsense\n"},
+	} {
+		createTestFiles(t, root, files)
+	}
+	for _, key := range []string{"GIT_DIR", "GIT_WORK_TREE", "GIT_OBJECT_DIRECTORY"} {
+		setTestEnv(t, key, "")
+	}
+	setTestEnv(t, "GIT_CEILING_DIRECTORIES", root)
+
+	tests := []struct {
+		name         string
+		dir          string
+		env          map[string]string
+		wantGitDir   string
+		wantWorkTree string
+		wantErr      error
+	}{
+		{name: "top of the working tree", dir: "work", wantGitDir: "work/.git", wantWorkTree: "work"},
+		{name: "subdirectory", dir: "work/sub/dir", wantGitDir: "work/.git", wantWorkTree: "work"},
+		{name: "bare", dir: "bare.git", wantGitDir: "bare.git"},
+		{name: "git file", dir: "linked", wantGitDir: "separate", wantWorkTree: "linked"},
+		{name: "GIT_DIR", dir: "outside/dir", env: map[string]string{"GIT_DIR": "../../work/.git"}, wantGitDir: "work/.git", wantWorkTree: "outside/dir"},
+		{
+			name: "GIT_WORK_TREE", dir: "work/sub",
+			env:        map[string]string{"GIT_WORK_TREE": filepath.Join(root, "outside")},
+			wantGitDir: "work/.git", wantWorkTree: "outside",
+		},
+		{name: "not found", dir: "outside/dir", wantErr: ErrNotRepository},
+		{name: "stops at the ceiling", dir: "work/sub/dir", env: map[string]string{"GIT_CEILING_DIRECTORIES": filepath.Join(root, "work", "sub")}, wantErr: ErrNotRepository},
+		{name: "invalid git file", dir: "broken"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				setTestEnv(t, key, value)
+			}
+			repo, err := DiscoverRepository(filepath.Join(root, tt.dir))
+			if tt.wantGitDir == "" {
+				if err == nil {
+					t.Fatalf("DiscoverRepository() = %+v, want an error", repo)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("DiscoverRepository() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := filepath.Join(root, tt.wantGitDir); repo.GitDir != want {
+				t.Errorf("GitDir = %s, want %s", repo.GitDir, want)
+			}
+			wantWorkTree := ""
+			if tt.wantWorkTree != "" {
+				wantWorkTree = filepath.Join(root, tt.wantWorkTree)
+			}
+			if repo.WorkTree != wantWorkTree {
+				t.Errorf("WorkTree = %q, want %q", repo.WorkTree, wantWorkTree)
+			}
+		})
+	}
+}
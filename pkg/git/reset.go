@@ -0,0 +1,110 @@
+package git
+
+import "strings"
+
+// ResetMode tells what reset changes besides the current branch.
+type ResetMode int
+
+const (
+	ResetSoft  ResetMode = iota // only move the branch
+	ResetMixed                  // also reset the index
+	ResetHard                   // also reset the working tree, discarding local changes
+	ResetKeep                   // reset the index and the working tree but keep local changes
+)
+
+// Reset the current branch (HEAD when detached) to the commit, recording the
+// previous commit in ORIG_HEAD and the update in the reflog with the message.
+// With ResetKeep a *CheckoutConflictError is returned, and nothing changed,
+// if a file with local changes differs between HEAD and the commit.
+// ref: https://git-scm.com/docs/git-reset
+func Reset(repo *Repository, commitSha string, mode ResetMode, message string) error {
+	_, headSha, err := ReadHead(repo)
+	if err != nil {
+		return err
+	}
+	headTree := ""
+	if headSha != "" {
+		if headTree, err = ReadCommitTree(repo, headSha); err != nil {
+			return err
+		}
+	}
+	newTree, err := ReadCommitTree(repo, commitSha)
+	if err != nil {
+		return err
+	}
+
+	switch mode {
+	case ResetMixed:
+		err = ResetIndex(repo, newTree, nil)
+	case ResetHard:
+		err = CheckoutTree(repo, headTree, newTree, true)
+	case ResetKeep:
+		err = CheckoutTree(repo, headTree, newTree, false)
+	}
+	if err != nil {
+		return err
+	}
+
+	if headSha != "" {
+		if err := UpdateRef(repo, "ORIG_HEAD", headSha, "", "updating ORIG_HEAD"); err != nil {
+			return err
+		}
+	}
+	return UpdateRef(repo, "HEAD", commitSha, "", message)
+}
+
+// Set the index entries to the files of the tree ("" for the empty tree),
+// only the entries matching the paths (files or directories, "." for
+// everything) unless paths is nil. The working tree is not touched; entries
+// which don't change keep their stat info so that they aren't shown as
+// modified.
+func ResetIndex(repo *Repository, treeSha string, paths []string) error {
+	files := map[string]TreeChild{}
+	if treeSha != "" {
+		if err := flattenTree(repo, treeSha, "", files); err != nil {
+			return err
+		}
+	}
+	idx, err := ReadIndex(repo)
+	if err != nil {
+		return err
+	}
+	matches := func(name string) bool {
+		if paths == nil {
+			return true
+		}
+		for _, p := range paths {
+			if p == "." || name == p || strings.HasPrefix(name, p+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	old := map[string]IndexEntry{}
+	entries := []IndexEntry{}
+	for _, entry := range idx.Entries {
+		if !matches(entry.Name) {
+			entries = append(entries, entry)
+		} else if entry.Stage() == 0 {
+			old[entry.Name] = entry
+		}
+	}
+	for name, file := range files {
+		if !matches(name) {
+			continue
+		}
+		if entry, ok := old[name]; ok && entryMatchesTree(&entry, file) {
+			entries = append(entries, entry)
+			continue
+		}
+		entry, err := indexEntryFromTree(name, file)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	}
+	idx.Entries = entries
+	idx.sort()
+	return idx.Write(repo)
+}
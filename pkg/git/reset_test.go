@@ -0,0 +1,117 @@
+package git
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReset(t *testing.T) {
+	files := map[string]string{"a": "1\n", "b": "1\n"}
+	changedFiles := map[string]string{"a": "2\n", "b": "1\n"}
+	tests := []struct {
+		mode        ResetMode
+		wantFiles   map[string]string
+		wantChanges []FileStatus
+	}{
+		{ResetSoft, map[string]string{"a": "2\n", "b": "local\n"}, []FileStatus{{Name: "a", Staged: 'M', Unstaged: ' '}, {Name: "b", Staged: ' ', Unstaged: 'M'}}},
+		{ResetMixed, map[string]string{"a": "2\n", "b": "local\n"}, []FileStatus{{Name: "a", Staged: ' ', Unstaged: 'M'}, {Name: "b", Staged: ' ', Unstaged: 'M'}}},
+		{ResetHard, files, nil},
+		{ResetKeep, map[string]string{"a": "1\n", "b": "local\n"}, []FileStatus{{Name: "b", Staged: ' ', Unstaged: 'M'}}},
+	}
+	for _, tt := range tests {
+		repo, first := newTestCheckout(t, files)
+		second := writeTestCommit(t, repo, "second", changedFiles, first)
+		if err := CheckoutCommit(repo, second, false); err != nil {
+			t.Fatal(err)
+		}
+		if err := UpdateRef(repo, "HEAD", second, first, "commit: second"); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.FS.WriteFile("/b", []byte("local\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := Reset(repo, first, tt.mode, "reset: moving to HEAD~1"); err != nil {
+			t.Errorf("Reset(mode %d) error: %v", tt.mode, err)
+			continue
+		}
+		if got := readTestRefs(t, repo, "refs/heads/main", "ORIG_HEAD"); got[0] != first || got[1] != second {
+			t.Errorf("mode %d: main, ORIG_HEAD = %q, want %s and %s", tt.mode, got, first, second)
+		}
+		if got := readTestReflog(t, repo, "HEAD"); got[0] != "reset: moving to HEAD~1" {
+			t.Errorf("mode %d: reflog of HEAD = %q", tt.mode, got)
+		}
+		assertTestFiles(t, repo, tt.wantFiles)
+		status, err := GetStatus(repo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (len(status.Changes) > 0 || tt.wantChanges != nil) && !reflect.DeepEqual(status.Changes, tt.wantChanges) {
+			t.Errorf("mode %d: changes = %+v, want %+v", tt.mode, status.Changes, tt.wantChanges)
+		}
+	}
+
+	// With keep, a local change to a file which differs is refused.
+	repo, first := newTestCheckout(t, files)
+	second := writeTestCommit(t, repo, "second", changedFiles, first)
+	if err := repo.FS.WriteFile("/a", []byte("local\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reset(repo, second, ResetKeep, "reset: moving to "+second); err == nil {
+		t.Error("Reset(keep) lost a local change")
+	}
+	if got := readTestRefs(t, repo, "refs/heads/main", "ORIG_HEAD"); got[0] != first || got[1] != "" {
+		t.Errorf("main, ORIG_HEAD = %q after a failed reset", got)
+	}
+}
+
+func TestResetIndex(t *testing.T) {
+	repo, first := newTestCheckout(t, map[string]string{"a": "1\n", "dir/b": "1\n", "dir/c": "1\n"})
+	for name, content := range map[string]string{"a": "2\n", "dir/b": "2\n", "dir/c": "2\n", "new": "new\n"} {
+		if err := repo.FS.WriteFile("/"+name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	idx, err := ReadIndex(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "dir/b", "dir/c", "new"} {
+		entry, err := HashWorktreeFile(repo, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		idx.Remove(name)
+		idx.Add(entry)
+	}
+	idx.sort()
+	if err := idx.Write(repo); err != nil {
+		t.Fatal(err)
+	}
+	tree, err := ReadCommitTree(repo, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Unstage dir and new, but keep a staged.
+	if err := ResetIndex(repo, tree, []string{"dir", "new"}); err != nil {
+		t.Fatal(err)
+	}
+	status, err := GetStatus(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &RepoStatus{
+		Ref:     "refs/heads/main",
+		HeadSha: first,
+		Changes: []FileStatus{
+			{Name: "a", Staged: 'M', Unstaged: ' '},
+			{Name: "dir/b", Staged: ' ', Unstaged: 'M'},
+			{Name: "dir/c", Staged: ' ', Unstaged: 'M'},
+		},
+		Untracked: []string{"new"},
+	}
+	if !reflect.DeepEqual(status, want) {
+		t.Errorf("status = %+v, want %+v", status, want)
+	}
+}
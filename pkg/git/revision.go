@@ -0,0 +1,606 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ref: https://git-scm.com/docs/gitrevisions
+
+// Returned by ResolveRevision when the name is neither a ref nor an object.
+var ErrUnknownRevision = errors.New("unknown revision")
+
+// The order in which a short ref name is looked up.
+var refSearchRules = []string{
+	"%s",
+	"refs/%s",
+	"refs/tags/%s",
+	"refs/heads/%s",
+	"refs/remotes/%s",
+	"refs/remotes/%s/HEAD",
+}
+
+// Return the refs which a short name such as "master" could mean, in search order.
+func expandRefName(name string) []string {
+	refs := []string{}
+	for _, rule := range refSearchRules {
+		ref := fmt.Sprintf(rule, name)
+		// Only HEAD like names (e.g. ORIG_HEAD) are looked up directly under .git.
+		if rule == "%s" && !strings.HasPrefix(ref, "refs/") && !isPseudoRef(ref) {
+			continue
+		}
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+func isPseudoRef(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'A' && c <= 'Z') && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// Strip refs/heads/, refs/tags/ or refs/remotes/ from the ref name.
+func ShortenRefName(ref string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/remotes/"} {
+		if strings.HasPrefix(ref, prefix) {
+			return strings.TrimPrefix(ref, prefix)
+		}
+	}
+	return strings.TrimPrefix(ref, "refs/")
+}
+
+// Find the ref which the short name means. Returns empty ref if nothing matches.
+func DwimRef(repo *Repository, name string) (ref, sha string, _ error) {
+	if name == "@" {
+		name = "HEAD"
+	}
+	for _, candidate := range expandRefName(name) {
+		var err error
+		if candidate == "HEAD" {
+			_, sha, err = ReadHead(repo)
+		} else {
+			sha, err = readRef(repo, candidate)
+		}
+		if err != nil {
+			return "", "", err
+		}
+		if sha != "" {
+			return candidate, sha, nil
+		}
+	}
+	return "", "", nil
+}
+
+// Resolve a revision such as HEAD~2, main^2, abc1234, v1.0^{tree} or
+// HEAD:path/to/file to the sha of an object.
+func ResolveRevision(repo *Repository, rev string) (string, error) {
+	if rev == "" {
+		return "", errors.New("empty revision")
+	}
+
+	// :/<text> finds the youngest commit whose message matches.
+	if strings.HasPrefix(rev, ":/") {
+		return findCommitByMessage(repo, rev[2:])
+	}
+
+	// <rev>:<path> and :[<stage>:]<path>
+	if colon := indexOutsideBraces(rev, ':'); colon >= 0 {
+		treeish, p := rev[:colon], rev[colon+1:]
+		if treeish == "" {
+			return resolveIndexPath(repo, p)
+		}
+		treeSha, err := ResolveRevision(repo, treeish)
+		if err != nil {
+			return "", err
+		}
+		if treeSha, err = PeelObject(repo, treeSha, "tree"); err != nil {
+			return "", err
+		}
+		name, err := revisionPath(repo, p)
+		if err != nil {
+			return "", err
+		}
+		_, sha, err := lookupTreePath(repo, treeSha, name)
+		if err != nil {
+			return "", err
+		}
+		if sha == "" {
+			return "", fmt.Errorf("path '%s' does not exist in '%s'", p, treeish)
+		}
+		return sha, nil
+	}
+
+	// Split the base name and the ^ and ~ operators.
+	opStart := len(rev)
+	if i := indexOutsideBraces(rev, '^'); i >= 0 && i < opStart {
+		opStart = i
+	}
+	if i := indexOutsideBraces(rev, '~'); i >= 0 && i < opStart {
+		opStart = i
+	}
+	sha, err := resolveBaseRevision(repo, rev[:opStart])
+	if err != nil {
+		return "", err
+	}
+	return applyRevisionOperators(repo, sha, rev[opStart:])
+}
+
+// Return the index of c which is not part of "@{...}" or "^{...}", or -1.
+func indexOutsideBraces(s string, c byte) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '{' && i > 0 && (s[i-1] == '@' || s[i-1] == '^'):
+			depth++
+		case s[i] == '}' && depth > 0:
+			depth--
+		case s[i] == c && depth == 0:
+			return i
+		}
+	}
+	return -1
+}
+
+// Resolve a name without ^ and ~: a ref, a (short) sha or <ref>@{...}.
+func resolveBaseRevision(repo *Repository, name string) (string, error) {
+	if name == "" {
+		// e.g. "^{tree}" alone
+		return "", errors.New("missing revision before operator")
+	}
+
+	if at := strings.Index(name, "@{"); at >= 0 && strings.HasSuffix(name, "}") {
+		return resolveAtBrace(repo, name[:at], name[at+2:len(name)-1])
+	}
+
+	if isFullSha(name) {
+		return name, nil
+	}
+	_, sha, err := DwimRef(repo, name)
+	if err != nil {
+		return "", err
+	}
+	if sha != "" {
+		return sha, nil
+	}
+	if isHexPrefix(name) {
+		return resolveShortSha(repo, name)
+	}
+	return "", fmt.Errorf("%w '%s'", ErrUnknownRevision, name)
+}
+
+// Resolve <ref>@{N}, @{-N}, <branch>@{upstream} and <branch>@{push}.
+func resolveAtBrace(repo *Repository, name, spec string) (string, error) {
+	if strings.HasPrefix(spec, "-") {
+		if name != "" {
+			return "", fmt.Errorf("invalid revision '%s@{%s}'", name, spec)
+		}
+		n, err := strconv.Atoi(spec[1:])
+		if err != nil || n < 1 {
+			return "", fmt.Errorf("invalid revision '@{%s}'", spec)
+		}
+		branch, err := previousBranch(repo, n)
+		if err != nil {
+			return "", err
+		}
+		return resolveBaseRevision(repo, branch)
+	}
+
+	// The empty name means the current branch (or HEAD when detached).
+	ref := ""
+	if name == "" || name == "@" {
+		headRef, _, err := ReadHead(repo)
+		if err != nil {
+			return "", err
+		}
+		ref = headRef
+		if ref == "" {
+			ref = "HEAD"
+		}
+	} else {
+		found, _, err := DwimRef(repo, name)
+		if err != nil {
+			return "", err
+		}
+		if found == "" {
+			return "", fmt.Errorf("%w '%s'", ErrUnknownRevision, name)
+		}
+		ref = found
+	}
+
+	switch strings.ToLower(spec) {
+	case "u", "upstream", "push":
+		upstream, err := UpstreamRef(repo, ref)
+		if err != nil {
+			return "", err
+		}
+		sha, err := readRef(repo, upstream)
+		if err != nil {
+			return "", err
+		}
+		if sha == "" {
+			return "", fmt.Errorf("upstream branch '%s' not stored as a remote-tracking branch", upstream)
+		}
+		return sha, nil
+	}
+
+	n, err := strconv.Atoi(spec)
+	if err == nil && n >= 0 {
+		return resolveReflogIndex(repo, ref, n)
+	}
+	date, err := ParseExpiryDate(spec, time.Now())
+	if err != nil || date.IsZero() {
+		return "", fmt.Errorf("invalid reflog selector '@{%s}'", spec)
+	}
+	return resolveReflogDate(repo, ref, date)
+}
+
+// Return the value the ref had at the date using its reflog. Before the
+// first recorded update, that is the value before the update if there was one.
+func resolveReflogDate(repo *Repository, ref string, date time.Time) (string, error) {
+	entries, err := readReflog(repo, ref)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("log for '%s' is empty", ref)
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !entries[i].Committer.When.After(date) {
+			return entries[i].NewSha, nil
+		}
+	}
+	if entries[0].OldSha != zeroSha {
+		return entries[0].OldSha, nil
+	}
+	return entries[0].NewSha, nil
+}
+
+// Return the value of the ref n updates ago using its reflog.
+func resolveReflogIndex(repo *Repository, ref string, n int) (string, error) {
+	entries, err := readReflog(repo, ref)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("log for '%s' is empty", ref)
+	}
+	if n < len(entries) {
+		return entries[len(entries)-1-n].NewSha, nil
+	}
+	// The oldest value before the first recorded update.
+	if n == len(entries) && entries[0].OldSha != zeroSha {
+		return entries[0].OldSha, nil
+	}
+	return "", fmt.Errorf("log for '%s' only has %d entries", ref, len(entries))
+}
+
+// Return the branch which @{-N} refers to, e.g. "master" for @{-1} after
+// switching from master.
+func ExpandPreviousBranch(repo *Repository, name string) (string, error) {
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "@{-"), "}"))
+	if err != nil || n < 1 || !strings.HasPrefix(name, "@{-") || !strings.HasSuffix(name, "}") {
+		return "", fmt.Errorf("invalid revision '%s'", name)
+	}
+	return previousBranch(repo, n)
+}
+
+// Find the n-th previously checked out branch from the reflog of HEAD.
+func previousBranch(repo *Repository, n int) (string, error) {
+	entries, err := readReflog(repo, "HEAD")
+	if err != nil {
+		return "", err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		// "checkout: moving from <old> to <new>"
+		message := entries[i].Message
+		if !strings.HasPrefix(message, "checkout: moving from ") {
+			continue
+		}
+		from := strings.TrimPrefix(message, "checkout: moving from ")
+		if to := strings.LastIndex(from, " to "); to >= 0 {
+			from = from[:to]
+		}
+		n--
+		if n == 0 {
+			return from, nil
+		}
+	}
+	return "", errors.New("no previous branch in the reflog of HEAD")
+}
+
+// Return the remote-tracking ref configured as the upstream of the branch.
+func UpstreamRef(repo *Repository, ref string) (string, error) {
+	if !strings.HasPrefix(ref, "refs/heads/") {
+		return "", errors.New("HEAD does not point to a branch")
+	}
+	branch := strings.TrimPrefix(ref, "refs/heads/")
+	config, err := LoadConfig(repo)
+	if err != nil {
+		return "", err
+	}
+	remote, hasRemote := config.Get("branch." + branch + ".remote")
+	merge, hasMerge := config.Get("branch." + branch + ".merge")
+	if !hasRemote || !hasMerge {
+		return "", fmt.Errorf("no upstream configured for branch '%s'", branch)
+	}
+	if remote == "." {
+		return merge, nil
+	}
+	return "refs/remotes/" + remote + "/" + strings.TrimPrefix(merge, "refs/heads/"), nil
+}
+
+// Apply the sequence of ^, ^N, ~N and ^{type} to the object.
+func applyRevisionOperators(repo *Repository, sha, ops string) (string, error) {
+	for len(ops) > 0 {
+		op := ops[0]
+		ops = ops[1:]
+		if op == '^' && strings.HasPrefix(ops, "{") {
+			end := strings.Index(ops, "}")
+			if end < 0 {
+				return "", fmt.Errorf("unterminated ^{...}")
+			}
+			peelType := ops[1:end]
+			ops = ops[end+1:]
+			var err error
+			if sha, err = PeelObject(repo, sha, peelType); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		digits := 0
+		for digits < len(ops) && ops[digits] >= '0' && ops[digits] <= '9' {
+			digits++
+		}
+		n := 1
+		if digits > 0 {
+			n, _ = strconv.Atoi(ops[:digits])
+			ops = ops[digits:]
+		}
+
+		commitSha, err := PeelObject(repo, sha, "commit")
+		if err != nil {
+			return "", err
+		}
+		switch op {
+		case '^':
+			// ^0 means the commit itself, ^N the N-th parent.
+			if n == 0 {
+				sha = commitSha
+				continue
+			}
+			commit, err := ReadCommit(repo, commitSha)
+			if err != nil {
+				return "", err
+			}
+			if n > len(commit.Parents) {
+				return "", fmt.Errorf("commit %s has no parent %d", commitSha, n)
+			}
+			sha = commit.Parents[n-1]
+		case '~':
+			// ~N follows the first parents N times.
+			sha = commitSha
+			for i := 0; i < n; i++ {
+				commit, err := ReadCommit(repo, sha)
+				if err != nil {
+					return "", err
+				}
+				if len(commit.Parents) == 0 {
+					return "", fmt.Errorf("commit %s has no parent", sha)
+				}
+				sha = commit.Parents[0]
+			}
+		default:
+			return "", fmt.Errorf("invalid operator '%c'", op)
+		}
+	}
+	return sha, nil
+}
+
+// Peel tags (and commits for "tree") until an object of the type is found.
+// An empty type peels tags until a non-tag object, "object" only checks existence.
+func PeelObject(repo *Repository, sha, objectType string) (string, error) {
+	for {
+		objReader, err := repo.Objects.Get(sha)
+		if err != nil {
+			return "", fmt.Errorf("object %s not found: %s", sha, err)
+		}
+		objType := objReader.Type
+		var content []byte
+		if objType == "tag" {
+			content, err = objReader.ReadContents()
+		}
+		objReader.Close()
+		if err != nil {
+			return "", err
+		}
+		if objectType == "object" || objType == objectType || (objectType == "" && objType != "tag") {
+			return sha, nil
+		}
+		switch objType {
+		case "tag":
+			// "object <sha>\ntype <type>\n..."
+			if !strings.HasPrefix(string(content), "object ") || len(content) < 47 {
+				return "", fmt.Errorf("invalid tag object %s", sha)
+			}
+			sha = string(content[7:47])
+		case "commit":
+			if objectType != "tree" {
+				return "", fmt.Errorf("%s is a commit, not a %s", sha, objectType)
+			}
+			return ReadCommitTree(repo, sha)
+		default:
+			return "", fmt.Errorf("%s is a %s, not a %s", sha, objType, objectType)
+		}
+	}
+}
+
+// Return the path of <rev>:<path> relative to the top of the working tree:
+// a path starting with "./" or "../" is relative to the current directory.
+func revisionPath(repo *Repository, p string) (string, error) {
+	if !strings.HasPrefix(p, "./") && !strings.HasPrefix(p, "../") {
+		return p, nil
+	}
+	return NormalizePath(repo, p)
+}
+
+// Resolve :<path> and :<stage>:<path> from the index.
+func resolveIndexPath(repo *Repository, p string) (string, error) {
+	stage := 0
+	if len(p) > 2 && p[0] >= '0' && p[0] <= '3' && p[1] == ':' {
+		stage = int(p[0] - '0')
+		p = p[2:]
+	}
+	name, err := revisionPath(repo, p)
+	if err != nil {
+		return "", err
+	}
+	idx, err := ReadIndex(repo)
+	if err != nil {
+		return "", err
+	}
+	name = path.Clean(name)
+	for _, entry := range idx.Entries {
+		if entry.Name == name && entry.Stage() == stage {
+			return entry.ShaString(), nil
+		}
+	}
+	return "", fmt.Errorf("path '%s' does not exist in the index", p)
+}
+
+// Find the youngest commit reachable from HEAD whose message contains text.
+func findCommitByMessage(repo *Repository, text string) (string, error) {
+	_, headSha, err := ReadHead(repo)
+	if err != nil {
+		return "", err
+	}
+	if headSha == "" {
+		return "", errors.New("HEAD does not have any commits yet")
+	}
+	walker, err := NewCommitWalker(repo, []string{headSha}, nil)
+	if err != nil {
+		return "", err
+	}
+	for {
+		commit, err := walker.Next()
+		if err != nil {
+			return "", err
+		}
+		if commit == nil {
+			return "", fmt.Errorf("no commit message matches '%s'", text)
+		}
+		if strings.Contains(commit.Message, text) {
+			return commit.Sha, nil
+		}
+	}
+}
+
+func isHexPrefix(s string) bool {
+	if len(s) < 4 || len(s) > 40 {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') && !(c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// Resolve an abbreviated sha. It fails if the prefix is ambiguous.
+func resolveShortSha(repo *Repository, prefix string) (string, error) {
+	prefix = strings.ToLower(prefix)
+	matches, err := findObjectsByPrefix(repo, prefix)
+	if err != nil {
+		return "", err
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("%w '%s'", ErrUnknownRevision, prefix)
+	case 1:
+		return matches[0], nil
+	}
+	return "", fmt.Errorf("short object ID %s is ambiguous", prefix)
+}
+
+// List the objects whose sha starts with the prefix.
+func findObjectsByPrefix(repo *Repository, prefix string) ([]string, error) {
+	found := map[string]bool{}
+	collect := func(sha string) error {
+		if strings.HasPrefix(sha, prefix) {
+			found[sha] = true
+		}
+		return nil
+	}
+	if db, ok := repo.Objects.(*ObjectDatabase); ok {
+		// Only one directory of loose objects can match.
+		files, err := ioutil.ReadDir(path.Join(db.Loose.Dir, prefix[:2]))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for _, file := range files {
+			if sha := prefix[:2] + file.Name(); isFullSha(sha) {
+				collect(sha)
+			}
+		}
+		if err := db.Packs.Iterate(collect); err != nil {
+			return nil, err
+		}
+	} else if err := repo.Objects.Iterate(collect); err != nil {
+		return nil, err
+	}
+
+	matches := []string{}
+	for sha := range found {
+		matches = append(matches, sha)
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// Return the shortest unique prefix of the sha which is at least minLen long.
+// Only the objects next to the sha in sorted order can share a longer prefix
+// with it: the loose objects of its directory and its neighbours in each
+// pack index.
+func ShortenSha(repo *Repository, sha string, minLen int) string {
+	if !isFullSha(sha) || minLen >= len(sha) {
+		return sha
+	}
+	n := minLen
+	compare := func(other string) error {
+		common := 0
+		for common < len(sha) && sha[common] == other[common] {
+			common++
+		}
+		if common < len(sha) && common+1 > n {
+			n = common + 1
+		}
+		return nil
+	}
+	if db, ok := repo.Objects.(*ObjectDatabase); ok {
+		files, _ := ioutil.ReadDir(path.Join(db.Loose.Dir, sha[:2]))
+		for _, file := range files {
+			if other := sha[:2] + file.Name(); isFullSha(other) {
+				compare(other)
+			}
+		}
+		db.Packs.neighbours(sha, func(other string) { compare(other) })
+	} else {
+		repo.Objects.Iterate(compare)
+	}
+	return sha[:n]
+}
@@ -0,0 +1,155 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"testing"
+)
+
+func TestResolveRevision(t *testing.T) {
+	repo := newTestRepository(t)
+	first := writeTestCommit(t, repo, "first", map[string]string{"a": "1\n", "dir/b": "2\n"})
+	second := writeTestCommit(t, repo, "second", map[string]string{"a": "one\n", "dir/b": "2\n"}, first)
+	side := writeTestCommit(t, repo, "side", map[string]string{"c": "3\n"}, first)
+	merge := writeTestCommit(t, repo, "merge", map[string]string{"a": "one\n", "c": "3\n"}, second, side)
+	for ref, sha := range map[string]string{
+		"refs/heads/main": merge,
+		"refs/heads/side": side,
+		"refs/tags/v1":    second,
+	} {
+		if err := UpdateRef(repo, ref, sha, "", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// main was at first before the merge.
+	reflog := fmt.Sprintf("%s %s A U Thor <author@example.com> 1700000000 +0000\tcommit (initial): first\n", zeroSha, first) +
+		fmt.Sprintf("%s %s A U Thor <author@example.com> 1700000600 +0000\tcommit (merge): merge\n", first, merge)
+	if err := repo.FS.MkdirAll(path.Join(repo.GitDir, "logs", "refs", "heads"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.FS.WriteFile(reflogPath(repo, "refs/heads/main"), []byte(reflog), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	firstTree, err := ReadCommitTree(repo, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		rev     string
+		want    string
+		wantErr bool
+	}{
+		{rev: "HEAD", want: merge},
+		{rev: "main", want: merge},
+		{rev: "heads/main", want: merge},
+		{rev: "refs/heads/side", want: side},
+		{rev: "v1", want: second},
+		{rev: merge, want: merge},
+		{rev: first[:7], want: first},
+		{rev: "HEAD^", want: second},
+		{rev: "HEAD^1", want: second},
+		{rev: "HEAD^2", want: side},
+		{rev: "HEAD~1", want: second},
+		{rev: "HEAD~2", want: first},
+		{rev: "HEAD^2~1", want: first},
+		{rev: "HEAD^0", want: merge},
+		{rev: "main@{1}", want: first},
+		{rev: "main@{0}", want: merge},
+		{rev: first + "^{tree}", want: firstTree},
+		{rev: "side~1^{commit}", want: first},
+		{rev: "HEAD:a", want: testBlobSha("one\n")},
+		{rev: "v1:dir/b", want: testBlobSha("2\n")},
+		{rev: ":/second", want: second},
+		{rev: ":/first", want: first},
+		{rev: "", wantErr: true},
+		{rev: "nothing", wantErr: true},
+		{rev: "HEAD~5", wantErr: true},
+		{rev: "HEAD^3", wantErr: true},
+		{rev: "HEAD:missing", wantErr: true},
+		{rev: "main@{5}", wantErr: true},
+		{rev: ":/no such message", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rev, func(t *testing.T) {
+			got, err := ResolveRevision(repo, tt.rev)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ResolveRevision() = %s, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveRevision() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// Callers tell an unknown name from other failures.
+	if _, err := ResolveRevision(repo, "nothing"); !errors.Is(err, ErrUnknownRevision) {
+		t.Errorf("ResolveRevision(nothing) error = %v, want ErrUnknownRevision", err)
+	}
+	if _, err := ResolveRevision(repo, "HEAD:missing"); errors.Is(err, ErrUnknownRevision) {
+		t.Errorf("ResolveRevision(HEAD:missing) error = %v, want the missing path", err)
+	}
+}
+
+func TestShortenSha(t *testing.T) {
+	memoryRepo := newTestRepository(t)
+	diskRepo := newTestDiskRepository(t)
+	db, err := diskRepo.objectDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Enough blobs for some to share 4 or 5 hex digits.
+	shas := []string{}
+	for i := 0; i < 800; i++ {
+		content := []byte(fmt.Sprintf("%d\n", i))
+		sha, err := memoryRepo.Objects.Put("blob", content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Put("blob", content); err != nil {
+			t.Fatal(err)
+		}
+		shas = append(shas, sha)
+	}
+	// Half of the objects of the disk repository are packed.
+	objects, err := ListObjects(diskRepo, shas[:400], nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := WritePackFiles(diskRepo, path.Join(db.Packs.Dir, "pack"), objects, 10, 50); err != nil {
+		t.Fatal(err)
+	}
+	db.Packs.Reload()
+	if err := prunePacked(db); err != nil {
+		t.Fatal(err)
+	}
+
+	longer := 0
+	for _, sha := range shas {
+		want := sha[:4]
+		for n := 4; n < len(sha); n++ {
+			if matches, _ := findObjectsByPrefix(memoryRepo, sha[:n]); len(matches) == 1 {
+				want = sha[:n]
+				break
+			}
+		}
+		if len(want) > 4 {
+			longer++
+		}
+		for _, repo := range []*Repository{memoryRepo, diskRepo} {
+			if got := ShortenSha(repo, sha, 4); got != want {
+				t.Errorf("ShortenSha(%s) = %s, want %s", sha, got, want)
+			}
+		}
+	}
+	if longer == 0 {
+		t.Error("no sha needs more than 4 digits, the test proves nothing")
+	}
+}
@@ -0,0 +1,22 @@
+package git
+
+import (
+	"os"
+	"syscall"
+)
+
+// Fill the stat fields of the index entry.
+func fillStatInfo(entry *IndexEntry, info os.FileInfo) {
+	entry.MtimeSec = uint32(info.ModTime().Unix())
+	entry.MtimeNsec = uint32(info.ModTime().Nanosecond())
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	entry.CtimeSec = uint32(stat.Ctim.Sec)
+	entry.CtimeNsec = uint32(stat.Ctim.Nsec)
+	entry.Dev = uint32(stat.Dev)
+	entry.Ino = uint32(stat.Ino)
+	entry.Uid = stat.Uid
+	entry.Gid = stat.Gid
+}
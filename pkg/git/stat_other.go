@@ -0,0 +1,17 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package git
+
+import (
+	"os"
+)
+
+// Fill the stat fields of the index entry.
+// Only mtime is available on this platform, ctime is approximated by it.
+func fillStatInfo(entry *IndexEntry, info os.FileInfo) {
+	entry.MtimeSec = uint32(info.ModTime().Unix())
+	entry.MtimeNsec = uint32(info.ModTime().Nanosecond())
+	entry.CtimeSec = entry.MtimeSec
+	entry.CtimeNsec = entry.MtimeNsec
+}
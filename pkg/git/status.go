@@ -0,0 +1,181 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type FileStatus struct {
+	Name     string
+	Staged   byte // HEAD vs index: ' ', 'A', 'M', 'D', 'T' or 'U'
+	Unstaged byte // index vs working tree: ' ', 'M', 'D', 'T' or 'U'
+}
+
+type RepoStatus struct {
+	Ref       string // "" for detached HEAD
+	HeadSha   string // "" when there are no commits yet
+	Changes   []FileStatus
+	Untracked []string
+}
+
+// Compare HEAD, the index and the working tree.
+func GetStatus(repo *Repository) (*RepoStatus, error) {
+	ref, headSha, err := ReadHead(repo)
+	if err != nil {
+		return nil, err
+	}
+	headFiles := map[string]TreeChild{}
+	if headSha != "" {
+		treeSha, err := ReadCommitTree(repo, headSha)
+		if err != nil {
+			return nil, err
+		}
+		if err := flattenTree(repo, treeSha, "", headFiles); err != nil {
+			return nil, err
+		}
+	}
+	idx, err := ReadIndex(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]*FileStatus{}
+	change := func(name string) *FileStatus {
+		if _, ok := changes[name]; !ok {
+			changes[name] = &FileStatus{Name: name, Staged: ' ', Unstaged: ' '}
+		}
+		return changes[name]
+	}
+
+	// HEAD vs index
+	indexed := map[string]bool{}
+	for _, entry := range idx.Entries {
+		indexed[entry.Name] = true
+		if entry.Stage() != 0 {
+			change(entry.Name).Staged = 'U'
+			change(entry.Name).Unstaged = 'U'
+			continue
+		}
+		head, ok := headFiles[entry.Name]
+		if !ok {
+			change(entry.Name).Staged = 'A'
+		} else if mode := fmt.Sprintf("%o", entry.Mode); head.Sha != entry.ShaString() || head.Mode != mode {
+			change(entry.Name).Staged = modifiedOrTypeChanged(head.Mode, mode)
+		}
+	}
+	for name := range headFiles {
+		if !indexed[name] {
+			change(name).Staged = 'D'
+		}
+	}
+
+	// index vs working tree
+	refreshed := false
+	for i := range idx.Entries {
+		entry := &idx.Entries[i]
+		if entry.Stage() != 0 {
+			continue
+		}
+		info, err := repo.FS.Lstat(filepath.Join(repo.WorkTree, filepath.FromSlash(entry.Name)))
+		if os.IsNotExist(err) || (err == nil && info.IsDir()) {
+			change(entry.Name).Unstaged = 'D'
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if entry.StatMatches(info) {
+			continue
+		}
+		if mode := fileMode(info); mode != entry.Mode {
+			change(entry.Name).Unstaged = modifiedOrTypeChanged(fmt.Sprintf("%o", entry.Mode), fmt.Sprintf("%o", mode))
+			continue
+		}
+		modified, err := IsWorktreeModified(repo, entry)
+		if err != nil {
+			return nil, err
+		}
+		if modified {
+			change(entry.Name).Unstaged = 'M'
+			continue
+		}
+		// The content is the same. Refresh the stat info so that the file
+		// isn't hashed again next time.
+		*entry = newIndexEntry(entry.Name, info, entry.Sha)
+		refreshed = true
+	}
+	if refreshed {
+		// The refresh is opportunistic: a failure (e.g. the index is locked)
+		// doesn't change the status.
+		_ = idx.Write(repo)
+	}
+
+	untracked, err := listUntrackedFiles(repo, idx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &RepoStatus{Ref: ref, HeadSha: headSha, Untracked: untracked}
+	for _, c := range changes {
+		status.Changes = append(status.Changes, *c)
+	}
+	sort.Slice(status.Changes, func(i, j int) bool {
+		return status.Changes[i].Name < status.Changes[j].Name
+	})
+	return status, nil
+}
+
+func modifiedOrTypeChanged(oldMode, newMode string) byte {
+	if isBlob(oldMode) && isBlob(newMode) {
+		return 'M'
+	}
+	if oldMode != newMode {
+		return 'T'
+	}
+	return 'M'
+}
+
+// List files not in the index which aren't ignored. A directory without any
+// tracked file is listed as a single "dir/" entry as git does.
+func listUntrackedFiles(repo *Repository, idx *Index) ([]string, error) {
+	trackedDirs := map[string]bool{}
+	for _, entry := range idx.Entries {
+		for dir := path.Dir(entry.Name); dir != "."; dir = path.Dir(dir) {
+			trackedDirs[dir] = true
+		}
+	}
+
+	ignore, err := NewIgnoreMatcher(repo)
+	if err != nil {
+		return nil, err
+	}
+	files, err := ListUntrackedFiles(repo, idx, ".", ignore)
+	if err != nil {
+		return nil, err
+	}
+	untracked := []string{}
+	seen := map[string]bool{}
+	for _, f := range files {
+		// Empty and ignored directories aren't shown.
+		if f.Ignored || strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		file := f.Name
+		// Find the top most directory which has no tracked files.
+		name := file
+		for dir := path.Dir(file); dir != "."; dir = path.Dir(dir) {
+			if !trackedDirs[dir] {
+				name = dir + "/"
+			}
+		}
+		if !seen[name] {
+			seen[name] = true
+			untracked = append(untracked, name)
+		}
+	}
+	sort.Strings(untracked)
+	return untracked, nil
+}
@@ -0,0 +1,180 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SwitchTarget is what Switch moves HEAD to: a branch, which may be created
+// first, or a commit to detach HEAD at.
+type SwitchTarget struct {
+	Name        string // as given, e.g. "topic" or "HEAD~1"; it goes into the reflog
+	Branch      string // "" to detach HEAD
+	Sha         string // the commit, "" for an unborn branch
+	Create      bool   // create Branch at Sha
+	ForceCreate bool   // reset Branch if it already exists
+	StartName   string // how the start point of a new branch was given, e.g. "origin/main"
+}
+
+// SwitchResult tells what Switch did besides moving HEAD.
+type SwitchResult struct {
+	OldRef       string // the branch HEAD pointed to, "" if it was detached
+	OldSha       string // the commit HEAD was at
+	Reset        bool   // an existing branch was reset to Sha
+	ResetCurrent bool   // the reset branch was the current one
+	Upstream     string // the upstream a new branch tracks, e.g. "refs/remotes/origin/main"
+}
+
+// Find what name switches to: a branch (also "-" for the previous one), a
+// new branch tracking the only remote-tracking branch of that name, or a
+// commit. With detach it is always a commit.
+// ref: https://git-scm.com/docs/git-switch
+func ResolveSwitchTarget(repo *Repository, name string, detach bool) (SwitchTarget, error) {
+	if name == "-" {
+		name = "@{-1}"
+	}
+	branch := name
+	if strings.HasPrefix(name, "@{-") {
+		// The previous branch is switched to by its name.
+		if previous, err := ExpandPreviousBranch(repo, name); err == nil {
+			branch = previous
+		}
+	}
+
+	if !detach && IsValidBranchName(branch) {
+		if sha, _ := ResolveRevision(repo, "refs/heads/"+branch); sha != "" {
+			return SwitchTarget{Name: branch, Branch: branch, Sha: sha}, nil
+		}
+		if current, _ := CurrentBranch(repo); current == branch {
+			// the unborn current branch
+			return SwitchTarget{Name: branch, Branch: branch}, nil
+		}
+		// "checkout topic" creates topic from the only origin/topic.
+		if remoteRef := UniqueRemoteBranch(repo, branch); remoteRef != "" {
+			return NewBranchTarget(repo, branch, strings.TrimPrefix(remoteRef, "refs/remotes/"), false)
+		}
+	}
+
+	sha, err := ResolveRevision(repo, name)
+	if err == nil {
+		sha, err = PeelObject(repo, sha, "commit")
+	}
+	if err != nil {
+		return SwitchTarget{}, fmt.Errorf("invalid reference: %s", name)
+	}
+	return SwitchTarget{Name: name, Sha: sha}, nil
+}
+
+// Return the remote-tracking branch refs/remotes/<remote>/<branch> if there is
+// exactly one, "" otherwise.
+func UniqueRemoteBranch(repo *Repository, branch string) string {
+	refs, err := ListRefs(repo)
+	if err != nil {
+		return ""
+	}
+	found := ""
+	for _, ref := range refs {
+		rest := strings.TrimPrefix(ref.Name, "refs/remotes/")
+		if rest == ref.Name || ref.Target != "" {
+			continue
+		}
+		if slash := strings.IndexByte(rest, '/'); slash >= 0 && rest[slash+1:] == branch {
+			if found != "" {
+				return ""
+			}
+			found = ref.Name
+		}
+	}
+	return found
+}
+
+// Check that the branch can be created at start and return the target for
+// it. With force an existing branch is reset.
+func NewBranchTarget(repo *Repository, branch, start string, force bool) (SwitchTarget, error) {
+	if !IsValidBranchName(branch) {
+		return SwitchTarget{}, fmt.Errorf("'%s' is not a valid branch name", branch)
+	}
+	if sha, _ := ResolveRevision(repo, "refs/heads/"+branch); sha != "" && !force {
+		return SwitchTarget{}, fmt.Errorf("a branch named '%s' already exists", branch)
+	}
+	target := SwitchTarget{Name: branch, Branch: branch, Create: true, ForceCreate: force, StartName: start}
+	sha, err := ResolveRevision(repo, start)
+	if err == nil {
+		sha, err = PeelObject(repo, sha, "commit")
+	}
+	if err != nil {
+		_, headSha, _ := ReadHead(repo)
+		if start == "HEAD" && headSha == "" {
+			// On an unborn branch, only HEAD changes.
+			target.Create = false
+			return target, nil
+		}
+		return SwitchTarget{}, fmt.Errorf("'%s' is not a commit and a branch '%s' cannot be created from it", start, branch)
+	}
+	target.Sha = sha
+	return target, nil
+}
+
+// Update the working tree and the index to the target, create its branch if
+// needed (tracking an upstream according to branch.autoSetupMerge) and move
+// HEAD. Everything which can fail is checked before the working tree
+// changes; a *CheckoutConflictError is returned if local changes would be
+// lost, unless force discards them.
+func Switch(repo *Repository, target SwitchTarget, force bool) (*SwitchResult, error) {
+	oldRef, oldSha, err := ReadHead(repo)
+	if err != nil {
+		return nil, err
+	}
+	result := &SwitchResult{OldRef: oldRef, OldSha: oldSha}
+
+	branchRef := "refs/heads/" + target.Branch
+	existingSha := ""
+	if target.Create {
+		existingSha, _ = ResolveRevision(repo, branchRef)
+		if result.Upstream, err = AutoUpstream(repo, target.StartName); err != nil {
+			return nil, err
+		}
+	}
+	result.Reset = existingSha != ""
+	// Resetting the current branch is allowed: the branch moves along with
+	// the working tree.
+	result.ResetCurrent = result.Reset && branchRef == oldRef
+
+	if target.Sha != "" {
+		if err := CheckoutCommit(repo, target.Sha, force); err != nil {
+			return nil, err
+		}
+	}
+
+	if target.Create {
+		if result.ResetCurrent {
+			err = UpdateRef(repo, branchRef, target.Sha, existingSha, "branch: Reset to "+target.StartName)
+		} else {
+			err = CreateBranch(repo, target.Branch, target.Sha, target.StartName, target.ForceCreate)
+		}
+		if err == nil && result.Upstream != "" {
+			err = SetUpstream(repo, target.Branch, result.Upstream)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	from := strings.TrimPrefix(oldRef, "refs/heads/")
+	if oldRef == "" {
+		from = oldSha
+	}
+	message := fmt.Sprintf("checkout: moving from %s to %s", from, target.Name)
+	if target.Branch != "" {
+		err = WriteSymbolicRef(repo, "HEAD", branchRef, message)
+	} else {
+		t := NewRefTransaction(repo)
+		t.Message = message
+		t.Update("HEAD", target.Sha, "", false)
+		err = t.Commit()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,99 @@
+package git
+
+import (
+	"path"
+	"testing"
+)
+
+func TestSwitch(t *testing.T) {
+	repo, first := newTestCheckout(t, map[string]string{"a": "1\n"})
+	second := writeTestCommit(t, repo, "second", map[string]string{"a": "2\n"}, first)
+	if err := UpdateRef(repo, "refs/remotes/origin/feature", second, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	cf, err := OpenConfigFile(repo.FS, path.Join(repo.GitDir, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cf.Set("remote.origin.fetch", "+refs/heads/*:refs/remotes/origin/*", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := cf.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// "feature" creates the branch from the remote-tracking branch.
+	target, err := ResolveSwitchTarget(repo, "feature", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := SwitchTarget{Name: "feature", Branch: "feature", Sha: second, Create: true, StartName: "origin/feature"}
+	if target != want {
+		t.Errorf("ResolveSwitchTarget(feature) = %+v, want %+v", target, want)
+	}
+	result, err := Switch(repo, target, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (SwitchResult{OldRef: "refs/heads/main", OldSha: first, Upstream: "refs/remotes/origin/feature"}); *result != want {
+		t.Errorf("Switch() = %+v, want %+v", *result, want)
+	}
+	assertTestFiles(t, repo, map[string]string{"a": "2\n"})
+	if ref, sha, err := ReadHead(repo); err != nil || ref != "refs/heads/feature" || sha != second {
+		t.Errorf("ReadHead() = %s, %s, %v", ref, sha, err)
+	}
+	if got := readTestReflog(t, repo, "HEAD"); got[0] != "checkout: moving from main to feature" {
+		t.Errorf("reflog of HEAD = %q", got)
+	}
+
+	// "-" goes back to the previous branch.
+	if target, err = ResolveSwitchTarget(repo, "-", false); err != nil {
+		t.Fatal(err)
+	}
+	if want := (SwitchTarget{Name: "main", Branch: "main", Sha: first}); target != want {
+		t.Errorf("ResolveSwitchTarget(-) = %+v, want %+v", target, want)
+	}
+	if _, err := Switch(repo, target, false); err != nil {
+		t.Fatal(err)
+	}
+	assertTestFiles(t, repo, map[string]string{"a": "1\n"})
+
+	// A local change which would be lost stops the switch.
+	if err := repo.FS.WriteFile("/a", []byte("changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if target, err = ResolveSwitchTarget(repo, second, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Switch(repo, target, false); err == nil {
+		t.Error("Switch() lost a local change")
+	}
+	if ref, _, _ := ReadHead(repo); ref != "refs/heads/main" {
+		t.Errorf("HEAD moved to %s after a failed switch", ref)
+	}
+	if _, err := Switch(repo, target, true); err != nil {
+		t.Fatal(err)
+	}
+	if ref, sha, err := ReadHead(repo); err != nil || ref != "" || sha != second {
+		t.Errorf("ReadHead() = %q, %s, %v, want HEAD detached at %s", ref, sha, err, second)
+	}
+
+	if _, err := NewBranchTarget(repo, "main", "HEAD", false); err == nil {
+		t.Error("NewBranchTarget() accepted an existing branch")
+	}
+	if _, err := NewBranchTarget(repo, "topic", "none", false); err == nil {
+		t.Error("NewBranchTarget() accepted a missing start point")
+	}
+	if _, err := ResolveSwitchTarget(repo, "none", false); err == nil {
+		t.Error("ResolveSwitchTarget() accepted a missing branch")
+	}
+	if target, err = NewBranchTarget(repo, "main", "HEAD~1", true); err != nil {
+		t.Fatal(err)
+	}
+	if result, err = Switch(repo, target, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestRefs(t, repo, "refs/heads/main"); got[0] != first || !result.Reset || result.ResetCurrent {
+		t.Errorf("main = %s, result = %+v, want main reset to %s", got[0], *result, first)
+	}
+}
@@ -0,0 +1,78 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Tag is an annotated tag object.
+// ref: https://git-scm.com/book/en/v2/Git-Internals-Git-References#_tags
+type Tag struct {
+	Sha     string
+	Object  string // the tagged object
+	Type    string // the type of the tagged object
+	Name    string
+	Tagger  Signature
+	Message string
+}
+
+// Read the tag object.
+func ReadTag(repo *Repository, sha string) (*Tag, error) {
+	objReader, err := repo.Objects.Get(sha)
+	if err != nil {
+		return nil, err
+	}
+	defer objReader.Close()
+	if objReader.Type != "tag" {
+		return nil, fmt.Errorf("object %s is a %s, not a tag", sha, objReader.Type)
+	}
+	tagBuf, err := objReader.ReadContents()
+	if err != nil {
+		return nil, err
+	}
+	return parseTag(sha, tagBuf)
+}
+
+func parseTag(sha string, tagBuf []byte) (*Tag, error) {
+	tag := &Tag{Sha: sha}
+	headerBuf := tagBuf
+	if headerEnd := bytes.Index(tagBuf, []byte("\n\n")); headerEnd >= 0 {
+		headerBuf = tagBuf[:headerEnd]
+		tag.Message = string(tagBuf[headerEnd+2:])
+	}
+	for _, line := range strings.Split(string(headerBuf), "\n") {
+		kv := strings.SplitN(line, " ", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "object":
+			tag.Object = kv[1]
+		case "type":
+			tag.Type = kv[1]
+		case "tag":
+			tag.Name = kv[1]
+		case "tagger":
+			tagger, err := parseSignature(kv[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid tagger in %s: %s", sha, err)
+			}
+			tag.Tagger = tagger
+		}
+	}
+	if !isFullSha(tag.Object) || tag.Type == "" {
+		return nil, fmt.Errorf("invalid tag object %s", sha)
+	}
+	return tag, nil
+}
+
+// Subject returns the first paragraph of the message joined into a line.
+func (t *Tag) Subject() string {
+	return messageSubject(t.Message)
+}
+
+// Body returns the message after the first paragraph.
+func (t *Tag) Body() string {
+	return messageBody(t.Message)
+}
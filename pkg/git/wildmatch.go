@@ -0,0 +1,289 @@
+package git
+
+// Port of git's wildmatch.c, used for includeIf "gitdir:" and gitignore patterns.
+// ref: https://github.com/git/git/blob/master/wildmatch.c
+
+const (
+	wmCasefold = 1 << iota // case insensitive match
+	wmPathname             // "*" and "?" don't match "/", "**/" matches directories
+)
+
+const (
+	wmMatch = iota
+	wmNoMatch
+	wmAbortAll
+	wmAbortToStarstar
+)
+
+// Report whether text matches the wildcard pattern.
+func wildmatch(pattern, text string, flags int) bool {
+	return dowild([]byte(pattern), []byte(text), flags) == wmMatch
+}
+
+// Return the byte at i, or 0 past the end (like a NUL terminated C string).
+func charAt(s []byte, i int) byte {
+	if i < len(s) {
+		return s[i]
+	}
+	return 0
+}
+
+func toLower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+func toUpper(c byte) byte {
+	if c >= 'a' && c <= 'z' {
+		return c - ('a' - 'A')
+	}
+	return c
+}
+
+func isGlobSpecial(c byte) bool {
+	return c == '*' || c == '?' || c == '[' || c == '\\'
+}
+
+func indexByte(s []byte, c byte) int {
+	for i, b := range s {
+		if b == c {
+			return i
+		}
+	}
+	return -1
+}
+
+func dowild(p, text []byte, flags int) int {
+	pi, ti := 0, 0
+	for ; pi < len(p); pi, ti = pi+1, ti+1 {
+		pCh := p[pi]
+		tCh := charAt(text, ti)
+		if ti >= len(text) && pCh != '*' {
+			return wmAbortAll
+		}
+		if flags&wmCasefold != 0 {
+			tCh = toLower(tCh)
+			pCh = toLower(pCh)
+		}
+		switch pCh {
+		case '\\':
+			// Literal match with the following character.
+			pi++
+			pCh = charAt(p, pi)
+			if flags&wmCasefold != 0 {
+				pCh = toLower(pCh)
+			}
+			if tCh != pCh {
+				return wmNoMatch
+			}
+		default:
+			if tCh != pCh {
+				return wmNoMatch
+			}
+		case '?':
+			// Match anything but '/'.
+			if flags&wmPathname != 0 && tCh == '/' {
+				return wmNoMatch
+			}
+		case '*':
+			matchSlash := false
+			pi++
+			if charAt(p, pi) == '*' {
+				prev := pi - 2
+				for pi++; charAt(p, pi) == '*'; pi++ {
+				}
+				if (prev < 0 || p[prev] == '/') &&
+					(pi >= len(p) || p[pi] == '/' || (p[pi] == '\\' && charAt(p, pi+1) == '/')) {
+					// "foo/**/bar" matches both "foo/bar" and "foo/a/bar".
+					if charAt(p, pi) == '/' && dowild(p[pi+1:], text[ti:], flags) == wmMatch {
+						return wmMatch
+					}
+					matchSlash = true
+				}
+			} else {
+				// without wmPathname, '*' == '**'
+				matchSlash = flags&wmPathname == 0
+			}
+			if pi >= len(p) {
+				// Trailing "**" matches everything. Trailing "*" matches
+				// only if there are no more slash characters.
+				if !matchSlash && indexByte(text[ti:], '/') >= 0 {
+					return wmNoMatch
+				}
+				return wmMatch
+			} else if !matchSlash && p[pi] == '/' {
+				// A single asterisk followed by a slash matches the next directory.
+				slash := indexByte(text[ti:], '/')
+				if slash < 0 {
+					return wmNoMatch
+				}
+				ti += slash
+				// the slash is consumed by the for loop
+				break
+			}
+			for {
+				if ti >= len(text) {
+					break
+				}
+				// Advance faster when the asterisk is followed by a literal.
+				if !isGlobSpecial(p[pi]) {
+					pCh = p[pi]
+					if flags&wmCasefold != 0 {
+						pCh = toLower(pCh)
+					}
+					for ti < len(text) {
+						tCh = text[ti]
+						if !matchSlash && tCh == '/' {
+							break
+						}
+						if flags&wmCasefold != 0 {
+							tCh = toLower(tCh)
+						}
+						if tCh == pCh {
+							break
+						}
+						ti++
+					}
+					if ti >= len(text) || tCh != pCh {
+						return wmNoMatch
+					}
+				}
+				tCh = text[ti]
+				if matched := dowild(p[pi:], text[ti:], flags); matched != wmNoMatch {
+					if !matchSlash || matched != wmAbortToStarstar {
+						return matched
+					}
+				} else if !matchSlash && tCh == '/' {
+					return wmAbortToStarstar
+				}
+				ti++
+			}
+			return wmAbortAll
+		case '[':
+			pi++
+			pCh = charAt(p, pi)
+			if pCh == '^' {
+				pCh = '!'
+			}
+			negated := pCh == '!'
+			if negated {
+				pi++
+				pCh = charAt(p, pi)
+			}
+			var prevCh byte
+			matched := false
+			for {
+				if pi >= len(p) {
+					return wmAbortAll
+				}
+				if pCh == '\\' {
+					pi++
+					pCh = charAt(p, pi)
+					if pi >= len(p) {
+						return wmAbortAll
+					}
+					if tCh == pCh {
+						matched = true
+					}
+				} else if pCh == '-' && prevCh != 0 && pi+1 < len(p) && p[pi+1] != ']' {
+					pi++
+					pCh = p[pi]
+					if pCh == '\\' {
+						pi++
+						pCh = charAt(p, pi)
+						if pi >= len(p) {
+							return wmAbortAll
+						}
+					}
+					if tCh <= pCh && tCh >= prevCh {
+						matched = true
+					} else if flags&wmCasefold != 0 {
+						if upper := toUpper(tCh); upper <= pCh && upper >= prevCh {
+							matched = true
+						}
+					}
+					pCh = 0 // This makes prevCh get set to 0.
+				} else if pCh == '[' && charAt(p, pi+1) == ':' {
+					start := pi + 2
+					pi = start
+					for pi < len(p) && p[pi] != ']' {
+						pi++
+					}
+					if pi >= len(p) {
+						return wmAbortAll
+					}
+					if pi-start-1 < 0 || p[pi-1] != ':' {
+						// Didn't find ":]", so treat like a normal set.
+						pi = start - 2
+						pCh = '['
+						if tCh == pCh {
+							matched = true
+						}
+					} else {
+						class := string(p[start : pi-1])
+						ok, valid := matchCharClass(class, tCh, flags)
+						if !valid {
+							return wmAbortAll
+						}
+						if ok {
+							matched = true
+						}
+						pCh = 0
+					}
+				} else if tCh == pCh {
+					matched = true
+				}
+				prevCh = pCh
+				pi++
+				pCh = charAt(p, pi)
+				if pCh == ']' {
+					break
+				}
+			}
+			if matched == negated || (flags&wmPathname != 0 && tCh == '/') {
+				return wmNoMatch
+			}
+		}
+	}
+	if ti < len(text) {
+		return wmNoMatch
+	}
+	return wmMatch
+}
+
+// Match c against the POSIX character class such as "alpha".
+// valid is false for an unknown class.
+func matchCharClass(class string, c byte, flags int) (matched bool, valid bool) {
+	isLower := c >= 'a' && c <= 'z'
+	isUpper := c >= 'A' && c <= 'Z'
+	isDigit := c >= '0' && c <= '9'
+	switch class {
+	case "alnum":
+		return isLower || isUpper || isDigit, true
+	case "alpha":
+		return isLower || isUpper, true
+	case "blank":
+		return c == ' ' || c == '\t', true
+	case "cntrl":
+		return c < 0x20 || c == 0x7f, true
+	case "digit":
+		return isDigit, true
+	case "graph":
+		return c > 0x20 && c < 0x7f, true
+	case "lower":
+		return isLower || (flags&wmCasefold != 0 && isUpper), true
+	case "print":
+		return c >= 0x20 && c < 0x7f, true
+	case "punct":
+		return c > 0x20 && c < 0x7f && !isLower && !isUpper && !isDigit, true
+	case "space":
+		return c == ' ' || (c >= '\t' && c <= '\r'), true
+	case "upper":
+		return isUpper || (flags&wmCasefold != 0 && isLower), true
+	case "xdigit":
+		return isDigit || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F'), true
+	}
+	return false, false
+}
@@ -0,0 +1,67 @@
+package git
+
+import "testing"
+
+// Cases from git's t/t3070-wildmatch.sh.
+func TestWildmatch(t *testing.T) {
+	tests := []struct {
+		pattern, text string
+		flags         int
+		want          bool
+	}{
+		{"foo", "foo", 0, true},
+		{"bar", "foo", 0, false},
+		{"", "", 0, true},
+		{"???", "foo", 0, true},
+		{"??", "foo", 0, false},
+		{"*", "foo", 0, true},
+		{"f*", "foo", 0, true},
+		{"*f", "foo", 0, false},
+		{"*foo*", "foo", 0, true},
+		{"*ob*a*r*", "foobar", 0, true},
+		{"*ab", "aaaaaaabababab", 0, true},
+		{`foo\*`, "foo*", 0, true},
+		{`foo\*bar`, "foobar", 0, false},
+		{`f\\oo`, `f\oo`, 0, true},
+		{"*[al]?", "ball", 0, true},
+		{"[ten]", "ten", 0, false},
+		{"**[!te]", "ten", 0, true},
+		{"**[!ten]", "ten", 0, false},
+		{"t[a-g]n", "ten", 0, true},
+		{"t[!a-g]n", "ten", 0, false},
+		{"t[^a-g]n", "ton", 0, true},
+		{"a[]]b", "a]b", 0, true},
+		{"a[]-]b", "a-b", 0, true},
+		{"[[:alpha:]][[:digit:]][[:upper:]]", "a1B", 0, true},
+		{"[[:digit:][:upper:][:space:]]", "a", 0, false},
+		{"[a-c[:digit:]x-z]", "5", 0, true},
+
+		// "*" and "?" match "/" unless wmPathname is given.
+		{"foo*bar", "foo/baz/bar", 0, true},
+		{"foo*bar", "foo/baz/bar", wmPathname, false},
+		{"foo?bar", "foo/bar", wmPathname, false},
+		{"foo/*/bar", "foo/baz/bar", wmPathname, true},
+		{"foo/**/bar", "foo/baz/bar", wmPathname, true},
+		{"foo/**/bar", "foo/b/a/z/bar", wmPathname, true},
+		{"foo/**/bar", "foo/bar", wmPathname, true},
+		{"**/foo", "foo", wmPathname, true},
+		{"**/foo", "XXX/foo", wmPathname, true},
+		{"**/foo", "bar/baz/foo", wmPathname, true},
+		{"*/foo", "bar/baz/foo", wmPathname, false},
+		{"**/bar*", "foo/bar/baz", wmPathname, false},
+		{"**/bar/*", "deep/foo/bar/baz", wmPathname, true},
+		{"**/bar/**", "deep/foo/bar/baz/", wmPathname, true},
+		{"foo/**", "foo/bar/baz", wmPathname, true},
+		{"foo**bar", "foo/baz/bar", wmPathname, false},
+
+		{"[A-Z]", "a", 0, false},
+		{"[A-Z]", "a", wmCasefold, true},
+		{"FOO", "foo", wmCasefold, true},
+		{"[[:upper:]]", "a", wmCasefold, true},
+	}
+	for _, tt := range tests {
+		if got := wildmatch(tt.pattern, tt.text, tt.flags); got != tt.want {
+			t.Errorf("wildmatch(%q, %q, %d) = %v, want %v", tt.pattern, tt.text, tt.flags, got, tt.want)
+		}
+	}
+}